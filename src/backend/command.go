@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"nlip/config"
+	"os"
+	"text/tabwriter"
+)
+
+// runCommand 执行命令行子命令，返回进程退出码
+func runCommand(args []string) int {
+	switch {
+	case len(args) == 2 && args[0] == "config" && args[1] == "print":
+		return printConfig()
+	default:
+		fmt.Fprintf(os.Stderr, "未知的命令: %v\n\n用法:\n  nlip                启动服务\n  nlip config print   输出当前生效的配置及来源\n", args)
+		return 2
+	}
+}
+
+// printConfig 输出当前生效的配置，包括数据库中保存的运行时设置，敏感配置项的值会被隐藏
+func printConfig() int {
+	config.LoadConfig()
+	if err := config.OpenDatabaseReadOnly(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "读取数据库中的设置失败: %v\n", err)
+		return 1
+	}
+	defer config.CloseDatabase()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE\tENV")
+	for _, e := range config.EffectiveConfig() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Key, e.Value, e.Source, e.Env)
+	}
+	if err := w.Flush(); err != nil {
+		return 1
+	}
+	return 0
+}
@@ -6,9 +6,9 @@ import (
 	"nlip/utils/logger"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mitchellh/mapstructure"
@@ -24,6 +24,11 @@ type Config struct {
 	ServerPort  string        `json:"server_port"`
 	Domain      string        `json:"domain"`
 	FrontendURL string        `json:"frontend_url"`
+	// TrustedProxies 可信反向代理的 IP 或 CIDR，只有来自这些地址的 TrustedHeader 和协议请求头才会用于获取客户端IP和协议
+	TrustedProxies []string `json:"trusted_proxies"`
+	// TrustedHeader 代理用于传递客户端地址的请求头：x-forwarded-for、x-real-ip 或 forwarded，
+	// 其他转发请求头由客户端原样传入，不会被使用
+	TrustedHeader string `json:"trusted_header"`
 
 	FileUpload struct {
 		MaxSize      int64    `json:"max_size"`
@@ -56,13 +61,114 @@ type Config struct {
 		DefaultExpiryDays int `json:"default_expiry_days"`
 		MaxExpiryDays   int `json:"max_expiry_days"`
 	} `json:"token"`
+
+	Jobs struct {
+		Workers int `json:"workers"`
+	} `json:"jobs"`
+
+	// Schedule 定时任务的 cron 表达式，为空时只能手动触发
+	Schedule struct {
+		CleanExpired  string `json:"clean_expired"`
+		CleanOverflow string `json:"clean_overflow"`
+		CleanInvites  string `json:"clean_invites"`
+	} `json:"schedule"`
+
+	// Quota 存储配额（字节），0 表示不限制，管理员可为单个用户或空间单独设置
+	Quota struct {
+		UserBytes  int64 `json:"user_bytes"`
+		SpaceBytes int64 `json:"space_bytes"`
+	} `json:"quota"`
+
+	// CORS 跨域访问策略，public 和 admin 分别用于公开接口和管理接口
+	CORS struct {
+		AllowOrigins     []string `json:"allow_origins"`
+		AllowMethods     []string `json:"allow_methods"`
+		AllowHeaders     []string `json:"allow_headers"`
+		ExposeHeaders    []string `json:"expose_headers"`
+		AllowCredentials bool     `json:"allow_credentials"`
+		MaxAge           int      `json:"max_age"`
+		// ExtensionIDs 浏览器扩展的 ID，允许 chrome-extension://<id> 访问管理接口以外的接口
+		ExtensionIDs []string   `json:"extension_ids"`
+		Public       CORSPolicy `json:"public"`
+		Admin        CORSPolicy `json:"admin"`
+	} `json:"cors"`
+
+	// SecurityHeaders 安全响应头，raw_paths 下的原始内容使用 raw_content_security_policy
+	SecurityHeaders struct {
+		Enabled                  bool     `json:"enabled"`
+		HSTSMaxAge               int      `json:"hsts_max_age"`
+		ContentSecurityPolicy    string   `json:"content_security_policy"`
+		RawContentSecurityPolicy string   `json:"raw_content_security_policy"`
+		RawPaths                 []string `json:"raw_paths"`
+		FrameAncestors           []string `json:"frame_ancestors"`
+		ReferrerPolicy           string   `json:"referrer_policy"`
+		PermissionsPolicy        string   `json:"permissions_policy"`
+	} `json:"security_headers"`
+
+	// RateLimit 接口访问频率限制，请求匹配的所有规则都会生效，store 为 memory 或 sqlite
+	RateLimit struct {
+		Enabled bool            `json:"enabled"`
+		Store   string          `json:"store"`
+		Rules   []RateLimitRule `json:"rules"`
+	} `json:"rate_limit"`
+
+	// LoginLockout 登录失败锁定，同一账号或IP连续失败达到次数后临时锁定，之后每次失败锁定时长翻倍
+	// 最后一次失败超过 reset_seconds 后重新计数
+	LoginLockout struct {
+		Enabled        bool `json:"enabled"`
+		MaxAttempts    int  `json:"max_attempts"`
+		IPMaxAttempts  int  `json:"ip_max_attempts"`
+		LockSeconds    int  `json:"lock_seconds"`
+		MaxLockSeconds int  `json:"max_lock_seconds"`
+		ResetSeconds   int  `json:"reset_seconds"`
+	} `json:"login_lockout"`
+
+	// TwoFactor 两步验证，issuer 为身份验证器应用中显示的名称
+	// require 为 off、admins 或 all，要求的用户未启用两步验证前只能访问设置两步验证的接口
+	TwoFactor struct {
+		Issuer  string `json:"issuer"`
+		Require string `json:"require"`
+	} `json:"two_factor"`
+}
+
+// CORSPolicy 路由组的跨域访问策略，列表为空或 max_age 为 0 时使用 cors 中的默认值
+type CORSPolicy struct {
+	AllowOrigins     []string `json:"allow_origins"`
+	AllowMethods     []string `json:"allow_methods"`
+	AllowHeaders     []string `json:"allow_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	MaxAge           int      `json:"max_age"`
+}
+
+// RateLimitRule 访问频率限制规则，使用令牌桶算法，桶容量为 burst，每个 period 补充 rate 个令牌
+// key 为限制的对象：ip 按客户端IP，user 按登录用户（未登录时按IP），token 按 API Token（未使用时按用户）
+type RateLimitRule struct {
+	Name   string `json:"name"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Key    string `json:"key"`
+	Rate   int    `json:"rate"`
+	Period string `json:"period"`
+	Burst  int    `json:"burst"`
 }
 
 var (
-	AppConfig   Config
+	// current 当前生效的配置，重新加载或修改设置时整体替换而不是原地修改
+	current atomic.Pointer[Config]
+	// configMutex 保证同一时间只有一处在替换配置，同时保护 configSources
 	configMutex sync.Mutex
 )
 
+func init() {
+	current.Store(&Config{})
+}
+
+// Get 获取当前生效的配置
+// 返回的配置不能修改，需要读取多个配置项时应只获取一次，避免中途配置被替换导致前后不一致
+func Get() *Config {
+	return current.Load()
+}
+
 // 添加默认支持的文件类型
 var defaultAllowedExtensions = []string{
 	// 文本文件
@@ -70,10 +176,28 @@ var defaultAllowedExtensions = []string{
 	"html", "htm", "css", "js", "ts", "yaml", "yml",
 	// 图片文件
 	"jpg", "jpeg", "png", "gif", "bmp", "webp", "svg",
+	// 未指定文件名粘贴的二进制内容
+	"bin",
 }
 
 // LoadConfig 加载配置
 func LoadConfig() {
+	cfg, sources := loadConfig()
+
+	configMutex.Lock()
+	configSources = sources
+	current.Store(&cfg)
+	configMutex.Unlock()
+
+	logger.Info("配置加载完成: env=%s, port=%s, domain=%s",
+		cfg.AppEnv,
+		cfg.ServerPort,
+		cfg.Domain,
+	)
+}
+
+// loadConfig 依次使用默认值、配置文件和环境变量构建配置，同时返回每个配置项的来源
+func loadConfig() (Config, map[string]string) {
 	// 获取工作目录
 	workDir, err := os.Getwd()
 	if err != nil {
@@ -82,13 +206,14 @@ func LoadConfig() {
 	}
 
 	// 设置基础默认配置
-	AppConfig = Config{
-		AppEnv:      getEnv("APP_ENV", "production"),
-		JWTSecret:   getEnv("JWT_SECRET", "your-secret-key"),
-		TokenExpiry: 24 * time.Hour,
-		UploadDir:   getEnv("UPLOAD_DIR", filepath.Join(workDir, "uploads")),
-		MaxFileSize: 10 * 1024 * 1024, // 10MB
-		ServerPort:  getEnv("PORT", "3000"),
+	cfg := Config{
+		AppEnv:        appEnv(),
+		JWTSecret:     "",
+		TokenExpiry:   24 * time.Hour,
+		UploadDir:     filepath.Join(workDir, "uploads"),
+		MaxFileSize:   10 * 1024 * 1024, // 10MB
+		ServerPort:    "3000",
+		TrustedHeader: "x-forwarded-for",
 		FileUpload: struct {
 			MaxSize      int64    `json:"max_size"`
 			AllowedTypes []string `json:"allowed_types"`
@@ -136,90 +261,240 @@ func LoadConfig() {
 			MaxItems:        10,
 			DefaultExpiryDays: 7,
 		},
+		Jobs: struct {
+			Workers int `json:"workers"`
+		}{
+			Workers: 4,
+		},
+		Schedule: struct {
+			CleanExpired  string `json:"clean_expired"`
+			CleanOverflow string `json:"clean_overflow"`
+			CleanInvites  string `json:"clean_invites"`
+		}{
+			CleanExpired:  "@hourly",
+			CleanOverflow: "@hourly",
+			CleanInvites:  "@hourly",
+		},
+		Quota: struct {
+			UserBytes  int64 `json:"user_bytes"`
+			SpaceBytes int64 `json:"space_bytes"`
+		}{
+			UserBytes:  1024 * 1024 * 1024, // 1GB
+			SpaceBytes: 512 * 1024 * 1024,  // 512MB
+		},
+		CORS: struct {
+			AllowOrigins     []string   `json:"allow_origins"`
+			AllowMethods     []string   `json:"allow_methods"`
+			AllowHeaders     []string   `json:"allow_headers"`
+			ExposeHeaders    []string   `json:"expose_headers"`
+			AllowCredentials bool       `json:"allow_credentials"`
+			MaxAge           int        `json:"max_age"`
+			ExtensionIDs     []string   `json:"extension_ids"`
+			Public           CORSPolicy `json:"public"`
+			Admin            CORSPolicy `json:"admin"`
+		}{
+			AllowOrigins:     []string{"http://127.0.0.1:3000"},
+			AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Last-Event-ID", "X-API-Token", "X-Clip-Password"},
+			ExposeHeaders:    []string{"Content-Length", "Content-Range", "Content-Disposition",
+				"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
+			AllowCredentials: true,
+			MaxAge:           3600,
+			// 原始内容、分享链接和 Webhook 写入接口供命令行工具和其他站点调用，允许任意来源但不携带凭据
+			Public: CORSPolicy{
+				AllowOrigins: []string{"*"},
+				AllowMethods: []string{"GET", "HEAD", "POST", "PUT", "OPTIONS"},
+			},
+			// 管理接口只允许 allow_origins 中的来源，不允许任意来源和浏览器扩展
+			Admin: CORSPolicy{
+				AllowCredentials: true,
+				MaxAge:           600,
+			},
+		},
+		SecurityHeaders: struct {
+			Enabled                  bool     `json:"enabled"`
+			HSTSMaxAge               int      `json:"hsts_max_age"`
+			ContentSecurityPolicy    string   `json:"content_security_policy"`
+			RawContentSecurityPolicy string   `json:"raw_content_security_policy"`
+			RawPaths                 []string `json:"raw_paths"`
+			FrameAncestors           []string `json:"frame_ancestors"`
+			ReferrerPolicy           string   `json:"referrer_policy"`
+			PermissionsPolicy        string   `json:"permissions_policy"`
+		}{
+			Enabled:    true,
+			HSTSMaxAge: 31536000, // 1年
+			// 前端为打包后的单页应用，脚本只从本站加载，组件库使用内联样式
+			ContentSecurityPolicy: "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; " +
+				"img-src 'self' data: blob:; font-src 'self' data:; connect-src 'self'; " +
+				"object-src 'none'; base-uri 'self'; form-action 'self'",
+			// 原始内容按上传时的类型直接返回，禁止执行脚本，只允许显示图片、音视频和样式
+			RawContentSecurityPolicy: "default-src 'none'; img-src 'self' data:; media-src 'self'; style-src 'unsafe-inline'",
+			RawPaths:                 []string{"/api/v1/nlip/raw/", "/api/v1/nlip/s/"},
+			FrameAncestors:           []string{"'self'"},
+			ReferrerPolicy:           "strict-origin-when-cross-origin",
+			PermissionsPolicy:        "camera=(), microphone=(), geolocation=(), payment=(), usb=()",
+		},
+		RateLimit: struct {
+			Enabled bool            `json:"enabled"`
+			Store   string          `json:"store"`
+			Rules   []RateLimitRule `json:"rules"`
+		}{
+			Enabled: true,
+			Store:   "memory",
+			Rules: []RateLimitRule{
+				{Name: "auth", Method: "POST", Path: "/api/v1/nlip/auth/*", Key: "ip", Rate: 5, Period: "1m", Burst: 5},
+				{Name: "upload", Method: "POST", Path: "/api/v1/nlip/spaces/*/clips/upload", Key: "user", Rate: 10, Period: "1m", Burst: 10},
+				{Name: "api", Path: "/api/v1/nlip/**", Key: "user", Rate: 60, Period: "1m", Burst: 60},
+			},
+		},
+		LoginLockout: struct {
+			Enabled        bool `json:"enabled"`
+			MaxAttempts    int  `json:"max_attempts"`
+			IPMaxAttempts  int  `json:"ip_max_attempts"`
+			LockSeconds    int  `json:"lock_seconds"`
+			MaxLockSeconds int  `json:"max_lock_seconds"`
+			ResetSeconds   int  `json:"reset_seconds"`
+		}{
+			Enabled:        true,
+			MaxAttempts:    5,
+			IPMaxAttempts:  20,
+			LockSeconds:    60,
+			MaxLockSeconds: 3600,
+			ResetSeconds:   86400,
+		},
+		TwoFactor: struct {
+			Issuer  string `json:"issuer"`
+			Require string `json:"require"`
+		}{
+			Issuer:  "NLIP",
+			Require: "off",
+		},
+	}
+
+	sources := defaultSources()
+	if name, _ := firstEnv("NLIP_APP_ENV", "APP_ENV"); name != "" {
+		sources["app_env"] = "env:" + name
 	}
 
 	// 根据环境加载配置
-	switch AppConfig.AppEnv {
+	before := snapshotConfig(&cfg)
+	switch cfg.AppEnv {
 	case "development":
-		loadDevConfig()
+		loadDevConfig(&cfg)
+		markChanged(before, &cfg, sources, "file:"+ConfigFile())
 	case "production":
-		loadProdConfig()
+		loadProdConfig(&cfg)
+		markChanged(before, &cfg, sources, "file:"+ConfigFile())
 	case "test":
-		loadTestConfig()
+		loadTestConfig(&cfg)
+		markChanged(before, &cfg, sources, "test")
 	default:
-		loadProdConfig()
+		loadProdConfig(&cfg)
+		markChanged(before, &cfg, sources, "file:"+ConfigFile())
+	}
+
+	// 环境变量优先级高于配置文件
+	applyEnvOverrides(&cfg, sources)
+
+	// 未配置 JWT 密钥时使用首次启动时生成的密钥
+	if cfg.JWTSecret == "" {
+		if secret := readJWTSecretFile(); secret != "" {
+			cfg.JWTSecret = secret
+			sources["jwt_secret"] = "file:" + jwtSecretFile
+		}
 	}
 
 	// 确保配置值在合理范围内
-	validateAndAdjustConfig()
+	validateAndAdjustConfig(&cfg)
 
 	// 设置域名相关配置
-	setupDomainConfig()
+	setupDomainConfig(&cfg, sources)
 
 	// 规范化文件类型列表
-	normalizeFileTypes()
+	normalizeFileTypes(&cfg)
 
-	logger.Info("配置加载完成: env=%s, port=%s, domain=%s",
-		AppConfig.AppEnv,
-		AppConfig.ServerPort,
-		AppConfig.Domain,
-	)
+	return cfg, sources
 }
 
 // validateAndAdjustConfig 验证并调整配置值
-func validateAndAdjustConfig() {
+func validateAndAdjustConfig(cfg *Config) {
 	// 确保空间配置在合理范围内
-	if AppConfig.Space.DefaultMaxItems > AppConfig.Space.MaxItemsLimit {
-		AppConfig.Space.DefaultMaxItems = AppConfig.Space.MaxItemsLimit
+	if cfg.Space.DefaultMaxItems > cfg.Space.MaxItemsLimit {
+		cfg.Space.DefaultMaxItems = cfg.Space.MaxItemsLimit
 	}
-	if AppConfig.Space.DefaultRetentionDays > AppConfig.Space.MaxRetentionDaysLimit {
-		AppConfig.Space.DefaultRetentionDays = AppConfig.Space.MaxRetentionDaysLimit
+	if cfg.Space.DefaultRetentionDays > cfg.Space.MaxRetentionDaysLimit {
+		cfg.Space.DefaultRetentionDays = cfg.Space.MaxRetentionDaysLimit
 	}
 
 	// 若设置最大过期天数，则检查默认过期天数是否超过最大过期天数
-	if AppConfig.Token.MaxExpiryDays > 0 && AppConfig.Token.DefaultExpiryDays > AppConfig.Token.MaxExpiryDays {
-		AppConfig.Token.DefaultExpiryDays = AppConfig.Token.MaxExpiryDays
+	if cfg.Token.MaxExpiryDays > 0 && cfg.Token.DefaultExpiryDays > cfg.Token.MaxExpiryDays {
+		cfg.Token.DefaultExpiryDays = cfg.Token.MaxExpiryDays
 	}
 }
 
-// setupDomainConfig 设置域名相关配置
-func setupDomainConfig() {
+// setupDomainConfig 设置域名相关配置，domain 由协议、主机名和端口生成
+func setupDomainConfig(cfg *Config, sources map[string]string) {
 	protocol := "http"
-	if getEnv("HTTPS_ENABLED", "false") == "true" {
+	if _, https := firstEnv("NLIP_HTTPS_ENABLED", "HTTPS_ENABLED"); https == "true" {
 		protocol = "https"
 	}
 
-	domain := getEnv("DOMAIN", "localhost")
-	port := AppConfig.ServerPort
+	_, domain := firstEnv("NLIP_DOMAIN", "DOMAIN")
+	if domain == "" {
+		domain = "localhost"
+	}
+	port := cfg.ServerPort
 
 	if (protocol == "http" && port == "80") || (protocol == "https" && port == "443") {
-		AppConfig.Domain = fmt.Sprintf("%s://%s", protocol, domain)
+		cfg.Domain = fmt.Sprintf("%s://%s", protocol, domain)
 	} else {
-		AppConfig.Domain = fmt.Sprintf("%s://%s:%s", protocol, domain, port)
+		cfg.Domain = fmt.Sprintf("%s://%s:%s", protocol, domain, port)
 	}
+	sources["domain"] = "derived"
 
-	AppConfig.FrontendURL = getEnv("FRONTEND_URL", AppConfig.Domain)
+	if name, frontendURL := firstEnv("NLIP_FRONTEND_URL", "FRONTEND_URL"); name != "" {
+		cfg.FrontendURL = frontendURL
+		sources["frontend_url"] = "env:" + name
+	} else {
+		cfg.FrontendURL = cfg.Domain
+		sources["frontend_url"] = "derived"
+	}
 }
 
 // normalizeFileTypes 规范化文件类型列表
-func normalizeFileTypes() {
-	for i, ext := range AppConfig.FileTypes.AllowList {
-		AppConfig.FileTypes.AllowList[i] = strings.ToLower(strings.TrimPrefix(ext, "."))
+// 生成新的列表而不是原地修改，默认列表和当前生效的配置可能共用同一个切片
+func normalizeFileTypes(cfg *Config) {
+	cfg.FileTypes.AllowList = normalizeExtensions(cfg.FileTypes.AllowList)
+	cfg.FileTypes.DenyList = normalizeExtensions(cfg.FileTypes.DenyList)
+}
+
+func normalizeExtensions(list []string) []string {
+	if list == nil {
+		return nil
 	}
-	for i, ext := range AppConfig.FileTypes.DenyList {
-		AppConfig.FileTypes.DenyList[i] = strings.ToLower(strings.TrimPrefix(ext, "."))
+	exts := make([]string, len(list))
+	for i, ext := range list {
+		exts[i] = strings.ToLower(strings.TrimPrefix(ext, "."))
 	}
+	return exts
 }
 
-// loadDevConfig 加载开发环境配置
-func loadDevConfig() {
+// ConfigFile 获取当前环境使用的配置文件路径
+func ConfigFile() string {
 	// 默认使用 yaml 配置
 	configFile := getEnv("CONFIG_FILE", "config.yaml")
-	if _, err := os.Stat(configFile); err != nil {
-		// 如果 yaml 不存在，尝试读取 json 配置
-		configFile = "config.dev.json"
+	if appEnv() == "development" {
+		if _, err := os.Stat(configFile); err != nil {
+			// 如果 yaml 不存在，尝试读取 json 配置
+			configFile = "config.dev.json"
+		}
 	}
+	return configFile
+}
 
+// loadDevConfig 加载开发环境配置
+func loadDevConfig(cfg *Config) {
+	configFile := ConfigFile()
 	if _, err := os.Stat(configFile); err == nil {
 		file, err := os.ReadFile(configFile)
 		if err != nil {
@@ -242,18 +517,18 @@ func loadDevConfig() {
 
 		// 更新配置
 		if jwtSecret, ok := config["jwt_secret"].(string); ok && jwtSecret != "" {
-			AppConfig.JWTSecret = jwtSecret
+			cfg.JWTSecret = jwtSecret
 		}
 		if tokenExpiry, ok := config["token_expiry"].(string); ok && tokenExpiry != "" {
 			if duration, err := time.ParseDuration(tokenExpiry); err == nil {
-				AppConfig.TokenExpiry = duration
+				cfg.TokenExpiry = duration
 			}
 		}
 		if uploadDir, ok := config["upload_dir"].(string); ok && uploadDir != "" {
-			AppConfig.UploadDir = uploadDir
+			cfg.UploadDir = uploadDir
 		}
 		if maxFileSize, ok := config["max_file_size"].(float64); ok && maxFileSize > 0 {
-			AppConfig.MaxFileSize = int64(maxFileSize)
+			cfg.MaxFileSize = int64(maxFileSize)
 		}
 
 		logger.Debug("从配置文件加载开发环境配置: %s", configFile)
@@ -261,9 +536,9 @@ func loadDevConfig() {
 }
 
 // 加载生产环境配置
-func loadProdConfig() {
+func loadProdConfig(cfg *Config) {
 	// 先尝试从配置文件加载
-	configFile := getEnv("CONFIG_FILE", "config.yaml")
+	configFile := ConfigFile()
 	if _, err := os.Stat(configFile); err == nil {
 		logger.Debug("从配置文件加载生产环境配置: %s", configFile)
 		file, err := os.ReadFile(configFile)
@@ -284,7 +559,7 @@ func loadProdConfig() {
 				TagName:          "json",
 				WeaklyTypedInput: true,
 				Metadata:         metadata,
-				Result:           &AppConfig,
+				Result:           cfg,
 			})
 			if err != nil {
 				logger.Error("创建解码器失败: %v", err)
@@ -298,67 +573,13 @@ func loadProdConfig() {
 		}
 	}
 
-	// 环境变量优先级高于配置文件
-	if port := os.Getenv("SERVER_PORT"); port != "" {
-		AppConfig.ServerPort = port
-	}
-	if jwtSecret := os.Getenv("JWT_SECRET"); jwtSecret != "" {
-		AppConfig.JWTSecret = jwtSecret
-	}
-	if uploadDir := os.Getenv("UPLOAD_DIR"); uploadDir != "" {
-		AppConfig.UploadDir = uploadDir
-	}
-	if maxFileSize := os.Getenv("MAX_FILE_SIZE"); maxFileSize != "" {
-		if size, err := strconv.ParseInt(maxFileSize, 10, 64); err == nil {
-			AppConfig.MaxFileSize = size
-		}
-	}
-	if emailHost := os.Getenv("EMAIL_HOST"); emailHost != "" {
-		AppConfig.Email.Host = emailHost
-	}
-	if emailPort := os.Getenv("EMAIL_PORT"); emailPort != "" {
-		if port, err := strconv.Atoi(emailPort); err == nil {
-			AppConfig.Email.Port = port
-		}
-	}
-	if emailUser := os.Getenv("EMAIL_USERNAME"); emailUser != "" {
-		AppConfig.Email.Username = emailUser
-	}
-	if emailPass := os.Getenv("EMAIL_PASSWORD"); emailPass != "" {
-		AppConfig.Email.Password = emailPass
-	}
-	if emailFrom := os.Getenv("EMAIL_FROM"); emailFrom != "" {
-		AppConfig.Email.From = emailFrom
-	}
-	if emailEnabled := os.Getenv("EMAIL_ENABLED"); emailEnabled != "" {
-		AppConfig.Email.Enabled = emailEnabled == "true"
-	}
-
-	if tokenMaxItems := os.Getenv("TOKEN_MAX_ITEMS"); tokenMaxItems != "" {
-		if items, err := strconv.Atoi(tokenMaxItems); err == nil {
-			AppConfig.Token.MaxItems = items
-		}
-	}
-
-	if tokenDefaultExpiryDays := os.Getenv("TOKEN_DEFAULT_EXPIRY_DAYS"); tokenDefaultExpiryDays != "" {
-		if days, err := strconv.Atoi(tokenDefaultExpiryDays); err == nil {
-			AppConfig.Token.DefaultExpiryDays = days
-		}
-	}
-
-	if tokenMaxExpiryDays := os.Getenv("TOKEN_MAX_EXPIRY_DAYS"); tokenMaxExpiryDays != "" {
-		if days, err := strconv.Atoi(tokenMaxExpiryDays); err == nil {
-			AppConfig.Token.MaxExpiryDays = days
-		}
-	}
-
 	logger.Info("生产环境配置加载完成")
 }
 
 // 加载测试环境配置
-func loadTestConfig() {
-	AppConfig.UploadDir = filepath.Join(os.TempDir(), "nlip-test-uploads")
-	AppConfig.ServerPort = "0" // 随机端口
+func loadTestConfig(cfg *Config) {
+	cfg.UploadDir = filepath.Join(os.TempDir(), "nlip-test-uploads")
+	cfg.ServerPort = "0" // 随机端口
 }
 
 // getEnv 获取环境变量，如果不存在则返回默认值
@@ -368,59 +589,3 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
-
-// 添加更新配置的函数
-func UpdateConfig(updates map[string]interface{}) error {
-	// 使用互斥锁保护配置更新
-	configMutex.Lock()
-	defer configMutex.Unlock()
-
-	if fileTypes, ok := updates["file_types"].(map[string]interface{}); ok {
-		if allowList, ok := fileTypes["allow_list"].([]string); ok {
-			AppConfig.FileTypes.AllowList = allowList
-		}
-		if denyList, ok := fileTypes["deny_list"].([]string); ok {
-			AppConfig.FileTypes.DenyList = denyList
-		}
-	}
-
-	if spaceSettings, ok := updates["space_defaults"].(map[string]interface{}); ok {
-		// 先处理上限值的更新
-		if maxItemsLimit, ok := spaceSettings["max_items_limit"].(int); ok {
-			AppConfig.Space.MaxItemsLimit = maxItemsLimit
-		}
-		if maxRetentionDaysLimit, ok := spaceSettings["max_retention_days_limit"].(int); ok {
-			AppConfig.Space.MaxRetentionDaysLimit = maxRetentionDaysLimit
-		}
-
-		// 再处理默认值的更新，确保不超过上限
-		if maxItems, ok := spaceSettings["max_items"].(int); ok {
-			if maxItems <= AppConfig.Space.MaxItemsLimit {
-				AppConfig.Space.DefaultMaxItems = maxItems
-			} else {
-				AppConfig.Space.DefaultMaxItems = AppConfig.Space.MaxItemsLimit
-			}
-		}
-		if retentionDays, ok := spaceSettings["retention_days"].(int); ok {
-			if retentionDays <= AppConfig.Space.MaxRetentionDaysLimit {
-				AppConfig.Space.DefaultRetentionDays = retentionDays
-			} else {
-				AppConfig.Space.DefaultRetentionDays = AppConfig.Space.MaxRetentionDaysLimit
-			}
-		}
-	}
-
-	// 保存更新后的配置到文件
-	return SaveConfig()
-}
-
-// SaveConfig 保存配置到文件
-func SaveConfig() error {
-	configFile := getEnv("CONFIG_FILE", "config.yaml")
-	data, err := yaml.Marshal(AppConfig)
-	if err != nil {
-		return fmt.Errorf("序列化配置失败: %v", err)
-	}
-
-	return os.WriteFile(configFile, data, 0644)
-}
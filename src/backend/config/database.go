@@ -14,6 +14,86 @@ import (
 
 var DB *sql.DB
 
+// clipsTimestampTriggerSQL 仅在内容相关字段变化时更新 updated_at，
+// 避免密码尝试计数等状态字段的更新影响“最近修改”排序
+const clipsTimestampTriggerSQL = `
+        CREATE TRIGGER IF NOT EXISTS update_clips_timestamp 
+        AFTER UPDATE OF content, content_type, file_path ON nlip_clipboard_items
+        BEGIN
+            UPDATE nlip_clipboard_items 
+            SET updated_at = CURRENT_TIMESTAMP 
+            WHERE id = NEW.id;
+        END;
+    `
+
+// spacesTimestampTriggerSQL 仅在空间设置变化时更新 updated_at，
+// 避免存储用量计数的更新影响空间的修改时间
+const spacesTimestampTriggerSQL = `
+        CREATE TRIGGER IF NOT EXISTS update_spaces_timestamp 
+        AFTER UPDATE OF name, type, owner_id, max_items, retention_days, collaborators ON nlip_spaces
+        BEGIN
+            UPDATE nlip_spaces 
+            SET updated_at = CURRENT_TIMESTAMP 
+            WHERE id = NEW.id;
+        END;
+    `
+
+// clipUsageTriggersSQL 在剪贴板内容写入、修改和删除时维护空间和创建者的存储用量
+var clipUsageTriggersSQL = []string{
+	`
+        CREATE TRIGGER IF NOT EXISTS add_clip_usage
+        AFTER INSERT ON nlip_clipboard_items
+        BEGIN
+            UPDATE nlip_spaces SET used_bytes = used_bytes + NEW.size_bytes WHERE id = NEW.space_id;
+            UPDATE nlip_users SET used_bytes = used_bytes + NEW.size_bytes WHERE id = NEW.creator_id;
+        END;
+    `,
+	`
+        CREATE TRIGGER IF NOT EXISTS update_clip_usage
+        AFTER UPDATE OF size_bytes ON nlip_clipboard_items
+        BEGIN
+            UPDATE nlip_spaces SET used_bytes = used_bytes - OLD.size_bytes + NEW.size_bytes WHERE id = NEW.space_id;
+            UPDATE nlip_users SET used_bytes = used_bytes - OLD.size_bytes + NEW.size_bytes WHERE id = NEW.creator_id;
+        END;
+    `,
+	`
+        CREATE TRIGGER IF NOT EXISTS remove_clip_usage
+        AFTER DELETE ON nlip_clipboard_items
+        BEGIN
+            UPDATE nlip_spaces SET used_bytes = used_bytes - OLD.size_bytes WHERE id = OLD.space_id;
+            UPDATE nlip_users SET used_bytes = used_bytes - OLD.size_bytes WHERE id = OLD.creator_id;
+        END;
+    `,
+}
+
+// dailyUploadsTriggerSQL 写入内容时累加所在空间当天的上传数量和大小
+const dailyUploadsTriggerSQL = `
+        CREATE TRIGGER IF NOT EXISTS add_daily_uploads
+        AFTER INSERT ON nlip_clipboard_items
+        BEGIN
+            INSERT INTO nlip_daily_uploads (space_id, day, uploads, bytes)
+            VALUES (NEW.space_id, substr(NEW.created_at, 1, 10), 1, NEW.size_bytes)
+            ON CONFLICT(space_id, day) DO UPDATE SET
+                uploads = uploads + 1,
+                bytes = bytes + excluded.bytes;
+        END;
+    `
+
+// OpenDatabaseReadOnly 以只读方式打开已有的数据库并加载运行时设置，不会创建表或执行迁移
+func OpenDatabaseReadOnly() error {
+	dbPath := filepath.Join("./data", "nlip.db")
+	if _, err := os.Stat(dbPath); err != nil {
+		return err
+	}
+
+	var err error
+	DB, err = sql.Open("sqlite", "file:"+dbPath+"?mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return err
+	}
+	return loadSettings()
+}
+
 func InitDatabase() error {
 	logger.Info("初始化数据库")
 
@@ -26,7 +106,8 @@ func InitDatabase() error {
 
 	dbPath := filepath.Join(dataDir, "nlip.db")
 	var err error
-	DB, err = sql.Open("sqlite", dbPath)
+	// 后台任务和定时任务会与请求并发写入，设置忙等待超时避免立即返回 SQLITE_BUSY
+	DB, err = sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		logger.Error("打开数据库失败: %v", err)
 		return err
@@ -45,6 +126,18 @@ func InitDatabase() error {
 		return err
 	}
 
+	// 执行数据库迁移
+	if err := runMigrations(); err != nil {
+		logger.Error("执行数据库迁移失败: %v", err)
+		return err
+	}
+
+	// 加载保存在数据库中的运行时设置
+	if err := loadSettings(); err != nil {
+		logger.Error("加载运行时设置失败: %v", err)
+		return err
+	}
+
 	// 验证连接
 	if err := DB.Ping(); err != nil {
 		logger.Error("数据库连接测试失败: %v", err)
@@ -160,31 +253,340 @@ func createTables() error {
 		return err
 	}
 
-	// 创建触发器，自动更新 updated_at 字段
-	logger.Debug("创建更新时间触发器")
+	// 分享链接表
+	logger.Debug("创建分享链接表")
 	_, err = DB.Exec(`
-        CREATE TRIGGER IF NOT EXISTS update_spaces_timestamp 
-        AFTER UPDATE ON nlip_spaces
-        BEGIN
-            UPDATE nlip_spaces 
-            SET updated_at = CURRENT_TIMESTAMP 
-            WHERE id = NEW.id;
-        END;
+        CREATE TABLE IF NOT EXISTS nlip_share_links (
+            id VARCHAR(36) PRIMARY KEY,
+            space_id VARCHAR(36) NOT NULL,
+            clip_id VARCHAR(15) NOT NULL,
+            created_by VARCHAR(36) NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            expires_at TIMESTAMP NOT NULL,
+            max_downloads INT,
+            download_count INT DEFAULT 0,
+            revoked_at TIMESTAMP,
+            FOREIGN KEY (space_id) REFERENCES nlip_spaces(id),
+            FOREIGN KEY (created_by) REFERENCES nlip_users(id)
+        )
     `)
 	if err != nil {
-		logger.Error("创建空间更新触发器失败: %v", err)
+		logger.Error("创建分享链接表失败: %v", err)
 		return err
 	}
 
+	// 分享访问记录表
+	logger.Debug("创建分享访问记录表")
 	_, err = DB.Exec(`
-        CREATE TRIGGER IF NOT EXISTS update_clips_timestamp 
-        AFTER UPDATE ON nlip_clipboard_items
-        BEGIN
-            UPDATE nlip_clipboard_items 
-            SET updated_at = CURRENT_TIMESTAMP 
-            WHERE id = NEW.id;
-        END;
+        CREATE TABLE IF NOT EXISTS nlip_share_access_logs (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            share_id VARCHAR(36) NOT NULL,
+            ip VARCHAR(64),
+            user_agent VARCHAR(255),
+            action VARCHAR(16) NOT NULL,
+            status VARCHAR(32) NOT NULL,
+            accessed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (share_id) REFERENCES nlip_share_links(id) ON DELETE CASCADE
+        )
+    `)
+	if err != nil {
+		logger.Error("创建分享访问记录表失败: %v", err)
+		return err
+	}
+
+	// Webhook 表
+	logger.Debug("创建Webhook表")
+	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS nlip_webhooks (
+            id VARCHAR(36) PRIMARY KEY,
+            space_id VARCHAR(36) NOT NULL,
+            url TEXT NOT NULL,
+            secret VARCHAR(255) NOT NULL,
+            events TEXT NOT NULL,
+            active BOOLEAN DEFAULT 1,
+            created_by VARCHAR(36) NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (space_id) REFERENCES nlip_spaces(id),
+            FOREIGN KEY (created_by) REFERENCES nlip_users(id)
+        )
+    `)
+	if err != nil {
+		logger.Error("创建Webhook表失败: %v", err)
+		return err
+	}
+
+	// Webhook 投递记录表，同时作为待投递队列
+	logger.Debug("创建Webhook投递记录表")
+	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS nlip_webhook_deliveries (
+            id VARCHAR(36) PRIMARY KEY,
+            webhook_id VARCHAR(36) NOT NULL,
+            event_type VARCHAR(32) NOT NULL,
+            payload TEXT NOT NULL,
+            status VARCHAR(16) NOT NULL DEFAULT 'pending',
+            attempts INT DEFAULT 0,
+            next_attempt_at TIMESTAMP,
+            last_status_code INT,
+            last_error TEXT,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            delivered_at TIMESTAMP,
+            FOREIGN KEY (webhook_id) REFERENCES nlip_webhooks(id) ON DELETE CASCADE
+        )
+    `)
+	if err != nil {
+		logger.Error("创建Webhook投递记录表失败: %v", err)
+		return err
+	}
+
+	// 入站 Webhook 表，通过密钥地址直接向空间写入内容
+	logger.Debug("创建入站Webhook表")
+	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS nlip_ingest_hooks (
+            id VARCHAR(36) PRIMARY KEY,
+            space_id VARCHAR(36) NOT NULL,
+            name VARCHAR(100) NOT NULL,
+            secret_hash VARCHAR(64) NOT NULL UNIQUE,
+            allowed_content_types TEXT,
+            rate_limit INT NOT NULL DEFAULT 60,
+            created_by VARCHAR(36) NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            last_used_at TIMESTAMP,
+            revoked_at TIMESTAMP,
+            FOREIGN KEY (space_id) REFERENCES nlip_spaces(id),
+            FOREIGN KEY (created_by) REFERENCES nlip_users(id)
+        )
     `)
+	if err != nil {
+		logger.Error("创建入站Webhook表失败: %v", err)
+		return err
+	}
+
+	// 创建后台任务表
+	logger.Debug("创建后台任务表")
+	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS nlip_jobs (
+            id VARCHAR(36) PRIMARY KEY,
+            type VARCHAR(50) NOT NULL,
+            unique_key VARCHAR(100),
+            payload TEXT NOT NULL,
+            status VARCHAR(20) NOT NULL DEFAULT 'pending',
+            attempts INT NOT NULL DEFAULT 0,
+            max_attempts INT NOT NULL DEFAULT 5,
+            run_at TIMESTAMP NOT NULL,
+            last_error TEXT,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            finished_at TIMESTAMP
+        )
+    `)
+	if err != nil {
+		logger.Error("创建后台任务表失败: %v", err)
+		return err
+	}
+
+	// 创建定时任务执行记录表
+	logger.Debug("创建定时任务执行记录表")
+	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS nlip_scheduled_tasks (
+            name VARCHAR(50) PRIMARY KEY,
+            last_run_at TIMESTAMP,
+            last_duration_ms INTEGER NOT NULL DEFAULT 0,
+            last_status VARCHAR(20),
+            last_error TEXT,
+            last_trigger VARCHAR(20),
+            run_count INTEGER NOT NULL DEFAULT 0
+        )
+    `)
+	if err != nil {
+		logger.Error("创建定时任务执行记录表失败: %v", err)
+		return err
+	}
+
+	// 创建清理记录表
+	logger.Debug("创建清理记录表")
+	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS nlip_cleanup_runs (
+            id VARCHAR(36) PRIMARY KEY,
+            kind VARCHAR(20) NOT NULL,
+            started_at TIMESTAMP NOT NULL,
+            finished_at TIMESTAMP NOT NULL,
+            items_deleted INTEGER NOT NULL DEFAULT 0,
+            bytes_freed INTEGER NOT NULL DEFAULT 0,
+            status VARCHAR(20) NOT NULL,
+            error TEXT
+        )
+    `)
+	if err != nil {
+		logger.Error("创建清理记录表失败: %v", err)
+		return err
+	}
+
+	// 创建清理记录空间明细表
+	logger.Debug("创建清理记录空间明细表")
+	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS nlip_cleanup_run_spaces (
+            run_id VARCHAR(36) NOT NULL,
+            space_id VARCHAR(36) NOT NULL,
+            space_name VARCHAR(100),
+            items_deleted INTEGER NOT NULL DEFAULT 0,
+            bytes_freed INTEGER NOT NULL DEFAULT 0,
+            clip_ids TEXT NOT NULL DEFAULT '[]',
+            PRIMARY KEY (run_id, space_id),
+            FOREIGN KEY (run_id) REFERENCES nlip_cleanup_runs(id) ON DELETE CASCADE
+        )
+    `)
+	if err != nil {
+		logger.Error("创建清理记录空间明细表失败: %v", err)
+		return err
+	}
+
+	// 创建运行时设置表，覆盖配置文件中的对应设置
+	logger.Debug("创建运行时设置表")
+	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS nlip_settings (
+            key VARCHAR(64) PRIMARY KEY,
+            value TEXT NOT NULL,
+            updated_by VARCHAR(36),
+            updated_at TIMESTAMP NOT NULL
+        )
+    `)
+	if err != nil {
+		logger.Error("创建运行时设置表失败: %v", err)
+		return err
+	}
+
+	// 创建访问频率限制表，rate_limit.store 为 sqlite 时使用，多个实例共享同一个数据库时限制一致
+	logger.Debug("创建访问频率限制表")
+	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS nlip_rate_limits (
+            key VARCHAR(255) PRIMARY KEY,
+            tokens REAL NOT NULL,
+            allowed INTEGER NOT NULL,
+            updated_at INTEGER NOT NULL,
+            full_at INTEGER NOT NULL
+        )
+    `)
+	if err != nil {
+		logger.Error("创建访问频率限制表失败: %v", err)
+		return err
+	}
+
+	// 创建登录失败记录表，kind 为 account 时 value 为用户名，为 ip 时 value 为客户端IP，时间为 Unix 毫秒时间戳
+	logger.Debug("创建登录失败记录表")
+	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS nlip_login_failures (
+            kind VARCHAR(16) NOT NULL,
+            value VARCHAR(255) NOT NULL,
+            failures INTEGER NOT NULL DEFAULT 0,
+            last_ip VARCHAR(64) NOT NULL DEFAULT '',
+            last_failed_at INTEGER NOT NULL,
+            locked_until INTEGER NOT NULL DEFAULT 0,
+            PRIMARY KEY (kind, value)
+        )
+    `)
+	if err != nil {
+		logger.Error("创建登录失败记录表失败: %v", err)
+		return err
+	}
+
+	// 创建账号安全事件表，用户下次登录时提示
+	logger.Debug("创建账号安全事件表")
+	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS nlip_security_events (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id VARCHAR(36) NOT NULL,
+            type VARCHAR(32) NOT NULL,
+            ip VARCHAR(64) NOT NULL DEFAULT '',
+            attempts INTEGER NOT NULL DEFAULT 0,
+            created_at TIMESTAMP NOT NULL,
+            read_at TIMESTAMP,
+            FOREIGN KEY (user_id) REFERENCES nlip_users(id) ON DELETE CASCADE
+        )
+    `)
+	if err != nil {
+		logger.Error("创建账号安全事件表失败: %v", err)
+		return err
+	}
+
+	// 创建两步验证恢复码表，只保存恢复码的哈希
+	logger.Debug("创建恢复码表")
+	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS nlip_recovery_codes (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id VARCHAR(36) NOT NULL,
+            code_hash VARCHAR(64) NOT NULL,
+            used_at TIMESTAMP,
+            created_at TIMESTAMP NOT NULL,
+            FOREIGN KEY (user_id) REFERENCES nlip_users(id) ON DELETE CASCADE
+        )
+    `)
+	if err != nil {
+		logger.Error("创建恢复码表失败: %v", err)
+		return err
+	}
+
+	// 创建通行密钥表，id 为凭据ID的 base64url 编码，public_key 为 COSE 格式的公钥
+	logger.Debug("创建通行密钥表")
+	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS nlip_webauthn_credentials (
+            id VARCHAR(1400) PRIMARY KEY,
+            user_id VARCHAR(36) NOT NULL,
+            name VARCHAR(50) NOT NULL,
+            public_key BLOB NOT NULL,
+            sign_count INTEGER NOT NULL DEFAULT 0,
+            transports VARCHAR(255) NOT NULL DEFAULT '',
+            created_at TIMESTAMP NOT NULL,
+            last_used_at TIMESTAMP,
+            FOREIGN KEY (user_id) REFERENCES nlip_users(id) ON DELETE CASCADE
+        )
+    `)
+	if err != nil {
+		logger.Error("创建通行密钥表失败: %v", err)
+		return err
+	}
+
+	// 创建设置变更记录表
+	logger.Debug("创建设置变更记录表")
+	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS nlip_settings_audit (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            key VARCHAR(64) NOT NULL,
+            old_value TEXT,
+            new_value TEXT NOT NULL,
+            changed_by VARCHAR(36),
+            changed_at TIMESTAMP NOT NULL
+        )
+    `)
+	if err != nil {
+		logger.Error("创建设置变更记录表失败: %v", err)
+		return err
+	}
+
+	// 创建每日上传统计表，由触发器在写入内容时累加，内容被清理后历史统计仍然保留
+	logger.Debug("创建每日上传统计表")
+	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS nlip_daily_uploads (
+            space_id VARCHAR(36) NOT NULL,
+            day VARCHAR(10) NOT NULL,
+            uploads INTEGER NOT NULL DEFAULT 0,
+            bytes INTEGER NOT NULL DEFAULT 0,
+            PRIMARY KEY (space_id, day)
+        )
+    `)
+	if err != nil {
+		logger.Error("创建每日上传统计表失败: %v", err)
+		return err
+	}
+
+	// 创建触发器，自动更新 updated_at 字段
+	logger.Debug("创建更新时间触发器")
+	_, err = DB.Exec(spacesTimestampTriggerSQL)
+	if err != nil {
+		logger.Error("创建空间更新触发器失败: %v", err)
+		return err
+	}
+
+	_, err = DB.Exec(clipsTimestampTriggerSQL)
 	if err != nil {
 		logger.Error("创建剪贴板更新触发器失败: %v", err)
 		return err
@@ -211,6 +613,25 @@ func createTables() error {
 		{"idx_tokens_user", "nlip_tokens", "user_id"},
 		{"idx_tokens_token", "nlip_tokens", "token"},
 		{"idx_tokens_expires", "nlip_tokens", "expires_at"},
+		{"idx_share_links_clip", "nlip_share_links", "space_id, clip_id"},
+		{"idx_share_access_logs_share", "nlip_share_access_logs", "share_id, accessed_at"},
+		{"idx_webhooks_space", "nlip_webhooks", "space_id"},
+		{"idx_ingest_hooks_space", "nlip_ingest_hooks", "space_id"},
+		{"idx_webhook_deliveries_webhook", "nlip_webhook_deliveries", "webhook_id, created_at"},
+		{"idx_jobs_due", "nlip_jobs", "status, run_at"},
+		{"idx_jobs_type", "nlip_jobs", "type, unique_key"},
+		{"idx_cleanup_runs_started", "nlip_cleanup_runs", "kind, started_at"},
+		{"idx_settings_audit_key", "nlip_settings_audit", "key, changed_at"},
+		{"idx_rate_limits_full", "nlip_rate_limits", "full_at"},
+		{"idx_login_failures_last", "nlip_login_failures", "last_failed_at"},
+		{"idx_security_events_user", "nlip_security_events", "user_id, read_at"},
+		{"idx_recovery_codes_user", "nlip_recovery_codes", "user_id, code_hash"},
+		{"idx_webauthn_credentials_user", "nlip_webauthn_credentials", "user_id"},
+		{"idx_clips_space_created", "nlip_clipboard_items", "space_id, created_at"},
+		{"idx_clips_space_updated", "nlip_clipboard_items", "space_id, updated_at"},
+		{"idx_clips_space_type", "nlip_clipboard_items", "space_id, content_type"},
+		{"idx_clips_updated", "nlip_clipboard_items", "updated_at"},
+		{"idx_daily_uploads_day", "nlip_daily_uploads", "day"},
 	}
 
 	for _, idx := range indexes {
@@ -223,6 +644,29 @@ func createTables() error {
 		}
 	}
 
+	// 同一类型和唯一键同时只保留一个等待或执行中的任务，创建唯一索引前先清理旧版本遗留的重复任务
+	_, err = DB.Exec(`
+        DELETE FROM nlip_jobs
+        WHERE unique_key IS NOT NULL AND status IN ('pending', 'running')
+          AND rowid NOT IN (
+            SELECT MIN(rowid) FROM nlip_jobs
+            WHERE unique_key IS NOT NULL AND status IN ('pending', 'running')
+            GROUP BY type, unique_key
+          )
+    `)
+	if err != nil {
+		logger.Error("清理重复的后台任务失败: %v", err)
+		return err
+	}
+	_, err = DB.Exec(`
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_unique_active ON nlip_jobs (type, unique_key)
+        WHERE status IN ('pending', 'running')
+    `)
+	if err != nil {
+		logger.Error("创建索引 idx_jobs_unique_active 失败: %v", err)
+		return err
+	}
+
 	// 检查是否需要创建默认公共空间
 	var count int
 	err = DB.QueryRow("SELECT COUNT(*) FROM nlip_spaces WHERE type = 'public'").Scan(&count)
@@ -257,8 +701,14 @@ func createTables() error {
 	if adminCount == 0 {
 		logger.Info("创建默认管理员账号")
 
+		password, needChangePwd, err := bootstrapAdminPassword()
+		if err != nil {
+			logger.Error("获取管理员初始密码失败: %v", err)
+			return err
+		}
+
 		// 生成密码哈希
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte("nlip123"), bcrypt.DefaultCost)
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 		if err != nil {
 			logger.Error("生成密码哈希失败: %v", err)
 			return err
@@ -267,8 +717,8 @@ func createTables() error {
 		// 插入管理员账号
 		_, err = DB.Exec(`
             INSERT INTO nlip_users (id, username, password_hash, is_admin, need_change_pwd) 
-            VALUES (?, ?, ?, TRUE, TRUE)
-        `, "admin-user", "admin", string(hashedPassword))
+            VALUES (?, ?, ?, TRUE, ?)
+        `, "admin-user", "admin", string(hashedPassword), needChangePwd)
 
 		if err != nil {
 			logger.Error("创建管理员账号失败: %v", err)
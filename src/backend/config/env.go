@@ -0,0 +1,283 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"nlip/utils/logger"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configSources 当前配置中每个配置项的来源，由 configMutex 保护
+var configSources map[string]string
+
+// secretFields 敏感配置项，日志和配置输出中不显示具体值
+var secretFields = map[string]bool{
+	"jwt_secret":     true,
+	"email.password": true,
+}
+
+// derivedFields 单独处理的配置项，不按字段路径从 NLIP_* 环境变量读取
+var derivedFields = map[string]bool{
+	"app_env":      true,
+	"domain":       true,
+	"frontend_url": true,
+}
+
+// legacyEnv 早期版本使用的环境变量，仍然支持，同名的 NLIP_* 环境变量优先
+var legacyEnv = []struct {
+	name string
+	key  string
+	// allowEmpty 为 true 时空值也会生效，例如用空的 cron 表达式停用定时任务
+	allowEmpty bool
+}{
+	{name: "JWT_SECRET", key: "jwt_secret"},
+	{name: "UPLOAD_DIR", key: "upload_dir"},
+	{name: "PORT", key: "server_port"},
+	{name: "SERVER_PORT", key: "server_port"},
+	{name: "MAX_FILE_SIZE", key: "max_file_size"},
+	{name: "EMAIL_ENABLED", key: "email.enabled"},
+	{name: "EMAIL_HOST", key: "email.host"},
+	{name: "EMAIL_PORT", key: "email.port"},
+	{name: "EMAIL_USERNAME", key: "email.username"},
+	{name: "EMAIL_PASSWORD", key: "email.password"},
+	{name: "EMAIL_FROM", key: "email.from"},
+	{name: "TOKEN_MAX_ITEMS", key: "token.max_items"},
+	{name: "TOKEN_DEFAULT_EXPIRY_DAYS", key: "token.default_expiry_days"},
+	{name: "TOKEN_MAX_EXPIRY_DAYS", key: "token.max_expiry_days"},
+	{name: "JOB_WORKERS", key: "jobs.workers"},
+	{name: "SCHEDULE_CLEAN_EXPIRED", key: "schedule.clean_expired", allowEmpty: true},
+	{name: "SCHEDULE_CLEAN_OVERFLOW", key: "schedule.clean_overflow", allowEmpty: true},
+	{name: "SCHEDULE_CLEAN_INVITES", key: "schedule.clean_invites", allowEmpty: true},
+	{name: "QUOTA_USER_BYTES", key: "quota.user_bytes"},
+	{name: "QUOTA_SPACE_BYTES", key: "quota.space_bytes"},
+}
+
+// ConfigEntry 一个配置项的当前值及来源
+type ConfigEntry struct {
+	Key    string
+	Env    string
+	Value  string
+	Source string
+}
+
+// configField 配置结构体中的一个配置项
+type configField struct {
+	key   string
+	index []int
+}
+
+// configFields 按结构体字段顺序列出所有配置项，键为 json 标签组成的路径，例如 email.password
+func configFields() []configField {
+	var fields []configField
+	var walk func(t reflect.Type, prefix string, index []int)
+	walk = func(t reflect.Type, prefix string, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			key := prefix + strings.Split(f.Tag.Get("json"), ",")[0]
+			idx := append(append([]int{}, index...), i)
+			if f.Type.Kind() == reflect.Struct {
+				walk(f.Type, key+".", idx)
+				continue
+			}
+			fields = append(fields, configField{key: key, index: idx})
+		}
+	}
+	walk(reflect.TypeOf(Config{}), "", nil)
+	return fields
+}
+
+// envName 配置项对应的环境变量名，例如 email.password 对应 NLIP_EMAIL_PASSWORD
+func envName(key string) string {
+	return "NLIP_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// defaultSources 所有配置项的来源初始化为默认值
+func defaultSources() map[string]string {
+	sources := make(map[string]string)
+	for _, f := range configFields() {
+		sources[f.key] = "default"
+	}
+	return sources
+}
+
+// snapshotConfig 获取所有配置项的字符串形式，用于判断配置项是否被修改
+func snapshotConfig(cfg *Config) map[string]string {
+	v := reflect.ValueOf(cfg).Elem()
+	snapshot := make(map[string]string)
+	for _, f := range configFields() {
+		snapshot[f.key] = formatValue(v.FieldByIndex(f.index))
+	}
+	return snapshot
+}
+
+// markChanged 将与 before 相比发生变化的配置项的来源记录为 source
+func markChanged(before map[string]string, cfg *Config, sources map[string]string, source string) {
+	for key, value := range snapshotConfig(cfg) {
+		if before[key] != value {
+			sources[key] = source
+		}
+	}
+}
+
+// applyEnvOverrides 使用环境变量覆盖配置，先处理早期版本的环境变量，再处理 NLIP_* 环境变量
+// 每个环境变量都可以用 <名称>_FILE 指定从文件读取值，适用于 Docker/Kubernetes secret
+func applyEnvOverrides(cfg *Config, sources map[string]string) {
+	fields := make(map[string]configField)
+	for _, f := range configFields() {
+		fields[f.key] = f
+	}
+	v := reflect.ValueOf(cfg).Elem()
+
+	apply := func(name, key string, allowEmpty bool) {
+		value, source, ok := lookupEnv(name)
+		if !ok || (value == "" && !allowEmpty) {
+			return
+		}
+		if err := setValue(v.FieldByIndex(fields[key].index), value); err != nil {
+			logger.Warning("忽略无效的环境变量 %s: %v", name, err)
+			return
+		}
+		sources[key] = source
+	}
+
+	for _, env := range legacyEnv {
+		apply(env.name, env.key, env.allowEmpty)
+	}
+	for _, f := range configFields() {
+		if !derivedFields[f.key] {
+			apply(envName(f.key), f.key, true)
+		}
+	}
+}
+
+// lookupEnv 读取环境变量，未设置时读取 <名称>_FILE 指定的文件，去掉末尾的换行
+// 返回值和来源，例如 env:NLIP_EMAIL_PASSWORD 或 file:/run/secrets/smtp_password
+func lookupEnv(name string) (string, string, bool) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, "env:" + name, true
+	}
+	path, ok := os.LookupEnv(name + "_FILE")
+	if !ok || path == "" {
+		return "", "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Error("读取环境变量 %s_FILE 指定的文件失败: %v", name, err)
+		return "", "", false
+	}
+	return strings.TrimRight(string(data), "\r\n"), "file:" + path, true
+}
+
+// firstEnv 返回第一个非空的环境变量的名称和值，都未设置时名称为空
+func firstEnv(names ...string) (string, string) {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return name, value
+		}
+	}
+	return "", ""
+}
+
+// appEnv 获取运行环境，决定加载哪一种配置
+func appEnv() string {
+	if _, env := firstEnv("NLIP_APP_ENV", "APP_ENV"); env != "" {
+		return env
+	}
+	return "production"
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setValue 将字符串解析为配置项的类型并写入，时长使用 "24h" 格式，字符串列表使用逗号分隔
+func setValue(v reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("无效的时长: %q", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("无效的布尔值: %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("无效的整数: %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		// 结构体列表（例如 rate_limit.rules）使用 JSON 格式
+		if v.Type().Elem().Kind() != reflect.String {
+			list := reflect.New(v.Type())
+			if err := json.Unmarshal([]byte(raw), list.Interface()); err != nil {
+				return fmt.Errorf("无效的 JSON 列表: %v", err)
+			}
+			v.Set(list.Elem())
+			return nil
+		}
+		list := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("不支持的配置类型: %s", v.Type())
+	}
+	return nil
+}
+
+// formatValue 配置项的字符串形式，字符串列表使用逗号连接，其他列表使用 JSON
+func formatValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Kind() == reflect.Slice {
+		if list, ok := v.Interface().([]string); ok {
+			return strings.Join(list, ",")
+		}
+		data, _ := json.Marshal(v.Interface())
+		return string(data)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// EffectiveConfig 列出当前生效的所有配置项及其来源，敏感配置项的值会被隐藏
+func EffectiveConfig() []ConfigEntry {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	v := reflect.ValueOf(Get()).Elem()
+	var entries []ConfigEntry
+	for _, f := range configFields() {
+		entry := ConfigEntry{
+			Key:    f.key,
+			Value:  formatValue(v.FieldByIndex(f.index)),
+			Source: configSources[f.key],
+		}
+		// domain 由 NLIP_DOMAIN 指定的主机名生成，不能直接设置
+		if f.key != "domain" {
+			entry.Env = envName(f.key)
+		}
+		if secretFields[f.key] && entry.Value != "" {
+			entry.Value = "******"
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
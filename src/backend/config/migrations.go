@@ -0,0 +1,195 @@
+package config
+
+import (
+	"database/sql"
+	"nlip/utils/db"
+	"nlip/utils/logger"
+	"os"
+)
+
+// migration 数据库结构迁移
+// 新建的表直接放在 createTables 中，已有表的结构变更通过迁移完成
+type migration struct {
+	version int64
+	name    string
+	up      func(*sql.Tx) error
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "add_clip_password",
+		up: func(tx *sql.Tx) error {
+			stmts := []string{
+				"ALTER TABLE nlip_clipboard_items ADD COLUMN password_hash VARCHAR(255)",
+				"ALTER TABLE nlip_clipboard_items ADD COLUMN failed_attempts INT DEFAULT 0",
+				"ALTER TABLE nlip_clipboard_items ADD COLUMN locked_until TIMESTAMP",
+				"DROP TRIGGER IF EXISTS update_clips_timestamp",
+				clipsTimestampTriggerSQL,
+			}
+			for _, stmt := range stmts {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version: 2,
+		name:    "add_storage_quota",
+		up: func(tx *sql.Tx) error {
+			stmts := []string{
+				"ALTER TABLE nlip_clipboard_items ADD COLUMN size_bytes INTEGER NOT NULL DEFAULT 0",
+				"ALTER TABLE nlip_spaces ADD COLUMN used_bytes INTEGER NOT NULL DEFAULT 0",
+				"ALTER TABLE nlip_spaces ADD COLUMN quota_bytes INTEGER",
+				"ALTER TABLE nlip_users ADD COLUMN used_bytes INTEGER NOT NULL DEFAULT 0",
+				"ALTER TABLE nlip_users ADD COLUMN quota_bytes INTEGER",
+				"DROP TRIGGER IF EXISTS update_spaces_timestamp",
+				spacesTimestampTriggerSQL,
+			}
+			stmts = append(stmts, clipUsageTriggersSQL...)
+			for _, stmt := range stmts {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			if err := backfillClipSizes(tx); err != nil {
+				return err
+			}
+
+			// 根据已有内容计算用量
+			stmts = []string{
+				`UPDATE nlip_spaces SET used_bytes = (
+					SELECT COALESCE(SUM(size_bytes), 0) FROM nlip_clipboard_items WHERE space_id = nlip_spaces.id
+				)`,
+				`UPDATE nlip_users SET used_bytes = (
+					SELECT COALESCE(SUM(size_bytes), 0) FROM nlip_clipboard_items WHERE creator_id = nlip_users.id
+				)`,
+			}
+			for _, stmt := range stmts {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version: 3,
+		name:    "add_daily_uploads",
+		up: func(tx *sql.Tx) error {
+			stmts := []string{
+				dailyUploadsTriggerSQL,
+				// 根据现有内容补充历史统计，已被清理的内容无法统计
+				`INSERT OR IGNORE INTO nlip_daily_uploads (space_id, day, uploads, bytes)
+				SELECT space_id, substr(created_at, 1, 10), COUNT(*), SUM(size_bytes)
+				FROM nlip_clipboard_items
+				GROUP BY space_id, substr(created_at, 1, 10)`,
+			}
+			for _, stmt := range stmts {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version: 4,
+		name:    "add_user_disabled",
+		up: func(tx *sql.Tx) error {
+			// tokens_valid_after 为 Unix 毫秒时间戳，签发时间早于该时间的 JWT 视为失效
+			stmts := []string{
+				"ALTER TABLE nlip_users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE",
+				"ALTER TABLE nlip_users ADD COLUMN tokens_valid_after INTEGER NOT NULL DEFAULT 0",
+			}
+			for _, stmt := range stmts {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version: 5,
+		name:    "add_user_totp",
+		up: func(tx *sql.Tx) error {
+			// totp_secret 在启用前保存待确认的密钥，totp_last_step 为最后一次使用的验证码时间窗口，防止验证码被重复使用
+			stmts := []string{
+				"ALTER TABLE nlip_users ADD COLUMN totp_secret VARCHAR(64)",
+				"ALTER TABLE nlip_users ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE",
+				"ALTER TABLE nlip_users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0",
+			}
+			for _, stmt := range stmts {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// backfillClipSizes 计算已有剪贴板内容的大小，包括文本内容和文件大小
+func backfillClipSizes(tx *sql.Tx) error {
+	rows, err := tx.Query(`
+		SELECT id, COALESCE(LENGTH(CAST(content AS BLOB)), 0), COALESCE(file_path, '')
+		FROM nlip_clipboard_items
+	`)
+	if err != nil {
+		return err
+	}
+
+	sizes := make(map[string]int64)
+	for rows.Next() {
+		var id, filePath string
+		var size int64
+		if err := rows.Scan(&id, &size, &filePath); err != nil {
+			rows.Close()
+			return err
+		}
+		if filePath != "" {
+			if info, err := os.Stat(filePath); err == nil {
+				size += info.Size()
+			}
+		}
+		sizes[id] = size
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, size := range sizes {
+		if _, err := tx.Exec("UPDATE nlip_clipboard_items SET size_bytes = ? WHERE id = ?", size, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runMigrations 执行尚未应用的迁移
+func runMigrations() error {
+	if err := db.InitMigrationTable(DB); err != nil {
+		return err
+	}
+
+	applied, err := db.GetAppliedMigrations(DB)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		if err := db.RunMigration(DB, m.version, m.name, m.up); err != nil {
+			return err
+		}
+	}
+
+	logger.Debug("数据库迁移检查完成")
+	return nil
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"nlip/utils/logger"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReloadHook 配置重新加载后的回调，old 和 new 分别为替换前后的配置
+type ReloadHook func(old, new *Config)
+
+type reloadHook struct {
+	name string
+	fn   ReloadHook
+}
+
+var (
+	reloadMu    sync.Mutex
+	reloadHooks []reloadHook
+)
+
+// OnReload 注册配置重新加载后的回调，各模块据此更新缓存的配置
+func OnReload(name string, fn ReloadHook) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadHooks = append(reloadHooks, reloadHook{name: name, fn: fn})
+}
+
+// Reload 重新读取配置文件和环境变量，数据库中保存的运行时设置仍然优先
+// 新配置校验通过后替换当前配置并通知已注册的模块，只能在重启后生效的配置项保持不变
+func Reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	// 读取运行时设置到替换配置期间持有 configMutex，避免覆盖同时通过 UpdateSettings 保存的设置
+	configMutex.Lock()
+	next, sources := loadConfig()
+	if err := applyStoredSettings(&next, sources); err != nil {
+		configMutex.Unlock()
+		return fmt.Errorf("加载运行时设置失败: %w", err)
+	}
+	if err := validateConfig(&next); err != nil {
+		configMutex.Unlock()
+		return fmt.Errorf("新配置无效: %w", err)
+	}
+
+	old := Get()
+	for _, key := range keepStaticFields(&next, old) {
+		sources[key] = configSources[key]
+		logger.Warning("配置项 %s 需要重启才能生效，本次重新加载已忽略", key)
+	}
+	changes := diffConfig(old, &next)
+	current.Store(&next)
+	configSources = sources
+	configMutex.Unlock()
+
+	if len(changes) == 0 {
+		logger.Info("配置已重新加载，没有配置项发生变化")
+		return nil
+	}
+	for _, change := range changes {
+		logger.Info("配置项已更新: %s", change)
+	}
+
+	for _, hook := range reloadHooks {
+		runReloadHook(hook, old, &next)
+	}
+	logger.Info("配置已重新加载，%d 个配置项发生变化", len(changes))
+	return nil
+}
+
+func runReloadHook(hook reloadHook, old, new *Config) {
+	defer func() {
+		if p := recover(); p != nil {
+			logger.Error("配置重新加载回调 %s 发生panic: %v", hook.name, p)
+		}
+	}()
+	hook.fn(old, new)
+}
+
+// keepStaticFields 将只能在启动时生效的配置项恢复为当前值，返回被忽略的配置项
+func keepStaticFields(next, current *Config) []string {
+	var ignored []string
+	if next.ServerPort != current.ServerPort {
+		ignored = append(ignored, "server_port")
+		next.ServerPort = current.ServerPort
+		// 域名中包含端口，同样保持不变
+		next.Domain = current.Domain
+		next.FrontendURL = current.FrontendURL
+	}
+	if next.UploadDir != current.UploadDir {
+		ignored = append(ignored, "upload_dir")
+		next.UploadDir = current.UploadDir
+	}
+	// 修改 JWT 密钥会使所有已登录的会话失效
+	if next.JWTSecret != current.JWTSecret {
+		ignored = append(ignored, "jwt_secret")
+		next.JWTSecret = current.JWTSecret
+	}
+	if next.Jobs.Workers != current.Jobs.Workers {
+		ignored = append(ignored, "jobs.workers")
+		next.Jobs.Workers = current.Jobs.Workers
+	}
+	return ignored
+}
+
+// diffConfig 比较两份配置，返回发生变化的配置项描述，敏感配置项不输出具体值
+func diffConfig(old, new *Config) []string {
+	var changes []string
+	diffValue("", reflect.ValueOf(*old), reflect.ValueOf(*new), &changes)
+	return changes
+}
+
+func diffValue(key string, a, b reflect.Value, changes *[]string) {
+	if a.Kind() == reflect.Struct {
+		for i := 0; i < a.NumField(); i++ {
+			name := strings.Split(a.Type().Field(i).Tag.Get("json"), ",")[0]
+			if key != "" {
+				name = key + "." + name
+			}
+			diffValue(name, a.Field(i), b.Field(i), changes)
+		}
+		return
+	}
+
+	if reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return
+	}
+	if secretFields[key] {
+		*changes = append(*changes, key+" (已修改)")
+		return
+	}
+	*changes = append(*changes, fmt.Sprintf("%s: %v -> %v", key, a.Interface(), b.Interface()))
+}
+
+// WatchConfigFile 定期检查配置文件的修改时间，文件变化后自动重新加载配置
+// 检查间隔由环境变量 CONFIG_WATCH_INTERVAL 设置（例如 10s），未设置时不监听，ctx 取消后停止
+func WatchConfigFile(ctx context.Context) {
+	spec := os.Getenv("CONFIG_WATCH_INTERVAL")
+	if spec == "" {
+		return
+	}
+	interval, err := time.ParseDuration(spec)
+	if err != nil || interval < time.Second {
+		logger.Warning("无效的配置文件检查间隔 %q，至少为 1s，已停用配置文件监听", spec)
+		return
+	}
+
+	configFile := ConfigFile()
+	lastMod := fileModTime(configFile)
+	logger.Info("开始监听配置文件 %s，检查间隔 %s", configFile, interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				mod := fileModTime(configFile)
+				if mod.Equal(lastMod) {
+					continue
+				}
+				lastMod = mod
+				logger.Info("检测到配置文件变化: %s", configFile)
+				if err := Reload(); err != nil {
+					logger.Error("重新加载配置失败，继续使用当前配置: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// fileModTime 获取文件修改时间，文件不存在时返回零值
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
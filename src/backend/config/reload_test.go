@@ -0,0 +1,161 @@
+package config_test
+
+import (
+	"encoding/json"
+	"nlip/config"
+	"nlip/utils/testutil"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReloadReplacesConfig(t *testing.T) {
+	testutil.Setup(t)
+
+	before := config.Get()
+	maxItems := before.Token.MaxItems
+
+	var mu sync.Mutex
+	var hookOld, hookNew *config.Config
+	config.OnReload("test", func(old, new *config.Config) {
+		mu.Lock()
+		defer mu.Unlock()
+		hookOld, hookNew = old, new
+	})
+
+	t.Setenv("NLIP_TOKEN_MAX_ITEMS", strconv.Itoa(maxItems+5))
+	if err := config.Reload(); err != nil {
+		t.Fatalf("重新加载配置失败: %v", err)
+	}
+
+	after := config.Get()
+	if after == before {
+		t.Fatal("重新加载后应替换为新的配置")
+	}
+	if after.Token.MaxItems != maxItems+5 {
+		t.Errorf("token.max_items = %d，期望 %d", after.Token.MaxItems, maxItems+5)
+	}
+	if before.Token.MaxItems != maxItems {
+		t.Errorf("重新加载不应修改之前获取的配置，token.max_items = %d", before.Token.MaxItems)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if hookOld != before || hookNew != after {
+		t.Error("回调应收到替换前后的配置")
+	}
+}
+
+func TestReloadKeepsStaticFields(t *testing.T) {
+	testutil.Setup(t)
+
+	port := config.Get().ServerPort
+	t.Setenv("NLIP_SERVER_PORT", "39999")
+	if err := config.Reload(); err != nil {
+		t.Fatalf("重新加载配置失败: %v", err)
+	}
+	if got := config.Get().ServerPort; got != port {
+		t.Errorf("server_port = %s，需要重启才能生效的配置项应保持 %s", got, port)
+	}
+}
+
+// TestReloadConcurrentReaders 在请求读取配置的同时重新加载和修改设置，需使用 go test -race 运行
+func TestReloadConcurrentReaders(t *testing.T) {
+	testutil.Setup(t)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				cfg := config.Get()
+				if cfg.Token.MaxItems <= 0 || cfg.MaxFileSize <= 0 || len(cfg.FileTypes.AllowList) == 0 {
+					t.Error("读取到不完整的配置")
+					return
+				}
+				_ = config.CurrentSettings()
+			}
+		}()
+	}
+
+	for i := 0; i < 20; i++ {
+		t.Setenv("NLIP_TOKEN_MAX_ITEMS", strconv.Itoa(10+i))
+		if err := config.Reload(); err != nil {
+			t.Errorf("重新加载配置失败: %v", err)
+			break
+		}
+		size, _ := json.Marshal(1024 * 1024 * (i + 1))
+		if _, err := config.UpdateSettings(map[string]json.RawMessage{"upload.max_size": size}, "test"); err != nil {
+			t.Errorf("修改设置失败: %v", err)
+			break
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if got := config.Get().MaxFileSize; got != 20*1024*1024 {
+		t.Errorf("upload.max_size = %d，期望最后一次修改的值", got)
+	}
+}
+
+// TestReloadInterleavedWithUpdateSettings 重新加载与修改设置同时进行时，已保存的设置不会被覆盖，需使用 go test -race 运行
+func TestReloadInterleavedWithUpdateSettings(t *testing.T) {
+	testutil.Setup(t)
+
+	// saved 为最近一次保存成功的值，之后读取到的配置不能比它旧
+	var saved atomic.Int64
+	saved.Store(config.Get().MaxFileSize)
+	// 回调在重新加载替换配置后执行，检查新配置是否比已保存的设置旧
+	var checking atomic.Bool
+	checking.Store(true)
+	t.Cleanup(func() { checking.Store(false) })
+	config.OnReload("test-interleave", func(_, new *config.Config) {
+		if want := saved.Load(); checking.Load() && new.MaxFileSize < want {
+			t.Errorf("upload.max_size = %d，重新加载覆盖了已保存的设置 %d", new.MaxFileSize, want)
+		}
+	})
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := config.Reload(); err != nil {
+					t.Errorf("重新加载配置失败: %v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	const rounds = 100
+	for i := 1; i <= rounds; i++ {
+		size := int64(1024 * 1024 * i)
+		raw, _ := json.Marshal(size)
+		if _, err := config.UpdateSettings(map[string]json.RawMessage{"upload.max_size": raw}, "test"); err != nil {
+			t.Fatalf("修改设置失败: %v", err)
+		}
+		saved.Store(size)
+	}
+	close(stop)
+	wg.Wait()
+
+	if got := config.Get().MaxFileSize; got != rounds*1024*1024 {
+		t.Errorf("upload.max_size = %d，期望最后一次修改的值", got)
+	}
+}
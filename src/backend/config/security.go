@@ -0,0 +1,200 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"nlip/utils/logger"
+	tokenUtils "nlip/utils/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// jwtSecretFile 未配置 JWT 密钥时自动生成的密钥保存位置
+var jwtSecretFile = filepath.Join("./data", "jwt_secret")
+
+// minJWTSecretLength 生产环境中 JWT 密钥的最小长度
+const minJWTSecretLength = 32
+
+// weakJWTSecrets 示例配置和早期版本中使用的默认密钥，生产环境中不允许使用
+var weakJWTSecrets = []string{
+	"your-secret-key",
+	"your-super-secret-key-at-least-32-chars",
+	"secret",
+	"changeme",
+}
+
+// devAdminPassword 开发和测试环境中默认管理员的初始密码
+const devAdminPassword = "nlip123"
+
+// readJWTSecretFile 读取自动生成的 JWT 密钥，文件不存在时返回空字符串
+func readJWTSecretFile() string {
+	data, err := os.ReadFile(jwtSecretFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("读取 JWT 密钥文件失败: %v", err)
+		}
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// EnsureJWTSecret 未配置 JWT 密钥时生成随机密钥并保存到数据目录，之后启动时继续使用该密钥
+func EnsureJWTSecret() error {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	if Get().JWTSecret != "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(jwtSecretFile), 0755); err != nil {
+		return fmt.Errorf("创建数据目录失败: %w", err)
+	}
+	secret := tokenUtils.GenerateSecureToken()
+	// O_EXCL 避免覆盖其他进程同时生成的密钥
+	file, err := os.OpenFile(jwtSecretFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("保存 JWT 密钥失败: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(secret + "\n"); err != nil {
+		return fmt.Errorf("保存 JWT 密钥失败: %w", err)
+	}
+
+	next := *Get()
+	next.JWTSecret = secret
+	current.Store(&next)
+	configSources["jwt_secret"] = "generated:" + jwtSecretFile
+	logger.Warning("未配置 JWT 密钥，已生成随机密钥并保存到 %s", jwtSecretFile)
+	return nil
+}
+
+// checkJWTSecret 生产环境中拒绝默认密钥和长度不足的密钥
+func checkJWTSecret(cfg *Config) error {
+	if cfg.AppEnv != "production" {
+		return nil
+	}
+	for _, weak := range weakJWTSecrets {
+		if strings.EqualFold(cfg.JWTSecret, weak) {
+			return fmt.Errorf("JWT密钥使用了示例配置中的默认值，请设置 NLIP_JWT_SECRET，或删除 jwt_secret 配置以自动生成随机密钥")
+		}
+	}
+	if len(cfg.JWTSecret) < minJWTSecretLength {
+		return fmt.Errorf("JWT密钥长度不能少于 %d 个字符", minJWTSecretLength)
+	}
+	return nil
+}
+
+// extensionIDPattern Chrome 扩展的 ID 为 32 个 a-p 之间的字母
+var extensionIDPattern = regexp.MustCompile(`^[a-pA-P]{32}$`)
+
+// checkCORS 校验跨域配置中的来源格式，管理接口不允许任意来源，默认策略允许任意来源时记录警告
+func checkCORS(cfg *Config) error {
+	// public 未设置来源时使用默认策略的来源，按实际生效的来源检查凭据
+	publicOrigins := cfg.CORS.Public.AllowOrigins
+	if len(publicOrigins) == 0 {
+		publicOrigins = cfg.CORS.AllowOrigins
+	}
+	policies := []struct {
+		key         string
+		origins     []string
+		credentials bool
+		maxAge      int
+	}{
+		{"cors", cfg.CORS.AllowOrigins, cfg.CORS.AllowCredentials, cfg.CORS.MaxAge},
+		{"cors.public", publicOrigins, cfg.CORS.Public.AllowCredentials, cfg.CORS.Public.MaxAge},
+		{"cors.admin", cfg.CORS.Admin.AllowOrigins, cfg.CORS.Admin.AllowCredentials, cfg.CORS.Admin.MaxAge},
+	}
+	for _, p := range policies {
+		if p.maxAge < 0 {
+			return fmt.Errorf("%s.max_age 不能小于0", p.key)
+		}
+		for _, origin := range p.origins {
+			if origin == "*" {
+				if p.key == "cors.admin" {
+					return fmt.Errorf("cors.admin.allow_origins 不能包含 \"*\"")
+				}
+				// 浏览器不接受任意来源携带凭据的响应，配置了也不会生效
+				if p.credentials {
+					return fmt.Errorf("%s 允许任意来源 (\"*\") 时不能启用 allow_credentials，请配置具体的来源或关闭 allow_credentials", p.key)
+				}
+				continue
+			}
+			if !validOrigin(origin) {
+				return fmt.Errorf("%s.allow_origins 中的来源无效: %q，格式为 https://example.com", p.key, origin)
+			}
+		}
+	}
+	for _, id := range cfg.CORS.ExtensionIDs {
+		if !extensionIDPattern.MatchString(id) {
+			return fmt.Errorf("cors.extension_ids 中的扩展 ID 无效: %q", id)
+		}
+	}
+
+	for _, origin := range cfg.CORS.AllowOrigins {
+		if origin == "*" {
+			msg := "CORS 允许任意来源访问 (cors.allow_origins 包含 \"*\")，建议只配置前端的域名"
+			logger.Warning(msg)
+			fmt.Fprintln(os.Stderr, "警告: "+msg)
+			break
+		}
+	}
+	return nil
+}
+
+// validOrigin 判断来源格式是否有效，只包含协议和主机，主机可以使用 *. 匹配子域名
+func validOrigin(origin string) bool {
+	u, err := url.Parse(strings.Replace(origin, "://*.", "://", 1))
+	if err != nil || u.Host == "" || strings.Contains(u.Host, "*") {
+		return false
+	}
+	if u.Path != "" && u.Path != "/" || u.RawQuery != "" || u.Fragment != "" {
+		return false
+	}
+	return u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "chrome-extension"
+}
+
+// checkTrustedProxies 校验可信代理列表和客户端地址请求头，每一项为 IP 或 CIDR
+func checkTrustedProxies(cfg *Config) error {
+	switch cfg.TrustedHeader {
+	case "x-forwarded-for", "x-real-ip", "forwarded":
+	default:
+		return fmt.Errorf("trusted_header 必须是 x-forwarded-for、x-real-ip 或 forwarded")
+	}
+	for _, entry := range cfg.TrustedProxies {
+		var err error
+		if strings.Contains(entry, "/") {
+			_, err = netip.ParsePrefix(entry)
+		} else {
+			_, err = netip.ParseAddr(entry)
+		}
+		if err != nil {
+			return fmt.Errorf("trusted_proxies 中的地址无效: %q，格式为 IP 或 CIDR，例如 172.16.0.0/12", entry)
+		}
+	}
+	return nil
+}
+
+// bootstrapAdminPassword 获取首次启动时创建的管理员账号的密码
+// 优先使用 NLIP_ADMIN_PASSWORD（或 NLIP_ADMIN_PASSWORD_FILE），生产环境未设置时生成随机密码并输出一次
+// needChangePwd 为 true 时管理员首次登录后需要修改密码
+func bootstrapAdminPassword() (password string, needChangePwd bool, err error) {
+	if value, _, ok := lookupEnv("NLIP_ADMIN_PASSWORD"); ok && value != "" {
+		if len(value) < 6 || len(value) > 50 {
+			return "", false, fmt.Errorf("NLIP_ADMIN_PASSWORD 长度必须在 6 到 50 个字符之间")
+		}
+		return value, false, nil
+	}
+
+	if env := Get().AppEnv; env == "development" || env == "test" {
+		logger.Warning("使用开发环境默认管理员密码，请勿在生产环境中使用")
+		return devAdminPassword, true, nil
+	}
+
+	password = tokenUtils.GenerateSecureToken()[:16]
+	fmt.Printf("\n已创建管理员账号 admin，初始密码: %s\n该密码只显示一次，首次登录后需要修改密码\n\n", password)
+	return password, true, nil
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckCORSRejectsWildcardWithCredentials(t *testing.T) {
+	t.Setenv("NLIP_APP_ENV", "test")
+	t.Setenv("NLIP_JWT_SECRET", "nlip-test-secret-0123456789abcdef")
+
+	tests := []struct {
+		name    string
+		modify  func(cfg *Config)
+		wantErr string
+	}{
+		{"默认配置", func(cfg *Config) {}, ""},
+		{"默认策略允许任意来源并携带凭据", func(cfg *Config) {
+			cfg.CORS.AllowOrigins = []string{"*"}
+			cfg.CORS.AllowCredentials = true
+		}, "cors 允许任意来源"},
+		{"默认策略允许任意来源不携带凭据", func(cfg *Config) {
+			cfg.CORS.AllowOrigins = []string{"*"}
+			cfg.CORS.AllowCredentials = false
+		}, ""},
+		{"公开策略允许任意来源并携带凭据", func(cfg *Config) {
+			cfg.CORS.Public.AllowCredentials = true
+		}, "cors.public 允许任意来源"},
+		{"公开策略继承任意来源并携带凭据", func(cfg *Config) {
+			cfg.CORS.AllowOrigins = []string{"*"}
+			cfg.CORS.AllowCredentials = false
+			cfg.CORS.Public.AllowOrigins = nil
+			cfg.CORS.Public.AllowCredentials = true
+		}, "cors.public 允许任意来源"},
+		{"公开策略指定来源并携带凭据", func(cfg *Config) {
+			cfg.CORS.Public.AllowOrigins = []string{"https://clip.example.com"}
+			cfg.CORS.Public.AllowCredentials = true
+		}, ""},
+		{"管理策略允许任意来源", func(cfg *Config) {
+			cfg.CORS.Admin.AllowOrigins = []string{"*"}
+			cfg.CORS.Admin.AllowCredentials = false
+		}, "cors.admin.allow_origins"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := loadConfig()
+			tt.modify(&cfg)
+			err := validateConfig(&cfg)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("配置应有效，实际返回错误: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("配置应被拒绝")
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Errorf("错误为 %q，期望包含 %q", err, tt.wantErr)
+			}
+		})
+	}
+}
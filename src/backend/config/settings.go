@@ -0,0 +1,384 @@
+package config
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"nlip/models/settings"
+	"nlip/utils/db"
+	"nlip/utils/logger"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SettingError 设置项的值无效
+type SettingError struct {
+	Key     string
+	Message string
+}
+
+func (e *SettingError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Message)
+}
+
+// setting 可在运行时修改的设置项
+type setting struct {
+	// parse 解析并校验设置值，返回将其写入配置的函数
+	parse func(raw json.RawMessage) (func(*Config), error)
+	// value 获取配置中的当前值
+	value func(*Config) interface{}
+	// field 获取配置中对应字段的指针
+	field func(*Config) interface{}
+}
+
+// configKey 设置项对应的配置项，例如 upload.max_size 对应 max_file_size
+func (s setting) configKey() string {
+	var c Config
+	ptr := reflect.ValueOf(s.field(&c)).Pointer()
+	v := reflect.ValueOf(&c).Elem()
+	for _, f := range configFields() {
+		if v.FieldByIndex(f.index).Addr().Pointer() == ptr {
+			return f.key
+		}
+	}
+	return ""
+}
+
+var extPattern = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// runtimeSettings 可在运行时修改的设置项，键与设置接口中的字段路径一致
+var runtimeSettings = map[string]setting{
+	"file_types.allow_list": extListSetting(func(c *Config) *[]string { return &c.FileTypes.AllowList }),
+	"file_types.deny_list":  extListSetting(func(c *Config) *[]string { return &c.FileTypes.DenyList }),
+	"upload.max_size":       int64Setting(1, 1024*1024*1024, func(c *Config) *int64 { return &c.MaxFileSize }),
+	"space.default_max_items": intSetting(1, 10000, func(c *Config) *int {
+		return &c.Space.DefaultMaxItems
+	}),
+	"space.default_retention_days": intSetting(1, 3650, func(c *Config) *int {
+		return &c.Space.DefaultRetentionDays
+	}),
+	"space.max_items_limit": intSetting(1, 10000, func(c *Config) *int {
+		return &c.Space.MaxItemsLimit
+	}),
+	"space.max_retention_days_limit": intSetting(1, 3650, func(c *Config) *int {
+		return &c.Space.MaxRetentionDaysLimit
+	}),
+	"security.token_expiry": durationSetting(time.Minute, 365*24*time.Hour, func(c *Config) *time.Duration {
+		return &c.TokenExpiry
+	}),
+	"security.require_2fa": enumSetting([]string{"off", "admins", "all"}, func(c *Config) *string {
+		return &c.TwoFactor.Require
+	}),
+}
+
+func intSetting(min, max int, field func(*Config) *int) setting {
+	return setting{
+		parse: func(raw json.RawMessage) (func(*Config), error) {
+			var v int
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return nil, fmt.Errorf("必须是整数")
+			}
+			if v < min || v > max {
+				return nil, fmt.Errorf("必须在 %d 到 %d 之间", min, max)
+			}
+			return func(c *Config) { *field(c) = v }, nil
+		},
+		value: func(c *Config) interface{} { return *field(c) },
+		field: func(c *Config) interface{} { return field(c) },
+	}
+}
+
+func int64Setting(min, max int64, field func(*Config) *int64) setting {
+	return setting{
+		parse: func(raw json.RawMessage) (func(*Config), error) {
+			var v int64
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return nil, fmt.Errorf("必须是整数")
+			}
+			if v < min || v > max {
+				return nil, fmt.Errorf("必须在 %d 到 %d 之间", min, max)
+			}
+			return func(c *Config) { *field(c) = v }, nil
+		},
+		value: func(c *Config) interface{} { return *field(c) },
+		field: func(c *Config) interface{} { return field(c) },
+	}
+}
+
+// durationSetting 时长设置，使用 "24h"、"30m" 等格式
+func durationSetting(min, max time.Duration, field func(*Config) *time.Duration) setting {
+	return setting{
+		parse: func(raw json.RawMessage) (func(*Config), error) {
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return nil, fmt.Errorf("必须是时长字符串，例如 24h")
+			}
+			v, err := time.ParseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf("无效的时长: %s", s)
+			}
+			if v < min || v > max {
+				return nil, fmt.Errorf("必须在 %s 到 %s 之间", min, max)
+			}
+			return func(c *Config) { *field(c) = v }, nil
+		},
+		value: func(c *Config) interface{} { return field(c).String() },
+		field: func(c *Config) interface{} { return field(c) },
+	}
+}
+
+// enumSetting 取值只能是 values 之一的字符串设置
+func enumSetting(values []string, field func(*Config) *string) setting {
+	return setting{
+		parse: func(raw json.RawMessage) (func(*Config), error) {
+			var v string
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return nil, fmt.Errorf("必须是字符串")
+			}
+			for _, allowed := range values {
+				if v == allowed {
+					return func(c *Config) { *field(c) = v }, nil
+				}
+			}
+			return nil, fmt.Errorf("必须是 %s 之一", strings.Join(values, "、"))
+		},
+		value: func(c *Config) interface{} { return *field(c) },
+		field: func(c *Config) interface{} { return field(c) },
+	}
+}
+
+// extListSetting 文件扩展名列表，统一转为小写并去掉开头的点
+func extListSetting(field func(*Config) *[]string) setting {
+	return setting{
+		parse: func(raw json.RawMessage) (func(*Config), error) {
+			var list []string
+			if err := json.Unmarshal(raw, &list); err != nil {
+				return nil, fmt.Errorf("必须是字符串数组")
+			}
+			seen := make(map[string]bool)
+			exts := make([]string, 0, len(list))
+			for _, ext := range list {
+				ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+				if !extPattern.MatchString(ext) {
+					return nil, fmt.Errorf("无效的扩展名: %q", ext)
+				}
+				if !seen[ext] {
+					seen[ext] = true
+					exts = append(exts, ext)
+				}
+			}
+			return func(c *Config) { *field(c) = exts }, nil
+		},
+		value: func(c *Config) interface{} {
+			if *field(c) == nil {
+				return []string{}
+			}
+			return *field(c)
+		},
+		field: func(c *Config) interface{} { return field(c) },
+	}
+}
+
+// validateSettings 校验设置项之间的约束
+func validateSettings(c *Config) error {
+	if c.Space.DefaultMaxItems > c.Space.MaxItemsLimit {
+		return &SettingError{Key: "space.default_max_items", Message: "不能大于 space.max_items_limit"}
+	}
+	if c.Space.DefaultRetentionDays > c.Space.MaxRetentionDaysLimit {
+		return &SettingError{Key: "space.default_retention_days", Message: "不能大于 space.max_retention_days_limit"}
+	}
+	return nil
+}
+
+// CurrentSettings 获取当前的服务器设置
+func CurrentSettings() *settings.ServerSettings {
+	cfg := Get()
+
+	var s settings.ServerSettings
+	s.FileTypes.AllowList = cfg.FileTypes.AllowList
+	s.FileTypes.DenyList = cfg.FileTypes.DenyList
+	s.Upload.MaxSize = cfg.MaxFileSize
+	s.Space.DefaultMaxItems = cfg.Space.DefaultMaxItems
+	s.Space.DefaultRetentionDays = cfg.Space.DefaultRetentionDays
+	s.Space.MaxItemsLimit = cfg.Space.MaxItemsLimit
+	s.Space.MaxRetentionDaysLimit = cfg.Space.MaxRetentionDaysLimit
+	s.Security.TokenExpiry = cfg.TokenExpiry.String()
+	s.Security.Require2FA = cfg.TwoFactor.Require
+	return &s
+}
+
+// UpdateSettings 校验并保存设置，所有设置项校验通过后才会一起生效
+// 返回实际发生变化的设置项，值无效时返回 *SettingError
+func UpdateSettings(updates map[string]json.RawMessage, changedBy string) ([]settings.Change, error) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	keys := make([]string, 0, len(updates))
+	for key := range updates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	old := Get()
+	next := *old
+	for _, key := range keys {
+		def, ok := runtimeSettings[key]
+		if !ok {
+			return nil, &SettingError{Key: key, Message: "未知的设置项"}
+		}
+		apply, err := def.parse(updates[key])
+		if err != nil {
+			return nil, &SettingError{Key: key, Message: err.Error()}
+		}
+		apply(&next)
+	}
+	if err := validateSettings(&next); err != nil {
+		return nil, err
+	}
+
+	changes := []settings.Change{}
+	for _, key := range keys {
+		def := runtimeSettings[key]
+		oldValue, err := json.Marshal(def.value(old))
+		if err != nil {
+			return nil, err
+		}
+		newValue, err := json.Marshal(def.value(&next))
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(oldValue, newValue) {
+			changes = append(changes, settings.Change{Key: key, OldValue: oldValue, NewValue: newValue})
+		}
+	}
+	if len(changes) == 0 {
+		return changes, nil
+	}
+
+	now := time.Now()
+	err := db.WithTransaction(DB, func(tx *sql.Tx) error {
+		for _, change := range changes {
+			if _, err := tx.Exec(`
+				INSERT INTO nlip_settings (key, value, updated_by, updated_at) VALUES (?, ?, ?, ?)
+				ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_by = excluded.updated_by, updated_at = excluded.updated_at
+			`, change.Key, string(change.NewValue), changedBy, now); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`
+				INSERT INTO nlip_settings_audit (key, old_value, new_value, changed_by, changed_at)
+				VALUES (?, ?, ?, ?, ?)
+			`, change.Key, string(change.OldValue), string(change.NewValue), changedBy, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("保存设置失败: %w", err)
+	}
+
+	for _, change := range changes {
+		configSources[runtimeSettings[change.Key].configKey()] = "database"
+	}
+	current.Store(&next)
+	return changes, nil
+}
+
+// loadSettings 使用数据库中保存的设置覆盖配置文件和环境变量中的设置
+func loadSettings() error {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	next := *Get()
+	if err := applyStoredSettings(&next, configSources); err != nil {
+		return err
+	}
+	current.Store(&next)
+	return nil
+}
+
+// applyStoredSettings 将数据库中保存的设置写入 cfg 并记录来源，无效的设置项会被忽略
+func applyStoredSettings(cfg *Config, sources map[string]string) error {
+	rows, err := DB.Query("SELECT key, value FROM nlip_settings")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return err
+		}
+		def, ok := runtimeSettings[key]
+		if !ok {
+			logger.Warning("忽略未知的设置项: %s", key)
+			continue
+		}
+		apply, err := def.parse(json.RawMessage(value))
+		if err != nil {
+			logger.Warning("忽略无效的设置项 %s: %v", key, err)
+			continue
+		}
+		apply(cfg)
+		sources[def.configKey()] = "database"
+		logger.Debug("使用数据库中的设置: %s=%s", key, value)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	validateAndAdjustConfig(cfg)
+	return nil
+}
+
+// SettingsHistory 分页获取设置变更记录，key 为空时返回所有设置项的记录
+func SettingsHistory(key string, limit, offset int) ([]settings.AuditEntry, int, error) {
+	where := ""
+	args := []interface{}{}
+	if key != "" {
+		where = " WHERE a.key = ?"
+		args = append(args, key)
+	}
+
+	var total int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM nlip_settings_audit a"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := DB.Query(`
+		SELECT a.id, a.key, COALESCE(a.old_value, 'null'), a.new_value,
+			COALESCE(a.changed_by, ''), COALESCE(u.username, ''), a.changed_at
+		FROM nlip_settings_audit a
+		LEFT JOIN nlip_users u ON u.id = a.changed_by`+where+`
+		ORDER BY a.id DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := []settings.AuditEntry{}
+	for rows.Next() {
+		var e settings.AuditEntry
+		var oldValue, newValue string
+		if err := rows.Scan(&e.ID, &e.Key, &oldValue, &newValue, &e.ChangedBy, &e.Username, &e.ChangedAt); err != nil {
+			return nil, 0, err
+		}
+		e.OldValue = json.RawMessage(oldValue)
+		e.NewValue = json.RawMessage(newValue)
+		list = append(list, e)
+	}
+	return list, total, rows.Err()
+}
+
+// IsRuntimeSetting 判断是否为可在运行时修改的设置项
+func IsRuntimeSetting(key string) bool {
+	_, ok := runtimeSettings[key]
+	return ok
+}
@@ -5,38 +5,138 @@ import (
 	"os"
 	"path/filepath"
 	"nlip/utils/logger"
+	"strings"
+	"time"
 )
 
 // ValidateConfig 验证配置
 func ValidateConfig() error {
+	if err := validateConfig(Get()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateConfig(cfg *Config) error {
 	logger.Debug("开始验证配置")
 
 	// 验证上传目录
-	if AppConfig.UploadDir == "" {
+	if cfg.UploadDir == "" {
 		return fmt.Errorf("上传目录不能为空")
 	}
 
 	// 确保上传目录存在
-	uploadDir := filepath.Clean(AppConfig.UploadDir)
+	uploadDir := filepath.Clean(cfg.UploadDir)
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
 		return fmt.Errorf("创建上传目录失败: %w", err)
 	}
 
 	// 验证JWT密钥
-	if AppConfig.JWTSecret == "" {
+	if cfg.JWTSecret == "" {
 		return fmt.Errorf("JWT密钥不能为空")
 	}
+	if err := checkJWTSecret(cfg); err != nil {
+		return err
+	}
 
 	// 验证文件大小限制
-	if AppConfig.MaxFileSize <= 0 {
+	if cfg.MaxFileSize <= 0 {
 		return fmt.Errorf("文件大小限制必须大于0")
 	}
 
 	// 验证令牌过期时间
-	if AppConfig.TokenExpiry <= 0 {
+	if cfg.TokenExpiry <= 0 {
 		return fmt.Errorf("令牌过期时间必须大于0")
 	}
 
-	logger.Info("配置验证通过")
+	// 验证可信代理
+	if err := checkTrustedProxies(cfg); err != nil {
+		return err
+	}
+
+	// 验证跨域配置
+	if err := checkCORS(cfg); err != nil {
+		return err
+	}
+
+	// 验证访问频率限制规则
+	if err := validateRateLimit(cfg); err != nil {
+		return err
+	}
+
+	// 验证登录失败锁定配置
+	if err := validateLoginLockout(cfg); err != nil {
+		return err
+	}
+
+	if err := validateTwoFactor(cfg); err != nil {
+		return err
+	}
+
 	return nil
-} 
\ No newline at end of file
+} 
+// validateRateLimit 验证访问频率限制规则
+func validateRateLimit(cfg *Config) error {
+	if cfg.RateLimit.Store != "memory" && cfg.RateLimit.Store != "sqlite" {
+		return fmt.Errorf("rate_limit.store 必须是 memory 或 sqlite")
+	}
+
+	names := make(map[string]bool)
+	for i, rule := range cfg.RateLimit.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rate_limit.rules[%d] 缺少 name", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rate_limit.rules 中的规则名称重复: %s", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("规则 %s 的 path 必须以 / 开头", rule.Name)
+		}
+		if pos := strings.Index(rule.Path, "**"); pos >= 0 && pos != len(rule.Path)-2 {
+			return fmt.Errorf("规则 %s 的 path 中 ** 只能出现在末尾", rule.Name)
+		}
+		if rule.Key != "ip" && rule.Key != "user" && rule.Key != "token" {
+			return fmt.Errorf("规则 %s 的 key 必须是 ip、user 或 token", rule.Name)
+		}
+		if rule.Rate <= 0 || rule.Burst < 0 {
+			return fmt.Errorf("规则 %s 的 rate 必须大于0，burst 不能小于0", rule.Name)
+		}
+		period, err := time.ParseDuration(rule.Period)
+		if err != nil || period < time.Second {
+			return fmt.Errorf("规则 %s 的 period 无效: %q，至少为 1s", rule.Name, rule.Period)
+		}
+	}
+	return nil
+}
+
+// validateLoginLockout 验证登录失败锁定配置
+func validateLoginLockout(cfg *Config) error {
+	l := cfg.LoginLockout
+	if !l.Enabled {
+		return nil
+	}
+	if l.MaxAttempts < 1 || l.IPMaxAttempts < 1 {
+		return fmt.Errorf("login_lockout.max_attempts 和 login_lockout.ip_max_attempts 必须大于0")
+	}
+	if l.LockSeconds < 1 || l.MaxLockSeconds < l.LockSeconds {
+		return fmt.Errorf("login_lockout.lock_seconds 必须大于0，且不能大于 login_lockout.max_lock_seconds")
+	}
+	if l.ResetSeconds < 1 {
+		return fmt.Errorf("login_lockout.reset_seconds 必须大于0")
+	}
+	return nil
+}
+
+// validateTwoFactor 验证两步验证配置
+func validateTwoFactor(cfg *Config) error {
+	if cfg.TwoFactor.Issuer == "" {
+		return fmt.Errorf("two_factor.issuer 不能为空")
+	}
+	switch cfg.TwoFactor.Require {
+	case "off", "admins", "all":
+		return nil
+	}
+	return fmt.Errorf("two_factor.require 必须是 off、admins 或 all")
+}
@@ -0,0 +1,152 @@
+package admin
+
+import (
+	"database/sql"
+	"nlip/models/cleanup"
+	"nlip/tasks/cleaner"
+	"nlip/utils/logger"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleListCleanupRuns 获取清理记录列表
+// @Summary 获取清理记录列表
+// @Description 按类型分页获取清理记录，记录保留 30 天，列表不包含各空间删除的内容
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param kind query string false "清理类型" Enums(expired, overflow, space_overflow)
+// @Param page query int false "页码，默认 1"
+// @Param pageSize query int false "每页数量，默认 20，最大 100"
+// @Success 200 {object} cleanup.ListRunsResponse "获取成功"
+// @Failure 400 {object} string "无效的清理类型"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/cleanup/runs [get]
+func HandleListCleanupRuns(c *fiber.Ctx) error {
+	kind := c.Query("kind")
+	switch kind {
+	case "", cleanup.KindExpired, cleanup.KindOverflow, cleanup.KindSpaceOverflow:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "无效的清理类型")
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize := c.QueryInt("pageSize", 20)
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	runs, total, err := cleaner.ListRuns(kind, pageSize, (page-1)*pageSize)
+	if err != nil {
+		logger.Error("获取清理记录列表失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取清理记录列表失败")
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取清理记录列表成功",
+		"data": cleanup.ListRunsResponse{
+			Runs:  runs,
+			Total: total,
+		},
+	})
+}
+
+// HandleGetCleanupRun 获取清理记录详情
+// @Summary 获取清理记录详情
+// @Description 获取清理记录及各空间删除的数量、释放的空间和剪贴板ID
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param runId path string true "清理记录ID"
+// @Success 200 {object} cleanup.RunResponse "获取成功"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 404 {object} string "清理记录不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/cleanup/runs/{runId} [get]
+func HandleGetCleanupRun(c *fiber.Ctx) error {
+	run, err := cleaner.GetRun(c.Params("runId"))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "清理记录不存在")
+	} else if err != nil {
+		logger.Error("获取清理记录失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取清理记录失败")
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取清理记录成功",
+		"data": cleanup.RunResponse{
+			Run: run,
+		},
+	})
+}
+
+// HandleCleanupDryRun 预演清理
+// @Summary 预演清理
+// @Description 预览下一次清理将删除的内容而不实际删除，可临时替换保留天数和最大数量以检查设置修改的影响
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param kind query string false "清理类型，默认 all" Enums(all, expired, overflow)
+// @Param spaceId query string false "只预演指定空间"
+// @Param retentionDays query int false "替换空间的保留天数"
+// @Param maxItems query int false "替换空间的最大数量"
+// @Success 200 {object} cleanup.DryRunResponse "预演成功"
+// @Failure 400 {object} string "参数无效"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 404 {object} string "空间不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/cleanup/dry-run [get]
+func HandleCleanupDryRun(c *fiber.Ctx) error {
+	opts := cleanup.DryRunOptions{SpaceID: c.Query("spaceId")}
+	switch kind := c.Query("kind", "all"); kind {
+	case "all":
+	case cleanup.KindExpired, cleanup.KindOverflow:
+		opts.Kind = kind
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "无效的清理类型")
+	}
+
+	var ok bool
+	if opts.RetentionDays, ok = positiveQueryInt(c, "retentionDays"); !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "保留天数必须为正整数")
+	}
+	if opts.MaxItems, ok = positiveQueryInt(c, "maxItems"); !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "最大数量必须为正整数")
+	}
+
+	result, err := cleaner.DryRun(opts)
+	if err == cleaner.ErrSpaceNotFound {
+		return fiber.NewError(fiber.StatusNotFound, "空间不存在")
+	} else if err != nil {
+		logger.Error("预演清理失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "预演清理失败")
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "预演清理成功",
+		"data": cleanup.DryRunResponse{
+			DryRun: result,
+		},
+	})
+}
+
+// positiveQueryInt 解析可选的正整数查询参数，参数不存在时返回 nil，参数无效时 ok 为 false
+func positiveQueryInt(c *fiber.Ctx, key string) (value *int, ok bool) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return nil, false
+	}
+	return &n, true
+}
@@ -0,0 +1,140 @@
+package admin
+
+import (
+	"database/sql"
+	"nlip/models/job"
+	"nlip/tasks/jobs"
+	"nlip/utils/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleListJobs 获取后台任务列表
+// @Summary 获取后台任务列表
+// @Description 按状态和类型分页获取后台任务，同时返回各状态的任务数量
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "任务状态" Enums(pending, running, succeeded, dead)
+// @Param type query string false "任务类型"
+// @Param page query int false "页码，默认 1"
+// @Param pageSize query int false "每页数量，默认 20，最大 100"
+// @Success 200 {object} job.ListJobsResponse "获取成功"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/jobs [get]
+func HandleListJobs(c *fiber.Ctx) error {
+	status := c.Query("status")
+	switch status {
+	case "", job.StatusPending, job.StatusRunning, job.StatusSucceeded, job.StatusDead:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "无效的任务状态")
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize := c.QueryInt("pageSize", 20)
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	list, total, err := jobs.List(status, c.Query("type"), pageSize, (page-1)*pageSize)
+	if err != nil {
+		logger.Error("获取后台任务列表失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取后台任务列表失败")
+	}
+
+	stats, err := jobs.Stats()
+	if err != nil {
+		logger.Error("统计后台任务失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "统计后台任务失败")
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取后台任务列表成功",
+		"data": job.ListJobsResponse{
+			Jobs:  list,
+			Total: total,
+			Stats: stats,
+		},
+	})
+}
+
+// HandleGetJob 获取后台任务详情
+// @Summary 获取后台任务详情
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param jobId path string true "任务ID"
+// @Success 200 {object} job.JobResponse "获取成功"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 404 {object} string "任务不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/jobs/{jobId} [get]
+func HandleGetJob(c *fiber.Ctx) error {
+	j, err := jobs.Get(c.Params("jobId"))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "任务不存在")
+	} else if err != nil {
+		logger.Error("获取后台任务失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取后台任务失败")
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取后台任务成功",
+		"data": job.JobResponse{
+			Job: j,
+		},
+	})
+}
+
+// HandleRetryJob 重试后台任务
+// @Summary 重试后台任务
+// @Description 将死信任务重置执行次数后重新执行，或将等待中的任务提前到立即执行
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param jobId path string true "任务ID"
+// @Success 200 {object} job.JobResponse "已重新加入队列"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 404 {object} string "任务不存在"
+// @Failure 409 {object} string "任务正在执行或已成功，或已有相同的任务在等待或执行中"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/jobs/{jobId}/retry [post]
+func HandleRetryJob(c *fiber.Ctx) error {
+	jobID := c.Params("jobId")
+	j, err := jobs.Get(jobID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "任务不存在")
+	} else if err != nil {
+		logger.Error("获取后台任务失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取后台任务失败")
+	}
+
+	if j.Status != job.StatusDead && j.Status != job.StatusPending {
+		return fiber.NewError(fiber.StatusConflict, "任务正在执行或已成功，无法重试")
+	}
+
+	j, err = jobs.Retry(jobID)
+	if err == jobs.ErrNotRetryable {
+		return fiber.NewError(fiber.StatusConflict, "任务正在执行或已成功，无法重试")
+	} else if err == jobs.ErrDuplicateActive {
+		return fiber.NewError(fiber.StatusConflict, "已有相同的任务在等待或执行中，无法重试")
+	} else if err != nil {
+		logger.Error("重试后台任务失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "重试后台任务失败")
+	}
+
+	logger.Info("管理员 %v 重试了后台任务: jobID=%s, type=%s", c.Locals("userId"), jobID, j.Type)
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "任务已重新加入队列",
+		"data": job.JobResponse{
+			Job: j,
+		},
+	})
+}
@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"net/url"
+	"nlip/models/lockout"
+	lockoutUtils "nlip/utils/lockout"
+	"nlip/utils/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleListLockouts 获取登录失败记录
+// @Summary 获取登录失败记录
+// @Description 获取仍在计数或锁定中的账号和IP的登录失败记录，锁定中的记录在前
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} lockout.ListLockoutsResponse "获取成功"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/lockouts [get]
+func HandleListLockouts(c *fiber.Ctx) error {
+	entries, err := lockoutUtils.List()
+	if err != nil {
+		logger.Error("获取登录失败记录失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取登录失败记录失败")
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取登录失败记录成功",
+		"data": lockout.ListLockoutsResponse{
+			Lockouts: entries,
+		},
+	})
+}
+
+// HandleDeleteLockout 解除账号或IP的登录锁定
+// @Summary 解除登录锁定
+// @Description 清除账号或IP的登录失败记录并解除锁定
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param kind path string true "类型：account 或 ip"
+// @Param value path string true "用户名或IP"
+// @Success 200 {object} string "解除成功"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 404 {object} string "没有登录失败记录"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/lockouts/{kind}/{value} [delete]
+func HandleDeleteLockout(c *fiber.Ctx) error {
+	kind := c.Params("kind")
+	if kind != lockout.KindAccount && kind != lockout.KindIP {
+		return fiber.NewError(fiber.StatusBadRequest, "类型必须是 account 或 ip")
+	}
+	value, err := url.PathUnescape(c.Params("value"))
+	if err != nil || value == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "无效的用户名或IP")
+	}
+
+	return unlock(c, kind, value)
+}
+
+// HandleUnlockUser 解除用户的登录锁定
+// @Summary 解除用户登录锁定
+// @Description 清除用户账号的登录失败记录并解除锁定，不影响按IP的锁定
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param userId path string true "用户ID"
+// @Success 200 {object} string "解除成功"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 404 {object} string "用户不存在或没有登录失败记录"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/users/{userId}/unlock [post]
+func HandleUnlockUser(c *fiber.Ctx) error {
+	u, err := loadTargetUser(c)
+	if err != nil {
+		return err
+	}
+	return unlock(c, lockout.KindAccount, u.Username)
+}
+
+func unlock(c *fiber.Ctx, kind, value string) error {
+	found, err := lockoutUtils.Unlock(kind, value)
+	if err != nil {
+		logger.Error("解除登录锁定失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "解除登录锁定失败")
+	}
+	if !found {
+		return fiber.NewError(fiber.StatusNotFound, "没有登录失败记录")
+	}
+
+	logger.Info("管理员 %v 解除了登录锁定: %s=%s", c.Locals("userId"), kind, value)
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "解除登录锁定成功",
+		"data":    nil,
+	})
+}
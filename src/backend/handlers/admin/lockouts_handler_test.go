@@ -0,0 +1,136 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"nlip/config"
+	"nlip/middleware"
+	"nlip/middleware/limiter"
+	"nlip/models/lockout"
+	"nlip/routes"
+	"nlip/utils/clientip"
+	"nlip/utils/testutil"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newApp() *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.CustomErrorHandler})
+	clientip.ApplyConfig(nil, config.Get())
+	app.Use(limiter.New())
+	routes.SetupRoutes(app.Group("/api"))
+	return app
+}
+
+func request(t *testing.T, app *fiber.App, method, path, token, body string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func login(t *testing.T, app *fiber.App, password string) *http.Response {
+	t.Helper()
+	return request(t, app, "POST", "/api/v1/nlip/auth/login", "",
+		`{"username":"alice","password":"`+password+`"}`)
+}
+
+// TestAdminUnlockEndpoints 登录失败次数过多后账号被锁定，管理员解除锁定后可以正常登录
+func TestAdminUnlockEndpoints(t *testing.T) {
+	// 关闭访问频率限制，只测试登录锁定
+	t.Setenv("NLIP_RATE_LIMIT_ENABLED", "false")
+	t.Setenv("NLIP_LOGIN_LOCKOUT_MAX_ATTEMPTS", "3")
+	testutil.Setup(t)
+	app := newApp()
+
+	adminID := testutil.CreateUser(t, "root", true)
+	userID := testutil.CreateUser(t, "alice", false)
+	adminToken := testutil.Token(t, adminID, "root", true)
+	userToken := testutil.Token(t, userID, "alice", false)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct-horse"), bcrypt.MinCost)
+	if _, err := config.DB.Exec("UPDATE nlip_users SET password_hash = ? WHERE id = ?", string(hash), userID); err != nil {
+		t.Fatalf("设置密码失败: %v", err)
+	}
+
+	lockAccount := func() {
+		t.Helper()
+		for i := 0; i < 3; i++ {
+			if resp := login(t, app, "wrong-password"); resp.StatusCode != http.StatusForbidden {
+				t.Fatalf("密码错误返回 %d，期望 403", resp.StatusCode)
+			}
+		}
+		resp := login(t, app, "correct-horse")
+		if resp.StatusCode != http.StatusLocked {
+			t.Fatalf("锁定后登录返回 %d，期望 423", resp.StatusCode)
+		}
+		if resp.Header.Get(fiber.HeaderRetryAfter) == "" {
+			t.Error("锁定时应返回 Retry-After")
+		}
+	}
+	lockAccount()
+
+	// 锁定记录出现在管理接口中
+	resp := request(t, app, "GET", "/api/v1/nlip/admin/lockouts", adminToken, "")
+	var list struct {
+		Data lockout.ListLockoutsResponse `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("获取登录失败记录返回 %d: %v", resp.StatusCode, err)
+	}
+	locked := false
+	for _, e := range list.Data.Lockouts {
+		if e.Kind == lockout.KindAccount && e.Value == "alice" && e.LockedUntil != nil {
+			locked = true
+		}
+	}
+	if !locked {
+		t.Fatalf("登录失败记录中应有锁定中的账号 alice: %+v", list.Data.Lockouts)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"普通用户不能解除锁定", "DELETE", "/api/v1/nlip/admin/lockouts/account/alice", userToken, http.StatusForbidden},
+		{"无效的类型", "DELETE", "/api/v1/nlip/admin/lockouts/user/alice", adminToken, http.StatusBadRequest},
+		{"解除账号锁定", "DELETE", "/api/v1/nlip/admin/lockouts/account/alice", adminToken, http.StatusOK},
+		{"没有记录时返回 404", "DELETE", "/api/v1/nlip/admin/lockouts/account/alice", adminToken, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if resp := request(t, app, tt.method, tt.path, tt.token, ""); resp.StatusCode != tt.want {
+			t.Fatalf("%s: 返回 %d，期望 %d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+	if resp := login(t, app, "correct-horse"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("解除锁定后登录返回 %d，期望 200", resp.StatusCode)
+	}
+
+	// 通过用户接口解除锁定
+	lockAccount()
+	if resp := request(t, app, "POST", "/api/v1/nlip/admin/users/"+userID+"/unlock", adminToken, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("通过用户接口解除锁定返回 %d，期望 200", resp.StatusCode)
+	}
+	if resp := login(t, app, "correct-horse"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("解除锁定后登录返回 %d，期望 200", resp.StatusCode)
+	}
+
+	// 解除IP的记录，IP地址中的点不需要转义
+	if resp := request(t, app, "DELETE", "/api/v1/nlip/admin/lockouts/ip/0.0.0.0", adminToken, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("解除IP记录返回 %d，期望 200", resp.StatusCode)
+	}
+}
@@ -0,0 +1,142 @@
+package admin
+
+import (
+	"database/sql"
+	"nlip/models/quota"
+	"nlip/utils/logger"
+	quotaUtil "nlip/utils/quota"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleGetUserQuota 获取用户存储用量
+// @Summary 获取用户存储用量
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param userId path string true "用户ID"
+// @Success 200 {object} quota.UsageResponse "获取成功"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 404 {object} string "用户不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/users/{userId}/quota [get]
+func HandleGetUserQuota(c *fiber.Ctx) error {
+	return respondUsage(c, quotaUtil.UserUsage, c.Params("userId"), "用户不存在", "获取存储用量成功")
+}
+
+// HandleUpdateUserQuota 设置用户存储配额
+// @Summary 设置用户存储配额
+// @Description 为用户单独设置存储配额（字节），quotaBytes 为 null 时恢复使用全局默认配额，为 0 时不限制
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param userId path string true "用户ID"
+// @Param request body quota.UpdateQuotaRequest true "配额设置"
+// @Success 200 {object} quota.UsageResponse "设置成功"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 404 {object} string "用户不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/users/{userId}/quota [put]
+func HandleUpdateUserQuota(c *fiber.Ctx) error {
+	userID := c.Params("userId")
+	req, err := parseQuotaRequest(c)
+	if err != nil {
+		return err
+	}
+
+	if err := quotaUtil.SetUserQuota(userID, req.QuotaBytes); err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "用户不存在")
+	} else if err != nil {
+		logger.Error("设置用户存储配额失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "设置存储配额失败")
+	}
+
+	logger.Info("管理员 %v 设置了用户存储配额: userID=%s, quotaBytes=%v", c.Locals("userId"), userID, formatQuota(req.QuotaBytes))
+	return respondUsage(c, quotaUtil.UserUsage, userID, "用户不存在", "设置存储配额成功")
+}
+
+// HandleGetSpaceQuota 获取空间存储用量
+// @Summary 获取空间存储用量
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param spaceId path string true "空间ID"
+// @Success 200 {object} quota.UsageResponse "获取成功"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 404 {object} string "空间不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/spaces/{spaceId}/quota [get]
+func HandleGetSpaceQuota(c *fiber.Ctx) error {
+	return respondUsage(c, quotaUtil.SpaceUsage, c.Params("spaceId"), "空间不存在", "获取存储用量成功")
+}
+
+// HandleUpdateSpaceQuota 设置空间存储配额
+// @Summary 设置空间存储配额
+// @Description 为空间单独设置存储配额（字节），quotaBytes 为 null 时恢复使用全局默认配额，为 0 时不限制
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param spaceId path string true "空间ID"
+// @Param request body quota.UpdateQuotaRequest true "配额设置"
+// @Success 200 {object} quota.UsageResponse "设置成功"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 404 {object} string "空间不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/spaces/{spaceId}/quota [put]
+func HandleUpdateSpaceQuota(c *fiber.Ctx) error {
+	spaceID := c.Params("spaceId")
+	req, err := parseQuotaRequest(c)
+	if err != nil {
+		return err
+	}
+
+	if err := quotaUtil.SetSpaceQuota(spaceID, req.QuotaBytes); err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "空间不存在")
+	} else if err != nil {
+		logger.Error("设置空间存储配额失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "设置存储配额失败")
+	}
+
+	logger.Info("管理员 %v 设置了空间存储配额: spaceID=%s, quotaBytes=%v", c.Locals("userId"), spaceID, formatQuota(req.QuotaBytes))
+	return respondUsage(c, quotaUtil.SpaceUsage, spaceID, "空间不存在", "设置存储配额成功")
+}
+
+func parseQuotaRequest(c *fiber.Ctx) (*quota.UpdateQuotaRequest, error) {
+	var req quota.UpdateQuotaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+	}
+	if req.QuotaBytes != nil && *req.QuotaBytes < 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "配额不能为负数")
+	}
+	return &req, nil
+}
+
+func formatQuota(quotaBytes *int64) string {
+	if quotaBytes == nil {
+		return "默认"
+	}
+	return quotaUtil.FormatBytes(*quotaBytes)
+}
+
+func respondUsage(c *fiber.Ctx, get func(string) (*quota.Usage, error), id, notFound, message string) error {
+	usage, err := get(id)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, notFound)
+	} else if err != nil {
+		logger.Error("获取存储用量失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取存储用量失败")
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": message,
+		"data": quota.UsageResponse{
+			Storage: usage,
+		},
+	})
+}
@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"nlip/models/schedule"
+	"nlip/tasks/scheduler"
+	"nlip/utils/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleListScheduledTasks 获取定时任务列表
+// @Summary 获取定时任务列表
+// @Description 获取所有定时任务的 cron 表达式、下次执行时间和最近一次执行情况
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} schedule.ListScheduledTasksResponse "获取成功"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/schedules [get]
+func HandleListScheduledTasks(c *fiber.Ctx) error {
+	tasks, err := scheduler.List()
+	if err != nil {
+		logger.Error("获取定时任务列表失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取定时任务列表失败")
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取定时任务列表成功",
+		"data": schedule.ListScheduledTasksResponse{
+			Tasks: tasks,
+		},
+	})
+}
+
+// HandleRunScheduledTask 手动触发定时任务
+// @Summary 手动触发定时任务
+// @Description 立即在后台执行一次定时任务，执行结果可通过定时任务列表查看
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "任务名称"
+// @Success 202 {object} schedule.ScheduledTaskResponse "已开始执行"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 404 {object} string "定时任务不存在"
+// @Failure 409 {object} string "定时任务正在执行中"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/schedules/{name}/run [post]
+func HandleRunScheduledTask(c *fiber.Ctx) error {
+	name := c.Params("name")
+	switch err := scheduler.Trigger(name); err {
+	case nil:
+	case scheduler.ErrTaskNotFound:
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case scheduler.ErrTaskRunning:
+		return fiber.NewError(fiber.StatusConflict, err.Error())
+	default:
+		logger.Error("触发定时任务失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "触发定时任务失败")
+	}
+
+	task, err := scheduler.Get(name)
+	if err != nil {
+		logger.Error("获取定时任务失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取定时任务失败")
+	}
+
+	logger.Info("管理员 %v 手动触发了定时任务: %s", c.Locals("userId"), name)
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"code":    fiber.StatusAccepted,
+		"message": "定时任务已开始执行",
+		"data": schedule.ScheduledTaskResponse{
+			Task: task,
+		},
+	})
+}
@@ -1,130 +1,121 @@
 package admin
 
 import (
-	"github.com/gofiber/fiber/v2"
+	"encoding/json"
+	"errors"
 	"nlip/config"
+	"nlip/models/settings"
 	"nlip/utils/logger"
-)
 
-// ServerSettings 服务器设置结构
-type ServerSettings struct {
-	FileTypes struct {
-		AllowList []string `json:"allow_list"`
-		DenyList  []string `json:"deny_list"`
-	} `json:"file_types"`
-	Upload struct {
-		MaxSize int64 `json:"max_size"`
-	} `json:"upload"`
-	Space struct {
-		DefaultMaxItems      int `json:"default_max_items"`
-		DefaultRetentionDays int `json:"default_retention_days"`
-		MaxItemsLimit       int `json:"max_items_limit"`
-		MaxRetentionDaysLimit int `json:"max_retention_days_limit"`
-	} `json:"space"`
-	Security struct {
-		TokenExpiry string `json:"token_expiry"`
-	} `json:"security"`
-}
+	"github.com/gofiber/fiber/v2"
+)
 
 // HandleGetSettings 获取当前服务器设置
+// @Summary 获取服务器设置
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} settings.ServerSettings "获取成功"
+// @Failure 403 {object} string "需要管理员权限"
+// @Router /api/v1/nlip/admin/settings [get]
 func HandleGetSettings(c *fiber.Ctx) error {
-	// isAdmin := c.Locals("isAdmin").(bool)
-	// if !isAdmin {
-	// 	return fiber.NewError(fiber.StatusForbidden, "需要管理员权限")
-	// }
-
-	settings := ServerSettings{
-		FileTypes: struct {
-			AllowList []string `json:"allow_list"`
-			DenyList  []string `json:"deny_list"`
-		}{
-			AllowList: config.AppConfig.FileTypes.AllowList,
-			DenyList:  config.AppConfig.FileTypes.DenyList,
-		},
-		Upload: struct {
-			MaxSize int64 `json:"max_size"`
-		}{
-			MaxSize: config.AppConfig.MaxFileSize,
-		},
-		Space: struct {
-			DefaultMaxItems      int `json:"default_max_items"`
-			DefaultRetentionDays int `json:"default_retention_days"`
-			MaxItemsLimit       int `json:"max_items_limit"`
-			MaxRetentionDaysLimit int `json:"max_retention_days_limit"`
-		}{
-			DefaultMaxItems:      config.AppConfig.Space.DefaultMaxItems,
-			DefaultRetentionDays: config.AppConfig.Space.DefaultRetentionDays,
-			MaxItemsLimit:       config.AppConfig.Space.MaxItemsLimit,
-			MaxRetentionDaysLimit: config.AppConfig.Space.MaxRetentionDaysLimit,
-		},
-		Security: struct {
-			TokenExpiry string `json:"token_expiry"`
-		}{
-			TokenExpiry: config.AppConfig.TokenExpiry.String(),
-		},
-	}
-
 	return c.JSON(fiber.Map{
 		"code":    fiber.StatusOK,
-		"data":    settings,
+		"data":    config.CurrentSettings(),
 		"message": "获取设置成功",
 	})
 }
 
 // HandleUpdateSettings 更新服务器设置
+// @Summary 更新服务器设置
+// @Description 只更新请求中包含的设置项，所有设置项校验通过后立即生效，无需重启。设置保存在数据库中，优先于配置文件和环境变量
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body settings.ServerSettings true "服务器设置"
+// @Success 200 {object} settings.UpdateSettingsResponse "更新成功"
+// @Failure 400 {object} string "设置项无效"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/settings [put]
 func HandleUpdateSettings(c *fiber.Ctx) error {
-	isAdmin := c.Locals("isAdmin").(bool)
-	if !isAdmin {
-		return fiber.NewError(fiber.StatusForbidden, "需要管理员权限")
-	}
-
-	var settings ServerSettings
-	if err := c.BodyParser(&settings); err != nil {
+	var sections map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &sections); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
 	}
 
-	updates := make(map[string]interface{})
-
-	// 更新文件类型设置
-	if len(settings.FileTypes.AllowList) > 0 || len(settings.FileTypes.DenyList) > 0 {
-		updates["file_types"] = map[string]interface{}{
-			"allow_list": settings.FileTypes.AllowList,
-			"deny_list":  settings.FileTypes.DenyList,
+	// 按 "分组.字段" 展开为设置项
+	updates := make(map[string]json.RawMessage)
+	for section, fields := range sections {
+		for field, value := range fields {
+			updates[section+"."+field] = value
 		}
 	}
 
-	// 更新上传设置
-	if settings.Upload.MaxSize > 0 {
-		updates["max_file_size"] = settings.Upload.MaxSize
+	userID, _ := c.Locals("userId").(string)
+	changes, err := config.UpdateSettings(updates, userID)
+	var settingErr *config.SettingError
+	if errors.As(err, &settingErr) {
+		return fiber.NewError(fiber.StatusBadRequest, settingErr.Error())
+	} else if err != nil {
+		logger.Error("更新服务器设置失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "更新设置失败")
 	}
 
-	// 更新空间设置
-	if settings.Space.DefaultMaxItems > 0 || 
-	   settings.Space.DefaultRetentionDays > 0 || 
-	   settings.Space.MaxItemsLimit > 0 || 
-	   settings.Space.MaxRetentionDaysLimit > 0 {
-		updates["space_defaults"] = map[string]interface{}{
-			"max_items":              settings.Space.DefaultMaxItems,
-			"retention_days":         settings.Space.DefaultRetentionDays,
-			"max_items_limit":        settings.Space.MaxItemsLimit,
-			"max_retention_days_limit": settings.Space.MaxRetentionDaysLimit,
-		}
+	for _, change := range changes {
+		logger.Info("管理员 %s 修改了服务器设置: %s %s -> %s", userID, change.Key, change.OldValue, change.NewValue)
+	}
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "更新设置成功",
+		"data": settings.UpdateSettingsResponse{
+			Settings: config.CurrentSettings(),
+			Changes:  changes,
+		},
+	})
+}
+
+// HandleListSettingsHistory 获取设置变更记录
+// @Summary 获取设置变更记录
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param key query string false "设置项，例如 upload.max_size"
+// @Param page query int false "页码，默认 1"
+// @Param pageSize query int false "每页数量，默认 20，最大 100"
+// @Success 200 {object} settings.ListHistoryResponse "获取成功"
+// @Failure 400 {object} string "未知的设置项"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/settings/history [get]
+func HandleListSettingsHistory(c *fiber.Ctx) error {
+	key := c.Query("key")
+	if key != "" && !config.IsRuntimeSetting(key) {
+		return fiber.NewError(fiber.StatusBadRequest, "未知的设置项")
 	}
 
-	// 更新安全设置
-	if settings.Security.TokenExpiry != "" {
-		updates["token_expiry"] = settings.Security.TokenExpiry
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize := c.QueryInt("pageSize", 20)
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
 	}
 
-	if err := config.UpdateConfig(updates); err != nil {
-		logger.Error("更新配置失败: %v", err)
-		return fiber.NewError(fiber.StatusInternalServerError, "更新配置失败")
+	history, total, err := config.SettingsHistory(key, pageSize, (page-1)*pageSize)
+	if err != nil {
+		logger.Error("获取设置变更记录失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取设置变更记录失败")
 	}
 
-	logger.Info("管理员更新了服务器设置")
 	return c.JSON(fiber.Map{
 		"code":    fiber.StatusOK,
-		"message": "更新设置成功",
-		"data":    updates,
+		"message": "获取设置变更记录成功",
+		"data": settings.ListHistoryResponse{
+			History: history,
+			Total:   total,
+		},
 	})
-} 
\ No newline at end of file
+}
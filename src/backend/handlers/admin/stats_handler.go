@@ -0,0 +1,36 @@
+package admin
+
+import (
+	statsModel "nlip/models/stats"
+	"nlip/utils/logger"
+	"nlip/utils/stats"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleGetInstanceStats 获取实例统计信息
+// @Summary 获取实例统计信息
+// @Description 获取整个实例的用户、空间和内容统计，包括存储用量、类型分布、每日上传、主要贡献者和占用最多的空间
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param days query int false "统计最近的天数，默认 7，最大 90"
+// @Success 200 {object} stats.InstanceStatsResponse "获取成功"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/stats [get]
+func HandleGetInstanceStats(c *fiber.Ctx) error {
+	result, err := stats.InstanceStats(stats.ClampDays(c.QueryInt("days", stats.DefaultDays)))
+	if err != nil {
+		logger.Error("获取实例统计信息失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取统计信息失败")
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取实例统计信息成功",
+		"data": statsModel.InstanceStatsResponse{
+			Stats: result,
+		},
+	})
+}
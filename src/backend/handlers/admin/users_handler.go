@@ -0,0 +1,523 @@
+package admin
+
+import (
+	"database/sql"
+	"nlip/config"
+	authHandler "nlip/handlers/auth"
+	"nlip/handlers/spaces"
+	"nlip/models/user"
+	"nlip/utils/db"
+	"nlip/utils/logger"
+	"nlip/utils/storage"
+	tokenUtils "nlip/utils/token"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// generatedPasswordLength 重置密码时随机生成的密码长度
+const generatedPasswordLength = 16
+
+const adminUserColumns = `
+	u.id, u.username, u.is_admin, u.need_change_pwd, u.disabled, u.created_at,
+	(SELECT COUNT(*) FROM nlip_spaces s WHERE s.owner_id = u.id), u.used_bytes, u.totp_enabled
+`
+
+func scanAdminUser(row interface{ Scan(...interface{}) error }) (*user.AdminUser, error) {
+	var u user.AdminUser
+	err := row.Scan(&u.ID, &u.Username, &u.IsAdmin, &u.NeedChangePwd, &u.Disabled, &u.CreatedAt, &u.SpacesCount, &u.UsedBytes, &u.TwoFactorEnabled)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func getAdminUser(userID string) (*user.AdminUser, error) {
+	return scanAdminUser(config.DB.QueryRow("SELECT "+adminUserColumns+" FROM nlip_users u WHERE u.id = ?", userID))
+}
+
+// loadTargetUser 获取路径参数中的用户，用户不存在时返回 404
+func loadTargetUser(c *fiber.Ctx) (*user.AdminUser, error) {
+	u, err := getAdminUser(c.Params("userId"))
+	if err == sql.ErrNoRows {
+		return nil, fiber.NewError(fiber.StatusNotFound, "用户不存在")
+	} else if err != nil {
+		logger.Error("获取用户信息失败: %v", err)
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "获取用户信息失败")
+	}
+	return u, nil
+}
+
+func respondUser(c *fiber.Ctx, userID, message string) error {
+	u, err := getAdminUser(userID)
+	if err != nil {
+		logger.Error("获取用户信息失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取用户信息失败")
+	}
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": message,
+		"data": user.AdminUserResponse{
+			User: u,
+		},
+	})
+}
+
+// HandleListUsers 获取用户列表
+// @Summary 获取用户列表
+// @Description 按用户名搜索并分页获取用户，同时返回拥有的空间数量和存储用量
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param q query string false "用户名关键字"
+// @Param page query int false "页码，默认 1"
+// @Param pageSize query int false "每页数量，默认 20，最大 100"
+// @Success 200 {object} user.ListUsersResponse "获取成功"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/users [get]
+func HandleListUsers(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize := c.QueryInt("pageSize", 20)
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	// 转义 LIKE 通配符，按关键字字面匹配
+	keyword := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.TrimSpace(c.Query("q")))
+	pattern := "%" + keyword + "%"
+
+	var total int
+	err := config.DB.QueryRow(`SELECT COUNT(*) FROM nlip_users WHERE username LIKE ? ESCAPE '\'`, pattern).Scan(&total)
+	if err != nil {
+		logger.Error("统计用户数量失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取用户列表失败")
+	}
+
+	rows, err := db.QueryRows(config.DB, `
+		SELECT `+adminUserColumns+`
+		FROM nlip_users u
+		WHERE u.username LIKE ? ESCAPE '\'
+		ORDER BY u.created_at ASC, u.username ASC
+		LIMIT ? OFFSET ?
+	`, pattern, pageSize, (page-1)*pageSize)
+	if err != nil {
+		logger.Error("获取用户列表失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取用户列表失败")
+	}
+	defer rows.Close()
+
+	users := []user.AdminUser{}
+	for rows.Next() {
+		u, err := scanAdminUser(rows)
+		if err != nil {
+			logger.Error("读取用户信息失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "获取用户列表失败")
+		}
+		users = append(users, *u)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("读取用户列表失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取用户列表失败")
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取用户列表成功",
+		"data": user.ListUsersResponse{
+			Users: users,
+			Total: total,
+		},
+	})
+}
+
+// HandleGetUser 获取用户详情
+// @Summary 获取用户详情
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param userId path string true "用户ID"
+// @Success 200 {object} user.AdminUserResponse "获取成功"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 404 {object} string "用户不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/users/{userId} [get]
+func HandleGetUser(c *fiber.Ctx) error {
+	u, err := loadTargetUser(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取用户信息成功",
+		"data": user.AdminUserResponse{
+			User: u,
+		},
+	})
+}
+
+// HandleCreateUser 创建用户
+// @Summary 创建用户
+// @Description 管理员直接创建用户，可指定是否为管理员以及首次登录后是否需要修改密码
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body user.CreateUserRequest true "用户信息"
+// @Success 201 {object} user.AdminUserResponse "创建成功"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 409 {object} string "用户名已存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/users [post]
+func HandleCreateUser(c *fiber.Ctx) error {
+	var req user.CreateUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Warning("解析创建用户请求失败: %v", err)
+		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+	}
+
+	var exists bool
+	err := config.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM nlip_users WHERE username = ?)", req.Username).Scan(&exists)
+	if err != nil {
+		logger.Error("检查用户名存在性失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "数据库查询错误")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "用户名已存在")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Error("生成密码哈希失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "密码加密失败")
+	}
+
+	userID := uuid.New().String()
+	_, err = config.DB.Exec(`
+		INSERT INTO nlip_users (id, username, password_hash, is_admin, need_change_pwd)
+		VALUES (?, ?, ?, ?, ?)
+	`, userID, req.Username, string(hashedPassword), req.IsAdmin, req.NeedChangePwd)
+	if err != nil {
+		logger.Error("创建用户失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "创建用户失败")
+	}
+
+	u, err := getAdminUser(userID)
+	if err != nil {
+		logger.Error("获取用户信息失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取用户信息失败")
+	}
+
+	logger.Info("管理员 %v 创建了用户: username=%s, id=%s, isAdmin=%t", c.Locals("userId"), req.Username, userID, req.IsAdmin)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"code":    fiber.StatusCreated,
+		"message": "创建用户成功",
+		"data": user.AdminUserResponse{
+			User: u,
+		},
+	})
+}
+
+// HandleUpdateUser 修改用户状态
+// @Summary 修改用户状态
+// @Description 设置或取消管理员身份、禁用或启用账号。禁用后账号无法登录，已签发的令牌立即失效。管理员不能修改自己的身份和状态
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param userId path string true "用户ID"
+// @Param request body user.UpdateUserRequest true "用户状态"
+// @Success 200 {object} user.AdminUserResponse "修改成功"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 404 {object} string "用户不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/users/{userId} [put]
+func HandleUpdateUser(c *fiber.Ctx) error {
+	var req user.UpdateUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Warning("解析修改用户请求失败: %v", err)
+		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+	}
+
+	u, err := loadTargetUser(c)
+	if err != nil {
+		return err
+	}
+	if u.ID == c.Locals("userId") {
+		return fiber.NewError(fiber.StatusBadRequest, "不能修改自己的管理员身份或账号状态")
+	}
+
+	isAdmin := u.IsAdmin
+	if req.IsAdmin != nil {
+		isAdmin = *req.IsAdmin
+	}
+	disabled := u.Disabled
+	if req.Disabled != nil {
+		disabled = *req.Disabled
+	}
+
+	// 禁用账号时使已签发的令牌失效
+	validAfter := "tokens_valid_after"
+	args := []interface{}{isAdmin, disabled}
+	if disabled && !u.Disabled {
+		validAfter = "?"
+		args = append(args, time.Now().UnixMilli())
+	}
+	args = append(args, u.ID)
+
+	if _, err := config.DB.Exec(`
+		UPDATE nlip_users SET is_admin = ?, disabled = ?, tokens_valid_after = `+validAfter+`
+		WHERE id = ?
+	`, args...); err != nil {
+		logger.Error("修改用户状态失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "修改用户状态失败")
+	}
+
+	logger.Info("管理员 %v 修改了用户状态: username=%s, isAdmin=%t, disabled=%t", c.Locals("userId"), u.Username, isAdmin, disabled)
+	return respondUser(c, u.ID, "修改用户状态成功")
+}
+
+// HandleResetUserPassword 重置用户密码
+// @Summary 重置用户密码
+// @Description 重置用户密码并要求其下次登录后修改密码，已签发的令牌立即失效。未指定新密码时随机生成并在响应中返回
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param userId path string true "用户ID"
+// @Param request body user.ResetPasswordRequest false "新密码"
+// @Success 200 {object} user.ResetPasswordResponse "重置成功"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 404 {object} string "用户不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/users/{userId}/reset-password [post]
+func HandleResetUserPassword(c *fiber.Ctx) error {
+	var req user.ResetPasswordRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			logger.Warning("解析重置密码请求失败: %v", err)
+			return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+		}
+	}
+
+	password := req.NewPassword
+	generated := password == ""
+	if generated {
+		password = tokenUtils.GenerateSecureToken()[:generatedPasswordLength]
+	} else if len(password) < 6 || len(password) > 50 {
+		return fiber.NewError(fiber.StatusBadRequest, "密码长度必须在6到50之间")
+	}
+
+	u, err := loadTargetUser(c)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Error("生成密码哈希失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "密码加密失败")
+	}
+
+	_, err = config.DB.Exec(`
+		UPDATE nlip_users SET password_hash = ?, need_change_pwd = TRUE, tokens_valid_after = ?
+		WHERE id = ?
+	`, string(hashedPassword), time.Now().UnixMilli(), u.ID)
+	if err != nil {
+		logger.Error("重置用户密码失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "重置密码失败")
+	}
+
+	u, err = getAdminUser(u.ID)
+	if err != nil {
+		logger.Error("获取用户信息失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取用户信息失败")
+	}
+
+	resp := user.ResetPasswordResponse{User: u}
+	if generated {
+		resp.Password = password
+	}
+
+	logger.Info("管理员 %v 重置了用户密码: username=%s", c.Locals("userId"), u.Username)
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "重置密码成功",
+		"data":    resp,
+	})
+}
+
+// HandleResetUserTwoFactor 重置用户的两步验证
+// @Summary 重置用户两步验证
+// @Description 用户丢失身份验证器和恢复码时，关闭其两步验证并删除密钥和恢复码
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param userId path string true "用户ID"
+// @Success 200 {object} user.AdminUserResponse "重置成功"
+// @Failure 400 {object} string "用户未启用两步验证"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 404 {object} string "用户不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/users/{userId}/2fa [delete]
+func HandleResetUserTwoFactor(c *fiber.Ctx) error {
+	u, err := loadTargetUser(c)
+	if err != nil {
+		return err
+	}
+	if !u.TwoFactorEnabled {
+		return fiber.NewError(fiber.StatusBadRequest, "用户未启用两步验证")
+	}
+
+	if err := authHandler.ResetTwoFactor(u.ID); err != nil {
+		logger.Error("重置两步验证失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "重置两步验证失败")
+	}
+
+	logger.Info("管理员 %v 重置了用户 %s 的两步验证", c.Locals("userId"), u.Username)
+	return respondUser(c, u.ID, "重置两步验证成功")
+}
+
+// HandleDeleteUser 删除用户
+// @Summary 删除用户
+// @Description 删除用户及其API Token，并将其从其他空间的协作者中移除。指定 transferTo 时用户拥有的空间转交给该用户，否则删除其私有空间，公共空间转交给当前管理员
+// @Tags 管理
+// @Produce json
+// @Security BearerAuth
+// @Param userId path string true "用户ID"
+// @Param transferTo query string false "接收空间的用户ID"
+// @Success 200 {object} user.DeleteUserResponse "删除成功"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 403 {object} string "需要管理员权限"
+// @Failure 404 {object} string "用户不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/admin/users/{userId} [delete]
+func HandleDeleteUser(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("userId").(string)
+	u, err := loadTargetUser(c)
+	if err != nil {
+		return err
+	}
+	if u.ID == adminID {
+		return fiber.NewError(fiber.StatusBadRequest, "不能删除自己")
+	}
+
+	transferTo := c.Query("transferTo")
+	if transferTo == u.ID {
+		return fiber.NewError(fiber.StatusBadRequest, "不能将空间转交给被删除的用户")
+	}
+	if transferTo != "" {
+		if _, err := getAdminUser(transferTo); err == sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusBadRequest, "接收空间的用户不存在")
+		} else if err != nil {
+			logger.Error("获取用户信息失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "获取用户信息失败")
+		}
+	}
+
+	var resp user.DeleteUserResponse
+	var filePaths []string
+	err = db.WithTransaction(config.DB, func(tx *sql.Tx) error {
+		// 未指定接收用户时删除私有空间，公共空间仍由管理员维护
+		if transferTo == "" {
+			rows, err := tx.Query("SELECT id FROM nlip_spaces WHERE owner_id = ? AND type = 'private'", u.ID)
+			if err != nil {
+				return err
+			}
+			var spaceIDs []string
+			for rows.Next() {
+				var spaceID string
+				if err := rows.Scan(&spaceID); err != nil {
+					rows.Close()
+					return err
+				}
+				spaceIDs = append(spaceIDs, spaceID)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			for _, spaceID := range spaceIDs {
+				paths, err := spaces.DeleteSpaceData(tx, spaceID)
+				if err != nil {
+					return err
+				}
+				filePaths = append(filePaths, paths...)
+			}
+			resp.DeletedSpaces = len(spaceIDs)
+		}
+
+		newOwner := transferTo
+		if newOwner == "" {
+			newOwner = adminID
+		}
+		// 新所有者不再需要作为协作者出现在转交的空间中
+		if _, err := db.ExecTx(tx, `
+			UPDATE nlip_spaces SET collaborators = json_remove(collaborators, '$."' || ? || '"')
+			WHERE owner_id = ? AND json_valid(collaborators) AND json_type(collaborators, '$."' || ? || '"') IS NOT NULL
+		`, newOwner, u.ID, newOwner); err != nil {
+			return err
+		}
+		result, err := db.ExecTx(tx, "UPDATE nlip_spaces SET owner_id = ? WHERE owner_id = ?", newOwner, u.ID)
+		if err != nil {
+			return err
+		}
+		transferred, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		resp.TransferredSpaces = int(transferred)
+
+		stmts := []string{
+			// 将用户从其他空间的协作者中移除
+			`UPDATE nlip_spaces SET collaborators = json_remove(collaborators, '$."' || ?1 || '"')
+			WHERE json_valid(collaborators) AND json_type(collaborators, '$."' || ?1 || '"') IS NOT NULL`,
+			"DELETE FROM nlip_invites WHERE created_by = ? AND used_at IS NULL",
+			// 删除用户创建的分享链接及访问记录
+			`DELETE FROM nlip_share_access_logs WHERE share_id IN (
+				SELECT id FROM nlip_share_links WHERE created_by = ?
+			)`,
+			"DELETE FROM nlip_share_links WHERE created_by = ?",
+			"DELETE FROM nlip_tokens WHERE user_id = ?",
+			"DELETE FROM nlip_security_events WHERE user_id = ?",
+			"DELETE FROM nlip_recovery_codes WHERE user_id = ?",
+			"DELETE FROM nlip_webauthn_credentials WHERE user_id = ?",
+			"DELETE FROM nlip_users WHERE id = ?",
+		}
+		for _, stmt := range stmts {
+			if _, err := db.ExecTx(tx, stmt, u.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("删除用户失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "删除用户失败")
+	}
+
+	for _, filePath := range filePaths {
+		if err := storage.DeleteFile(filePath); err != nil {
+			logger.Warning("删除空间文件失败: %v", err)
+		}
+	}
+
+	logger.Info("管理员 %s 删除了用户: username=%s, 转交空间 %d 个, 删除空间 %d 个",
+		adminID, u.Username, resp.TransferredSpaces, resp.DeletedSpaces)
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "删除用户成功",
+		"data":    resp,
+	})
+}
@@ -2,27 +2,60 @@ package auth
 
 import (
 	"database/sql"
+	"fmt"
+	"math"
 	"nlip/config"
 	"nlip/models/token"
 	"nlip/models/user"
+	"nlip/utils/clientip"
 	"nlip/utils/jwt"
+	lockoutUtils "nlip/utils/lockout"
 	"nlip/utils/logger"
+	"nlip/utils/quota"
+	"nlip/utils/totp"
+	"strconv"
 	"time"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// checkLockout 账号或客户端IP因登录失败次数过多被锁定时拒绝登录
+func checkLockout(c *fiber.Ctx, username string) error {
+	ip := clientip.IP(c)
+	wait, err := lockoutUtils.Check(username, ip)
+	if err != nil {
+		logger.Error("查询登录锁定状态失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "查询登录状态失败")
+	}
+	if wait <= 0 {
+		return nil
+	}
+	logger.Warning("登录已被临时锁定: username=%s, ip=%s, remaining=%s", username, ip, wait)
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	minutes := int(math.Ceil(wait.Minutes()))
+	return fiber.NewError(fiber.StatusLocked, fmt.Sprintf("登录失败次数过多，已被临时锁定，请在%d分钟后重试", minutes))
+}
+
+// recordLoginFailure 记录登录失败，userID 为空表示用户名不存在
+func recordLoginFailure(c *fiber.Ctx, username, userID string) {
+	if _, err := lockoutUtils.RecordFailure(username, userID, clientip.IP(c)); err != nil {
+		logger.Error("记录登录失败次数失败: %v", err)
+	}
+}
+
 // HandleLogin 处理登录请求
 // @Summary 用户登录
-// @Description 使用用户名和密码进行登录
+// @Description 使用用户名和密码进行登录，已启用两步验证的用户返回挑战令牌，需要再调用 /auth/2fa/verify 提交验证码
 // @Tags 认证
 // @Accept json
 // @Produce json
 // @Param request body user.LoginRequest true "登录请求参数"
 // @Success 200 {object} user.AuthResponse "登录成功"
+// @Success 200 {object} user.TwoFactorChallengeResponse "需要两步验证"
 // @Failure 400 {object} string "请求参数错误"
 // @Failure 401 {object} string "用户名或密码错误"
+// @Failure 423 {object} string "登录失败次数过多，已被临时锁定"
 // @Failure 500 {object} string "服务器内部错误"
 // @Router /api/v1/nlip/auth/login [post]
 func HandleLogin(c *fiber.Ctx) error {
@@ -34,39 +67,80 @@ func HandleLogin(c *fiber.Ctx) error {
 
 	logger.Debug("处理登录请求: username=%s", req.Username)
 
+	if err := checkLockout(c, req.Username); err != nil {
+		return err
+	}
+
 	// 查找用户
 	var u user.User
 	err := config.DB.QueryRow(
-		"SELECT id, username, password_hash, is_admin, created_at, need_change_pwd FROM nlip_users WHERE username = ?",
+		"SELECT id, username, password_hash, is_admin, created_at, need_change_pwd, disabled, totp_enabled FROM nlip_users WHERE username = ?",
 		req.Username,
-	).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.IsAdmin, &u.CreatedAt, &u.NeedChangePwd)
+	).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.IsAdmin, &u.CreatedAt, &u.NeedChangePwd, &u.Disabled, &u.TwoFactorEnabled)
 
 	if err != nil {
 		logger.Warning("用户名不存在: %s", req.Username)
+		recordLoginFailure(c, req.Username, "")
 		return fiber.NewError(fiber.StatusUnauthorized, "用户名不存在")
 	}
 
 	// 验证密码
 	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)); err != nil {
 		logger.Warning("密码验证失败: username=%s", req.Username)
+		recordLoginFailure(c, req.Username, u.ID)
 		return fiber.NewError(fiber.StatusForbidden, "用户名或密码错误")
 	}
 
-	// 生成令牌
-	token, err := jwt.GenerateToken(&u)
+	if u.Disabled {
+		logger.Warning("已禁用账号尝试登录: username=%s", req.Username)
+		return fiber.NewError(fiber.StatusForbidden, "账号已被禁用")
+	}
+
+	// 已启用两步验证时先返回挑战令牌，提交验证码后才签发登录令牌
+	if u.TwoFactorEnabled {
+		challenge, err := jwt.GenerateChallenge(u.ID)
+		if err != nil {
+			logger.Error("生成两步验证挑战令牌失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "生成令牌失败")
+		}
+		logger.Info("密码验证通过，等待两步验证: username=%s", u.Username)
+		return c.JSON(fiber.Map{
+			"code":    fiber.StatusOK,
+			"message": "请输入两步验证码",
+			"data": user.TwoFactorChallengeResponse{
+				TwoFactorRequired: true,
+				ChallengeToken:    challenge,
+				ExpiresIn:         int(jwt.ChallengeExpiry.Seconds()),
+			},
+		})
+	}
+
+	return completeLogin(c, &u)
+}
+
+// completeLogin 签发登录令牌，清除登录失败记录并返回未读的安全提醒
+func completeLogin(c *fiber.Ctx, u *user.User) error {
+	token, err := jwt.GenerateToken(u)
 	if err != nil {
 		logger.Error("生成令牌失败: %v", err)
 		return fiber.NewError(fiber.StatusInternalServerError, "生成令牌失败")
 	}
 
+	notices, err := lockoutUtils.RecordSuccess(u.Username, u.ID, clientip.IP(c))
+	if err != nil {
+		logger.Error("清除登录失败记录失败: %v", err)
+	}
+
 	logger.Info("用户登录成功: username=%s, id=%s, needChangePwd=%t", u.Username, u.ID, u.NeedChangePwd)
 	return c.JSON(fiber.Map{
 		"code":    fiber.StatusOK,
 		"message": "登录成功",
 		"data": user.AuthResponse{
-			Token:         token,
-			User:          &u,
-			NeedChangePwd: u.NeedChangePwd,
+			Token:                  token,
+			User:                   u,
+			NeedChangePwd:          u.NeedChangePwd,
+			SecurityNotices:        notices,
+			TwoFactorSetupRequired: !u.TwoFactorEnabled && totp.Required(u.IsAdmin),
 		},
 	})
 }
@@ -149,7 +223,7 @@ func HandleRegister(c *fiber.Ctx) error {
 
 // HandleGetCurrentUser 获取当前登录用户信息
 // @Summary 获取当前用户信息
-// @Description 获取当前登录用户的基本信息
+// @Description 获取当前登录用户的基本信息和存储用量
 // @Tags 认证
 // @Accept json
 // @Produce json
@@ -159,9 +233,9 @@ func HandleRegister(c *fiber.Ctx) error {
 // @Failure 500 {object} string "服务器内部错误"
 // @Router /api/v1/nlip/auth/me [get]
 func HandleGetCurrentUser(c *fiber.Ctx) error {
-	// 从context中获取用户信息
-	userRaw := c.Locals("user")
-	if userRaw == nil {
+	// 从context中获取认证中间件设置的用户信息
+	userID, _ := c.Locals("userId").(string)
+	if userID == "" {
 		logger.Warning("获取当前用户失败：用户未登录")
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"code":    fiber.StatusUnauthorized,
@@ -169,25 +243,24 @@ func HandleGetCurrentUser(c *fiber.Ctx) error {
 			"data":    nil,
 		})
 	}
+	username, _ := c.Locals("username").(string)
+	isAdmin, _ := c.Locals("isAdmin").(bool)
 
-	user, ok := userRaw.(*jwt.UserClaims)
-	if !ok {
-		logger.Error("获取当前用户失败：用户信息格式错误")
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"code":    fiber.StatusInternalServerError,
-			"message": "用户信息格式错误",
-			"data":    nil,
-		})
+	usage, err := quota.UserUsage(userID)
+	if err != nil {
+		logger.Error("获取用户存储用量失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取用户存储用量失败")
 	}
 
-	logger.Info("成功获取当前用户信息: userId=%s, username=%s", user.UserID, user.Username)
+	logger.Info("成功获取当前用户信息: userId=%s, username=%s", userID, username)
 	return c.JSON(fiber.Map{
 		"code":    fiber.StatusOK,
 		"message": "获取用户信息成功",
-		"data": fiber.Map{
-			"id":       user.UserID,
-			"username": user.Username,
-			"isAdmin":  user.IsAdmin,
+		"data": user.GetCurrentUserResponse{
+			ID:       userID,
+			Username: username,
+			IsAdmin:  isAdmin,
+			Storage:  usage,
 		},
 	})
 }
@@ -270,6 +343,7 @@ func HandleChangePassword(c *fiber.Ctx) error {
 // @Success 200 {object} token.TokenLoginResponse "登录成功"
 // @Failure 400 {object} string "请求参数错误"
 // @Failure 401 {object} string "Token无效或已过期"
+// @Failure 423 {object} string "登录失败次数过多，已被临时锁定"
 // @Failure 500 {object} string "服务器内部错误"
 // @Router /api/v1/nlip/auth/token-login [post]
 func HandleTokenLogin(c *fiber.Ctx) error {
@@ -279,26 +353,38 @@ func HandleTokenLogin(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
 	}
 
+	if err := checkLockout(c, req.Username); err != nil {
+		return err
+	}
+
 	var tokenID string
 	var u user.User
 	err := config.DB.QueryRow(`
-		SELECT t.id, u.id, u.username, u.password_hash, u.is_admin, u.created_at, u.need_change_pwd FROM nlip_tokens t
+		SELECT t.id, u.id, u.username, u.password_hash, u.is_admin, u.created_at, u.need_change_pwd, u.disabled FROM nlip_tokens t
 		JOIN nlip_users u ON t.user_id = u.id
 		WHERE u.username = ? AND t.token = ? 
 		AND (t.expires_at IS NULL OR t.expires_at > strftime('%s', 'now'))
 	`, req.Username, req.Token).Scan(
-		&tokenID, &u.ID, &u.Username, &u.PasswordHash, &u.IsAdmin, &u.CreatedAt, &u.NeedChangePwd,
+		&tokenID, &u.ID, &u.Username, &u.PasswordHash, &u.IsAdmin, &u.CreatedAt, &u.NeedChangePwd, &u.Disabled,
 	)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
 			logger.Warning("Token不存在或已过期: username=%s, token=%s", req.Username, req.Token)
+			var userID string
+			config.DB.QueryRow("SELECT id FROM nlip_users WHERE username = ?", req.Username).Scan(&userID)
+			recordLoginFailure(c, req.Username, userID)
 			return fiber.NewError(fiber.StatusUnauthorized, "Token不存在或已过期")
 		}
 		logger.Error("登录失败: %v", err)
 		return fiber.NewError(fiber.StatusUnauthorized, "登录失败")
 	}
 
+	if u.Disabled {
+		logger.Warning("已禁用账号尝试使用Token登录: username=%s", req.Username)
+		return fiber.NewError(fiber.StatusForbidden, "账号已被禁用")
+	}
+
 	// 更新最后使用时间
 	_, err = config.DB.Exec("UPDATE nlip_tokens SET last_used_at = ? WHERE id = ?", time.Now(), tokenID)
 	if err != nil {
@@ -311,12 +397,18 @@ func HandleTokenLogin(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "生成JWT失败")
 	}
 
+	notices, err := lockoutUtils.RecordSuccess(u.Username, u.ID, clientip.IP(c))
+	if err != nil {
+		logger.Error("清除登录失败记录失败: %v", err)
+	}
+
 	return c.JSON(fiber.Map{
 		"code":    fiber.StatusOK,
 		"message": "登录成功",
 		"data": token.TokenLoginResponse{
-			JWTToken: jwtToken,
-			User:     &u,
+			JWTToken:        jwtToken,
+			User:            &u,
+			SecurityNotices: notices,
 		},
 	})
 }
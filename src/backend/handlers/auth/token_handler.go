@@ -42,7 +42,7 @@ func HandleCreateToken(c *fiber.Ctx) error {
 	}
 
 	// 检查是否超过最大限制
-	if tokenCount >= config.AppConfig.Token.MaxItems {
+	if tokenCount >= config.Get().Token.MaxItems {
 		return fiber.NewError(fiber.StatusBadRequest, "已达到最大token数量限制")
 	}
 
@@ -157,7 +157,7 @@ func HandleListTokens(c *fiber.Ctx) error {
 		"message": "获取token列表成功",
 		"data": token.ListTokensResponse{
 			Tokens: tokens,
-			MaxItems: config.AppConfig.Token.MaxItems,
+			MaxItems: config.Get().Token.MaxItems,
 		},
 	})
 }
@@ -0,0 +1,438 @@
+package auth
+
+import (
+	"database/sql"
+	"nlip/config"
+	"nlip/models/user"
+	"nlip/utils/db"
+	"nlip/utils/jwt"
+	"nlip/utils/logger"
+	"nlip/utils/totp"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// verifySecondFactor 校验验证码或恢复码
+// 验证码通过后记录时间窗口，恢复码通过后标记为已使用，两者都只能使用一次
+func verifySecondFactor(userID, code string) (bool, error) {
+	if totp.IsRecoveryCode(code) {
+		result, err := config.DB.Exec(`
+			UPDATE nlip_recovery_codes SET used_at = ?
+			WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+		`, time.Now(), userID, totp.HashRecoveryCode(code))
+		if err != nil {
+			return false, err
+		}
+		n, err := result.RowsAffected()
+		if err == nil && n > 0 {
+			logger.Info("用户使用恢复码完成两步验证: userId=%s", userID)
+		}
+		return n > 0, err
+	}
+
+	var secret sql.NullString
+	var lastStep int64
+	err := config.DB.QueryRow(
+		"SELECT totp_secret, totp_last_step FROM nlip_users WHERE id = ?", userID,
+	).Scan(&secret, &lastStep)
+	if err != nil {
+		return false, err
+	}
+	if !secret.Valid {
+		return false, nil
+	}
+	step, ok := totp.Validate(secret.String, code, time.Now())
+	if !ok || step <= lastStep {
+		return false, nil
+	}
+
+	// 并发提交同一个验证码时只有一个请求能更新时间窗口
+	result, err := config.DB.Exec(
+		"UPDATE nlip_users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?",
+		step, userID, step,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// replaceRecoveryCodes 生成新的恢复码并使之前的恢复码全部失效
+func replaceRecoveryCodes(tx *sql.Tx, userID string) ([]string, error) {
+	codes, err := totp.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM nlip_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, code := range codes {
+		_, err := tx.Exec(
+			"INSERT INTO nlip_recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)",
+			userID, totp.HashRecoveryCode(code), now,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// HandleGetTwoFactorStatus 获取两步验证状态
+// @Summary 获取两步验证状态
+// @Description 获取当前用户是否已启用两步验证、服务器是否要求启用以及剩余的恢复码数量
+// @Tags 认证
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} user.TwoFactorStatus "获取成功"
+// @Failure 401 {object} string "未授权"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/auth/2fa [get]
+func HandleGetTwoFactorStatus(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+	isAdmin, _ := c.Locals("isAdmin").(bool)
+
+	status := user.TwoFactorStatus{Required: totp.Required(isAdmin)}
+	err := config.DB.QueryRow(`
+		SELECT u.totp_enabled,
+			(SELECT COUNT(*) FROM nlip_recovery_codes r WHERE r.user_id = u.id AND r.used_at IS NULL)
+		FROM nlip_users u WHERE u.id = ?
+	`, userID).Scan(&status.Enabled, &status.RecoveryCodesLeft)
+	if err != nil {
+		logger.Error("获取两步验证状态失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取两步验证状态失败")
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取两步验证状态成功",
+		"data":    status,
+	})
+}
+
+// HandleSetupTwoFactor 生成两步验证密钥
+// @Summary 生成两步验证密钥
+// @Description 生成新的密钥和 otpauth:// 地址，使用验证码确认后才会启用，重复调用会替换未确认的密钥
+// @Tags 认证
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} user.TwoFactorSetupResponse "生成成功"
+// @Failure 401 {object} string "未授权"
+// @Failure 409 {object} string "已启用两步验证"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/auth/2fa/setup [post]
+func HandleSetupTwoFactor(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+	username, _ := c.Locals("username").(string)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		logger.Error("生成两步验证密钥失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "生成两步验证密钥失败")
+	}
+
+	result, err := config.DB.Exec(`
+		UPDATE nlip_users SET totp_secret = ?, totp_last_step = 0
+		WHERE id = ? AND totp_enabled = FALSE
+	`, secret, userID)
+	if err != nil {
+		logger.Error("保存两步验证密钥失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "生成两步验证密钥失败")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusConflict, "已启用两步验证，请先关闭后再重新设置")
+	}
+
+	logger.Info("用户生成两步验证密钥: userId=%s", userID)
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "请使用身份验证器应用扫描二维码，并输入验证码完成设置",
+		"data": user.TwoFactorSetupResponse{
+			Secret: secret,
+			URI:    totp.URI(config.Get().TwoFactor.Issuer, username, secret),
+		},
+	})
+}
+
+// HandleEnableTwoFactor 启用两步验证
+// @Summary 启用两步验证
+// @Description 使用身份验证器应用中的验证码确认密钥并启用两步验证，返回的恢复码只显示一次
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body user.TwoFactorCodeRequest true "验证码"
+// @Success 200 {object} user.RecoveryCodesResponse "启用成功"
+// @Failure 400 {object} string "验证码错误或未生成密钥"
+// @Failure 401 {object} string "未授权"
+// @Failure 409 {object} string "已启用两步验证"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/auth/2fa/enable [post]
+func HandleEnableTwoFactor(c *fiber.Ctx) error {
+	var req user.TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Warning("解析启用两步验证请求失败: %v", err)
+		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+	}
+
+	userID := c.Locals("userId").(string)
+
+	var secret sql.NullString
+	var enabled bool
+	err := config.DB.QueryRow(
+		"SELECT totp_secret, totp_enabled FROM nlip_users WHERE id = ?", userID,
+	).Scan(&secret, &enabled)
+	if err != nil {
+		logger.Error("获取两步验证密钥失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "启用两步验证失败")
+	}
+	if enabled {
+		return fiber.NewError(fiber.StatusConflict, "已启用两步验证")
+	}
+	if !secret.Valid {
+		return fiber.NewError(fiber.StatusBadRequest, "请先生成两步验证密钥")
+	}
+
+	step, ok := totp.Validate(secret.String, req.Code, time.Now())
+	if !ok {
+		logger.Warning("启用两步验证时验证码错误: userId=%s", userID)
+		return fiber.NewError(fiber.StatusBadRequest, "验证码错误")
+	}
+
+	var codes []string
+	err = db.WithTransaction(config.DB, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			"UPDATE nlip_users SET totp_enabled = TRUE, totp_last_step = ? WHERE id = ?",
+			step, userID,
+		)
+		if err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		logger.Error("启用两步验证失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "启用两步验证失败")
+	}
+
+	logger.Info("用户启用两步验证: userId=%s", userID)
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "两步验证已启用，请妥善保存恢复码",
+		"data": user.RecoveryCodesResponse{
+			RecoveryCodes: codes,
+		},
+	})
+}
+
+// HandleDisableTwoFactor 关闭两步验证
+// @Summary 关闭两步验证
+// @Description 验证密码和验证码（或恢复码）后关闭两步验证，服务器要求启用时不能关闭
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body user.TwoFactorDisableRequest true "密码和验证码"
+// @Success 200 {object} string "关闭成功"
+// @Failure 400 {object} string "验证码错误或未启用两步验证"
+// @Failure 401 {object} string "未授权"
+// @Failure 403 {object} string "密码错误或服务器要求启用两步验证"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/auth/2fa/disable [post]
+func HandleDisableTwoFactor(c *fiber.Ctx) error {
+	var req user.TwoFactorDisableRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Warning("解析关闭两步验证请求失败: %v", err)
+		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+	}
+
+	userID := c.Locals("userId").(string)
+	isAdmin, _ := c.Locals("isAdmin").(bool)
+	if totp.Required(isAdmin) {
+		return fiber.NewError(fiber.StatusForbidden, "服务器要求启用两步验证，无法关闭")
+	}
+
+	var passwordHash string
+	var enabled bool
+	err := config.DB.QueryRow(
+		"SELECT password_hash, totp_enabled FROM nlip_users WHERE id = ?", userID,
+	).Scan(&passwordHash, &enabled)
+	if err != nil {
+		logger.Error("获取用户信息失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取用户信息失败")
+	}
+	if !enabled {
+		return fiber.NewError(fiber.StatusBadRequest, "未启用两步验证")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+		logger.Warning("关闭两步验证时密码错误: userId=%s", userID)
+		return fiber.NewError(fiber.StatusForbidden, "密码错误")
+	}
+
+	ok, err := verifySecondFactor(userID, req.Code)
+	if err != nil {
+		logger.Error("校验验证码失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "校验验证码失败")
+	}
+	if !ok {
+		logger.Warning("关闭两步验证时验证码错误: userId=%s", userID)
+		return fiber.NewError(fiber.StatusBadRequest, "验证码错误")
+	}
+
+	if err := ResetTwoFactor(userID); err != nil {
+		logger.Error("关闭两步验证失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "关闭两步验证失败")
+	}
+
+	logger.Info("用户关闭两步验证: userId=%s", userID)
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "两步验证已关闭",
+		"data":    nil,
+	})
+}
+
+// HandleRegenerateRecoveryCodes 重新生成恢复码
+// @Summary 重新生成恢复码
+// @Description 验证验证码后生成新的恢复码，之前的恢复码全部失效
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body user.TwoFactorCodeRequest true "验证码"
+// @Success 200 {object} user.RecoveryCodesResponse "生成成功"
+// @Failure 400 {object} string "验证码错误或未启用两步验证"
+// @Failure 401 {object} string "未授权"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/auth/2fa/recovery-codes [post]
+func HandleRegenerateRecoveryCodes(c *fiber.Ctx) error {
+	var req user.TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Warning("解析生成恢复码请求失败: %v", err)
+		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+	}
+
+	userID := c.Locals("userId").(string)
+
+	var enabled bool
+	if err := config.DB.QueryRow("SELECT totp_enabled FROM nlip_users WHERE id = ?", userID).Scan(&enabled); err != nil {
+		logger.Error("获取两步验证状态失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取两步验证状态失败")
+	}
+	if !enabled {
+		return fiber.NewError(fiber.StatusBadRequest, "未启用两步验证")
+	}
+
+	ok, err := verifySecondFactor(userID, req.Code)
+	if err != nil {
+		logger.Error("校验验证码失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "校验验证码失败")
+	}
+	if !ok {
+		logger.Warning("生成恢复码时验证码错误: userId=%s", userID)
+		return fiber.NewError(fiber.StatusBadRequest, "验证码错误")
+	}
+
+	var codes []string
+	err = db.WithTransaction(config.DB, func(tx *sql.Tx) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		logger.Error("生成恢复码失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "生成恢复码失败")
+	}
+
+	logger.Info("用户重新生成恢复码: userId=%s", userID)
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "恢复码已重新生成，请妥善保存",
+		"data": user.RecoveryCodesResponse{
+			RecoveryCodes: codes,
+		},
+	})
+}
+
+// HandleVerifyTwoFactor 提交两步验证码完成登录
+// @Summary 两步验证登录
+// @Description 使用登录时返回的挑战令牌和验证码（或恢复码）换取登录令牌
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body user.TwoFactorVerifyRequest true "挑战令牌和验证码"
+// @Success 200 {object} user.AuthResponse "登录成功"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 401 {object} string "挑战令牌无效或验证码错误"
+// @Failure 403 {object} string "账号已被禁用"
+// @Failure 423 {object} string "登录失败次数过多，已被临时锁定"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/auth/2fa/verify [post]
+func HandleVerifyTwoFactor(c *fiber.Ctx) error {
+	var req user.TwoFactorVerifyRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Warning("解析两步验证请求失败: %v", err)
+		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+	}
+
+	userID, err := jwt.ValidateChallenge(req.ChallengeToken)
+	if err != nil {
+		logger.Warning("无效的两步验证挑战令牌")
+		return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+	}
+
+	var u user.User
+	err = config.DB.QueryRow(`
+		SELECT id, username, is_admin, created_at, need_change_pwd, disabled, totp_enabled
+		FROM nlip_users WHERE id = ?
+	`, userID).Scan(&u.ID, &u.Username, &u.IsAdmin, &u.CreatedAt, &u.NeedChangePwd, &u.Disabled, &u.TwoFactorEnabled)
+	if err == sql.ErrNoRows || (err == nil && !u.TwoFactorEnabled) {
+		// 用户已被删除或两步验证已被重置，需要重新登录
+		return fiber.NewError(fiber.StatusUnauthorized, jwt.ErrInvalidChallenge.Error())
+	} else if err != nil {
+		logger.Error("获取用户信息失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取用户信息失败")
+	}
+
+	if err := checkLockout(c, u.Username); err != nil {
+		return err
+	}
+
+	ok, err := verifySecondFactor(u.ID, req.Code)
+	if err != nil {
+		logger.Error("校验验证码失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "校验验证码失败")
+	}
+	if !ok {
+		logger.Warning("两步验证码错误: username=%s", u.Username)
+		recordLoginFailure(c, u.Username, u.ID)
+		return fiber.NewError(fiber.StatusUnauthorized, "验证码错误")
+	}
+
+	if u.Disabled {
+		logger.Warning("已禁用账号尝试登录: username=%s", u.Username)
+		return fiber.NewError(fiber.StatusForbidden, "账号已被禁用")
+	}
+
+	return completeLogin(c, &u)
+}
+
+// ResetTwoFactor 关闭用户的两步验证并删除密钥和恢复码，管理员重置两步验证时也会调用
+func ResetTwoFactor(userID string) error {
+	return db.WithTransaction(config.DB, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			UPDATE nlip_users SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0
+			WHERE id = ?
+		`, userID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM nlip_recovery_codes WHERE user_id = ?", userID)
+		return err
+	})
+}
@@ -0,0 +1,367 @@
+package auth_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"nlip/config"
+	"nlip/middleware"
+	"nlip/middleware/limiter"
+	"nlip/routes"
+	"nlip/utils/clientip"
+	"nlip/utils/testutil"
+	"nlip/utils/totp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	jwtv4 "github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "correct-horse"
+
+// setupTwoFactor 初始化测试环境，关闭访问频率限制和登录锁定，避免影响验证码校验结果
+func setupTwoFactor(t *testing.T) *fiber.App {
+	t.Helper()
+	t.Setenv("NLIP_RATE_LIMIT_ENABLED", "false")
+	t.Setenv("NLIP_LOGIN_LOCKOUT_ENABLED", "false")
+	testutil.Setup(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.CustomErrorHandler})
+	clientip.ApplyConfig(nil, config.Get())
+	app.Use(limiter.New())
+	routes.SetupRoutes(app.Group("/api"))
+	return app
+}
+
+// createUser 创建可以用密码登录的测试用户
+func createUser(t *testing.T, username string, isAdmin bool) string {
+	t.Helper()
+	id := testutil.CreateUser(t, username, isAdmin)
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("生成密码哈希失败: %v", err)
+	}
+	if _, err := config.DB.Exec("UPDATE nlip_users SET password_hash = ? WHERE id = ?", string(hash), id); err != nil {
+		t.Fatalf("设置密码失败: %v", err)
+	}
+	return id
+}
+
+// enableTOTP 直接为用户启用两步验证，返回密钥
+func enableTOTP(t *testing.T, userID string) string {
+	t.Helper()
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	_, err = config.DB.Exec(`
+		UPDATE nlip_users SET totp_secret = ?, totp_enabled = TRUE, totp_last_step = 0 WHERE id = ?
+	`, secret, userID)
+	if err != nil {
+		t.Fatalf("启用两步验证失败: %v", err)
+	}
+	return secret
+}
+
+// totpCode 按 RFC 6238 计算指定时间窗口的验证码，与身份验证器应用的计算方式相同
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("解析密钥失败: %v", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// currentStep 返回当前的时间窗口序号，临近窗口切换时等到下一个窗口，避免请求期间窗口变化
+func currentStep() int64 {
+	now := time.Now()
+	if now.Unix()%30 >= 28 {
+		time.Sleep(time.Duration(30-now.Unix()%30) * time.Second)
+	}
+	return time.Now().Unix() / 30
+}
+
+// call 发送 JSON 请求，返回状态码和响应中的 data
+func call(t *testing.T, app *fiber.App, method, path, authorization string, body interface{}) (int, json.RawMessage) {
+	t.Helper()
+	var reader *strings.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = strings.NewReader(string(data))
+	} else {
+		reader = strings.NewReader("")
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data json.RawMessage `json:"data"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result.Data
+}
+
+// login 使用密码登录，返回两步验证的挑战令牌
+func login(t *testing.T, app *fiber.App, username string) string {
+	t.Helper()
+	status, data := call(t, app, "POST", "/api/v1/nlip/auth/login", "",
+		map[string]string{"username": username, "password": testPassword})
+	var challenge struct {
+		TwoFactorRequired bool   `json:"twoFactorRequired"`
+		ChallengeToken    string `json:"challengeToken"`
+	}
+	if err := json.Unmarshal(data, &challenge); err != nil || status != http.StatusOK || !challenge.TwoFactorRequired {
+		t.Fatalf("登录返回 %d，期望需要两步验证: %s", status, data)
+	}
+	return challenge.ChallengeToken
+}
+
+// verify 提交两步验证码，返回状态码和登录令牌
+func verify(t *testing.T, app *fiber.App, challenge, code string) (int, string) {
+	t.Helper()
+	status, data := call(t, app, "POST", "/api/v1/nlip/auth/2fa/verify", "",
+		map[string]string{"challengeToken": challenge, "code": code})
+	var auth struct {
+		Token string `json:"token"`
+	}
+	_ = json.Unmarshal(data, &auth)
+	return status, auth.Token
+}
+
+// TestVerifyTwoFactorTimeWindow 只接受前后各一个时间窗口内的验证码，同一时间窗口及更早的验证码不能再次使用
+func TestVerifyTwoFactorTimeWindow(t *testing.T) {
+	app := setupTwoFactor(t)
+	userID := createUser(t, "alice", false)
+	secret := enableTOTP(t, userID)
+	challenge := login(t, app, "alice")
+	step := currentStep()
+
+	tests := []struct {
+		name string
+		step int64
+		want int
+	}{
+		{"早两个时间窗口", step - 2, http.StatusUnauthorized},
+		{"晚两个时间窗口", step + 2, http.StatusUnauthorized},
+		{"早一个时间窗口", step - 1, http.StatusOK},
+		{"重复使用同一个验证码", step - 1, http.StatusUnauthorized},
+		{"当前时间窗口", step, http.StatusOK},
+		{"比已使用的时间窗口更早", step - 1, http.StatusUnauthorized},
+		{"当前时间窗口再次使用", step, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		status, token := verify(t, app, challenge, totpCode(t, secret, tt.step))
+		if status != tt.want {
+			t.Fatalf("%s: 返回 %d，期望 %d", tt.name, status, tt.want)
+		}
+		if status == http.StatusOK && token == "" {
+			t.Fatalf("%s: 验证通过后应返回登录令牌", tt.name)
+		}
+	}
+
+	var lastStep int64
+	if err := config.DB.QueryRow("SELECT totp_last_step FROM nlip_users WHERE id = ?", userID).Scan(&lastStep); err != nil {
+		t.Fatalf("查询时间窗口失败: %v", err)
+	}
+	if lastStep != step {
+		t.Errorf("记录的时间窗口为 %d，期望 %d", lastStep, step)
+	}
+}
+
+// TestRecoveryCodesSingleUse 恢复码只保存哈希，每个恢复码只能使用一次
+func TestRecoveryCodesSingleUse(t *testing.T) {
+	app := setupTwoFactor(t)
+	userID := createUser(t, "alice", false)
+	token := testutil.Token(t, userID, "alice", false)
+
+	status, data := call(t, app, "POST", "/api/v1/nlip/auth/2fa/setup", token, nil)
+	var setup struct {
+		Secret string `json:"secret"`
+	}
+	if err := json.Unmarshal(data, &setup); err != nil || status != http.StatusOK {
+		t.Fatalf("生成密钥返回 %d: %s", status, data)
+	}
+	status, data = call(t, app, "POST", "/api/v1/nlip/auth/2fa/enable", token,
+		map[string]string{"code": totpCode(t, setup.Secret, currentStep())})
+	var enabled struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	if err := json.Unmarshal(data, &enabled); err != nil || status != http.StatusOK || len(enabled.RecoveryCodes) < 2 {
+		t.Fatalf("启用两步验证返回 %d: %s", status, data)
+	}
+	codes := enabled.RecoveryCodes
+
+	// 数据库中只保存哈希
+	var stored int
+	err := config.DB.QueryRow(`
+		SELECT COUNT(*) FROM nlip_recovery_codes WHERE user_id = ? AND (code_hash = ? OR code_hash = ?)
+	`, userID, codes[0], strings.ReplaceAll(codes[0], "-", "")).Scan(&stored)
+	if err != nil || stored != 0 {
+		t.Fatalf("数据库中不应保存恢复码明文: count=%d, err=%v", stored, err)
+	}
+
+	challenge := login(t, app, "alice")
+	if status, _ := verify(t, app, challenge, codes[0]); status != http.StatusOK {
+		t.Fatalf("使用恢复码返回 %d，期望 200", status)
+	}
+	if status, _ := verify(t, app, challenge, codes[0]); status != http.StatusUnauthorized {
+		t.Fatalf("重复使用恢复码返回 %d，期望 401", status)
+	}
+	// 输入时忽略大小写、空格和连字符
+	variant := strings.ToUpper(strings.ReplaceAll(codes[1], "-", " "))
+	if status, _ := verify(t, app, challenge, variant); status != http.StatusOK {
+		t.Fatalf("使用大写并以空格分隔的恢复码返回 %d，期望 200", status)
+	}
+	if status, _ := verify(t, app, challenge, codes[1]); status != http.StatusUnauthorized {
+		t.Fatalf("重复使用恢复码返回 %d，期望 401", status)
+	}
+
+	status, data = call(t, app, "GET", "/api/v1/nlip/auth/2fa", token, nil)
+	var st struct {
+		RecoveryCodesLeft int `json:"recoveryCodesLeft"`
+	}
+	if err := json.Unmarshal(data, &st); err != nil || status != http.StatusOK {
+		t.Fatalf("获取两步验证状态返回 %d: %s", status, data)
+	}
+	if want := len(codes) - 2; st.RecoveryCodesLeft != want {
+		t.Errorf("剩余恢复码 %d 个，期望 %d 个", st.RecoveryCodesLeft, want)
+	}
+}
+
+// signChallenge 使用与服务器相同的派生密钥签发挑战令牌
+func signChallenge(t *testing.T, userID string, issuedAt, expiresAt time.Time) string {
+	t.Helper()
+	mac := hmac.New(sha256.New, []byte(config.Get().JWTSecret))
+	mac.Write([]byte("nlip-2fa-challenge"))
+	claims := jwtv4.RegisteredClaims{
+		Subject:   userID,
+		IssuedAt:  jwtv4.NewNumericDate(issuedAt),
+		ExpiresAt: jwtv4.NewNumericDate(expiresAt),
+	}
+	token, err := jwtv4.NewWithClaims(jwtv4.SigningMethodHS256, claims).SignedString(mac.Sum(nil))
+	if err != nil {
+		t.Fatalf("签发挑战令牌失败: %v", err)
+	}
+	return token
+}
+
+// TestChallengeTokenExpiryAndScope 挑战令牌过期后不能使用，且不能与登录令牌互换
+func TestChallengeTokenExpiryAndScope(t *testing.T) {
+	app := setupTwoFactor(t)
+	userID := createUser(t, "alice", false)
+	secret := enableTOTP(t, userID)
+	challenge := login(t, app, "alice")
+
+	// 挑战令牌不能当作登录令牌访问接口
+	for _, path := range []string{"/api/v1/nlip/auth/me", "/api/v1/nlip/spaces/list", "/api/v1/nlip/auth/2fa"} {
+		if status, _ := call(t, app, "GET", path, "Bearer "+challenge, nil); status != http.StatusUnauthorized {
+			t.Errorf("使用挑战令牌访问 %s 返回 %d，期望 401", path, status)
+		}
+	}
+
+	// 登录令牌不能当作挑战令牌
+	loginToken := strings.TrimPrefix(testutil.Token(t, userID, "alice", false), "Bearer ")
+	step := currentStep()
+	if status, _ := verify(t, app, loginToken, totpCode(t, secret, step-1)); status != http.StatusUnauthorized {
+		t.Errorf("使用登录令牌作为挑战令牌返回 %d，期望 401", status)
+	}
+
+	// 过期的挑战令牌
+	now := time.Now()
+	expired := signChallenge(t, userID, now.Add(-10*time.Minute), now.Add(-time.Second))
+	if status, _ := verify(t, app, expired, totpCode(t, secret, step-1)); status != http.StatusUnauthorized {
+		t.Errorf("使用过期的挑战令牌返回 %d，期望 401", status)
+	}
+
+	// 同样方式签发的未过期令牌可以使用，说明上面的拒绝是因为过期
+	valid := signChallenge(t, userID, now, now.Add(time.Minute))
+	status, token := verify(t, app, valid, totpCode(t, secret, step-1))
+	if status != http.StatusOK {
+		t.Fatalf("使用未过期的挑战令牌返回 %d，期望 200", status)
+	}
+
+	// 两步验证被重置后，之前的挑战令牌失效
+	if _, err := config.DB.Exec("UPDATE nlip_users SET totp_enabled = FALSE WHERE id = ?", userID); err != nil {
+		t.Fatalf("重置两步验证失败: %v", err)
+	}
+	if status, _ := verify(t, app, challenge, totpCode(t, secret, step)); status != http.StatusUnauthorized {
+		t.Errorf("两步验证重置后使用挑战令牌返回 %d，期望 401", status)
+	}
+
+	// 验证通过后签发的登录令牌可以正常使用
+	if status, _ := call(t, app, "GET", "/api/v1/nlip/auth/me", "Bearer "+token, nil); status != http.StatusOK {
+		t.Errorf("使用登录令牌访问返回 %d，期望 200", status)
+	}
+}
+
+// TestRequiredTwoFactorEnforced 服务器要求启用两步验证时，未启用的用户只能访问两步验证设置相关接口
+func TestRequiredTwoFactorEnforced(t *testing.T) {
+	t.Setenv("NLIP_TWO_FACTOR_REQUIRE", "admins")
+	app := setupTwoFactor(t)
+
+	adminID := createUser(t, "root", true)
+	securedAdminID := createUser(t, "root2", true)
+	userID := createUser(t, "alice", false)
+	enableTOTP(t, securedAdminID)
+
+	adminToken := testutil.Token(t, adminID, "root", true)
+	securedAdminToken := testutil.Token(t, securedAdminID, "root2", true)
+	userToken := testutil.Token(t, userID, "alice", false)
+
+	tests := []struct {
+		name  string
+		token string
+		path  string
+		want  int
+	}{
+		{"未启用的管理员访问空间列表", adminToken, "/api/v1/nlip/spaces/list", http.StatusForbidden},
+		{"未启用的管理员访问管理接口", adminToken, "/api/v1/nlip/admin/settings", http.StatusForbidden},
+		{"未启用的管理员查看两步验证状态", adminToken, "/api/v1/nlip/auth/2fa", http.StatusOK},
+		{"未启用的管理员获取当前用户", adminToken, "/api/v1/nlip/auth/me", http.StatusOK},
+		{"已启用的管理员访问空间列表", securedAdminToken, "/api/v1/nlip/spaces/list", http.StatusOK},
+		{"普通用户不受 admins 限制", userToken, "/api/v1/nlip/spaces/list", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := call(t, app, "GET", tt.path, tt.token, nil); status != tt.want {
+				t.Errorf("GET %s 返回 %d，期望 %d", tt.path, status, tt.want)
+			}
+		})
+	}
+
+	// 设置为 all 后普通用户也需要启用
+	if _, err := config.UpdateSettings(map[string]json.RawMessage{"security.require_2fa": json.RawMessage(`"all"`)}, adminID); err != nil {
+		t.Fatalf("修改设置失败: %v", err)
+	}
+	if status, _ := call(t, app, "GET", "/api/v1/nlip/spaces/list", userToken, nil); status != http.StatusForbidden {
+		t.Errorf("require_2fa 为 all 时未启用的普通用户返回 %d，期望 403", status)
+	}
+	if status, _ := call(t, app, "POST", "/api/v1/nlip/auth/2fa/setup", userToken, nil); status != http.StatusOK {
+		t.Errorf("require_2fa 为 all 时未启用的普通用户生成密钥返回 %d，期望 200", status)
+	}
+}
@@ -0,0 +1,485 @@
+package auth
+
+import (
+	"bytes"
+	"database/sql"
+	"nlip/config"
+	"nlip/models/user"
+	"nlip/models/webauthn"
+	"nlip/utils/logger"
+	webauthnUtils "nlip/utils/webauthn"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultCredentialName 注册时未指定名称的通行密钥名称
+const defaultCredentialName = "通行密钥"
+
+// knownTransports 浏览器报告的认证器传输方式，用于登录时提示浏览器
+var knownTransports = map[string]bool{
+	"usb": true, "nfc": true, "ble": true, "smart-card": true, "hybrid": true, "internal": true,
+}
+
+func scanCredential(row interface{ Scan(...interface{}) error }) (*webauthn.Credential, error) {
+	var cred webauthn.Credential
+	var transports string
+	if err := row.Scan(&cred.ID, &cred.Name, &transports, &cred.CreatedAt, &cred.LastUsedAt); err != nil {
+		return nil, err
+	}
+	cred.Transports = splitTransports(transports)
+	return &cred, nil
+}
+
+func splitTransports(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+// credentialDescriptors 获取用户已注册的通行密钥，注册时排除已有的认证器，登录时提示浏览器可用的凭据
+func credentialDescriptors(userID string) ([]webauthn.CredentialDescriptor, error) {
+	rows, err := config.DB.Query("SELECT id, transports FROM nlip_webauthn_credentials WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	descriptors := []webauthn.CredentialDescriptor{}
+	for rows.Next() {
+		var id, transports string
+		if err := rows.Scan(&id, &transports); err != nil {
+			return nil, err
+		}
+		descriptors = append(descriptors, webauthn.CredentialDescriptor{
+			Type:       "public-key",
+			ID:         id,
+			Transports: splitTransports(transports),
+		})
+	}
+	return descriptors, rows.Err()
+}
+
+// HandleBeginPasskeyRegistration 获取注册通行密钥的参数
+// @Summary 开始注册通行密钥
+// @Description 返回 navigator.credentials.create() 使用的参数，二进制字段为 base64url 编码，5 分钟内有效
+// @Tags 认证
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} webauthn.CreationOptionsResponse "获取成功"
+// @Failure 401 {object} string "未授权"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/auth/webauthn/register/begin [post]
+func HandleBeginPasskeyRegistration(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+	username, _ := c.Locals("username").(string)
+
+	exclude, err := credentialDescriptors(userID)
+	if err != nil {
+		logger.Error("获取通行密钥列表失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取通行密钥列表失败")
+	}
+
+	challenge, err := webauthnUtils.NewChallenge(webauthnUtils.KindRegistration, userID)
+	if err != nil {
+		logger.Error("生成通行密钥挑战失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "生成通行密钥挑战失败")
+	}
+
+	params := make([]webauthn.CredentialParameter, 0, len(webauthnUtils.Algorithms))
+	for _, alg := range webauthnUtils.Algorithms {
+		params = append(params, webauthn.CredentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取注册参数成功",
+		"data": webauthn.CreationOptionsResponse{
+			PublicKey: webauthn.CreationOptions{
+				RP: webauthn.RelyingParty{
+					ID:   webauthnUtils.RPID(),
+					Name: config.Get().TwoFactor.Issuer,
+				},
+				User: webauthn.UserEntity{
+					ID:          webauthnUtils.EncodeBase64URL([]byte(userID)),
+					Name:        username,
+					DisplayName: username,
+				},
+				Challenge:          challenge,
+				PubKeyCredParams:   params,
+				Timeout:            int(webauthnUtils.Timeout.Milliseconds()),
+				Attestation:        "none",
+				ExcludeCredentials: exclude,
+				AuthenticatorSelection: webauthn.AuthenticatorSelection{
+					ResidentKey:      "preferred",
+					UserVerification: "preferred",
+				},
+			},
+		},
+	})
+}
+
+// HandleFinishPasskeyRegistration 保存新注册的通行密钥
+// @Summary 完成注册通行密钥
+// @Description 提交 navigator.credentials.create() 的结果，验证通过后保存为当前用户的通行密钥
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body webauthn.FinishRegistrationRequest true "注册结果"
+// @Success 201 {object} webauthn.CredentialResponse "注册成功"
+// @Failure 400 {object} string "验证失败或已过期"
+// @Failure 401 {object} string "未授权"
+// @Failure 409 {object} string "通行密钥已注册"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/auth/webauthn/register/finish [post]
+func HandleFinishPasskeyRegistration(c *fiber.Ctx) error {
+	var req webauthn.FinishRegistrationRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Warning("解析注册通行密钥请求失败: %v", err)
+		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+	}
+
+	userID := c.Locals("userId").(string)
+
+	clientData, err := webauthnUtils.DecodeBase64URL(req.Credential.Response.ClientDataJSON)
+	if err != nil || req.Credential.Type != "public-key" {
+		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+	}
+	attestation, err := webauthnUtils.DecodeBase64URL(req.Credential.Response.AttestationObject)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+	}
+
+	reg, err := webauthnUtils.VerifyRegistration(userID, clientData, attestation)
+	if err != nil {
+		logger.Warning("通行密钥注册验证失败: userId=%s, err=%v", userID, err)
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	credentialID := webauthnUtils.EncodeBase64URL(reg.CredentialID)
+	var exists bool
+	err = config.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM nlip_webauthn_credentials WHERE id = ?)", credentialID).Scan(&exists)
+	if err != nil {
+		logger.Error("检查通行密钥失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "保存通行密钥失败")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "该通行密钥已注册")
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = defaultCredentialName
+	}
+	var transports []string
+	for _, t := range req.Credential.Response.Transports {
+		if knownTransports[t] {
+			transports = append(transports, t)
+		}
+	}
+
+	_, err = config.DB.Exec(`
+		INSERT INTO nlip_webauthn_credentials (id, user_id, name, public_key, sign_count, transports, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, credentialID, userID, name, reg.PublicKey, reg.SignCount, strings.Join(transports, ","), time.Now())
+	if err != nil {
+		logger.Error("保存通行密钥失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "保存通行密钥失败")
+	}
+
+	cred, err := scanCredential(config.DB.QueryRow(`
+		SELECT id, name, transports, created_at, last_used_at FROM nlip_webauthn_credentials WHERE id = ?
+	`, credentialID))
+	if err != nil {
+		logger.Error("获取通行密钥失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取通行密钥失败")
+	}
+
+	logger.Info("用户注册通行密钥: userId=%s, name=%s", userID, name)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"code":    fiber.StatusCreated,
+		"message": "通行密钥注册成功",
+		"data": webauthn.CredentialResponse{
+			Credential: cred,
+		},
+	})
+}
+
+// HandleBeginPasskeyLogin 获取通行密钥登录的参数
+// @Summary 开始通行密钥登录
+// @Description 返回 navigator.credentials.get() 使用的参数。指定用户名时列出该用户的通行密钥，否则由浏览器选择设备上保存的通行密钥
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body webauthn.BeginLoginRequest false "用户名"
+// @Success 200 {object} webauthn.RequestOptionsResponse "获取成功"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/auth/webauthn/login/begin [post]
+func HandleBeginPasskeyLogin(c *fiber.Ctx) error {
+	var req webauthn.BeginLoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Warning("解析通行密钥登录请求失败: %v", err)
+		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+	}
+
+	// 用户名不存在时与没有通行密钥的用户返回相同的结果，避免泄露用户名是否存在
+	var userID string
+	allow := []webauthn.CredentialDescriptor{}
+	if req.Username != "" {
+		err := config.DB.QueryRow("SELECT id FROM nlip_users WHERE username = ?", req.Username).Scan(&userID)
+		if err != nil && err != sql.ErrNoRows {
+			logger.Error("查询用户失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "数据库查询错误")
+		}
+		if userID != "" {
+			if allow, err = credentialDescriptors(userID); err != nil {
+				logger.Error("获取通行密钥列表失败: %v", err)
+				return fiber.NewError(fiber.StatusInternalServerError, "获取通行密钥列表失败")
+			}
+		}
+	}
+
+	challenge, err := webauthnUtils.NewChallenge(webauthnUtils.KindLogin, userID)
+	if err != nil {
+		logger.Error("生成通行密钥挑战失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "生成通行密钥挑战失败")
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取登录参数成功",
+		"data": webauthn.RequestOptionsResponse{
+			PublicKey: webauthn.RequestOptions{
+				Challenge:        challenge,
+				RPID:             webauthnUtils.RPID(),
+				Timeout:          int(webauthnUtils.Timeout.Milliseconds()),
+				UserVerification: "required",
+				AllowCredentials: allow,
+			},
+		},
+	})
+}
+
+// HandleFinishPasskeyLogin 使用通行密钥登录
+// @Summary 完成通行密钥登录
+// @Description 提交 navigator.credentials.get() 的结果，验证通过后签发登录令牌。认证器已完成用户验证，不再需要两步验证码
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body webauthn.FinishLoginRequest true "登录结果"
+// @Success 200 {object} user.AuthResponse "登录成功"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 401 {object} string "通行密钥无效或验证失败"
+// @Failure 403 {object} string "账号已被禁用"
+// @Failure 423 {object} string "登录失败次数过多，已被临时锁定"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/auth/webauthn/login/finish [post]
+func HandleFinishPasskeyLogin(c *fiber.Ctx) error {
+	var req webauthn.FinishLoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Warning("解析通行密钥登录请求失败: %v", err)
+		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+	}
+
+	resp := req.Credential.Response
+	rawID, err1 := webauthnUtils.DecodeBase64URL(req.Credential.ID)
+	clientData, err2 := webauthnUtils.DecodeBase64URL(resp.ClientDataJSON)
+	authData, err3 := webauthnUtils.DecodeBase64URL(resp.AuthenticatorData)
+	signature, err4 := webauthnUtils.DecodeBase64URL(resp.Signature)
+	userHandle, err5 := webauthnUtils.DecodeBase64URL(resp.UserHandle)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil || req.Credential.Type != "public-key" {
+		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+	}
+	credentialID := webauthnUtils.EncodeBase64URL(rawID)
+
+	var u user.User
+	var publicKey []byte
+	var signCount uint32
+	err := config.DB.QueryRow(`
+		SELECT c.public_key, c.sign_count,
+			u.id, u.username, u.is_admin, u.created_at, u.need_change_pwd, u.disabled, u.totp_enabled
+		FROM nlip_webauthn_credentials c
+		JOIN nlip_users u ON c.user_id = u.id
+		WHERE c.id = ?
+	`, credentialID).Scan(&publicKey, &signCount,
+		&u.ID, &u.Username, &u.IsAdmin, &u.CreatedAt, &u.NeedChangePwd, &u.Disabled, &u.TwoFactorEnabled)
+	if err == sql.ErrNoRows {
+		logger.Warning("未注册的通行密钥尝试登录: credentialId=%s", credentialID)
+		return fiber.NewError(fiber.StatusUnauthorized, "通行密钥未注册")
+	} else if err != nil {
+		logger.Error("获取通行密钥失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取通行密钥失败")
+	}
+
+	if err := checkLockout(c, u.Username); err != nil {
+		return err
+	}
+
+	expectedUserID, newCount, err := webauthnUtils.VerifyAssertion(clientData, authData, signature, publicKey, signCount)
+	if err == webauthnUtils.ErrInvalidChallenge {
+		return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+	}
+	if err == nil && ((expectedUserID != "" && expectedUserID != u.ID) ||
+		(len(userHandle) > 0 && !bytes.Equal(userHandle, []byte(u.ID)))) {
+		err = webauthnUtils.ErrInvalidCredential
+	}
+	if err != nil {
+		logger.Warning("通行密钥登录验证失败: username=%s, credentialId=%s", u.Username, credentialID)
+		recordLoginFailure(c, u.Username, u.ID)
+		return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+	}
+
+	if u.Disabled {
+		logger.Warning("已禁用账号尝试使用通行密钥登录: username=%s", u.Username)
+		return fiber.NewError(fiber.StatusForbidden, "账号已被禁用")
+	}
+
+	_, err = config.DB.Exec(
+		"UPDATE nlip_webauthn_credentials SET sign_count = ?, last_used_at = ? WHERE id = ?",
+		newCount, time.Now(), credentialID,
+	)
+	if err != nil {
+		logger.Error("更新通行密钥使用记录失败: %v", err)
+	}
+
+	return completeLogin(c, &u)
+}
+
+// HandleListPasskeys 获取当前用户的通行密钥
+// @Summary 获取通行密钥列表
+// @Description 获取当前用户注册的所有通行密钥
+// @Tags 认证
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} webauthn.ListCredentialsResponse "获取成功"
+// @Failure 401 {object} string "未授权"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/auth/webauthn/credentials [get]
+func HandleListPasskeys(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+
+	rows, err := config.DB.Query(`
+		SELECT id, name, transports, created_at, last_used_at FROM nlip_webauthn_credentials
+		WHERE user_id = ? ORDER BY created_at
+	`, userID)
+	if err != nil {
+		logger.Error("获取通行密钥列表失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取通行密钥列表失败")
+	}
+	defer rows.Close()
+
+	credentials := []webauthn.Credential{}
+	for rows.Next() {
+		cred, err := scanCredential(rows)
+		if err != nil {
+			logger.Error("读取通行密钥失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "获取通行密钥列表失败")
+		}
+		credentials = append(credentials, *cred)
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取通行密钥列表成功",
+		"data": webauthn.ListCredentialsResponse{
+			Credentials: credentials,
+		},
+	})
+}
+
+// HandleRenamePasskey 修改通行密钥名称
+// @Summary 修改通行密钥名称
+// @Description 修改当前用户的通行密钥名称，便于区分不同设备
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param credentialId path string true "通行密钥ID"
+// @Param request body webauthn.RenameCredentialRequest true "新名称"
+// @Success 200 {object} webauthn.CredentialResponse "修改成功"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 401 {object} string "未授权"
+// @Failure 404 {object} string "通行密钥不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/auth/webauthn/credentials/{credentialId} [put]
+func HandleRenamePasskey(c *fiber.Ctx) error {
+	var req webauthn.RenameCredentialRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Warning("解析修改通行密钥请求失败: %v", err)
+		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+	}
+
+	userID := c.Locals("userId").(string)
+	credentialID := c.Params("credentialId")
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "名称不能为空")
+	}
+
+	result, err := config.DB.Exec(
+		"UPDATE nlip_webauthn_credentials SET name = ? WHERE id = ? AND user_id = ?",
+		name, credentialID, userID,
+	)
+	if err != nil {
+		logger.Error("修改通行密钥名称失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "修改通行密钥名称失败")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "通行密钥不存在")
+	}
+
+	cred, err := scanCredential(config.DB.QueryRow(`
+		SELECT id, name, transports, created_at, last_used_at FROM nlip_webauthn_credentials WHERE id = ?
+	`, credentialID))
+	if err != nil {
+		logger.Error("获取通行密钥失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取通行密钥失败")
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "修改通行密钥名称成功",
+		"data": webauthn.CredentialResponse{
+			Credential: cred,
+		},
+	})
+}
+
+// HandleDeletePasskey 删除通行密钥
+// @Summary 删除通行密钥
+// @Description 删除当前用户的通行密钥，删除后该设备不能再用于登录
+// @Tags 认证
+// @Produce json
+// @Security BearerAuth
+// @Param credentialId path string true "通行密钥ID"
+// @Success 200 {object} string "删除成功"
+// @Failure 401 {object} string "未授权"
+// @Failure 404 {object} string "通行密钥不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/auth/webauthn/credentials/{credentialId} [delete]
+func HandleDeletePasskey(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+	credentialID := c.Params("credentialId")
+
+	result, err := config.DB.Exec(
+		"DELETE FROM nlip_webauthn_credentials WHERE id = ? AND user_id = ?", credentialID, userID,
+	)
+	if err != nil {
+		logger.Error("删除通行密钥失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "删除通行密钥失败")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "通行密钥不存在")
+	}
+
+	logger.Info("用户删除通行密钥: userId=%s, credentialId=%s", userID, credentialID)
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "删除通行密钥成功",
+		"data":    nil,
+	})
+}
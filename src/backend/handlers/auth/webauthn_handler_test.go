@@ -0,0 +1,303 @@
+package auth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"nlip/config"
+	"nlip/utils/testutil"
+	webauthnUtils "nlip/utils/webauthn"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// 认证器数据的标志位：用户在场、用户已验证、包含凭据数据
+const (
+	flagUP = 0x01
+	flagUV = 0x04
+	flagAT = 0x40
+)
+
+// softAuthenticator 测试中使用的软件认证器，使用 ES256 密钥生成注册和登录的结果
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	// rpID 计算认证器数据中依赖方ID哈希使用的值，正常情况下与服务器一致
+	rpID string
+}
+
+func newSoftAuthenticator(t *testing.T, userID string) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+	return &softAuthenticator{
+		key:          key,
+		credentialID: credentialID,
+		userHandle:   []byte(userID),
+		rpID:         webauthnUtils.RPID(),
+	}
+}
+
+// cborHead 编码 CBOR 数据项的类型和长度
+func cborHead(major byte, n int) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 256:
+		return []byte{major<<5 | 24, byte(n)}
+	}
+	return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, len(b)), b...) }
+func cborText(s string) []byte  { return append(cborHead(3, len(s)), s...) }
+
+// coseKey 公钥的 COSE_Key 编码：{1: 2 (EC2), 3: -7 (ES256), -1: 1 (P-256), -2: x, -3: y}
+func (a *softAuthenticator) coseKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+	out := []byte{0xa5, 0x01, 0x02, 0x03, 0x26, 0x20, 0x01, 0x21}
+	out = append(out, cborBytes(x)...)
+	out = append(out, 0x22)
+	return append(out, cborBytes(y)...)
+}
+
+// authenticatorData 生成认证器数据，注册时附带凭据ID和公钥
+func (a *softAuthenticator) authenticatorData(flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, signCount)
+	if flags&flagAT == 0 {
+		return data
+	}
+	data = append(data, make([]byte, 16)...) // aaguid
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+	data = append(data, a.credentialID...)
+	return append(data, a.coseKey()...)
+}
+
+func clientDataJSON(ceremonyType, challenge string) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      ceremonyType,
+		"challenge": challenge,
+		"origin":    config.Get().Domain,
+	})
+	return data
+}
+
+// create 模拟 navigator.credentials.create()，返回 none 证明的注册结果
+func (a *softAuthenticator) create(challenge string, signCount uint32) fiber.Map {
+	attestation := []byte{0xa3}
+	attestation = append(attestation, cborText("fmt")...)
+	attestation = append(attestation, cborText("none")...)
+	attestation = append(attestation, cborText("attStmt")...)
+	attestation = append(attestation, 0xa0)
+	attestation = append(attestation, cborText("authData")...)
+	attestation = append(attestation, cborBytes(a.authenticatorData(flagUP|flagUV|flagAT, signCount))...)
+
+	return fiber.Map{
+		"id":   webauthnUtils.EncodeBase64URL(a.credentialID),
+		"type": "public-key",
+		"response": fiber.Map{
+			"clientDataJSON":    webauthnUtils.EncodeBase64URL(clientDataJSON("webauthn.create", challenge)),
+			"attestationObject": webauthnUtils.EncodeBase64URL(attestation),
+			"transports":        []string{"internal"},
+		},
+	}
+}
+
+// get 模拟 navigator.credentials.get()，对认证器数据和客户端数据的哈希签名
+func (a *softAuthenticator) get(t *testing.T, challenge string, signCount uint32) fiber.Map {
+	t.Helper()
+	authData := a.authenticatorData(flagUP|flagUV, signCount)
+	clientData := clientDataJSON("webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+
+	return fiber.Map{
+		"id":   webauthnUtils.EncodeBase64URL(a.credentialID),
+		"type": "public-key",
+		"response": fiber.Map{
+			"clientDataJSON":    webauthnUtils.EncodeBase64URL(clientData),
+			"authenticatorData": webauthnUtils.EncodeBase64URL(authData),
+			"signature":         webauthnUtils.EncodeBase64URL(signature),
+			"userHandle":        webauthnUtils.EncodeBase64URL(a.userHandle),
+		},
+	}
+}
+
+// beginCeremony 获取注册或登录参数，返回挑战
+func beginCeremony(t *testing.T, app *fiber.App, path, authorization string, body interface{}) string {
+	t.Helper()
+	status, data := call(t, app, "POST", path, authorization, body)
+	var options struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+		} `json:"publicKey"`
+	}
+	if err := json.Unmarshal(data, &options); err != nil || status != http.StatusOK || options.PublicKey.Challenge == "" {
+		t.Fatalf("%s 返回 %d: %s", path, status, data)
+	}
+	return options.PublicKey.Challenge
+}
+
+func beginRegistration(t *testing.T, app *fiber.App, token string) string {
+	return beginCeremony(t, app, "/api/v1/nlip/auth/webauthn/register/begin", token, nil)
+}
+
+func beginPasskeyLogin(t *testing.T, app *fiber.App) string {
+	return beginCeremony(t, app, "/api/v1/nlip/auth/webauthn/login/begin", "", map[string]string{"username": "alice"})
+}
+
+func finishRegistration(t *testing.T, app *fiber.App, token string, credential fiber.Map) int {
+	t.Helper()
+	status, _ := call(t, app, "POST", "/api/v1/nlip/auth/webauthn/register/finish", token,
+		fiber.Map{"name": "laptop", "credential": credential})
+	return status
+}
+
+func finishPasskeyLogin(t *testing.T, app *fiber.App, credential fiber.Map) (int, string) {
+	t.Helper()
+	status, data := call(t, app, "POST", "/api/v1/nlip/auth/webauthn/login/finish", "",
+		fiber.Map{"credential": credential})
+	var auth struct {
+		Token string `json:"token"`
+	}
+	_ = json.Unmarshal(data, &auth)
+	return status, auth.Token
+}
+
+func storedSignCount(t *testing.T, a *softAuthenticator) (count uint32, found bool) {
+	t.Helper()
+	rows, err := config.DB.Query("SELECT sign_count FROM nlip_webauthn_credentials WHERE id = ?",
+		webauthnUtils.EncodeBase64URL(a.credentialID))
+	if err != nil {
+		t.Fatalf("查询通行密钥失败: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		found = true
+		rows.Scan(&count)
+	}
+	return count, found
+}
+
+// TestPasskeyRegistrationAndLogin 使用软件认证器完成注册和登录，重放同一个结果时挑战已失效
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	app := setupTwoFactor(t)
+	userID := testutil.CreateUser(t, "alice", false)
+	token := testutil.Token(t, userID, "alice", false)
+	a := newSoftAuthenticator(t, userID)
+
+	registration := a.create(beginRegistration(t, app, token), 0)
+	if status := finishRegistration(t, app, token, registration); status != http.StatusCreated {
+		t.Fatalf("注册通行密钥返回 %d，期望 201", status)
+	}
+	// 重放注册结果，挑战已使用
+	if status := finishRegistration(t, app, token, registration); status != http.StatusBadRequest {
+		t.Errorf("重放注册结果返回 %d，期望 400", status)
+	}
+
+	// 登录的挑战不能用于注册
+	if status := finishRegistration(t, app, token, a.create(beginPasskeyLogin(t, app), 0)); status != http.StatusBadRequest {
+		t.Errorf("使用登录的挑战注册返回 %d，期望 400", status)
+	}
+
+	challenge := beginPasskeyLogin(t, app)
+	status, jwtToken := finishPasskeyLogin(t, app, a.get(t, challenge, 1))
+	if status != http.StatusOK || jwtToken == "" {
+		t.Fatalf("通行密钥登录返回 %d，期望 200 并返回令牌", status)
+	}
+	if count, _ := storedSignCount(t, a); count != 1 {
+		t.Errorf("登录后签名计数为 %d，期望 1", count)
+	}
+
+	// 登录令牌可以访问需要认证的接口
+	if status, _ := call(t, app, "GET", "/api/v1/nlip/auth/webauthn/credentials", "Bearer "+jwtToken, nil); status != http.StatusOK {
+		t.Errorf("使用通行密钥登录的令牌访问接口返回 %d，期望 200", status)
+	}
+
+	// 使用同一个挑战再次登录，签名计数正常增加也被拒绝
+	if status, _ := finishPasskeyLogin(t, app, a.get(t, challenge, 2)); status != http.StatusUnauthorized {
+		t.Errorf("重复使用登录的挑战返回 %d，期望 401", status)
+	}
+}
+
+// TestPasskeyWrongRPIDHash 认证器数据中的依赖方ID哈希与服务器不一致时，注册和登录都被拒绝
+func TestPasskeyWrongRPIDHash(t *testing.T) {
+	app := setupTwoFactor(t)
+	userID := testutil.CreateUser(t, "alice", false)
+	token := testutil.Token(t, userID, "alice", false)
+	a := newSoftAuthenticator(t, userID)
+
+	a.rpID = "evil.example.com"
+	if status := finishRegistration(t, app, token, a.create(beginRegistration(t, app, token), 0)); status != http.StatusBadRequest {
+		t.Fatalf("依赖方ID不一致时注册返回 %d，期望 400", status)
+	}
+	if _, found := storedSignCount(t, a); found {
+		t.Fatal("验证失败的通行密钥不应被保存")
+	}
+
+	a.rpID = webauthnUtils.RPID()
+	if status := finishRegistration(t, app, token, a.create(beginRegistration(t, app, token), 0)); status != http.StatusCreated {
+		t.Fatalf("注册通行密钥返回 %d，期望 201", status)
+	}
+
+	a.rpID = "evil.example.com"
+	if status, _ := finishPasskeyLogin(t, app, a.get(t, beginPasskeyLogin(t, app), 1)); status != http.StatusUnauthorized {
+		t.Errorf("依赖方ID不一致时登录返回 %d，期望 401", status)
+	}
+	if count, _ := storedSignCount(t, a); count != 0 {
+		t.Errorf("登录失败后签名计数变为 %d，期望保持 0", count)
+	}
+}
+
+// TestPasskeySignCountMustIncrease 签名计数没有增加时拒绝登录，说明凭据可能被复制
+func TestPasskeySignCountMustIncrease(t *testing.T) {
+	app := setupTwoFactor(t)
+	userID := testutil.CreateUser(t, "alice", false)
+	token := testutil.Token(t, userID, "alice", false)
+	a := newSoftAuthenticator(t, userID)
+
+	if status := finishRegistration(t, app, token, a.create(beginRegistration(t, app, token), 5)); status != http.StatusCreated {
+		t.Fatalf("注册通行密钥返回 %d，期望 201", status)
+	}
+
+	tests := []struct {
+		name      string
+		signCount uint32
+		want      int
+		stored    uint32
+	}{
+		{"计数减少", 3, http.StatusUnauthorized, 5},
+		{"计数不变", 5, http.StatusUnauthorized, 5},
+		{"计数为 0", 0, http.StatusUnauthorized, 5},
+		{"计数增加", 6, http.StatusOK, 6},
+		{"登录后计数回退", 4, http.StatusUnauthorized, 6},
+	}
+	for _, tt := range tests {
+		status, _ := finishPasskeyLogin(t, app, a.get(t, beginPasskeyLogin(t, app), tt.signCount))
+		if status != tt.want {
+			t.Errorf("%s: 登录返回 %d，期望 %d", tt.name, status, tt.want)
+		}
+		if count, _ := storedSignCount(t, a); count != tt.stored {
+			t.Errorf("%s: 签名计数为 %d，期望 %d", tt.name, count, tt.stored)
+		}
+	}
+}
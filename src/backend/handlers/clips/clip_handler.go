@@ -2,21 +2,28 @@ package clips
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"nlip/config"
 	"nlip/models/clip"
 	"nlip/models/space"
 	"nlip/utils/db"
+	"nlip/utils/events"
 	"nlip/utils/id"
 	"nlip/utils/logger"
+	"nlip/utils/notifier"
+	"nlip/utils/quota"
 	"nlip/utils/storage"
 	"nlip/utils/validator"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"mime/multipart"
 
 	"nlip/tasks/cleaner"
+	"nlip/tasks/thumbnail"
+	"nlip/tasks/webhook"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -49,6 +56,7 @@ const (
             c.content_type, 
             c.content, 
             c.file_path, 
+            c.password_hash,
             c.created_at,
             c.updated_at,
             u.id as creator_id,
@@ -88,7 +96,7 @@ func checkClipPermission(tx *sql.Tx, spaceID, spaceType, clipID, userID string,
 // 添加文件处理辅助函数
 func handleFileUpload(file *multipart.FileHeader) ([]byte, string, error) {
 	// 检查文件大小
-	if file.Size > config.AppConfig.MaxFileSize {
+	if file.Size > config.Get().MaxFileSize {
 		return nil, "", fiber.NewError(fiber.StatusBadRequest, "文件大小超过限制")
 	}
 
@@ -121,7 +129,7 @@ func handleFileUpload(file *multipart.FileHeader) ([]byte, string, error) {
 func scanClip(rows *sql.Rows) (*clip.Clip, error) {
 	var cl clip.Clip
 	var creatorID, creatorUsername, content sql.NullString
-	var filePath sql.NullString
+	var filePath, passwordHash sql.NullString
 
 	err := rows.Scan(
 		&cl.ID,
@@ -130,6 +138,7 @@ func scanClip(rows *sql.Rows) (*clip.Clip, error) {
 		&cl.ContentType,
 		&content,
 		&filePath,
+		&passwordHash,
 		&cl.CreatedAt,
 		&cl.UpdatedAt,
 		&creatorID,
@@ -148,6 +157,11 @@ func scanClip(rows *sql.Rows) (*clip.Clip, error) {
 		cl.FilePath = filePath.String
 	}
 
+	if passwordHash.Valid && passwordHash.String != "" {
+		cl.IsProtected = true
+		cl.PasswordHash = passwordHash.String
+	}
+
 	if creatorID.Valid && creatorUsername.Valid {
 		cl.Creator = &clip.Creator{
 			ID:       creatorID.String,
@@ -162,7 +176,7 @@ func scanClip(rows *sql.Rows) (*clip.Clip, error) {
 func scanSingleClip(row *sql.Row) (*clip.Clip, error) {
 	var cl clip.Clip
 	var creatorID, creatorUsername sql.NullString
-	var filePath sql.NullString
+	var filePath, passwordHash sql.NullString
 
 	err := row.Scan(
 		&cl.ID,
@@ -171,6 +185,7 @@ func scanSingleClip(row *sql.Row) (*clip.Clip, error) {
 		&cl.ContentType,
 		&cl.Content,
 		&filePath,
+		&passwordHash,
 		&cl.CreatedAt,
 		&cl.UpdatedAt,
 		&creatorID,
@@ -185,6 +200,11 @@ func scanSingleClip(row *sql.Row) (*clip.Clip, error) {
 		cl.FilePath = filePath.String
 	}
 
+	if passwordHash.Valid && passwordHash.String != "" {
+		cl.IsProtected = true
+		cl.PasswordHash = passwordHash.String
+	}
+
 	if creatorID.Valid && creatorUsername.Valid {
 		cl.Creator = &clip.Creator{
 			ID:       creatorID.String,
@@ -195,6 +215,118 @@ func scanSingleClip(row *sql.Row) (*clip.Clip, error) {
 	return &cl, nil
 }
 
+// CreateClip 保存剪贴板内容并添加清理空间超量内容的后台任务，供上传、粘贴和 Webhook 写入共用
+// 文件内容通过 fileData 传入，为空时仅保存文本内容；fileName 为空的文件保存为 paste-<id>.bin
+func CreateClip(s space.Space, userID, username, content string, fileData []byte, fileName, contentType, passwordHash string) (*clip.Clip, error) {
+	// 生成剪贴板ID（事务外进行）
+	fullID, clipID := id.GenerateClipID(s.ID)
+
+	// 准备剪贴板内容
+	cl := clip.Clip{
+		ID:          fullID,
+		ClipID:      clipID,
+		SpaceID:     s.ID,
+		ContentType: contentType,
+		Content:     content,
+		IsProtected: passwordHash != "",
+		Creator: &clip.Creator{
+			ID:       userID,
+			Username: username,
+		},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	var uploadedClip *clip.Clip
+
+	// 执行数据库事务
+	err := db.WithTransaction(config.DB, func(tx *sql.Tx) error {
+		// 处理文件上传
+		if fileData != nil {
+			storedName := fmt.Sprintf("%s%s", cl.ClipID, filepath.Ext(fileName))
+			if fileName == "" {
+				// 未指定文件名粘贴的二进制内容
+				storedName = "paste-" + cl.ClipID + binaryPasteExt
+			}
+			filePath, err := storage.SaveFile(fileData, storedName)
+			if err != nil {
+				logger.Error("保存文件失败: %v", err)
+				return fiber.NewError(fiber.StatusInternalServerError, ErrFileUploadFailed)
+			}
+			cl.FilePath = filePath
+		}
+
+		// 插入数据库，空间和用户的存储用量由触发器更新
+		_, err := tx.Exec(`
+			INSERT INTO nlip_clipboard_items 
+			(id, clip_id, space_id, content_type, content, file_path, password_hash, creator_id, size_bytes, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?)
+		`, cl.ID, cl.ClipID, cl.SpaceID, cl.ContentType, cl.Content, cl.FilePath, passwordHash, userID, len(cl.Content)+len(fileData), cl.CreatedAt, cl.UpdatedAt)
+		if err != nil {
+			logger.Error("保存剪贴板内容失败: %v", err)
+			err = fiber.NewError(fiber.StatusInternalServerError, "保存剪贴板内容失败")
+		} else {
+			err = checkQuota(tx, cl.SpaceID, userID)
+		}
+
+		if err != nil {
+			if cl.FilePath != "" {
+				if err := storage.DeleteFile(cl.FilePath); err != nil {
+					logger.Error("删除失败的上传文件失败: %v", err)
+				}
+			}
+			return err
+		}
+
+		uploadedClip = &cl
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// 通知等待新剪贴板的请求及事件订阅者
+	notifier.Publish(s.ID, cl.ClipID)
+	publishClipEvent(events.ClipCreated, uploadedClip)
+
+	// 由后台任务清理超出数量限制的内容
+	if err := cleaner.EnqueueSpaceOverflow(s.ID); err != nil {
+		logger.Error("添加清理空间超量内容任务失败，但上传已成功: %v", err)
+	}
+
+	// 图片文件由后台任务生成缩略图
+	if uploadedClip.FilePath != "" && strings.HasPrefix(uploadedClip.ContentType, "image/") {
+		if err := thumbnail.Enqueue(uploadedClip.FilePath); err != nil {
+			logger.Error("添加缩略图任务失败: %v", err)
+		}
+	}
+
+	return uploadedClip, nil
+}
+
+// checkQuota 检查写入后空间和用户的存储用量是否超出配额，超出时返回 413
+func checkQuota(tx *sql.Tx, spaceID, userID string) error {
+	err := quota.Check(tx, spaceID, userID)
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		logger.Warning("存储配额不足: spaceID=%s, userID=%s, %v", spaceID, userID, err)
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, exceeded.Error())
+	} else if err != nil {
+		logger.Error("检查存储配额失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "检查存储配额失败")
+	}
+	return nil
+}
+
+// publishClipEvent 发布剪贴板事件并投递给空间 Webhook，受保护剪贴板的内容不会随事件下发
+func publishClipEvent(eventType string, cl *clip.Clip) {
+	masked := *cl
+	maskProtectedClip(&masked)
+	data := clip.ClipResponse{Clip: &masked}
+	events.Publish(cl.SpaceID, eventType, data)
+	webhook.Enqueue(cl.SpaceID, eventType, data)
+}
+
 // HandleUploadClip 处理上传剪贴板内容
 // @Summary 上传Clip
 // @Description 上传剪贴板内容
@@ -264,87 +396,22 @@ func HandleUploadClip(c *fiber.Ctx) error {
 		}
 	}
 
-	// 生成剪贴板ID（事务外进行）
-	fullID, clipID := id.GenerateClipID(req.SpaceID)
-
-	// 准备剪贴板内容
-	cl := clip.Clip{
-		ID:          fullID,
-		ClipID:      clipID,
-		SpaceID:     req.SpaceID,
-		ContentType: contentType,
-		Content:     req.Content,
-		Creator: &clip.Creator{
-			ID:       userID,
-			Username: username,
-		},
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
-	var uploadedClip *clip.Clip
-
-	// 执行数据库事务
-	err = db.WithTransaction(config.DB, func(tx *sql.Tx) error {
-		// 处理文件上传
-		if fileData != nil {
-			fileName := fmt.Sprintf("%s%s", cl.ClipID, filepath.Ext(fileName))
-			filePath, err := storage.SaveFile(fileData, fileName)
-			if err != nil {
-				logger.Error("保存文件失败: %v", err)
-				return fiber.NewError(fiber.StatusInternalServerError, ErrFileUploadFailed)
-			}
-			cl.FilePath = filePath
-		}
-
-		// 插入数据库
-		_, err = tx.Exec(`
-			INSERT INTO nlip_clipboard_items 
-			(id, clip_id, space_id, content_type, content, file_path, creator_id, created_at, updated_at)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-		`, cl.ID, cl.ClipID, cl.SpaceID, cl.ContentType, cl.Content, cl.FilePath, userID, cl.CreatedAt, cl.UpdatedAt)
-
+	// 生成剪贴板密码哈希
+	var passwordHash string
+	if req.Password != "" {
+		passwordHash, err = hashClipPassword(req.Password)
 		if err != nil {
-			if cl.FilePath != "" {
-				if err := storage.DeleteFile(cl.FilePath); err != nil {
-					logger.Error("删除失败的上传文件失败: %v", err)
-				}
-			}
-			logger.Error("保存剪贴板内容失败: %v", err)
-			return fiber.NewError(fiber.StatusInternalServerError, "保存剪贴板内容失败")
+			logger.Error("生成剪贴板密码哈希失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "密码加密失败")
 		}
+	}
 
-		uploadedClip = &cl
-		return nil
-	})
-
+	uploadedClip, err := CreateClip(s, userID, username, req.Content, fileData, fileName, contentType, passwordHash)
 	if err != nil {
 		return err
 	}
 
-	// 创建一个 channel 用于等待清理操作完成
-	cleanupDone := make(chan error)
-
-	// 执行清理操作
-	go func() {
-		// 添加延迟，确保上传事务完全提交
-		time.Sleep(100 * time.Millisecond)
-
-		err := cleaner.CleanSpaceOverflow(req.SpaceID)
-		if err != nil {
-			logger.Error("清理空间超量内容失败: %v", err)
-			cleanupDone <- err
-			return
-		}
-		cleanupDone <- nil
-	}()
-
-	// 等待清理操作完成
-	if cleanupErr := <-cleanupDone; cleanupErr != nil {
-		// 如果清理失败，记录日志但仍然返回上传成功
-		logger.Error("清理空间超量内容失败，但上传已成功: %v", cleanupErr)
-	}
-
-	logger.Info("用户 %s 成功上传内容到空间 %s，清理操作已完成", userID, req.SpaceID)
+	logger.Info("用户 %s 成功上传内容到空间 %s", userID, req.SpaceID)
 	return c.JSON(fiber.Map{
 		"code":    fiber.StatusOK,
 		"message": "上传成功",
@@ -390,6 +457,8 @@ func HandleListClips(c *fiber.Ctx) error {
 				logger.Error("读取剪贴板数据失败: %v", err)
 				return fiber.NewError(fiber.StatusInternalServerError, "读取剪贴板数据失败")
 			}
+			// 列表中只展示受保护剪贴板的存在，不返回内容
+			maskProtectedClip(cl)
 			clips = append(clips, *cl)
 		}
 
@@ -418,8 +487,9 @@ func HandleListClips(c *fiber.Ctx) error {
 func HandleGetLastClip(c *fiber.Ctx) error {
 	s := c.Locals("space").(space.Space)
 	isDownload := c.Query("download") == "true"
-	return db.WithTransaction(config.DB, func(tx *sql.Tx) error {
 
+	var cl *clip.Clip
+	err := db.WithTransaction(config.DB, func(tx *sql.Tx) error {
 		// 使用通用查询语句
 		row := tx.QueryRow(
 			selectClipWithCreatorSQL+
@@ -427,49 +497,42 @@ func HandleGetLastClip(c *fiber.Ctx) error {
 			s.ID,
 		)
 
-		cl, err := scanSingleClip(row)
+		var err error
+		cl, err = scanSingleClip(row)
 		if err == sql.ErrNoRows {
 			return fiber.NewError(fiber.StatusNotFound, ErrClipNotFound)
 		} else if err != nil {
 			logger.Error("获取剪贴板内容失败: %v", err)
 			return fiber.NewError(fiber.StatusInternalServerError, "获取剪贴板内容失败")
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-		if cl.FilePath != "" && isDownload {
-			data, err := storage.GetFile(cl.FilePath)
-			if err != nil {
-				logger.Error("读取文件失败: %v", err)
-				return fiber.NewError(fiber.StatusInternalServerError, "读取文件失败")
-			}
-
-			c.Set("Content-Type", cl.ContentType)
-			c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`,
-				filepath.Base(cl.FilePath)))
-
-			return c.Send(data)
-		}
+	// 受保护的剪贴板需要校验密码，在事务外进行以便记录失败次数
+	if err := verifyClipPassword(c, cl); err != nil {
+		return err
+	}
 
-		return c.JSON(fiber.Map{
-			"code":    fiber.StatusOK,
-			"message": "获取成功",
-			"data": clip.ClipResponse{
-				Clip: cl,
-			},
-		})
-	})
+	return sendClip(c, cl, isDownload)
 }
 
 // HandleGetClip 获取单个剪贴板内容
 // @Summary 获取Clip详情
-// @Description 根据ID获取单个Clip的详细信息
+// @Description 根据ID获取单个Clip的详细信息，受密码保护的Clip需在 X-Clip-Password 请求头中提供密码
 // @Tags 剪贴板
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path string true "Clip ID"
+// @Param X-Clip-Password header string false "剪贴板访问密码"
 // @Success 200 {object} clip.ClipResponse "获取成功"
 // @Failure 401 {object} string "未授权"
+// @Failure 403 {object} string "缺少密码或密码错误"
 // @Failure 404 {object} string "Clip不存在"
+// @Failure 423 {object} string "密码错误次数过多，已临时锁定"
 // @Failure 500 {object} string "服务器内部错误"
 // @Router /api/v1/nlip/clips/{id} [get]
 func HandleGetClip(c *fiber.Ctx) error {
@@ -477,7 +540,8 @@ func HandleGetClip(c *fiber.Ctx) error {
 	clipID := c.Params("clipId")
 	isDownload := c.Query("download") == "true"
 
-	return db.WithTransaction(config.DB, func(tx *sql.Tx) error {
+	var cl *clip.Clip
+	err := db.WithTransaction(config.DB, func(tx *sql.Tx) error {
 		// 查询剪贴板内容
 		row := tx.QueryRow(
 			selectClipWithCreatorSQL+
@@ -485,36 +549,49 @@ func HandleGetClip(c *fiber.Ctx) error {
 			clipID, s.ID,
 		)
 
-		cl, err := scanSingleClip(row)
+		var err error
+		cl, err = scanSingleClip(row)
 		if err == sql.ErrNoRows {
 			return fiber.NewError(fiber.StatusNotFound, ErrClipNotFound)
 		} else if err != nil {
 			logger.Error("获取剪贴板内容失败: %v", err)
 			return fiber.NewError(fiber.StatusInternalServerError, "获取剪贴板内容失败")
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-		// 处理文件下载请求
-		if cl.FilePath != "" && isDownload {
-			data, err := storage.GetFile(cl.FilePath)
-			if err != nil {
-				logger.Error("读取文件失败: %v", err)
-				return fiber.NewError(fiber.StatusInternalServerError, "读取文件失败")
-			}
+	if err := verifyClipPassword(c, cl); err != nil {
+		return err
+	}
 
-			c.Set("Content-Type", cl.ContentType)
-			c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`,
-				filepath.Base(cl.FilePath)))
+	return sendClip(c, cl, isDownload)
+}
 
-			return c.Send(data)
+// sendClip 返回剪贴板内容，文件类型且请求下载时直接返回文件数据
+func sendClip(c *fiber.Ctx, cl *clip.Clip, isDownload bool) error {
+	if cl.FilePath != "" && isDownload {
+		data, err := storage.GetFile(cl.FilePath)
+		if err != nil {
+			logger.Error("读取文件失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "读取文件失败")
 		}
 
-		return c.JSON(fiber.Map{
-			"code":    fiber.StatusOK,
-			"message": "获取成功",
-			"data": clip.ClipResponse{
-				Clip: cl,
-			},
-		})
+		c.Set("Content-Type", cl.ContentType)
+		c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`,
+			filepath.Base(cl.FilePath)))
+
+		return c.Send(data)
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取成功",
+		"data": clip.ClipResponse{
+			Clip: cl,
+		},
 	})
 }
 
@@ -561,6 +638,20 @@ func HandleDeleteClip(c *fiber.Ctx) error {
 			return fiber.NewError(fiber.StatusInternalServerError, "删除剪贴板内容失败")
 		}
 
+		// 删除关联的分享链接及访问记录
+		_, err = tx.Exec(`
+			DELETE FROM nlip_share_access_logs WHERE share_id IN (
+				SELECT id FROM nlip_share_links WHERE clip_id = ? AND space_id = ?
+			)
+		`, clipID, s.ID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "删除分享链接失败")
+		}
+		_, err = tx.Exec("DELETE FROM nlip_share_links WHERE clip_id = ? AND space_id = ?", clipID, s.ID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "删除分享链接失败")
+		}
+
 		// 删除关联文件
 		if filePath != "" {
 			if err := storage.DeleteFile(filePath); err != nil {
@@ -574,6 +665,9 @@ func HandleDeleteClip(c *fiber.Ctx) error {
 		return err
 	}
 
+	events.Publish(s.ID, events.ClipDeleted, fiber.Map{"clipId": clipID})
+	webhook.Enqueue(s.ID, events.ClipDeleted, fiber.Map{"clipId": clipID})
+
 	logger.Info("用户 %s 删除了剪贴板内容: spaceID=%s, clipID=%s", userID, s.ID, clipID)
 	return c.JSON(fiber.Map{
 		"code":    fiber.StatusOK,
@@ -609,19 +703,38 @@ func HandleUpdateClip(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidRequest)
 	}
 
-	return db.WithTransaction(config.DB, func(tx *sql.Tx) error {
+	// 受保护的剪贴板在修改前需要校验密码
+	row := config.DB.QueryRow(
+		selectClipWithCreatorSQL+
+			"WHERE c.clip_id = ? AND c.space_id = ?",
+		clipID, s.ID,
+	)
+	existing, err := scanSingleClip(row)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, ErrClipNotFound)
+	} else if err != nil {
+		logger.Error("获取剪贴板内容失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取剪贴板内容失败")
+	}
+	if err := verifyClipPassword(c, existing); err != nil {
+		return err
+	}
+
+	var updatedClip *clip.Clip
+	err = db.WithTransaction(config.DB, func(tx *sql.Tx) error {
 		// 权限检查
 		_, err := checkClipPermission(tx, s.ID, s.Type, clipID, userID, isAdmin)
 		if err != nil {
 			return err
 		}
 
-		// 更新内容
+		// 更新内容，文件大小保持不变，只按文本长度的变化调整存储用量
 		result, err := tx.Exec(`
 			UPDATE nlip_clipboard_items 
-			SET content = ?, updated_at = ?
+			SET content = ?, updated_at = ?,
+				size_bytes = size_bytes - COALESCE(LENGTH(CAST(content AS BLOB)), 0) + ?
 			WHERE clip_id = ? AND space_id = ?
-		`, req.Content, time.Now(), clipID, s.ID)
+		`, req.Content, time.Now(), len(req.Content), clipID, s.ID)
 
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "更新剪贴板内容失败")
@@ -632,6 +745,17 @@ func HandleUpdateClip(c *fiber.Ctx) error {
 			return fiber.NewError(fiber.StatusNotFound, ErrClipNotFound)
 		}
 
+		// 内容变长时检查存储配额，用量计入原创建者
+		if len(req.Content) > len(existing.Content) {
+			creatorID := ""
+			if existing.Creator != nil {
+				creatorID = existing.Creator.ID
+			}
+			if err := checkQuota(tx, s.ID, creatorID); err != nil {
+				return err
+			}
+		}
+
 		// 查询更新后的完整剪贴板内容
 		row := tx.QueryRow(
 			selectClipWithCreatorSQL+
@@ -639,18 +763,24 @@ func HandleUpdateClip(c *fiber.Ctx) error {
 			clipID, s.ID,
 		)
 
-		cl, err := scanSingleClip(row)
+		updatedClip, err = scanSingleClip(row)
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "获取更新后的剪贴板内容失败")
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-		logger.Info("用户 %s 更新了剪贴板内容: spaceID=%s, clipID=%s", userID, s.ID, clipID)
-		return c.JSON(fiber.Map{
-			"code":    fiber.StatusOK,
-			"message": "更新成功",
-			"data": clip.ClipResponse{
-				Clip: cl,
-			},
-		})
+	publishClipEvent(events.ClipUpdated, updatedClip)
+
+	logger.Info("用户 %s 更新了剪贴板内容: spaceID=%s, clipID=%s", userID, s.ID, clipID)
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "更新成功",
+		"data": clip.ClipResponse{
+			Clip: updatedClip,
+		},
 	})
 }
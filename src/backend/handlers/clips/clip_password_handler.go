@@ -0,0 +1,187 @@
+package clips
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"nlip/config"
+	"nlip/models/clip"
+	"nlip/models/space"
+	"nlip/utils/logger"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// ClipPasswordHeader 访问受保护剪贴板时携带密码的请求头
+	ClipPasswordHeader = "X-Clip-Password"
+
+	// 连续输错密码的次数上限及锁定时长
+	maxClipPasswordAttempts  = 5
+	clipPasswordLockDuration = 15 * time.Minute
+
+	ErrClipPasswordRequired = "该剪贴板受密码保护，请提供访问密码"
+	ErrClipPasswordInvalid  = "剪贴板密码错误"
+)
+
+// hashClipPassword 生成剪贴板密码哈希，与用户密码使用相同的 bcrypt 参数
+func hashClipPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+// maskProtectedClip 隐藏受保护剪贴板的内容，仅保留其存在信息
+func maskProtectedClip(cl *clip.Clip) {
+	if cl.IsProtected {
+		cl.Content = ""
+		cl.FilePath = ""
+	}
+}
+
+// verifyClipPassword 校验受保护剪贴板的访问密码
+// 连续输错达到上限后临时锁定该剪贴板，锁定期间拒绝所有密码尝试
+func verifyClipPassword(c *fiber.Ctx, cl *clip.Clip) error {
+	if !cl.IsProtected {
+		return nil
+	}
+
+	var failedAttempts int
+	var lockedUntil sql.NullTime
+	err := config.DB.QueryRow(`
+		SELECT COALESCE(failed_attempts, 0), locked_until
+		FROM nlip_clipboard_items WHERE id = ?
+	`, cl.ID).Scan(&failedAttempts, &lockedUntil)
+	if err != nil {
+		logger.Error("查询剪贴板锁定状态失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "查询剪贴板状态失败")
+	}
+
+	now := time.Now()
+	if lockedUntil.Valid && lockedUntil.Time.After(now) {
+		minutes := int(math.Ceil(lockedUntil.Time.Sub(now).Minutes()))
+		return fiber.NewError(fiber.StatusLocked,
+			fmt.Sprintf("密码错误次数过多，剪贴板已被临时锁定，请在%d分钟后重试", minutes))
+	}
+
+	password := c.Get(ClipPasswordHeader)
+	if password == "" {
+		return fiber.NewError(fiber.StatusForbidden, ErrClipPasswordRequired)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(cl.PasswordHash), []byte(password)); err != nil {
+		// 计数和锁定在同一条语句中完成，并发的错误尝试不会互相覆盖计数
+		// 计数只在输入正确密码后清零，锁定到期后再次输错会立即重新锁定
+		var newLockedUntil sql.NullTime
+		err := config.DB.QueryRow(`
+			UPDATE nlip_clipboard_items
+			SET failed_attempts = COALESCE(failed_attempts, 0) + 1,
+				locked_until = CASE WHEN COALESCE(failed_attempts, 0) + 1 >= ? THEN ? END
+			WHERE id = ? AND (locked_until IS NULL OR locked_until <= ?)
+			RETURNING failed_attempts, locked_until
+		`, maxClipPasswordAttempts, now.Add(clipPasswordLockDuration), cl.ID, now).Scan(&failedAttempts, &newLockedUntil)
+		if err == sql.ErrNoRows {
+			// 其他请求在此期间已触发锁定
+			return fiber.NewError(fiber.StatusLocked, "密码错误次数过多，剪贴板已被临时锁定，请稍后重试")
+		} else if err != nil {
+			logger.Error("更新剪贴板密码尝试次数失败: %v", err)
+		} else if newLockedUntil.Valid {
+			logger.Warning("剪贴板密码连续错误%d次，已临时锁定: clipID=%s, spaceID=%s", failedAttempts, cl.ClipID, cl.SpaceID)
+		}
+
+		logger.Warning("剪贴板密码验证失败: clipID=%s, spaceID=%s", cl.ClipID, cl.SpaceID)
+		return fiber.NewError(fiber.StatusForbidden, ErrClipPasswordInvalid)
+	}
+
+	if failedAttempts > 0 || lockedUntil.Valid {
+		if _, err := config.DB.Exec(`
+			UPDATE nlip_clipboard_items SET failed_attempts = 0, locked_until = NULL WHERE id = ?
+		`, cl.ID); err != nil {
+			logger.Error("重置剪贴板密码尝试次数失败: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// HandleSetClipPassword 设置或清除剪贴板密码
+// @Summary 设置Clip密码
+// @Description 为剪贴板设置访问密码，密码为空时清除密码。仅创建者、空间所有者或管理员可操作
+// @Tags 剪贴板
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Clip ID"
+// @Param request body clip.SetClipPasswordRequest true "设置密码请求参数"
+// @Success 200 {object} string "设置成功"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 403 {object} string "无权限操作"
+// @Failure 404 {object} string "Clip不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/spaces/{spaceId}/clips/{id}/password [put]
+func HandleSetClipPassword(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+	clipID := c.Params("clipId")
+	userID := c.Locals("userId").(string)
+	isAdmin := c.Locals("isAdmin").(bool)
+
+	var req clip.SetClipPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidRequest)
+	}
+
+	var creatorID sql.NullString
+	err := config.DB.QueryRow(`
+		SELECT creator_id FROM nlip_clipboard_items WHERE clip_id = ? AND space_id = ?
+	`, clipID, s.ID).Scan(&creatorID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, ErrClipNotFound)
+	} else if err != nil {
+		logger.Error("查询剪贴板内容失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "查询剪贴板内容失败")
+	}
+
+	if !isAdmin && userID != s.OwnerID && userID != creatorID.String {
+		logger.Warning("用户 %s 尝试修改剪贴板密码: spaceID=%s, clipID=%s", userID, s.ID, clipID)
+		return fiber.NewError(fiber.StatusForbidden, ErrNoPermission)
+	}
+
+	var passwordHash interface{}
+	if req.Password != "" {
+		hashed, err := hashClipPassword(req.Password)
+		if err != nil {
+			logger.Error("生成剪贴板密码哈希失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "密码加密失败")
+		}
+		passwordHash = hashed
+	}
+
+	_, err = config.DB.Exec(`
+		UPDATE nlip_clipboard_items
+		SET password_hash = ?, failed_attempts = 0, locked_until = NULL
+		WHERE clip_id = ? AND space_id = ?
+	`, passwordHash, clipID, s.ID)
+	if err != nil {
+		logger.Error("更新剪贴板密码失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "更新剪贴板密码失败")
+	}
+
+	message := "设置密码成功"
+	if req.Password == "" {
+		message = "已清除密码"
+	}
+
+	logger.Info("用户 %s 更新了剪贴板密码: spaceID=%s, clipID=%s, protected=%v",
+		userID, s.ID, clipID, req.Password != "")
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": message,
+		"data": fiber.Map{
+			"isProtected": req.Password != "",
+		},
+	})
+}
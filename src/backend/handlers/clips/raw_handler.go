@@ -0,0 +1,196 @@
+package clips
+
+import (
+	"database/sql"
+	"fmt"
+	"mime"
+	"net/http"
+	"nlip/config"
+	"nlip/models/clip"
+	"nlip/models/space"
+	"nlip/utils/logger"
+	"nlip/utils/storage"
+	"nlip/utils/validator"
+	"path/filepath"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LastClipID 获取最近修改的剪贴板时使用的特殊ID
+const LastClipID = "last"
+
+// binaryPasteExt 未指定文件名粘贴的二进制内容使用的扩展名
+const binaryPasteExt = ".bin"
+
+// buildRawURL 生成剪贴板纯文本访问地址
+func buildRawURL(spaceID, clipID string) string {
+	return fmt.Sprintf("%s/api/v1/nlip/raw/%s/%s", config.Get().FrontendURL, spaceID, clipID)
+}
+
+// detectRawContentType 根据请求头、文件扩展名和内容推断文件类型
+func detectRawContentType(c *fiber.Ctx, fileName string, data []byte) string {
+	contentType := c.Get(fiber.HeaderContentType)
+	if contentType != "" && contentType != fiber.MIMEApplicationForm && contentType != fiber.MIMEOctetStream {
+		return contentType
+	}
+	if byExt := mime.TypeByExtension(filepath.Ext(fileName)); byExt != "" {
+		return byExt
+	}
+	return http.DetectContentType(data)
+}
+
+// HandlePasteClip 以原始请求体创建剪贴板内容
+// @Summary 粘贴原始内容
+// @Description 直接使用请求体创建剪贴板内容，便于 curl 等命令行工具使用。指定文件名时保存为文件；未指定时文本内容保存为文本，二进制内容保存为 paste-<id>.bin 文件。返回纯文本格式的访问地址
+// @Tags 剪贴板
+// @Accept plain
+// @Produce plain
+// @Security BearerAuth
+// @Param spaceId path string true "空间ID"
+// @Param filename path string false "文件名"
+// @Param X-API-Token header string false "用户Token"
+// @Param X-Clip-Password header string false "剪贴板密码"
+// @Success 200 {string} string "剪贴板纯文本访问地址"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 401 {object} string "未授权"
+// @Failure 403 {object} string "无权限操作"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/p/{spaceId}/{filename} [post]
+// @Router /api/v1/nlip/p/{spaceId}/{filename} [put]
+func HandlePasteClip(c *fiber.Ctx) error {
+	userID := GuestUserID
+	username := "游客"
+	if c.Locals("userId") != nil {
+		userID = c.Locals("userId").(string)
+		username = c.Locals("username").(string)
+	}
+
+	s := c.Locals("space").(space.Space)
+	fileName := c.Params("filename")
+	body := c.Body()
+
+	if len(body) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "内容不能为空")
+	}
+	if int64(len(body)) > config.Get().MaxFileSize {
+		return fiber.NewError(fiber.StatusBadRequest, "文件大小超过限制")
+	}
+
+	var content, contentType string
+	var fileData []byte
+	if fileName != "" {
+		if !validator.ValidateFileName(fileName) {
+			return fiber.NewError(fiber.StatusBadRequest, "文件名不合法")
+		}
+		contentType = detectRawContentType(c, fileName, body)
+		if !validator.ValidateFileType(fileName, contentType) {
+			return fiber.NewError(fiber.StatusBadRequest, "不支持的文件类型")
+		}
+		fileData = body
+	} else if utf8.Valid(body) {
+		content = string(body)
+	} else {
+		// 未指定文件名的二进制内容保存为 paste-<id>.bin 文件，类型根据内容推断
+		contentType = http.DetectContentType(body)
+		if !validator.ValidateFileType("paste"+binaryPasteExt, contentType) {
+			return fiber.NewError(fiber.StatusBadRequest, "不支持的文件类型")
+		}
+		fileData = body
+	}
+
+	var passwordHash string
+	if password := c.Get(ClipPasswordHeader); password != "" {
+		if len(password) < 4 || len(password) > 72 {
+			return fiber.NewError(fiber.StatusBadRequest, "密码长度需在4到72个字符之间")
+		}
+		hashed, err := hashClipPassword(password)
+		if err != nil {
+			logger.Error("生成剪贴板密码哈希失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "密码加密失败")
+		}
+		passwordHash = hashed
+	}
+
+	cl, err := CreateClip(s, userID, username, content, fileData, fileName, contentType, passwordHash)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("用户 %s 通过原始内容接口上传到空间 %s: clipID=%s", userID, s.ID, cl.ClipID)
+	c.Type("txt", "utf-8")
+	return c.SendString(buildRawURL(s.ID, cl.ClipID) + "\n")
+}
+
+// HandleGetRawClip 获取剪贴板的原始内容
+// @Summary 获取原始内容
+// @Description 以纯文本或文件原始字节返回剪贴板内容，clipId 为 last 时返回最近修改的内容
+// @Tags 剪贴板
+// @Produce plain
+// @Security BearerAuth
+// @Param spaceId path string true "空间ID"
+// @Param clipId path string true "Clip ID 或 last"
+// @Param X-API-Token header string false "用户Token"
+// @Param X-Clip-Password header string false "剪贴板密码"
+// @Success 200 {string} string "剪贴板原始内容"
+// @Failure 401 {object} string "未授权"
+// @Failure 403 {object} string "缺少密码或密码错误"
+// @Failure 404 {object} string "Clip不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/raw/{spaceId}/{clipId} [get]
+func HandleGetRawClip(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+	clipID := c.Params("clipId")
+
+	var row *sql.Row
+	if clipID == LastClipID {
+		row = config.DB.QueryRow(
+			selectClipWithCreatorSQL+
+				"WHERE c.space_id = ? ORDER BY c.updated_at DESC LIMIT 1",
+			s.ID,
+		)
+	} else {
+		row = config.DB.QueryRow(
+			selectClipWithCreatorSQL+
+				"WHERE c.clip_id = ? AND c.space_id = ?",
+			clipID, s.ID,
+		)
+	}
+
+	cl, err := scanSingleClip(row)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, ErrClipNotFound)
+	} else if err != nil {
+		logger.Error("获取剪贴板内容失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取剪贴板内容失败")
+	}
+
+	if err := verifyClipPassword(c, cl); err != nil {
+		return err
+	}
+
+	return sendRawClip(c, cl)
+}
+
+// sendRawClip 返回剪贴板原始内容，文件返回原始字节，文本返回 text/plain
+func sendRawClip(c *fiber.Ctx, cl *clip.Clip) error {
+	if cl.FilePath != "" {
+		data, err := storage.GetFile(cl.FilePath)
+		if err != nil {
+			logger.Error("读取文件失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "读取文件失败")
+		}
+
+		contentType := cl.ContentType
+		if contentType == "" {
+			contentType = fiber.MIMEOctetStream
+		}
+		c.Set(fiber.HeaderContentType, contentType)
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; filename="%s"`,
+			filepath.Base(cl.FilePath)))
+		return c.Send(data)
+	}
+
+	c.Type("txt", "utf-8")
+	return c.SendString(cl.Content)
+}
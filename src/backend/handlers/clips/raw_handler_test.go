@@ -0,0 +1,98 @@
+package clips_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"nlip/config"
+	"nlip/middleware"
+	"nlip/middleware/limiter"
+	"nlip/routes"
+	"nlip/utils/clientip"
+	"nlip/utils/testutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var binNamePattern = regexp.MustCompile(`^paste-[a-z2-7]{6}\.bin$`)
+
+func newApp() *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.CustomErrorHandler})
+	clientip.ApplyConfig(nil, config.Get())
+	app.Use(limiter.New())
+	routes.SetupRoutes(app.Group("/api"))
+	return app
+}
+
+// TestPasteBinaryWithoutFileName 未指定文件名时，文本保存为文本，二进制内容保存为 paste-<id>.bin 文件
+func TestPasteBinaryWithoutFileName(t *testing.T) {
+	testutil.Setup(t)
+	app := newApp()
+
+	ownerID := testutil.CreateUser(t, "alice", false)
+	spaceID := testutil.CreateSpace(t, "alice-private", "private", ownerID, nil)
+	token := testutil.Token(t, ownerID, "alice", false)
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0xff, 0x00}, 32)...)
+	tests := []struct {
+		name            string
+		body            []byte
+		wantContentType string
+		wantFile        bool
+	}{
+		{"文本内容", []byte("hello nlip\n"), "", false},
+		{"PNG 图片", png, "image/png", true},
+		{"未知二进制内容", []byte{0x00, 0xfe, 0xff, 0x01, 0x02}, "application/octet-stream", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/api/v1/nlip/p/"+spaceID, bytes.NewReader(tt.body))
+			req.Header.Set("Authorization", token)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			rawURL, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("粘贴返回 %d，期望 200: %s", resp.StatusCode, rawURL)
+			}
+			clipID := filepath.Base(strings.TrimSpace(string(rawURL)))
+
+			var contentType, filePath string
+			err = config.DB.QueryRow(`
+				SELECT content_type, COALESCE(file_path, '') FROM nlip_clipboard_items
+				WHERE space_id = ? AND clip_id = ?
+			`, spaceID, clipID).Scan(&contentType, &filePath)
+			if err != nil {
+				t.Fatalf("查询剪贴板内容失败: %v", err)
+			}
+			if contentType != tt.wantContentType {
+				t.Errorf("内容类型为 %q，期望 %q", contentType, tt.wantContentType)
+			}
+			if tt.wantFile && !binNamePattern.MatchString(filepath.Base(filePath)) {
+				t.Errorf("文件路径为 %q，期望文件名为 paste-<id>.bin", filePath)
+			}
+			if !tt.wantFile && filePath != "" {
+				t.Errorf("文本内容不应保存为文件，实际文件路径为 %q", filePath)
+			}
+
+			req = httptest.NewRequest("GET", "/api/v1/nlip/raw/"+spaceID+"/"+clipID, nil)
+			req.Header.Set("Authorization", token)
+			resp, err = app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			data, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if !bytes.Equal(data, tt.body) {
+				t.Errorf("读取到的内容与上传的不一致")
+			}
+		})
+	}
+}
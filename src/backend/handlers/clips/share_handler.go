@@ -0,0 +1,454 @@
+package clips
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"nlip/config"
+	"nlip/models/share"
+	"nlip/models/space"
+	"nlip/utils/clientip"
+	"nlip/utils/logger"
+	"nlip/utils/sign"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// 分享访问状态
+const (
+	shareStatusOK               = "ok"
+	shareStatusRevoked          = "revoked"
+	shareStatusExpired          = "expired"
+	shareStatusLimitReached     = "limit_reached"
+	shareStatusClipMissing      = "clip_missing"
+	shareStatusPasswordRejected = "password_rejected"
+
+	ErrShareNotFound = "分享链接不存在或无效"
+)
+
+// generateShareToken 生成带签名的分享令牌，令牌中包含分享ID和过期时间
+func generateShareToken(shareID string, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%s.%d", shareID, expiresAt.Unix())
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + sign.Sign([]byte(encoded), config.Get().JWTSecret)
+}
+
+// parseShareToken 校验分享令牌签名并解析出分享ID和过期时间
+func parseShareToken(token string) (string, time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", time.Time{}, errors.New("分享令牌格式错误")
+	}
+	if !sign.Verify([]byte(parts[0]), parts[1], config.Get().JWTSecret) {
+		return "", time.Time{}, errors.New("分享令牌签名无效")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("分享令牌解码失败: %w", err)
+	}
+	fields := strings.Split(string(payload), ".")
+	if len(fields) != 2 {
+		return "", time.Time{}, errors.New("分享令牌内容错误")
+	}
+	expiresUnix, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("分享令牌过期时间错误: %w", err)
+	}
+
+	return fields[0], time.Unix(expiresUnix, 0), nil
+}
+
+// buildShareURL 生成分享链接的完整访问地址
+func buildShareURL(token string) string {
+	return fmt.Sprintf("%s/api/v1/nlip/s/%s", config.Get().FrontendURL, token)
+}
+
+// checkClipManager 检查当前用户是否可以管理指定剪贴板的分享
+// 仅剪贴板创建者、空间所有者和管理员可以管理
+func checkClipManager(c *fiber.Ctx, s space.Space, clipID string) (string, error) {
+	userID, ok := c.Locals("userId").(string)
+	if !ok || userID == "" {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "请先登录")
+	}
+	isAdmin, _ := c.Locals("isAdmin").(bool)
+
+	var creatorID sql.NullString
+	err := config.DB.QueryRow(`
+		SELECT creator_id FROM nlip_clipboard_items WHERE clip_id = ? AND space_id = ?
+	`, clipID, s.ID).Scan(&creatorID)
+	if err == sql.ErrNoRows {
+		return "", fiber.NewError(fiber.StatusNotFound, ErrClipNotFound)
+	} else if err != nil {
+		logger.Error("查询剪贴板内容失败: %v", err)
+		return "", fiber.NewError(fiber.StatusInternalServerError, "查询剪贴板内容失败")
+	}
+
+	if !isAdmin && userID != s.OwnerID && userID != creatorID.String {
+		logger.Warning("用户 %s 尝试管理剪贴板分享: spaceID=%s, clipID=%s", userID, s.ID, clipID)
+		return "", fiber.NewError(fiber.StatusForbidden, ErrNoPermission)
+	}
+
+	return userID, nil
+}
+
+// recordShareAccess 记录分享链接的访问情况，供剪贴板所有者查看
+func recordShareAccess(c *fiber.Ctx, shareID, action, status string) {
+	userAgent := c.Get("User-Agent")
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	_, err := config.DB.Exec(`
+		INSERT INTO nlip_share_access_logs (share_id, ip, user_agent, action, status, accessed_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, shareID, clientip.IP(c), userAgent, action, status, time.Now())
+	if err != nil {
+		logger.Error("记录分享访问失败: %v", err)
+	}
+}
+
+// HandleCreateShare 创建剪贴板分享链接
+// @Summary 创建分享链接
+// @Description 为单个剪贴板创建带签名、可过期的公开只读分享链接，可限制下载次数
+// @Tags 分享
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Clip ID"
+// @Param request body share.CreateShareRequest true "创建分享链接请求参数"
+// @Success 201 {object} share.ShareResponse "创建成功"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 403 {object} string "无权限操作"
+// @Failure 404 {object} string "Clip不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/spaces/{spaceId}/clips/{id}/shares [post]
+func HandleCreateShare(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+	clipID := c.Params("clipId")
+
+	var req share.CreateShareRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidRequest)
+	}
+
+	userID, err := checkClipManager(c, s, clipID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	link := share.ShareLink{
+		ID:           uuid.New().String(),
+		SpaceID:      s.ID,
+		ClipID:       clipID,
+		CreatedBy:    userID,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(time.Duration(req.ExpiresInHours) * time.Hour),
+		MaxDownloads: req.MaxDownloads,
+	}
+
+	_, err = config.DB.Exec(`
+		INSERT INTO nlip_share_links (id, space_id, clip_id, created_by, created_at, expires_at, max_downloads)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, link.ID, link.SpaceID, link.ClipID, link.CreatedBy, link.CreatedAt, link.ExpiresAt, link.MaxDownloads)
+	if err != nil {
+		logger.Error("创建分享链接失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "创建分享链接失败")
+	}
+
+	link.URL = buildShareURL(generateShareToken(link.ID, link.ExpiresAt))
+
+	logger.Info("用户 %s 创建了分享链接: spaceID=%s, clipID=%s, shareID=%s", userID, s.ID, clipID, link.ID)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"code":    fiber.StatusCreated,
+		"message": "创建分享链接成功",
+		"data": share.ShareResponse{
+			Share: &link,
+		},
+	})
+}
+
+// HandleListShares 获取剪贴板的分享链接列表
+// @Summary 获取分享链接列表
+// @Description 获取指定剪贴板的所有分享链接及访问次数
+// @Tags 分享
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Clip ID"
+// @Success 200 {object} share.ListSharesResponse "获取成功"
+// @Failure 403 {object} string "无权限操作"
+// @Failure 404 {object} string "Clip不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/spaces/{spaceId}/clips/{id}/shares [get]
+func HandleListShares(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+	clipID := c.Params("clipId")
+
+	if _, err := checkClipManager(c, s, clipID); err != nil {
+		return err
+	}
+
+	rows, err := config.DB.Query(`
+		SELECT l.id, l.space_id, l.clip_id, l.created_by, l.created_at, l.expires_at,
+			l.max_downloads, l.download_count, l.revoked_at,
+			(SELECT COUNT(*) FROM nlip_share_access_logs a WHERE a.share_id = l.id)
+		FROM nlip_share_links l
+		WHERE l.space_id = ? AND l.clip_id = ?
+		ORDER BY l.created_at DESC
+	`, s.ID, clipID)
+	if err != nil {
+		logger.Error("获取分享链接列表失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取分享链接列表失败")
+	}
+	defer rows.Close()
+
+	shares := []share.ShareLink{}
+	for rows.Next() {
+		var link share.ShareLink
+		var maxDownloads sql.NullInt64
+		var revokedAt sql.NullTime
+		if err := rows.Scan(&link.ID, &link.SpaceID, &link.ClipID, &link.CreatedBy, &link.CreatedAt,
+			&link.ExpiresAt, &maxDownloads, &link.DownloadCount, &revokedAt, &link.AccessCount); err != nil {
+			logger.Error("读取分享链接数据失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "读取分享链接数据失败")
+		}
+		if maxDownloads.Valid {
+			limit := int(maxDownloads.Int64)
+			link.MaxDownloads = &limit
+		}
+		if revokedAt.Valid {
+			link.RevokedAt = &revokedAt.Time
+		}
+		shares = append(shares, link)
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取分享链接列表成功",
+		"data": share.ListSharesResponse{
+			Shares: shares,
+		},
+	})
+}
+
+// HandleRevokeShare 撤销分享链接
+// @Summary 撤销分享链接
+// @Description 撤销指定的分享链接，撤销后链接立即失效
+// @Tags 分享
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Clip ID"
+// @Param shareId path string true "分享链接ID"
+// @Success 200 {object} string "撤销成功"
+// @Failure 403 {object} string "无权限操作"
+// @Failure 404 {object} string "分享链接不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/spaces/{spaceId}/clips/{id}/shares/{shareId} [delete]
+func HandleRevokeShare(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+	clipID := c.Params("clipId")
+	shareID := c.Params("shareId")
+
+	userID, err := checkClipManager(c, s, clipID)
+	if err != nil {
+		return err
+	}
+
+	result, err := config.DB.Exec(`
+		UPDATE nlip_share_links SET revoked_at = ?
+		WHERE id = ? AND space_id = ? AND clip_id = ? AND revoked_at IS NULL
+	`, time.Now(), shareID, s.ID, clipID)
+	if err != nil {
+		logger.Error("撤销分享链接失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "撤销分享链接失败")
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, ErrShareNotFound)
+	}
+
+	logger.Info("用户 %s 撤销了分享链接: spaceID=%s, clipID=%s, shareID=%s", userID, s.ID, clipID, shareID)
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "撤销分享链接成功",
+		"data":    nil,
+	})
+}
+
+// HandleListShareAccessLogs 获取分享链接的访问记录
+// @Summary 获取分享访问记录
+// @Description 获取指定分享链接的所有访问记录，包括被拒绝的访问
+// @Tags 分享
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Clip ID"
+// @Param shareId path string true "分享链接ID"
+// @Success 200 {object} share.ListAccessLogsResponse "获取成功"
+// @Failure 403 {object} string "无权限操作"
+// @Failure 404 {object} string "分享链接不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/spaces/{spaceId}/clips/{id}/shares/{shareId}/logs [get]
+func HandleListShareAccessLogs(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+	clipID := c.Params("clipId")
+	shareID := c.Params("shareId")
+
+	if _, err := checkClipManager(c, s, clipID); err != nil {
+		return err
+	}
+
+	var exists bool
+	err := config.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM nlip_share_links WHERE id = ? AND space_id = ? AND clip_id = ?)
+	`, shareID, s.ID, clipID).Scan(&exists)
+	if err != nil {
+		logger.Error("查询分享链接失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "查询分享链接失败")
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, ErrShareNotFound)
+	}
+
+	rows, err := config.DB.Query(`
+		SELECT id, share_id, ip, user_agent, action, status, accessed_at
+		FROM nlip_share_access_logs
+		WHERE share_id = ?
+		ORDER BY accessed_at DESC
+	`, shareID)
+	if err != nil {
+		logger.Error("获取分享访问记录失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取分享访问记录失败")
+	}
+	defer rows.Close()
+
+	logs := []share.AccessLog{}
+	for rows.Next() {
+		var log share.AccessLog
+		var ip, userAgent sql.NullString
+		if err := rows.Scan(&log.ID, &log.ShareID, &ip, &userAgent, &log.Action, &log.Status, &log.AccessedAt); err != nil {
+			logger.Error("读取分享访问记录失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "读取分享访问记录失败")
+		}
+		log.IP = ip.String
+		log.UserAgent = userAgent.String
+		logs = append(logs, log)
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取分享访问记录成功",
+		"data": share.ListAccessLogsResponse{
+			Logs: logs,
+		},
+	})
+}
+
+// HandleAccessShare 通过分享链接访问剪贴板
+// @Summary 访问分享链接
+// @Description 通过签名分享令牌公开只读访问单个剪贴板，无需登录。受密码保护的剪贴板仍需提供 X-Clip-Password
+// @Tags 分享
+// @Produce json
+// @Param token path string true "分享令牌"
+// @Param download query bool false "是否下载文件"
+// @Success 200 {object} clip.ClipResponse "获取成功"
+// @Failure 403 {object} string "缺少密码或密码错误"
+// @Failure 404 {object} string "分享链接不存在或无效"
+// @Failure 410 {object} string "分享链接已撤销、过期或达到下载次数上限"
+// @Router /api/v1/nlip/s/{token} [get]
+func HandleAccessShare(c *fiber.Ctx) error {
+	isDownload := c.Query("download") == "true"
+	action := "view"
+	if isDownload {
+		action = "download"
+	}
+
+	shareID, tokenExpiresAt, err := parseShareToken(c.Params("token"))
+	if err != nil {
+		logger.Warning("无效的分享令牌: %v", err)
+		return fiber.NewError(fiber.StatusNotFound, ErrShareNotFound)
+	}
+
+	var spaceID, clipID string
+	var expiresAt time.Time
+	var maxDownloads sql.NullInt64
+	var downloadCount int
+	var revokedAt sql.NullTime
+	err = config.DB.QueryRow(`
+		SELECT space_id, clip_id, expires_at, max_downloads, download_count, revoked_at
+		FROM nlip_share_links WHERE id = ?
+	`, shareID).Scan(&spaceID, &clipID, &expiresAt, &maxDownloads, &downloadCount, &revokedAt)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, ErrShareNotFound)
+	} else if err != nil {
+		logger.Error("查询分享链接失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "查询分享链接失败")
+	}
+
+	now := time.Now()
+	switch {
+	case revokedAt.Valid:
+		recordShareAccess(c, shareID, action, shareStatusRevoked)
+		return fiber.NewError(fiber.StatusGone, "分享链接已被撤销")
+	case now.After(expiresAt) || now.After(tokenExpiresAt):
+		recordShareAccess(c, shareID, action, shareStatusExpired)
+		return fiber.NewError(fiber.StatusGone, "分享链接已过期")
+	case maxDownloads.Valid && int64(downloadCount) >= maxDownloads.Int64:
+		recordShareAccess(c, shareID, action, shareStatusLimitReached)
+		return fiber.NewError(fiber.StatusGone, "分享链接已达到下载次数上限")
+	}
+
+	row := config.DB.QueryRow(
+		selectClipWithCreatorSQL+
+			"WHERE c.clip_id = ? AND c.space_id = ?",
+		clipID, spaceID,
+	)
+	cl, err := scanSingleClip(row)
+	if err == sql.ErrNoRows {
+		recordShareAccess(c, shareID, action, shareStatusClipMissing)
+		return fiber.NewError(fiber.StatusNotFound, ErrClipNotFound)
+	} else if err != nil {
+		logger.Error("获取剪贴板内容失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取剪贴板内容失败")
+	}
+
+	if err := verifyClipPassword(c, cl); err != nil {
+		recordShareAccess(c, shareID, action, shareStatusPasswordRejected)
+		return err
+	}
+
+	// 只有返回内容本身时才计入下载次数：文本剪贴板的内容在响应中，文件剪贴板只在下载时计数，
+	// 查看文件信息不消耗次数
+	if isDownload || cl.FilePath == "" {
+		// 原子地增加下载次数，避免并发访问超过下载次数上限
+		result, err := config.DB.Exec(`
+			UPDATE nlip_share_links SET download_count = download_count + 1
+			WHERE id = ? AND revoked_at IS NULL
+				AND (max_downloads IS NULL OR download_count < max_downloads)
+		`, shareID)
+		if err != nil {
+			logger.Error("更新分享链接下载次数失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "访问分享链接失败")
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			recordShareAccess(c, shareID, action, shareStatusLimitReached)
+			return fiber.NewError(fiber.StatusGone, "分享链接已达到下载次数上限")
+		}
+	}
+
+	recordShareAccess(c, shareID, action, shareStatusOK)
+	logger.Info("分享链接被访问: shareID=%s, spaceID=%s, clipID=%s, action=%s", shareID, spaceID, clipID, action)
+
+	// 公开访问时不暴露创建者信息和服务器上的文件路径
+	cl.Creator = nil
+	if !isDownload && cl.FilePath != "" {
+		cl.FilePath = filepath.Base(cl.FilePath)
+	}
+	return sendClip(c, cl, isDownload)
+}
@@ -0,0 +1,167 @@
+package clips_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"nlip/config"
+	"nlip/tasks/cleaner"
+	"nlip/utils/testutil"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// paste 通过原始内容接口创建剪贴板，返回剪贴板 ID
+func paste(t *testing.T, app *fiber.App, token, spaceID, content string) string {
+	t.Helper()
+	req := httptest.NewRequest("PUT", "/api/v1/nlip/p/"+spaceID, strings.NewReader(content))
+	req.Header.Set("Authorization", token)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	rawURL, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("粘贴返回 %d，期望 200: %s", resp.StatusCode, rawURL)
+	}
+	return path.Base(strings.TrimSpace(string(rawURL)))
+}
+
+// createShare 创建分享链接，返回公开访问地址中的路径
+func createShare(t *testing.T, app *fiber.App, token, spaceID, clipID string) string {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/v1/nlip/spaces/"+spaceID+"/clips/"+clipID+"/shares",
+		strings.NewReader(`{"expiresInHours":1}`))
+	req.Header.Set("Authorization", token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data struct {
+			Share struct {
+				URL string `json:"url"`
+			} `json:"share"`
+		} `json:"data"`
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("创建分享链接返回 %d，期望 201", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	return "/api/v1/nlip/s/" + path.Base(body.Data.Share.URL)
+}
+
+func countShares(t *testing.T, spaceID, clipID string) (links, logs int) {
+	t.Helper()
+	err := config.DB.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM nlip_share_links WHERE space_id = ?1 AND clip_id = ?2),
+			(SELECT COUNT(*) FROM nlip_share_access_logs a JOIN nlip_share_links l ON l.id = a.share_id
+				WHERE l.space_id = ?1 AND l.clip_id = ?2)
+	`, spaceID, clipID).Scan(&links, &logs)
+	if err != nil {
+		t.Fatalf("统计分享链接失败: %v", err)
+	}
+	return links, logs
+}
+
+// TestAccessShareHidesCreator 匿名访问分享链接时不返回创建者信息
+func TestAccessShareHidesCreator(t *testing.T) {
+	testutil.Setup(t)
+	app := newApp()
+
+	ownerID := testutil.CreateUser(t, "alice", false)
+	spaceID := testutil.CreateSpace(t, "alice-private", "private", ownerID, nil)
+	token := testutil.Token(t, ownerID, "alice", false)
+
+	clipID := paste(t, app, token, spaceID, "shared text")
+	sharePath := createShare(t, app, token, spaceID, clipID)
+
+	resp, err := app.Test(httptest.NewRequest("GET", sharePath, nil), -1)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("访问分享链接返回 %d，期望 200", resp.StatusCode)
+	}
+
+	var body struct {
+		Data struct {
+			Clip map[string]json.RawMessage `json:"clip"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if string(body.Data.Clip["content"]) != `"shared text"` {
+		t.Errorf("分享内容为 %s，期望 \"shared text\"", body.Data.Clip["content"])
+	}
+	if creator, ok := body.Data.Clip["creator"]; ok {
+		t.Errorf("匿名访问不应返回创建者信息，实际为 %s", creator)
+	}
+}
+
+// TestCleanerDeletesShareOfRemovedClip 清理任务删除内容时一并删除分享链接，复用的剪贴板 ID 不能通过旧链接访问
+func TestCleanerDeletesShareOfRemovedClip(t *testing.T) {
+	testutil.Setup(t)
+	app := newApp()
+
+	ownerID := testutil.CreateUser(t, "alice", false)
+	spaceID := testutil.CreateSpace(t, "alice-private", "private", ownerID, nil)
+	token := testutil.Token(t, ownerID, "alice", false)
+
+	oldID := paste(t, app, token, spaceID, "old secret")
+	newID := paste(t, app, token, spaceID, "new content")
+	sharePath := createShare(t, app, token, spaceID, oldID)
+
+	// 访问一次以产生访问记录
+	resp, err := app.Test(httptest.NewRequest("GET", sharePath, nil), -1)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if links, logs := countShares(t, spaceID, oldID); links != 1 || logs != 1 {
+		t.Fatalf("分享链接 %d 个、访问记录 %d 条，期望各 1", links, logs)
+	}
+
+	// 空间只保留一条内容，较早的内容被清理
+	if _, err := config.DB.Exec(`UPDATE nlip_clipboard_items SET created_at = ? WHERE space_id = ? AND clip_id = ?`,
+		time.Now().Add(-time.Hour), spaceID, oldID); err != nil {
+		t.Fatalf("更新创建时间失败: %v", err)
+	}
+	if _, err := config.DB.Exec("UPDATE nlip_spaces SET max_items = 1 WHERE id = ?", spaceID); err != nil {
+		t.Fatalf("更新空间失败: %v", err)
+	}
+	if err := cleaner.CleanSpaceOverflow(spaceID); err != nil {
+		t.Fatalf("清理空间失败: %v", err)
+	}
+	if links, logs := countShares(t, spaceID, oldID); links != 0 || logs != 0 {
+		t.Fatalf("清理后仍有分享链接 %d 个、访问记录 %d 条", links, logs)
+	}
+
+	// 剩余内容复用被清理的剪贴板 ID
+	if _, err := config.DB.Exec("UPDATE nlip_clipboard_items SET clip_id = ? WHERE space_id = ? AND clip_id = ?",
+		oldID, spaceID, newID); err != nil {
+		t.Fatalf("更新剪贴板 ID 失败: %v", err)
+	}
+	resp, err = app.Test(httptest.NewRequest("GET", sharePath, nil), -1)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("旧分享链接返回 %d，期望 404", resp.StatusCode)
+	}
+}
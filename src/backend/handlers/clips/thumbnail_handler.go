@@ -0,0 +1,58 @@
+package clips
+
+import (
+	"database/sql"
+	"nlip/config"
+	"nlip/models/space"
+	"nlip/utils/logger"
+	"nlip/utils/storage"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleGetClipThumbnail 获取图片剪贴板的缩略图
+// @Summary 获取缩略图
+// @Description 获取图片剪贴板的 JPEG 缩略图，缩略图在上传后由后台任务生成，尚未生成或格式不支持时返回 404
+// @Tags 剪贴板
+// @Produce jpeg
+// @Security BearerAuth
+// @Param spaceId path string true "空间ID"
+// @Param clipId path string true "Clip ID"
+// @Param X-Clip-Password header string false "剪贴板密码"
+// @Success 200 {file} binary "缩略图"
+// @Failure 403 {object} string "缺少密码或密码错误"
+// @Failure 404 {object} string "缩略图不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/spaces/{spaceId}/clips/{clipId}/thumbnail [get]
+func HandleGetClipThumbnail(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+	clipID := c.Params("clipId")
+
+	cl, err := scanSingleClip(config.DB.QueryRow(
+		selectClipWithCreatorSQL+"WHERE c.clip_id = ? AND c.space_id = ?",
+		clipID, s.ID,
+	))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, ErrClipNotFound)
+	} else if err != nil {
+		logger.Error("获取剪贴板内容失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取剪贴板内容失败")
+	}
+
+	if err := verifyClipPassword(c, cl); err != nil {
+		return err
+	}
+
+	if cl.FilePath == "" {
+		return fiber.NewError(fiber.StatusNotFound, "缩略图不存在")
+	}
+	thumbPath := storage.ThumbnailPath(cl.FilePath)
+	if _, err := os.Stat(thumbPath); err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "缩略图不存在")
+	}
+
+	c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+	c.Type("jpg")
+	return c.SendFile(thumbPath)
+}
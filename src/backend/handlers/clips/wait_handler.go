@@ -0,0 +1,166 @@
+package clips
+
+import (
+	"database/sql"
+	"nlip/config"
+	"nlip/models/clip"
+	"nlip/models/space"
+	"nlip/utils/disconnect"
+	"nlip/utils/logger"
+	"nlip/utils/notifier"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// 等待新剪贴板的默认超时时间及上限
+const (
+	defaultWaitTimeout = 30 * time.Second
+	maxWaitTimeout     = 120 * time.Second
+)
+
+// parseWaitTimeout 解析等待超时时间，支持 60s、2m 等格式或纯秒数
+func parseWaitTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultWaitTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			return 0, err
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	if timeout <= 0 {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "超时时间必须大于0")
+	}
+	if timeout > maxWaitTimeout {
+		timeout = maxWaitTimeout
+	}
+	return timeout, nil
+}
+
+// findNextClip 查找空间中指定剪贴板之后创建的第一条剪贴板
+func findNextClip(spaceID, afterClipID string) (*clip.Clip, error) {
+	row := config.DB.QueryRow(
+		selectClipWithCreatorSQL+`
+		WHERE c.space_id = ? AND c.created_at > (
+			SELECT created_at FROM nlip_clipboard_items WHERE clip_id = ? AND space_id = ?
+		)
+		ORDER BY c.created_at ASC LIMIT 1`,
+		spaceID, afterClipID, spaceID,
+	)
+	return scanSingleClip(row)
+}
+
+// HandleWaitNextClip 等待空间中出现新的剪贴板
+// @Summary 等待新Clip
+// @Description 阻塞直到空间中出现比 after 更新的剪贴板并返回，超时返回 204。未指定 after 时等待请求之后上传的剪贴板
+// @Tags 剪贴板
+// @Produce json
+// @Security BearerAuth
+// @Param spaceId path string true "空间ID"
+// @Param after query string false "Clip ID，返回在其之后创建的剪贴板"
+// @Param timeout query string false "超时时间，如 60s，默认30s，最长120s"
+// @Param download query bool false "是否下载文件"
+// @Success 200 {object} clip.ClipResponse "获取成功"
+// @Success 204 "等待超时"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 403 {object} string "缺少密码或密码错误"
+// @Failure 404 {object} string "after 指定的Clip不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/spaces/{spaceId}/clips/next [get]
+func HandleWaitNextClip(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+	afterClipID := c.Query("after")
+	isDownload := c.Query("download") == "true"
+
+	timeout, err := parseWaitTimeout(c.Query("timeout"))
+	if err != nil {
+		if fiberErr, ok := err.(*fiber.Error); ok {
+			return fiberErr
+		}
+		return fiber.NewError(fiber.StatusBadRequest, "超时时间格式错误")
+	}
+
+	// 先订阅再查询，避免查询与等待之间上传的剪贴板被遗漏
+	updates, unsubscribe := notifier.Subscribe(s.ID)
+	defer unsubscribe()
+
+	if afterClipID != "" {
+		var exists bool
+		err := config.DB.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM nlip_clipboard_items WHERE clip_id = ? AND space_id = ?)
+		`, afterClipID, s.ID).Scan(&exists)
+		if err != nil {
+			logger.Error("查询剪贴板内容失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "查询剪贴板内容失败")
+		}
+		if !exists {
+			return fiber.NewError(fiber.StatusNotFound, ErrClipNotFound)
+		}
+
+		cl, err := findNextClip(s.ID, afterClipID)
+		if err == nil {
+			return sendNextClip(c, cl, isDownload)
+		} else if err != sql.ErrNoRows {
+			logger.Error("获取剪贴板内容失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "获取剪贴板内容失败")
+		}
+	}
+
+	logger.Debug("等待新剪贴板: spaceID=%s, after=%s, timeout=%v", s.ID, afterClipID, timeout)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	// 客户端提前断开时立即结束等待并取消订阅
+	gone, stopWatch := disconnect.Watch(c)
+	defer stopWatch()
+
+	for {
+		select {
+		case clipID := <-updates:
+			var cl *clip.Clip
+			var err error
+			if afterClipID != "" {
+				cl, err = findNextClip(s.ID, afterClipID)
+			} else {
+				row := config.DB.QueryRow(
+					selectClipWithCreatorSQL+
+						"WHERE c.clip_id = ? AND c.space_id = ?",
+					clipID, s.ID,
+				)
+				cl, err = scanSingleClip(row)
+			}
+
+			if err == sql.ErrNoRows {
+				// 剪贴板可能已被删除或 after 指定的剪贴板已被清理，继续等待
+				continue
+			} else if err != nil {
+				logger.Error("获取剪贴板内容失败: %v", err)
+				return fiber.NewError(fiber.StatusInternalServerError, "获取剪贴板内容失败")
+			}
+			return sendNextClip(c, cl, isDownload)
+
+		case <-timer.C:
+			return c.SendStatus(fiber.StatusNoContent)
+
+		case <-gone:
+			logger.Debug("客户端已断开，停止等待新剪贴板: spaceID=%s", s.ID)
+			return c.SendStatus(fiber.StatusNoContent)
+		}
+	}
+}
+
+// sendNextClip 校验密码后返回等待到的剪贴板
+func sendNextClip(c *fiber.Ctx, cl *clip.Clip, isDownload bool) error {
+	if err := verifyClipPassword(c, cl); err != nil {
+		return err
+	}
+	return sendClip(c, cl, isDownload)
+}
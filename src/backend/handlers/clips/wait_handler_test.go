@@ -0,0 +1,54 @@
+package clips_test
+
+import (
+	"fmt"
+	"net"
+	"nlip/utils/notifier"
+	"nlip/utils/testutil"
+	"testing"
+	"time"
+)
+
+// waitFor 在超时前轮询条件是否成立
+func waitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return cond()
+}
+
+// TestWaitNextClipStopsOnDisconnect 客户端断开后长轮询立即结束并取消订阅
+func TestWaitNextClipStopsOnDisconnect(t *testing.T) {
+	testutil.Setup(t)
+	app := newApp()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.ShutdownWithTimeout(time.Second) })
+
+	ownerID := testutil.CreateUser(t, "alice", false)
+	spaceID := testutil.CreateSpace(t, "alice-private", "private", ownerID, nil)
+	token := testutil.Token(t, ownerID, "alice", false)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	fmt.Fprintf(conn, "GET /api/v1/nlip/spaces/%s/clips/next?timeout=120s HTTP/1.1\r\nHost: nlip\r\nAuthorization: %s\r\n\r\n", spaceID, token)
+
+	if !waitFor(5*time.Second, func() bool { return notifier.Count(spaceID) == 1 }) {
+		t.Fatal("长轮询未开始等待")
+	}
+
+	conn.Close()
+	if !waitFor(5*time.Second, func() bool { return notifier.Count(spaceID) == 0 }) {
+		t.Fatal("客户端断开后长轮询仍在等待")
+	}
+}
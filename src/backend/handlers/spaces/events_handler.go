@@ -0,0 +1,201 @@
+package spaces
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"nlip/config"
+	"nlip/models/space"
+	"nlip/utils/events"
+	"nlip/utils/logger"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// heartbeatInterval SSE 心跳间隔，避免代理因连接空闲而断开
+const heartbeatInterval = 15 * time.Second
+
+// writeEvent 按 SSE 格式写入一条事件
+func writeEvent(w *bufio.Writer, ev events.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// publishSpaceChanges 发布 space_updated 事件，只包含发生变化的字段
+// 协作者等信息不会推送给订阅者，没有变化时不发布事件
+func publishSpaceChanges(before, after space.Space) {
+	changes := fiber.Map{}
+	if before.Name != after.Name {
+		changes["name"] = after.Name
+	}
+	if before.Type != after.Type {
+		changes["type"] = after.Type
+	}
+	if before.MaxItems != after.MaxItems {
+		changes["maxItems"] = after.MaxItems
+	}
+	if before.RetentionDays != after.RetentionDays {
+		changes["retentionDays"] = after.RetentionDays
+	}
+	if len(changes) == 0 {
+		return
+	}
+	events.Publish(after.ID, events.SpaceUpdated, changes)
+}
+
+// checkStreamAccess 检查事件流的订阅者是否仍可访问空间
+// 用户需未被禁用，且空间为公共空间或用户仍是空间所有者或协作者
+func checkStreamAccess(spaceID, userID string) (bool, error) {
+	var spaceType, ownerID string
+	var collaboratorsJSON sql.NullString
+	err := config.DB.QueryRow(`
+		SELECT type, owner_id, collaborators FROM nlip_spaces WHERE id = ?
+	`, spaceID).Scan(&spaceType, &ownerID, &collaboratorsJSON)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if userID != "" {
+		var disabled bool
+		err := config.DB.QueryRow("SELECT disabled FROM nlip_users WHERE id = ?", userID).Scan(&disabled)
+		if err == sql.ErrNoRows || disabled {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+
+	if spaceType == "public" {
+		return true, nil
+	}
+	if userID == "" {
+		return false, nil
+	}
+	if userID == ownerID {
+		return true, nil
+	}
+
+	collaborators := make(map[string]string)
+	if collaboratorsJSON.Valid && collaboratorsJSON.String != "" {
+		if err := json.Unmarshal([]byte(collaboratorsJSON.String), &collaborators); err != nil {
+			return false, err
+		}
+	}
+	_, ok := collaborators[userID]
+	return ok, nil
+}
+
+// HandleSpaceEvents 以 Server-Sent Events 推送空间活动
+// @Summary 订阅空间事件
+// @Description 通过 Server-Sent Events 推送空间内剪贴板的创建、更新、删除及空间设置变更事件，支持 Last-Event-ID 断线续传
+// @Tags 空间
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param spaceId path string true "空间ID"
+// @Param token query string false "认证Token，用于无法设置请求头的 EventSource"
+// @Param Last-Event-ID header string false "最后收到的事件ID"
+// @Success 200 {string} string "事件流"
+// @Failure 401 {object} string "未授权"
+// @Failure 403 {object} string "无权限访问"
+// @Router /api/v1/nlip/spaces/{spaceId}/events [get]
+func HandleSpaceEvents(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+	userID, _ := c.Locals("userId").(string)
+
+	lastEventID := c.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	var afterID int64
+	if lastEventID != "" {
+		id, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "无效的事件ID")
+		}
+		afterID = id
+	}
+
+	missed, updates, unsubscribe := events.Subscribe(s.ID, afterID)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	logger.Info("建立空间事件流: spaceID=%s, lastEventID=%d", s.ID, afterID)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		if _, err := fmt.Fprintf(w, "retry: 3000\n\n"); err != nil {
+			return
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		for _, ev := range missed {
+			if err := writeEvent(w, ev); err != nil {
+				return
+			}
+		}
+
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+
+		// 连接建立后用户可能被移出空间或被禁用，推送事件和心跳前都重新检查权限
+		allowed := func() bool {
+			ok, err := checkStreamAccess(s.ID, userID)
+			if err != nil {
+				logger.Error("检查空间事件流权限失败: spaceID=%s, %v", s.ID, err)
+				return false
+			}
+			if !ok {
+				logger.Info("用户已无权访问空间，关闭事件流: spaceID=%s, userID=%s", s.ID, userID)
+			}
+			return ok
+		}
+
+		for {
+			select {
+			case ev, ok := <-updates:
+				if !ok {
+					// 推送跟不上时订阅会被关闭，客户端会携带 Last-Event-ID 重连补发
+					logger.Warning("空间事件流推送过慢已断开: spaceID=%s", s.ID)
+					return
+				}
+				if !allowed() {
+					return
+				}
+				if err := writeEvent(w, ev); err != nil {
+					logger.Debug("空间事件流连接已断开: spaceID=%s", s.ID)
+					return
+				}
+			case <-ticker.C:
+				if !allowed() {
+					return
+				}
+				if _, err := fmt.Fprintf(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				if err := w.Flush(); err != nil {
+					logger.Debug("空间事件流连接已断开: spaceID=%s", s.ID)
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
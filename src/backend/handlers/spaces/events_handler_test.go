@@ -0,0 +1,181 @@
+package spaces_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"nlip/config"
+	"nlip/middleware"
+	"nlip/middleware/limiter"
+	"nlip/routes"
+	"nlip/utils/clientip"
+	"nlip/utils/testutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type sseEvent struct {
+	event string
+	data  string
+}
+
+// startServer 在本机端口上启动完整路由，事件流需要真实连接才能逐条读取
+func startServer(t *testing.T) (*fiber.App, string) {
+	t.Helper()
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.CustomErrorHandler})
+	clientip.ApplyConfig(nil, config.Get())
+	app.Use(limiter.New())
+	routes.SetupRoutes(app.Group("/api"))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.ShutdownWithTimeout(time.Second) })
+	return app, "http://" + ln.Addr().String()
+}
+
+// subscribe 订阅空间事件流，返回按顺序收到的事件，连接关闭时通道关闭
+func subscribe(t *testing.T, baseURL, spaceID, token string) <-chan sseEvent {
+	t.Helper()
+	req, _ := http.NewRequest("GET", baseURL+"/api/v1/nlip/spaces/"+spaceID+"/events", nil)
+	req.Header.Set("Authorization", token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("订阅事件流失败: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("订阅事件流返回 %d", resp.StatusCode)
+	}
+
+	ch := make(chan sseEvent, 16)
+	go func() {
+		defer close(ch)
+		reader := bufio.NewReader(resp.Body)
+		var ev sseEvent
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				ev.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.data = strings.TrimPrefix(line, "data: ")
+			case line == "" && ev.event != "":
+				ch <- ev
+				ev = sseEvent{}
+			}
+		}
+	}()
+	return ch
+}
+
+func renameSpace(t *testing.T, app *fiber.App, spaceID, token, name string) {
+	t.Helper()
+	req := httptest.NewRequest("PUT", "/api/v1/nlip/spaces/"+spaceID+"/settings", strings.NewReader(`{"name":"`+name+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", token)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("更新空间设置返回 %d", resp.StatusCode)
+	}
+}
+
+func exec(t *testing.T, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := config.DB.Exec(query, args...); err != nil {
+		t.Fatalf("执行 %q 失败: %v", query, err)
+	}
+}
+
+// TestSpaceUpdatedSendsChangedFields space_updated 事件只包含变化的字段
+func TestSpaceUpdatedSendsChangedFields(t *testing.T) {
+	testutil.Setup(t)
+	app, baseURL := startServer(t)
+
+	ownerID := testutil.CreateUser(t, "alice", false)
+	viewerID := testutil.CreateUser(t, "bob", false)
+	spaceID := testutil.CreateSpace(t, "alice-private", "private", ownerID, map[string]string{viewerID: "view"})
+	ownerToken := testutil.Token(t, ownerID, "alice", false)
+
+	stream := subscribe(t, baseURL, spaceID, testutil.Token(t, viewerID, "bob", false))
+	renameSpace(t, app, spaceID, ownerToken, "renamed")
+
+	select {
+	case ev, ok := <-stream:
+		if !ok {
+			t.Fatal("事件流意外关闭")
+		}
+		if ev.event != "space_updated" {
+			t.Fatalf("收到事件 %q，期望 space_updated", ev.event)
+		}
+		var payload struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(ev.data), &payload); err != nil {
+			t.Fatalf("解析事件失败: %v", err)
+		}
+		if len(payload.Data) != 1 || payload.Data["name"] != "renamed" {
+			t.Errorf("事件数据为 %v，期望只包含 name", payload.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("未收到 space_updated 事件")
+	}
+}
+
+// TestEventStreamClosesWhenAccessLost 用户被移出空间或被禁用后，事件流不再推送并关闭
+func TestEventStreamClosesWhenAccessLost(t *testing.T) {
+	testutil.Setup(t)
+	app, baseURL := startServer(t)
+
+	ownerID := testutil.CreateUser(t, "alice", false)
+	viewerID := testutil.CreateUser(t, "bob", false)
+	spaceID := testutil.CreateSpace(t, "alice-private", "private", ownerID, map[string]string{viewerID: "view"})
+	ownerToken := testutil.Token(t, ownerID, "alice", false)
+	viewerToken := testutil.Token(t, viewerID, "bob", false)
+
+	tests := []struct {
+		name   string
+		revoke func()
+	}{
+		{"移出协作者", func() {
+			exec(t, "UPDATE nlip_spaces SET collaborators = '{}' WHERE id = ?", spaceID)
+		}},
+		{"禁用用户", func() {
+			exec(t, "UPDATE nlip_users SET disabled = 1 WHERE id = ?", viewerID)
+		}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec(t, "UPDATE nlip_users SET disabled = 0 WHERE id = ?", viewerID)
+			exec(t, "UPDATE nlip_spaces SET collaborators = ? WHERE id = ?", `{"`+viewerID+`":"view"}`, spaceID)
+			stream := subscribe(t, baseURL, spaceID, viewerToken)
+
+			tt.revoke()
+			renameSpace(t, app, spaceID, ownerToken, "renamed-"+string(rune('a'+i)))
+
+			select {
+			case ev, ok := <-stream:
+				if ok {
+					t.Fatalf("失去权限后仍收到事件 %q: %s", ev.event, ev.data)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("失去权限后事件流未关闭")
+			}
+		})
+	}
+}
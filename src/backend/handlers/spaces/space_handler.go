@@ -8,10 +8,15 @@ import (
 	"fmt"
 	"nlip/config"
 	"nlip/models/space"
+	webhookModel "nlip/models/webhook"
+	"nlip/tasks/invite"
+	"nlip/tasks/webhook"
 	"nlip/utils/db"
-	"nlip/utils/email"
 	"nlip/utils/id"
 	"nlip/utils/logger"
+	"nlip/utils/quota"
+	"nlip/utils/stats"
+	"nlip/utils/storage"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -19,7 +24,7 @@ import (
 
 func getMessage(emailEnabled bool) string {
 	if emailEnabled {
-		return "生成邀请链接成功，已发送邮件"
+		return "生成邀请链接成功，邀请邮件将在后台发送"
 	}
 	return "生成邀请链接成功，请手动将邀请链接发送给协作者"
 }
@@ -317,6 +322,7 @@ func HandleUpdateSpace(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
 	}
 	s := c.Locals("space").(space.Space)
+	before := s
 	userID := c.Locals("userId").(string)
 	isAdmin := c.Locals("isAdmin").(bool)
 
@@ -328,7 +334,7 @@ func HandleUpdateSpace(c *fiber.Ctx) error {
 	}
 
 	// 获取服务器设置
-	serverSettings := config.AppConfig.Space
+	serverSettings := config.Get().Space
 
 	// 更新字段并检查是否超过服务器设置
 	if req.Name != "" {
@@ -404,6 +410,8 @@ func HandleUpdateSpace(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "获取更新后的空间信息失败")
 	}
 
+	publishSpaceChanges(before, s)
+
 	logger.Info("用户 %s 更新了空间: id=%s, name=%s", userID, s.ID, s.Name)
 	return c.JSON(fiber.Map{
 		"code":    fiber.StatusOK,
@@ -433,18 +441,11 @@ func HandleDeleteSpace(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusForbidden, "没有权限删除公共空间")
 	}
 
-	// 开始事务
+	var filePaths []string
 	err := db.WithTransaction(config.DB, func(tx *sql.Tx) error {
-		// 删除空间内的所有内容
-		var execErr error
-		_, execErr = db.ExecTx(tx, "DELETE FROM nlip_clipboard_items WHERE space_id = ?", s.ID)
-		if execErr != nil {
-			return execErr
-		}
-
-		// 删除空间
-		_, execErr = db.ExecTx(tx, "DELETE FROM nlip_spaces WHERE id = ?", s.ID)
-		return execErr
+		var txErr error
+		filePaths, txErr = DeleteSpaceData(tx, s.ID)
+		return txErr
 	})
 
 	if err != nil {
@@ -452,6 +453,12 @@ func HandleDeleteSpace(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "删除空间失败")
 	}
 
+	for _, filePath := range filePaths {
+		if err := storage.DeleteFile(filePath); err != nil {
+			logger.Warning("删除空间文件失败: %v", err)
+		}
+	}
+
 	logger.Info("用户 %s 删除了空间: id=%s", userID, s.ID)
 	return c.JSON(fiber.Map{
 		"code":    fiber.StatusOK,
@@ -460,6 +467,57 @@ func HandleDeleteSpace(c *fiber.Ctx) error {
 	})
 }
 
+// DeleteSpaceData 在事务中删除空间及其内容、分享链接、Webhook 和邀请
+// 返回空间内文件的路径，调用方应在事务提交后删除这些文件
+func DeleteSpaceData(tx *sql.Tx, spaceID string) ([]string, error) {
+	rows, err := tx.Query(`
+		SELECT file_path FROM nlip_clipboard_items
+		WHERE space_id = ? AND file_path IS NOT NULL AND file_path != ''
+	`, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	var filePaths []string
+	for rows.Next() {
+		var filePath string
+		if err := rows.Scan(&filePath); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		filePaths = append(filePaths, filePath)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stmts := []string{
+		// 删除空间内的所有内容
+		"DELETE FROM nlip_clipboard_items WHERE space_id = ?",
+		// 删除空间内的分享链接及访问记录
+		`DELETE FROM nlip_share_access_logs WHERE share_id IN (
+			SELECT id FROM nlip_share_links WHERE space_id = ?
+		)`,
+		"DELETE FROM nlip_share_links WHERE space_id = ?",
+		// 删除空间的 Webhook 及投递记录
+		`DELETE FROM nlip_webhook_deliveries WHERE webhook_id IN (
+			SELECT id FROM nlip_webhooks WHERE space_id = ?
+		)`,
+		"DELETE FROM nlip_webhooks WHERE space_id = ?",
+		// 删除空间的入站 Webhook 和协作邀请
+		"DELETE FROM nlip_ingest_hooks WHERE space_id = ?",
+		"DELETE FROM nlip_invites WHERE space_id = ?",
+		// 删除空间
+		"DELETE FROM nlip_spaces WHERE id = ?",
+	}
+	for _, stmt := range stmts {
+		if _, err := db.ExecTx(tx, stmt, spaceID); err != nil {
+			return nil, err
+		}
+	}
+	return filePaths, nil
+}
+
 // HandleInviteCollaborator 邀请协作者
 // @Summary 邀请协作者
 // @Description 生成邀请链接并可选发送邀请邮件，只有空间所有者可以邀请协作者
@@ -513,12 +571,13 @@ func HandleInviteCollaborator(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "生成邀请链接失败")
 	}
 
-	inviteLink := fmt.Sprintf("%s/invite/%s", config.AppConfig.FrontendURL, tokenHash)
+	cfg := config.Get()
+	inviteLink := fmt.Sprintf("%s/invite/%s", cfg.FrontendURL, tokenHash)
 
-	if config.AppConfig.Email.Enabled {
-		// 发送邀请邮件（如果启用了邮件功能）
-		if err = email.SendInviteEmail(req.Email, s.Name, inviteLink); err != nil {
-			logger.Error("发送邀请邮件失败: %v", err)
+	if cfg.Email.Enabled {
+		// 发送邀请邮件（如果启用了邮件功能），由后台任务发送并在失败时重试
+		if err = invite.EnqueueEmail(req.Email, s.Name, inviteLink); err != nil {
+			logger.Error("添加邀请邮件任务失败: %v", err)
 			return c.JSON(fiber.Map{
 				"code":    fiber.StatusOK,
 				"message": "生成邀请链接成功，但邮件发送失败",
@@ -532,7 +591,7 @@ func HandleInviteCollaborator(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{
 		"code":    fiber.StatusOK,
-		"message": getMessage(config.AppConfig.Email.Enabled),
+		"message": getMessage(cfg.Email.Enabled),
 		"data": space.InviteCollaboratorResponse{
 			InviteLink: inviteLink,
 		},
@@ -704,6 +763,11 @@ func HandleAcceptInvite(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "接受邀请失败")
 	}
 
+	webhook.Enqueue(spaceID, webhookModel.EventCollaboratorAdded, fiber.Map{
+		"collaboratorId": userID,
+		"permission":     permission,
+	})
+
 	logger.Info("用户 %s 成功加入空间 %s", userID, spaceID)
 	return c.JSON(fiber.Map{
 		"code":    fiber.StatusOK,
@@ -768,6 +832,10 @@ func HandleRemoveCollaborator(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "删除协作者失败")
 	}
 
+	webhook.Enqueue(s.ID, webhookModel.EventCollaboratorRemoved, fiber.Map{
+		"collaboratorId": req.CollaboratorID,
+	})
+
 	logger.Info("用户 %s 删除了协作者 %s 从空间 %s", userID, req.CollaboratorID, s.ID)
 	return c.JSON(fiber.Map{
 		"code":    fiber.StatusOK,
@@ -834,6 +902,11 @@ func HandleUpdateCollaboratorPermissions(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "更新协作者权限失败")
 	}
 
+	webhook.Enqueue(s.ID, webhookModel.EventCollaboratorUpdated, fiber.Map{
+		"collaboratorId": req.CollaboratorID,
+		"permission":     req.Permission,
+	})
+
 	logger.Info("用户 %s 更新了协作者 %s 的权限在空间 %s", userID, req.CollaboratorID, s.ID)
 	return c.JSON(fiber.Map{
 		"code":    fiber.StatusOK,
@@ -865,6 +938,7 @@ func HandleUpdateSpaceSettings(c *fiber.Ctx) error {
 	userID := c.Locals("userId").(string)
 	isAdmin := c.Locals("isAdmin").(bool)
 	s := c.Locals("space").(space.Space)
+	before := s
 
 	if s.Type == "public" && !isAdmin {
 		logger.Warning("非管理员用户 %s 尝试更新公共空间设置: spaceID=%s", userID, s.ID)
@@ -907,6 +981,8 @@ func HandleUpdateSpaceSettings(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "更新空间设置失败")
 	}
 
+	publishSpaceChanges(before, s)
+
 	logger.Info("用户 %s 更新了空间设置: id=%s, name=%s", userID, s.ID, s.Name)
 	return c.JSON(fiber.Map{
 		"code":    fiber.StatusOK,
@@ -917,29 +993,24 @@ func HandleUpdateSpaceSettings(c *fiber.Ctx) error {
 
 // HandleSpaceStats 获取空间统计信息
 // @Summary 获取空间统计信息
-// @Description 获取空间的统计信息，包括剪贴板数量和所有者信息
+// @Description 获取空间的统计信息，包括剪贴板数量、存储用量、类型分布、每日上传、主要贡献者、最近活动时间和下一次过期清理时间
 // @Tags 空间
 // @Produce json
 // @Security BearerAuth
+// @Param days query int false "统计最近的天数，默认 7，最大 90"
 // @Success 200 {object} space.SpaceStatsResponse "获取统计信息成功"
 // @Failure 500 {object} string "服务器内部错误"
 // @Router /api/v1/nlip/spaces/{id}/stats [get]
 func HandleSpaceStats(c *fiber.Ctx) error {
 	s := c.Locals("space").(space.Space)
 
-	// 获取剪贴板数量
-	var clipCount int
-	var ownerUsername string
-	err := config.DB.QueryRow(`
-		SELECT COUNT(*) FROM nlip_clipboard_items 
-		WHERE space_id = ?
-	`, s.ID).Scan(&clipCount)
-
+	activity, err := stats.SpaceActivity(s.ID, stats.ClampDays(c.QueryInt("days", stats.DefaultDays)))
 	if err != nil {
 		logger.Error("获取空间统计信息失败: %v", err)
 		return fiber.NewError(fiber.StatusInternalServerError, "获取统计信息失败")
 	}
 
+	var ownerUsername string
 	if s.Type == "private" && s.OwnerID != "" {
 		err = config.DB.QueryRow(`
 			SELECT username FROM nlip_users WHERE id = ?
@@ -951,13 +1022,33 @@ func HandleSpaceStats(c *fiber.Ctx) error {
 		}
 	}
 
+	usage, err := quota.SpaceUsage(s.ID)
+	if err != nil {
+		logger.Error("获取空间存储用量失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取空间存储用量失败")
+	}
+
+	nextEviction, err := stats.NextEviction(s.ID)
+	if err != nil {
+		logger.Error("获取空间过期时间失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取统计信息失败")
+	}
+
+	resp := space.SpaceStatsResponse{
+		Activity:       *activity,
+		OwnerUsername:  ownerUsername,
+		Storage:        usage,
+		NextEvictionAt: nextEviction,
+	}
+	if nextEviction != nil {
+		seconds := int64(max(time.Until(*nextEviction), 0).Seconds())
+		resp.NextEvictionIn = &seconds
+	}
+
 	return c.JSON(fiber.Map{
 		"code":    fiber.StatusOK,
 		"message": "获取空间统计信息成功",
-		"data": space.SpaceStatsResponse{
-			ClipsCount:     clipCount,
-			OwnerUsername:  ownerUsername,
-		},
+		"data":    resp,
 	})
 }
 
@@ -0,0 +1,497 @@
+package webhooks
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"nlip/config"
+	"nlip/handlers/clips"
+	"nlip/models/clip"
+	"nlip/models/space"
+	"nlip/models/webhook"
+	"nlip/utils/clientip"
+	"nlip/utils/id"
+	"nlip/utils/logger"
+	"nlip/utils/validator"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	ErrIngestHookNotFound = "入站Webhook不存在"
+
+	// defaultIngestRateLimit 入站 Webhook 默认每分钟允许的请求数
+	defaultIngestRateLimit = 60
+	// ingestRateWindow 入站 Webhook 限流窗口
+	ingestRateWindow = time.Minute
+)
+
+// ingestWindow 单个入站 Webhook 的限流窗口计数
+type ingestWindow struct {
+	start time.Time
+	count int
+}
+
+var (
+	ingestMu      sync.Mutex
+	ingestWindows = make(map[string]*ingestWindow)
+)
+
+// allowIngest 检查入站 Webhook 是否超过每分钟请求数限制，超限时返回需等待的时间
+func allowIngest(hookID string, limit int) (bool, time.Duration) {
+	ingestMu.Lock()
+	defer ingestMu.Unlock()
+
+	now := time.Now()
+	w, ok := ingestWindows[hookID]
+	if !ok || now.Sub(w.start) >= ingestRateWindow {
+		// 顺带清理过期的窗口，避免长期运行后占用内存
+		if !ok && len(ingestWindows) > 1000 {
+			for key, old := range ingestWindows {
+				if now.Sub(old.start) >= ingestRateWindow {
+					delete(ingestWindows, key)
+				}
+			}
+		}
+		ingestWindows[hookID] = &ingestWindow{start: now, count: 1}
+		return true, 0
+	}
+
+	if w.count >= limit {
+		return false, ingestRateWindow - now.Sub(w.start)
+	}
+	w.count++
+	return true, 0
+}
+
+// hashIngestSecret 计算入站 Webhook 密钥的哈希，数据库中只保存哈希
+func hashIngestSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// buildIngestURL 生成入站 Webhook 的完整地址
+func buildIngestURL(secret string) string {
+	return fmt.Sprintf("%s/api/v1/nlip/hooks/%s", config.Get().FrontendURL, secret)
+}
+
+func splitContentTypes(value sql.NullString) []string {
+	if !value.Valid || value.String == "" {
+		return []string{}
+	}
+	return strings.Split(value.String, ",")
+}
+
+// ingestCreator 入站 Webhook 创建者的当前状态及其所在空间
+type ingestCreator struct {
+	exists        bool
+	disabled      bool
+	isAdmin       bool
+	spaceType     sql.NullString
+	spaceOwnerID  sql.NullString
+	collaborators sql.NullString
+}
+
+// checkIngestCreator 检查创建者是否仍可写入空间：用户存在且未被禁用，并且是管理员、空间所有者或有编辑权限的协作者
+// 空间所有权转让后，原所有者如果不是协作者也视为失去权限
+func checkIngestCreator(userID string, cr ingestCreator) error {
+	if !cr.exists || cr.disabled {
+		return fiber.NewError(fiber.StatusGone, "入站Webhook的创建者已被禁用或删除")
+	}
+	if !cr.spaceType.Valid {
+		return fiber.NewError(fiber.StatusGone, "入站Webhook所属的空间已删除")
+	}
+	if cr.isAdmin || cr.spaceType.String == "public" || cr.spaceOwnerID.String == userID {
+		return nil
+	}
+
+	collaborators := make(map[string]string)
+	if cr.collaborators.Valid && cr.collaborators.String != "" {
+		if err := json.Unmarshal([]byte(cr.collaborators.String), &collaborators); err != nil {
+			logger.Error("解析协作者列表失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "解析协作者数据失败")
+		}
+	}
+	if collaborators[userID] != "edit" {
+		return fiber.NewError(fiber.StatusForbidden, "入站Webhook的创建者已无权写入该空间")
+	}
+	return nil
+}
+
+// HandleCreateIngestHook 创建入站 Webhook
+// @Summary 创建入站Webhook
+// @Description 为空间创建带密钥的入站地址，外部系统无需登录即可通过该地址写入内容。完整地址仅在创建时返回一次
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param spaceId path string true "空间ID"
+// @Param request body webhook.CreateIngestHookRequest true "创建入站Webhook请求参数"
+// @Success 201 {object} webhook.IngestHookResponse "创建成功"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 403 {object} string "无权限操作"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/spaces/{spaceId}/hooks [post]
+func HandleCreateIngestHook(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+
+	var req webhook.CreateIngestHookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+	}
+
+	userID, err := checkSpaceOwner(c, s)
+	if err != nil {
+		return err
+	}
+
+	rateLimit := req.RateLimit
+	if rateLimit == 0 {
+		rateLimit = defaultIngestRateLimit
+	}
+	contentTypes := req.AllowedContentTypes
+	if contentTypes == nil {
+		contentTypes = []string{}
+	}
+
+	secret := id.GenerateSecureToken()
+	hook := webhook.IngestHook{
+		ID:                  uuid.New().String(),
+		SpaceID:             s.ID,
+		Name:                req.Name,
+		AllowedContentTypes: contentTypes,
+		RateLimit:           rateLimit,
+		CreatedBy:           userID,
+		CreatedAt:           time.Now(),
+		URL:                 buildIngestURL(secret),
+	}
+
+	_, err = config.DB.Exec(`
+		INSERT INTO nlip_ingest_hooks
+		(id, space_id, name, secret_hash, allowed_content_types, rate_limit, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, hook.ID, hook.SpaceID, hook.Name, hashIngestSecret(secret), strings.Join(contentTypes, ","),
+		hook.RateLimit, hook.CreatedBy, hook.CreatedAt)
+	if err != nil {
+		logger.Error("创建入站Webhook失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "创建入站Webhook失败")
+	}
+
+	logger.Info("用户 %s 创建了入站Webhook: spaceID=%s, hookID=%s", userID, s.ID, hook.ID)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"code":    fiber.StatusCreated,
+		"message": "创建入站Webhook成功",
+		"data": webhook.IngestHookResponse{
+			Hook: &hook,
+		},
+	})
+}
+
+// HandleListIngestHooks 获取空间入站 Webhook 列表
+// @Summary 获取入站Webhook列表
+// @Description 获取空间的所有入站 Webhook，不包含密钥地址
+// @Tags Webhook
+// @Produce json
+// @Security BearerAuth
+// @Param spaceId path string true "空间ID"
+// @Success 200 {object} webhook.ListIngestHooksResponse "获取成功"
+// @Failure 403 {object} string "无权限操作"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/spaces/{spaceId}/hooks [get]
+func HandleListIngestHooks(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+
+	if _, err := checkSpaceOwner(c, s); err != nil {
+		return err
+	}
+
+	rows, err := config.DB.Query(`
+		SELECT id, space_id, name, allowed_content_types, rate_limit, created_by, created_at, last_used_at, revoked_at
+		FROM nlip_ingest_hooks WHERE space_id = ?
+		ORDER BY created_at DESC
+	`, s.ID)
+	if err != nil {
+		logger.Error("获取入站Webhook列表失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取入站Webhook列表失败")
+	}
+	defer rows.Close()
+
+	hooks := []webhook.IngestHook{}
+	for rows.Next() {
+		var hook webhook.IngestHook
+		var contentTypes sql.NullString
+		var lastUsedAt, revokedAt sql.NullTime
+		if err := rows.Scan(&hook.ID, &hook.SpaceID, &hook.Name, &contentTypes, &hook.RateLimit,
+			&hook.CreatedBy, &hook.CreatedAt, &lastUsedAt, &revokedAt); err != nil {
+			logger.Error("读取入站Webhook数据失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "读取入站Webhook数据失败")
+		}
+		hook.AllowedContentTypes = splitContentTypes(contentTypes)
+		if lastUsedAt.Valid {
+			hook.LastUsedAt = &lastUsedAt.Time
+		}
+		if revokedAt.Valid {
+			hook.RevokedAt = &revokedAt.Time
+		}
+		hooks = append(hooks, hook)
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取入站Webhook列表成功",
+		"data": webhook.ListIngestHooksResponse{
+			Hooks: hooks,
+		},
+	})
+}
+
+// HandleRevokeIngestHook 撤销入站 Webhook
+// @Summary 撤销入站Webhook
+// @Description 撤销入站 Webhook，撤销后该地址立即失效
+// @Tags Webhook
+// @Produce json
+// @Security BearerAuth
+// @Param spaceId path string true "空间ID"
+// @Param hookId path string true "入站Webhook ID"
+// @Success 200 {object} string "撤销成功"
+// @Failure 403 {object} string "无权限操作"
+// @Failure 404 {object} string "入站Webhook不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/spaces/{spaceId}/hooks/{hookId} [delete]
+func HandleRevokeIngestHook(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+	hookID := c.Params("hookId")
+
+	userID, err := checkSpaceOwner(c, s)
+	if err != nil {
+		return err
+	}
+
+	result, err := config.DB.Exec(`
+		UPDATE nlip_ingest_hooks SET revoked_at = ?
+		WHERE id = ? AND space_id = ? AND revoked_at IS NULL
+	`, time.Now(), hookID, s.ID)
+	if err != nil {
+		logger.Error("撤销入站Webhook失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "撤销入站Webhook失败")
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, ErrIngestHookNotFound)
+	}
+
+	logger.Info("用户 %s 撤销了入站Webhook: spaceID=%s, hookID=%s", userID, s.ID, hookID)
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "撤销入站Webhook成功",
+		"data":    nil,
+	})
+}
+
+// HandleIngest 通过入站 Webhook 地址写入内容
+// @Summary 入站Webhook写入内容
+// @Description 无需登录，将 JSON、表单或原始请求体转换为剪贴板内容。JSON 和表单中的 content 字段作为文本内容，表单中的 file 字段或指定 filename 查询参数时保存为文件
+// @Tags Webhook
+// @Accept json,x-www-form-urlencoded,mpfd,plain
+// @Produce json
+// @Param secret path string true "入站Webhook密钥"
+// @Param filename query string false "原始请求体保存为文件时使用的文件名"
+// @Success 201 {object} clip.ClipResponse "写入成功"
+// @Failure 400 {object} string "请求内容错误"
+// @Failure 403 {object} string "创建者已无权写入该空间"
+// @Failure 404 {object} string "入站Webhook不存在"
+// @Failure 410 {object} string "入站Webhook已撤销，或创建者已被禁用或删除"
+// @Failure 415 {object} string "不允许的内容类型"
+// @Failure 429 {object} string "请求过于频繁"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/hooks/{secret} [post]
+func HandleIngest(c *fiber.Ctx) error {
+	var hookID, spaceID, createdBy string
+	var contentTypes, username sql.NullString
+	var rateLimit int
+	var revokedAt sql.NullTime
+	var creator ingestCreator
+	err := config.DB.QueryRow(`
+		SELECT h.id, h.space_id, h.allowed_content_types, h.rate_limit, h.revoked_at, h.created_by, u.username,
+			u.id IS NOT NULL, COALESCE(u.disabled, 0), COALESCE(u.is_admin, 0),
+			s.type, s.owner_id, s.collaborators
+		FROM nlip_ingest_hooks h
+		LEFT JOIN nlip_users u ON h.created_by = u.id
+		LEFT JOIN nlip_spaces s ON h.space_id = s.id
+		WHERE h.secret_hash = ?
+	`, hashIngestSecret(c.Params("secret"))).Scan(&hookID, &spaceID, &contentTypes, &rateLimit, &revokedAt, &createdBy, &username,
+		&creator.exists, &creator.disabled, &creator.isAdmin, &creator.spaceType, &creator.spaceOwnerID, &creator.collaborators)
+	if err == sql.ErrNoRows {
+		logger.Warning("无效的入站Webhook地址: ip=%s", clientip.IP(c))
+		return fiber.NewError(fiber.StatusNotFound, ErrIngestHookNotFound)
+	} else if err != nil {
+		logger.Error("查询入站Webhook失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "查询入站Webhook失败")
+	}
+
+	if revokedAt.Valid {
+		return fiber.NewError(fiber.StatusGone, "入站Webhook已撤销")
+	}
+
+	// 入站 Webhook 以创建者身份写入，创建者被禁用或失去空间写权限后不能继续使用
+	if err := checkIngestCreator(createdBy, creator); err != nil {
+		logger.Warning("入站Webhook的创建者已无法写入空间: hookID=%s, spaceID=%s, createdBy=%s, %v", hookID, spaceID, createdBy, err)
+		return err
+	}
+
+	if ok, retryAfter := allowIngest(hookID, rateLimit); !ok {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(retryAfter.Seconds())+1))
+		logger.Warning("入站Webhook请求过于频繁: hookID=%s", hookID)
+		return fiber.NewError(fiber.StatusTooManyRequests, "请求过于频繁，请稍后再试")
+	}
+
+	mediaType := fiber.MIMEOctetStream
+	if header := c.Get(fiber.HeaderContentType); header != "" {
+		parsed, _, err := mime.ParseMediaType(header)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "无效的 Content-Type")
+		}
+		mediaType = parsed
+	}
+
+	if allowed := splitContentTypes(contentTypes); len(allowed) > 0 && !containsString(allowed, mediaType) {
+		logger.Warning("入站Webhook收到不允许的内容类型: hookID=%s, contentType=%s", hookID, mediaType)
+		return fiber.NewError(fiber.StatusUnsupportedMediaType, "不允许的内容类型: "+mediaType)
+	}
+
+	if int64(len(c.Body())) > config.Get().MaxFileSize {
+		return fiber.NewError(fiber.StatusBadRequest, "文件大小超过限制")
+	}
+
+	content, fileData, fileName, fileType, err := parseIngestBody(c, mediaType)
+	if err != nil {
+		return err
+	}
+
+	cl, err := clips.CreateClip(space.Space{ID: spaceID, Type: creator.spaceType.String, OwnerID: creator.spaceOwnerID.String}, createdBy, username.String, content, fileData, fileName, fileType, "")
+	if err != nil {
+		return err
+	}
+
+	if _, err := config.DB.Exec("UPDATE nlip_ingest_hooks SET last_used_at = ? WHERE id = ?", time.Now(), hookID); err != nil {
+		logger.Error("更新入站Webhook使用时间失败: %v", err)
+	}
+
+	logger.Info("入站Webhook写入内容: hookID=%s, spaceID=%s, clipID=%s", hookID, spaceID, cl.ClipID)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"code":    fiber.StatusCreated,
+		"message": "写入成功",
+		"data": clip.ClipResponse{
+			Clip: cl,
+		},
+	})
+}
+
+// parseIngestBody 根据内容类型将请求体转换为文本内容或文件
+func parseIngestBody(c *fiber.Ctx, mediaType string) (string, []byte, string, string, error) {
+	body := c.Body()
+
+	switch mediaType {
+	case fiber.MIMEApplicationJSON:
+		if !json.Valid(body) {
+			return "", nil, "", "", fiber.NewError(fiber.StatusBadRequest, "无效的 JSON 内容")
+		}
+		var payload map[string]interface{}
+		if err := json.Unmarshal(body, &payload); err == nil {
+			if content, ok := payload["content"].(string); ok && content != "" {
+				return content, nil, "", "", nil
+			}
+		}
+		return string(body), nil, "", "", nil
+
+	case fiber.MIMEMultipartForm:
+		if file, err := c.FormFile("file"); err == nil {
+			if !validator.ValidateFileName(file.Filename) || !validator.ValidateFileType(file.Filename, file.Header.Get(fiber.HeaderContentType)) {
+				return "", nil, "", "", fiber.NewError(fiber.StatusBadRequest, "不支持的文件类型")
+			}
+			src, err := file.Open()
+			if err != nil {
+				return "", nil, "", "", fiber.NewError(fiber.StatusBadRequest, "读取上传文件失败")
+			}
+			defer src.Close()
+			data, err := io.ReadAll(src)
+			if err != nil {
+				return "", nil, "", "", fiber.NewError(fiber.StatusBadRequest, "读取上传文件失败")
+			}
+			return "", data, file.Filename, file.Header.Get(fiber.HeaderContentType), nil
+		}
+		form, err := c.MultipartForm()
+		if err != nil {
+			return "", nil, "", "", fiber.NewError(fiber.StatusBadRequest, "无效的表单内容")
+		}
+		return formContent(form.Value)
+
+	case fiber.MIMEApplicationForm:
+		if content := c.FormValue("content"); content != "" {
+			return content, nil, "", "", nil
+		}
+		// 没有 content 字段时按原始文本保存，兼容 curl -d 默认的表单类型
+		if !utf8.Valid(body) {
+			return "", nil, "", "", fiber.NewError(fiber.StatusBadRequest, "内容不是有效的文本")
+		}
+		return string(body), nil, "", "", nil
+	}
+
+	if fileName := c.Query("filename"); fileName != "" {
+		if !validator.ValidateFileName(fileName) || !validator.ValidateFileType(fileName, mediaType) {
+			return "", nil, "", "", fiber.NewError(fiber.StatusBadRequest, "不支持的文件类型")
+		}
+		return "", body, fileName, mediaType, nil
+	}
+
+	if len(body) == 0 {
+		return "", nil, "", "", fiber.NewError(fiber.StatusBadRequest, "内容不能为空")
+	}
+	if !utf8.Valid(body) {
+		return "", nil, "", "", fiber.NewError(fiber.StatusBadRequest, "内容不是有效的文本，上传文件时请指定 filename 参数")
+	}
+	return string(body), nil, "", "", nil
+}
+
+// formContent 将表单字段转换为文本内容，优先使用 content 字段
+func formContent(values map[string][]string) (string, []byte, string, string, error) {
+	if content := values["content"]; len(content) > 0 && content[0] != "" {
+		return content[0], nil, "", "", nil
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return "", nil, "", "", fiber.NewError(fiber.StatusBadRequest, "内容不能为空")
+	}
+	sort.Strings(keys)
+
+	var lines []string
+	for _, key := range keys {
+		for _, value := range values[key] {
+			lines = append(lines, key+"="+value)
+		}
+	}
+	return strings.Join(lines, "\n"), nil, "", "", nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
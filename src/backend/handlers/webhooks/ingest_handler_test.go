@@ -0,0 +1,103 @@
+package webhooks_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"nlip/config"
+	"nlip/utils/testutil"
+	"strings"
+	"testing"
+)
+
+// createIngestHook 通过接口创建入站 Webhook，返回写入地址的路径
+func createIngestHook(t *testing.T, spaceID, token string) string {
+	t.Helper()
+	app := newApp()
+	req := httptest.NewRequest("POST", "/api/v1/nlip/spaces/"+spaceID+"/hooks", strings.NewReader(`{"name":"ci"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", token)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("创建入站Webhook返回 %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data struct {
+			Hook struct {
+				URL string `json:"url"`
+			} `json:"hook"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	i := strings.Index(body.Data.Hook.URL, "/api/v1/nlip/hooks/")
+	if i < 0 {
+		t.Fatalf("入站Webhook地址无效: %q", body.Data.Hook.URL)
+	}
+	return body.Data.Hook.URL[i:]
+}
+
+func exec(t *testing.T, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := config.DB.Exec(query, args...); err != nil {
+		t.Fatalf("执行 %q 失败: %v", query, err)
+	}
+}
+
+// TestIngestRechecksCreatorAccess 写入前重新检查创建者状态和空间权限
+func TestIngestRechecksCreatorAccess(t *testing.T) {
+	testutil.Setup(t)
+	app := newApp()
+
+	ownerID := testutil.CreateUser(t, "alice", false)
+	otherID := testutil.CreateUser(t, "bob", false)
+	spaceID := testutil.CreateSpace(t, "alice-private", "private", ownerID, nil)
+	hookPath := createIngestHook(t, spaceID, testutil.Token(t, ownerID, "alice", false))
+
+	tests := []struct {
+		name  string
+		setup func()
+		want  int
+	}{
+		{"创建者为空间所有者", func() {}, http.StatusCreated},
+		{"创建者被禁用", func() {
+			exec(t, "UPDATE nlip_users SET disabled = 1 WHERE id = ?", ownerID)
+		}, http.StatusGone},
+		{"创建者恢复启用", func() {
+			exec(t, "UPDATE nlip_users SET disabled = 0 WHERE id = ?", ownerID)
+		}, http.StatusCreated},
+		{"空间已转让给他人", func() {
+			exec(t, "UPDATE nlip_spaces SET owner_id = ?, collaborators = '{}' WHERE id = ?", otherID, spaceID)
+		}, http.StatusForbidden},
+		{"转让后作为只读协作者", func() {
+			exec(t, "UPDATE nlip_spaces SET collaborators = ? WHERE id = ?", `{"`+ownerID+`":"view"}`, spaceID)
+		}, http.StatusForbidden},
+		{"转让后作为编辑协作者", func() {
+			exec(t, "UPDATE nlip_spaces SET collaborators = ? WHERE id = ?", `{"`+ownerID+`":"edit"}`, spaceID)
+		}, http.StatusCreated},
+		{"创建者被删除", func() {
+			exec(t, "UPDATE nlip_ingest_hooks SET created_by = ? WHERE space_id = ?", "missing-user", spaceID)
+		}, http.StatusGone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+			req := httptest.NewRequest("POST", hookPath, strings.NewReader("hello"))
+			req.Header.Set("Content-Type", "text/plain")
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("写入返回 %d，期望 %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
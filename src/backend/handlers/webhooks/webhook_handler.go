@@ -0,0 +1,313 @@
+package webhooks
+
+import (
+	"database/sql"
+	"nlip/config"
+	"nlip/models/space"
+	"nlip/models/webhook"
+	webhookTask "nlip/tasks/webhook"
+	"nlip/utils/id"
+	"nlip/utils/logger"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	ErrWebhookNotFound  = "Webhook不存在"
+	ErrDeliveryNotFound = "投递记录不存在"
+
+	// maxDeliveriesListed 投递记录列表返回的最大条数
+	maxDeliveriesListed = 100
+)
+
+// checkSpaceOwner 检查当前用户是否为空间所有者或管理员
+func checkSpaceOwner(c *fiber.Ctx, s space.Space) (string, error) {
+	userID, ok := c.Locals("userId").(string)
+	if !ok || userID == "" {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "请先登录")
+	}
+	isAdmin, _ := c.Locals("isAdmin").(bool)
+
+	if !isAdmin && userID != s.OwnerID {
+		logger.Warning("用户 %s 尝试管理空间Webhook: spaceID=%s", userID, s.ID)
+		return "", fiber.NewError(fiber.StatusForbidden, "只有空间所有者可以管理Webhook")
+	}
+	return userID, nil
+}
+
+// getSpaceWebhook 获取空间中的指定 Webhook
+func getSpaceWebhook(spaceID, webhookID string) (*webhook.Webhook, error) {
+	var w webhook.Webhook
+	var events string
+	err := config.DB.QueryRow(`
+		SELECT id, space_id, url, events, active, created_by, created_at
+		FROM nlip_webhooks WHERE id = ? AND space_id = ?
+	`, webhookID, spaceID).Scan(&w.ID, &w.SpaceID, &w.URL, &events, &w.Active, &w.CreatedBy, &w.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fiber.NewError(fiber.StatusNotFound, ErrWebhookNotFound)
+	} else if err != nil {
+		logger.Error("查询Webhook失败: %v", err)
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "查询Webhook失败")
+	}
+	w.Events = strings.Split(events, ",")
+	return &w, nil
+}
+
+// HandleCreateWebhook 创建空间 Webhook
+// @Summary 创建Webhook
+// @Description 为空间注册 Webhook 地址，事件以 HMAC-SHA256 签名的 JSON 消息推送。密钥仅在创建时返回一次
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param spaceId path string true "空间ID"
+// @Param request body webhook.CreateWebhookRequest true "创建Webhook请求参数"
+// @Success 201 {object} webhook.WebhookResponse "创建成功"
+// @Failure 400 {object} string "请求参数错误"
+// @Failure 403 {object} string "无权限操作"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/spaces/{spaceId}/webhooks [post]
+func HandleCreateWebhook(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+
+	var req webhook.CreateWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "无效的请求数据")
+	}
+
+	userID, err := checkSpaceOwner(c, s)
+	if err != nil {
+		return err
+	}
+
+	if err := webhookTask.ValidateURL(req.URL); err != nil {
+		logger.Warning("用户 %s 注册的Webhook地址无效: spaceID=%s, %v", userID, s.ID, err)
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	events := req.Events
+	if len(events) == 0 {
+		events = webhook.AllEvents
+	}
+
+	w := webhook.Webhook{
+		ID:        uuid.New().String(),
+		SpaceID:   s.ID,
+		URL:       req.URL,
+		Secret:    id.GenerateSecureToken(),
+		Events:    events,
+		Active:    true,
+		CreatedBy: userID,
+		CreatedAt: time.Now(),
+	}
+
+	_, err = config.DB.Exec(`
+		INSERT INTO nlip_webhooks (id, space_id, url, secret, events, active, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, 1, ?, ?)
+	`, w.ID, w.SpaceID, w.URL, w.Secret, strings.Join(w.Events, ","), w.CreatedBy, w.CreatedAt)
+	if err != nil {
+		logger.Error("创建Webhook失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "创建Webhook失败")
+	}
+
+	logger.Info("用户 %s 创建了Webhook: spaceID=%s, webhookID=%s", userID, s.ID, w.ID)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"code":    fiber.StatusCreated,
+		"message": "创建Webhook成功",
+		"data": webhook.WebhookResponse{
+			Webhook: &w,
+		},
+	})
+}
+
+// HandleListWebhooks 获取空间 Webhook 列表
+// @Summary 获取Webhook列表
+// @Description 获取空间注册的所有 Webhook，不包含密钥
+// @Tags Webhook
+// @Produce json
+// @Security BearerAuth
+// @Param spaceId path string true "空间ID"
+// @Success 200 {object} webhook.ListWebhooksResponse "获取成功"
+// @Failure 403 {object} string "无权限操作"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/spaces/{spaceId}/webhooks [get]
+func HandleListWebhooks(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+
+	if _, err := checkSpaceOwner(c, s); err != nil {
+		return err
+	}
+
+	rows, err := config.DB.Query(`
+		SELECT id, space_id, url, events, active, created_by, created_at
+		FROM nlip_webhooks WHERE space_id = ?
+		ORDER BY created_at DESC
+	`, s.ID)
+	if err != nil {
+		logger.Error("获取Webhook列表失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取Webhook列表失败")
+	}
+	defer rows.Close()
+
+	webhooks := []webhook.Webhook{}
+	for rows.Next() {
+		var w webhook.Webhook
+		var events string
+		if err := rows.Scan(&w.ID, &w.SpaceID, &w.URL, &events, &w.Active, &w.CreatedBy, &w.CreatedAt); err != nil {
+			logger.Error("读取Webhook数据失败: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "读取Webhook数据失败")
+		}
+		w.Events = strings.Split(events, ",")
+		webhooks = append(webhooks, w)
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取Webhook列表成功",
+		"data": webhook.ListWebhooksResponse{
+			Webhooks: webhooks,
+		},
+	})
+}
+
+// HandleDeleteWebhook 删除空间 Webhook
+// @Summary 删除Webhook
+// @Description 删除 Webhook 及其投递记录，未完成的投递不再发送
+// @Tags Webhook
+// @Produce json
+// @Security BearerAuth
+// @Param spaceId path string true "空间ID"
+// @Param webhookId path string true "Webhook ID"
+// @Success 200 {object} string "删除成功"
+// @Failure 403 {object} string "无权限操作"
+// @Failure 404 {object} string "Webhook不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/spaces/{spaceId}/webhooks/{webhookId} [delete]
+func HandleDeleteWebhook(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+	webhookID := c.Params("webhookId")
+
+	userID, err := checkSpaceOwner(c, s)
+	if err != nil {
+		return err
+	}
+
+	if _, err := getSpaceWebhook(s.ID, webhookID); err != nil {
+		return err
+	}
+
+	if _, err := config.DB.Exec("DELETE FROM nlip_webhook_deliveries WHERE webhook_id = ?", webhookID); err != nil {
+		logger.Error("删除Webhook投递记录失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "删除Webhook失败")
+	}
+	if _, err := config.DB.Exec("DELETE FROM nlip_webhooks WHERE id = ? AND space_id = ?", webhookID, s.ID); err != nil {
+		logger.Error("删除Webhook失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "删除Webhook失败")
+	}
+
+	logger.Info("用户 %s 删除了Webhook: spaceID=%s, webhookID=%s", userID, s.ID, webhookID)
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "删除Webhook成功",
+		"data":    nil,
+	})
+}
+
+// HandleListDeliveries 获取 Webhook 投递记录
+// @Summary 获取Webhook投递记录
+// @Description 获取 Webhook 最近的投递记录，包括状态、尝试次数和最后一次响应
+// @Tags Webhook
+// @Produce json
+// @Security BearerAuth
+// @Param spaceId path string true "空间ID"
+// @Param webhookId path string true "Webhook ID"
+// @Success 200 {object} webhook.ListDeliveriesResponse "获取成功"
+// @Failure 403 {object} string "无权限操作"
+// @Failure 404 {object} string "Webhook不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/spaces/{spaceId}/webhooks/{webhookId}/deliveries [get]
+func HandleListDeliveries(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+	webhookID := c.Params("webhookId")
+
+	if _, err := checkSpaceOwner(c, s); err != nil {
+		return err
+	}
+	if _, err := getSpaceWebhook(s.ID, webhookID); err != nil {
+		return err
+	}
+
+	deliveries, err := webhookTask.ListDeliveries(webhookID, maxDeliveriesListed)
+	if err != nil {
+		logger.Error("获取Webhook投递记录失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "获取Webhook投递记录失败")
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    fiber.StatusOK,
+		"message": "获取Webhook投递记录成功",
+		"data": webhook.ListDeliveriesResponse{
+			Deliveries: deliveries,
+		},
+	})
+}
+
+// HandleRedeliver 重新投递 Webhook 消息
+// @Summary 重新投递Webhook
+// @Description 以原始消息体重新投递一次，生成新的投递记录
+// @Tags Webhook
+// @Produce json
+// @Security BearerAuth
+// @Param spaceId path string true "空间ID"
+// @Param webhookId path string true "Webhook ID"
+// @Param deliveryId path string true "投递记录ID"
+// @Success 202 {object} webhook.DeliveryResponse "已加入投递队列"
+// @Failure 403 {object} string "无权限操作"
+// @Failure 404 {object} string "投递记录不存在"
+// @Failure 500 {object} string "服务器内部错误"
+// @Router /api/v1/nlip/spaces/{spaceId}/webhooks/{webhookId}/deliveries/{deliveryId}/redeliver [post]
+func HandleRedeliver(c *fiber.Ctx) error {
+	s := c.Locals("space").(space.Space)
+	webhookID := c.Params("webhookId")
+	deliveryID := c.Params("deliveryId")
+
+	userID, err := checkSpaceOwner(c, s)
+	if err != nil {
+		return err
+	}
+	if _, err := getSpaceWebhook(s.ID, webhookID); err != nil {
+		return err
+	}
+
+	original, err := webhookTask.GetDelivery(webhookID, deliveryID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, ErrDeliveryNotFound)
+	} else if err != nil {
+		logger.Error("查询Webhook投递记录失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "查询Webhook投递记录失败")
+	}
+
+	newID, err := webhookTask.Redeliver(original)
+	if err != nil {
+		logger.Error("创建Webhook重新投递记录失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "重新投递失败")
+	}
+
+	delivery, err := webhookTask.GetDelivery(webhookID, newID)
+	if err != nil {
+		logger.Error("查询Webhook投递记录失败: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "查询Webhook投递记录失败")
+	}
+
+	logger.Info("用户 %s 重新投递了Webhook消息: webhookID=%s, deliveryID=%s", userID, webhookID, deliveryID)
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"code":    fiber.StatusAccepted,
+		"message": "已加入投递队列",
+		"data": webhook.DeliveryResponse{
+			Delivery: delivery,
+		},
+	})
+}
@@ -0,0 +1,63 @@
+package webhooks_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"nlip/config"
+	"nlip/middleware"
+	"nlip/middleware/limiter"
+	"nlip/routes"
+	"nlip/utils/clientip"
+	"nlip/utils/testutil"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func newApp() *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.CustomErrorHandler})
+	clientip.ApplyConfig(nil, config.Get())
+	app.Use(limiter.New())
+	routes.SetupRoutes(app.Group("/api"))
+	return app
+}
+
+// TestCreateWebhookRejectsInternalAddress 注册 Webhook 时拒绝解析到本机或内网的地址
+func TestCreateWebhookRejectsInternalAddress(t *testing.T) {
+	testutil.Setup(t)
+	app := newApp()
+
+	ownerID := testutil.CreateUser(t, "alice", false)
+	spaceID := testutil.CreateSpace(t, "alice-private", "private", ownerID, nil)
+	token := testutil.Token(t, ownerID, "alice", false)
+	path := "/api/v1/nlip/spaces/" + spaceID + "/webhooks"
+
+	tests := []struct {
+		name string
+		url  string
+		want int
+	}{
+		{"本机地址", "http://127.0.0.1:8080/hook", http.StatusBadRequest},
+		{"本机域名", "http://localhost/hook", http.StatusBadRequest},
+		{"内网地址", "http://192.168.1.10/hook", http.StatusBadRequest},
+		{"云元数据地址", "http://169.254.169.254/latest/meta-data", http.StatusBadRequest},
+		{"未指定地址", "http://0.0.0.0/hook", http.StatusBadRequest},
+		{"公网地址", "https://93.184.216.34/hook", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", path, strings.NewReader(`{"url":"`+tt.url+`"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", token)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("注册 %s 返回 %d，期望 %d", tt.url, resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
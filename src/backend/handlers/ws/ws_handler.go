@@ -32,7 +32,7 @@ func HandleWebSocket(c *websocket.Conn) {
     }
 
     // 验证token
-    claims, err := jwt.ValidateToken(token)
+    claims, err := jwt.Authenticate(token)
     if err != nil {
         logger.Warning("WebSocket token验证失败: %v", err)
         return
@@ -12,8 +12,16 @@ import (
 	"nlip/middleware/limiter"
 	"nlip/middleware/logger"
 	"nlip/middleware/recover"
+	"nlip/middleware/security"
 	"nlip/routes"
 	"nlip/tasks/cleaner"
+	"nlip/tasks/invite"
+	"nlip/tasks/jobs"
+	"nlip/tasks/scheduler"
+	"nlip/tasks/thumbnail"
+	"nlip/tasks/webhook"
+	"nlip/utils/clientip"
+	"nlip/utils/email"
 	appLogger "nlip/utils/logger"
 	"net/http"
 	"os"
@@ -41,15 +49,25 @@ var embedDistFiles embed.FS
 // @name Authorization
 // @schemes http https
 func main() {
+	// 执行子命令，例如 nlip config print
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	// 加载配置
 	config.LoadConfig()
 
+	// 未配置 JWT 密钥时生成随机密钥
+	if err := config.EnsureJWTSecret(); err != nil {
+		log.Fatalf("生成JWT密钥失败: %v", err)
+	}
+
 	// 验证配置
 	if err := config.ValidateConfig(); err != nil {
 		log.Fatalf("配置验证失败: %v", err)
 	}
 
-	appLogger.SetAppEnv(config.AppConfig.AppEnv)
+	appLogger.SetAppEnv(config.Get().AppEnv)
 
 	// 初始化数据库
 	if err := config.InitDatabase(); err != nil {
@@ -64,8 +82,10 @@ func main() {
 	})
 
 	// 全局中间件
+	clientip.ApplyConfig(nil, config.Get())
 	app.Use(logger.New())
 	app.Use(recover.New())
+	app.Use(security.New())
 	app.Use(cors.New())
 	app.Use(compress.New())
 	app.Use(limiter.New())
@@ -109,17 +129,51 @@ func main() {
 		return c.Send(indexContent)
 	})
 
-	// 启动清理任务
-	cleaner.StartCleanupTask()
+	// 注册并启动后台任务队列
+	email.InitEmailConfig()
+	invite.RegisterJobs()
+	cleaner.RegisterJobs()
+	thumbnail.RegisterJobs()
+	webhook.RegisterJobs()
+	stopJobs := jobs.Start()
+
+	// 注册并启动定时任务，服务关闭时通过 context 取消
+	if err := cleaner.RegisterScheduledTasks(); err != nil {
+		log.Fatalf("注册定时任务失败: %v", err)
+	}
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	scheduler.Start(schedulerCtx)
+
+	// 配置重新加载后通知缓存了配置的模块，文件类型、上传大小等设置在每次请求时读取，无需通知
+	config.OnReload("email", email.ApplyConfig)
+	config.OnReload("cleaner", cleaner.ApplySchedule)
+	config.OnReload("cors", cors.ApplyConfig)
+	config.OnReload("clientip", clientip.ApplyConfig)
+	config.OnReload("limiter", limiter.ApplyConfig)
+
+	// 收到 SIGHUP 信号或配置文件变化时重新加载配置
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			appLogger.Info("接收到 SIGHUP 信号，重新加载配置")
+			if err := config.Reload(); err != nil {
+				appLogger.Error("重新加载配置失败，继续使用当前配置: %v", err)
+			}
+		}
+	}()
+	config.WatchConfigFile(schedulerCtx)
 
 	// 记录启动日志
-	appLogger.Info("服务器启动在端口 :%s", config.AppConfig.ServerPort)
+	appLogger.Info("服务器启动在端口 :%s", config.Get().ServerPort)
 
 	// 优雅关闭处理
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		<-sigChan
 		appLogger.Info("接收到关闭信号，开始优雅关闭")
 
@@ -132,23 +186,27 @@ func main() {
 			appLogger.Error("服务器关闭失败: %v", err)
 		}
 
+		// 停止定时任务并等待正在执行的任务退出
+		stopScheduler()
+		scheduler.Wait()
+
+		// 停止后台任务执行器，等待正在执行的任务完成后再关闭数据库
+		jobsCtx, cancelJobs := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancelJobs()
+		if err := stopJobs(jobsCtx); err != nil {
+			appLogger.Error("停止后台任务执行器失败: %v", err)
+		}
+
 		// 关闭日志
 		appLogger.Close()
 	}()
 
 	// 启动服务器
-	if err := app.Listen(":" + config.AppConfig.ServerPort); err != nil {
+	if err := app.Listen(":" + config.Get().ServerPort); err != nil {
 		appLogger.Error("服务器启动失败: %v", err)
 		log.Fatal(err)
 	}
 
-	app.Use(func(c *fiber.Ctx) error {
-		c.Set("X-XSS-Protection", "1; mode=block")
-		c.Set("X-Content-Type-Options", "nosniff")
-		c.Set("X-Download-Options", "noopen")
-		c.Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
-		c.Set("X-Frame-Options", "SAMEORIGIN")
-		c.Set("X-DNS-Prefetch-Control", "off")
-		return c.Next()
-	})
+	// 等待关闭流程完成后再关闭数据库
+	<-shutdownDone
 }
@@ -7,18 +7,81 @@ import (
 	"nlip/models/space"
 	"nlip/utils/jwt"
 	"nlip/utils/logger"
+	"nlip/utils/totp"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// APITokenHeader 使用用户Token直接认证时携带Token的请求头
+const APITokenHeader = "X-API-Token"
+
+var (
+	spaceIDPattern  = regexp.MustCompile(`/spaces/([^/]+)`)
+	rawRoutePattern = regexp.MustCompile(`/nlip/(?:raw|p)/([^/]+)`)
+)
+
 func isGuest(authHeader string, userID string) bool {
 	return authHeader == "" && userID == ""
 }
 
+// isRawRoute 判断是否为纯文本粘贴和获取路由，路径中直接包含空间ID
+func isRawRoute(path string) bool {
+	return rawRoutePattern.MatchString(path)
+}
+
+// isPasteRoute 判断是否为纯文本粘贴路由
+func isPasteRoute(path string) bool {
+	return strings.Contains(path, "/nlip/p/")
+}
+
+// isAdminRoute 判断是否为管理接口，管理接口由权限中间件校验，不涉及空间所有者和协作者权限
+func isAdminRoute(path string) bool {
+	return strings.Contains(path, "/nlip/admin/")
+}
+
 func isSpaceRoute(path string) bool {
-	return strings.Contains(path, "/spaces")
+	if isAdminRoute(path) {
+		return false
+	}
+	return strings.Contains(path, "/spaces") || isRawRoute(path)
+}
+
+// extractSpaceID 从路径中获取空间ID
+func extractSpaceID(path string) string {
+	if matches := rawRoutePattern.FindStringSubmatch(path); matches != nil {
+		return matches[1]
+	}
+	if matches := spaceIDPattern.FindStringSubmatch(path); matches != nil {
+		return matches[1]
+	}
+	return ""
+}
+
+// isTwoFactorSetupRoute 判断是否为服务器要求启用两步验证时仍可访问的路由
+func isTwoFactorSetupRoute(path string) bool {
+	return strings.Contains(path, "/auth/2fa") || strings.HasSuffix(path, "/auth/me") ||
+		strings.HasSuffix(path, "/auth/change-password")
+}
+
+// isEventStreamRoute 判断是否为空间事件流路由
+// 浏览器的 EventSource 无法设置请求头，允许通过 token 查询参数传递认证令牌
+func isEventStreamRoute(method string, path string) bool {
+	return method == "GET" && strings.HasSuffix(path, "/events") && strings.Contains(path, "/spaces/")
+}
+
+// isShareRoute 判断是否为分享链接访问路由
+// 分享链接通过签名令牌校验访问权限，不涉及空间权限
+func isShareRoute(method string, path string) bool {
+	return method == "GET" && strings.Contains(path, "/nlip/s/")
+}
+
+// isIngestRoute 判断是否为入站 Webhook 写入路由
+// 入站 Webhook 通过地址中的密钥校验访问权限，不需要用户登录
+func isIngestRoute(method string, path string) bool {
+	return method == "POST" && strings.Contains(path, "/nlip/hooks/")
 }
 
 func isViewable(method string, path string) bool {
@@ -28,6 +91,10 @@ func isViewable(method string, path string) bool {
 	if method == "POST" && !strings.Contains(path, "/collaborators/invite") {
 		return true
 	}
+	// 通过 PUT 粘贴内容与上传内容权限相同
+	if method == "PUT" && isPasteRoute(path) {
+		return true
+	}
 	return false
 }
 
@@ -75,8 +142,7 @@ func handleGuestAccess(c *fiber.Ctx, path string, s *space.Space, userID string)
 	}
 
 	//通过正则化匹配从path中获取spaceID
-	re := regexp.MustCompile(`/spaces/([^/]+)`)
-	spaceID := re.FindStringSubmatch(path)[1]
+	spaceID := extractSpaceID(path)
 	logger.Debug("获取空间信息: spaceID=%s, path=%s", spaceID, path)
 	var collaboratorsJSON sql.NullString
 	if spaceID != "" {
@@ -98,8 +164,7 @@ func handleGuestAccess(c *fiber.Ctx, path string, s *space.Space, userID string)
 				return sql.NullString{}, false, fiber.NewError(fiber.StatusNotFound, "公共空间不存在协作者")
 			}
 			if isGuest(c.Get("Authorization"), userID) {
-				method := c.Method()
-				if method == "GET" || (method == "POST" && !strings.Contains(path, "/collaborators/invite")) {
+				if isViewable(c.Method(), path) {
 					logger.Debug("游客访问公共空间，跳过token验证")
 					c.Locals("space", *s)
 					return sql.NullString{}, true, nil
@@ -125,12 +190,23 @@ func handleTokenValidation(c *fiber.Ctx, authHeader string) error {
 		return fiber.NewError(fiber.StatusUnauthorized, "认证令牌格式错误")
 	}
 
-	claims, err := jwt.ValidateToken(parts[1])
-	if err != nil {
+	claims, err := jwt.Authenticate(parts[1])
+	switch err {
+	case nil:
+	case jwt.ErrAccountDisabled, jwt.ErrTokenRevoked:
+		logger.Warning("拒绝认证令牌: %v", err)
+		return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+	default:
 		logger.Warning("无效的认证令牌: %v", err)
 		return fiber.NewError(fiber.StatusUnauthorized, "无效的认证令牌")
 	}
 
+	// API Token 供命令行等非交互客户端使用，不受此限制
+	if !claims.TwoFactorEnabled && totp.Required(claims.IsAdmin) && !isTwoFactorSetupRoute(c.Path()) {
+		logger.Warning("用户未启用两步验证: userID=%s, path=%s", claims.UserID, c.Path())
+		return fiber.NewError(fiber.StatusForbidden, "服务器要求启用两步验证，请先完成设置")
+	}
+
 	c.Locals("userId", claims.UserID)
 	c.Locals("username", claims.Username)
 	c.Locals("isAdmin", claims.IsAdmin)
@@ -141,6 +217,53 @@ func handleTokenValidation(c *fiber.Ctx, authHeader string) error {
 	return nil
 }
 
+// handleAPITokenValidation 通过 X-API-Token 请求头中的用户Token进行认证
+// 返回是否携带了Token，便于命令行工具无需先换取JWT即可调用接口
+func handleAPITokenValidation(c *fiber.Ctx) (bool, error) {
+	apiToken := c.Get(APITokenHeader)
+	if apiToken == "" {
+		return false, nil
+	}
+
+	var tokenID, userID, username string
+	var isAdmin, disabled bool
+	var expiresAt sql.NullTime
+	err := config.DB.QueryRow(`
+		SELECT t.id, t.expires_at, u.id, u.username, u.is_admin, u.disabled FROM nlip_tokens t
+		JOIN nlip_users u ON t.user_id = u.id
+		WHERE t.token = ?
+	`, apiToken).Scan(&tokenID, &expiresAt, &userID, &username, &isAdmin, &disabled)
+	if err == sql.ErrNoRows {
+		logger.Warning("无效的API Token: %s %s", c.Method(), c.Path())
+		return true, fiber.NewError(fiber.StatusUnauthorized, "Token不存在或已过期")
+	} else if err != nil {
+		logger.Error("查询API Token失败: %v", err)
+		return true, fiber.NewError(fiber.StatusInternalServerError, "验证Token失败")
+	}
+
+	if expiresAt.Valid && expiresAt.Time.Before(time.Now()) {
+		logger.Warning("API Token已过期: tokenID=%s", tokenID)
+		return true, fiber.NewError(fiber.StatusUnauthorized, "Token不存在或已过期")
+	}
+
+	if disabled {
+		logger.Warning("已禁用账号尝试使用API Token: userID=%s", userID)
+		return true, fiber.NewError(fiber.StatusUnauthorized, "账号已被禁用")
+	}
+
+	if _, err := config.DB.Exec("UPDATE nlip_tokens SET last_used_at = ? WHERE id = ?", time.Now(), tokenID); err != nil {
+		logger.Error("更新token最后使用时间失败: %v", err)
+	}
+
+	c.Locals("userId", userID)
+	c.Locals("username", username)
+	c.Locals("isAdmin", isAdmin)
+	c.Locals("tokenId", tokenID)
+
+	logger.Debug("API Token认证成功: userID=%s, username=%s", userID, username)
+	return true, nil
+}
+
 func handleSpaceAccess(c *fiber.Ctx, path string, userID string, s *space.Space, collaboratorsJSON sql.NullString) error {
 	if !isSpaceRoute(path) {
 		return nil
@@ -202,7 +325,16 @@ func handleSpaceAccess(c *fiber.Ctx, path string, userID string, s *space.Space,
 func AuthMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		path := c.Path()
+		if isEventStreamRoute(c.Method(), path) && c.Get("Authorization") == "" && c.Query("token") != "" {
+			c.Request().Header.Set("Authorization", "Bearer "+c.Query("token"))
+		}
 		authHeader := c.Get("Authorization")
+		// 优先使用 API Token 认证
+		apiTokenUsed, err := handleAPITokenValidation(c)
+		if err != nil {
+			return err
+		}
+
 		var userID string
 		if c.Locals("userId") == nil {
 			userID = ""
@@ -210,6 +342,16 @@ func AuthMiddleware() fiber.Handler {
 			userID = c.Locals("userId").(string)
 		}
 
+		if isShareRoute(c.Method(), path) {
+			logger.Debug("分享链接访问，跳过token验证")
+			return c.Next()
+		}
+
+		if isIngestRoute(c.Method(), path) {
+			logger.Debug("入站Webhook访问，跳过token验证")
+			return c.Next()
+		}
+
 		var s space.Space
 
 		collaboratorsJSON, guestAccess, err := handleGuestAccess(c, path, &s, userID)
@@ -220,8 +362,10 @@ func AuthMiddleware() fiber.Handler {
 			return c.Next()
 		}
 
-		if err := handleTokenValidation(c, authHeader); err != nil {
-			return err
+		if !apiTokenUsed {
+			if err := handleTokenValidation(c, authHeader); err != nil {
+				return err
+			}
 		}
 
 		if c.Locals("userId") == nil {
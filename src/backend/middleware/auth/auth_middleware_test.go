@@ -0,0 +1,77 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"nlip/config"
+	"nlip/middleware"
+	"nlip/middleware/limiter"
+	"nlip/routes"
+	"nlip/utils/clientip"
+	"nlip/utils/testutil"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func newApp() *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.CustomErrorHandler})
+	clientip.ApplyConfig(nil, config.Get())
+	app.Use(limiter.New())
+	routes.SetupRoutes(app.Group("/api"))
+	return app
+}
+
+// TestAdminSpaceRoutesSkipSpacePermission 管理接口中的空间路由不应按空间所有者和协作者校验权限
+func TestAdminSpaceRoutesSkipSpacePermission(t *testing.T) {
+	testutil.Setup(t)
+	app := newApp()
+
+	adminID := testutil.CreateUser(t, "root", true)
+	ownerID := testutil.CreateUser(t, "alice", false)
+	strangerID := testutil.CreateUser(t, "bob", false)
+	spaceID := testutil.CreateSpace(t, "alice-private", "private", ownerID, nil)
+
+	adminToken := testutil.Token(t, adminID, "root", true)
+	ownerToken := testutil.Token(t, ownerID, "alice", false)
+	strangerToken := testutil.Token(t, strangerID, "bob", false)
+
+	quotaPath := "/api/v1/nlip/admin/spaces/" + spaceID + "/quota"
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		want   int
+	}{
+		{"管理员查看他人私有空间配额", "GET", quotaPath, adminToken, "", http.StatusOK},
+		{"管理员设置他人私有空间配额", "PUT", quotaPath, adminToken, `{"quotaBytes":1048576}`, http.StatusOK},
+		{"管理员查看不存在的空间配额", "GET", "/api/v1/nlip/admin/spaces/missing/quota", adminToken, "", http.StatusNotFound},
+		{"空间所有者不能访问管理接口", "GET", quotaPath, ownerToken, "", http.StatusForbidden},
+		{"游客不能访问管理接口", "GET", quotaPath, "", "", http.StatusUnauthorized},
+		{"空间所有者访问自己的空间", "GET", "/api/v1/nlip/spaces/" + spaceID + "/clips/list", ownerToken, "", http.StatusOK},
+		{"无权限用户访问他人私有空间", "GET", "/api/v1/nlip/spaces/" + spaceID + "/clips/list", strangerToken, "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("%s %s 返回 %d，期望 %d", tt.method, tt.path, resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package compress
 
 import (
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/compress"
 )
@@ -9,5 +11,9 @@ import (
 func New() fiber.Handler {
 	return compress.New(compress.Config{
 		Level: compress.LevelBestSpeed,
+		// 事件流需要逐条推送，不进行压缩
+		Next: func(c *fiber.Ctx) bool {
+			return strings.HasSuffix(c.Path(), "/events")
+		},
 	})
 } 
\ No newline at end of file
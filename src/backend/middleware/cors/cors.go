@@ -1,18 +1,149 @@
 package cors
 
 import (
+	"nlip/config"
+	"nlip/utils/logger"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 )
 
-// New 创建一个新的CORS中间件
+// apiPrefix 接口路径前缀，与 routes 中的 v1 路由组一致
+const apiPrefix = "/api/v1/nlip"
+
+// publicPaths 使用 cors.public 策略的路径：原始内容、分享链接和 Webhook 写入
+var publicPaths = []string{
+	apiPrefix + "/raw/",
+	apiPrefix + "/p/",
+	apiPrefix + "/s/",
+	apiPrefix + "/hooks/",
+}
+
+// adminPath 使用 cors.admin 策略的路径
+const adminPath = apiPrefix + "/admin"
+
+// handlers 各路由组的 CORS 处理函数，重新加载配置后整体替换
+type handlers struct {
+	defaults fiber.Handler
+	public   fiber.Handler
+	admin    fiber.Handler
+}
+
+var current atomic.Pointer[handlers]
+
+// New 创建 CORS 中间件，按请求路径选择默认、公开或管理接口的跨域策略
+// 预检请求在路由和认证之前处理，因此在全局中间件中按路径区分路由组
 func New() fiber.Handler {
+	current.Store(build(config.Get()))
+	return func(c *fiber.Ctx) error {
+		h := current.Load()
+		path := c.Path()
+		if path == adminPath || strings.HasPrefix(path, adminPath+"/") {
+			return h.admin(c)
+		}
+		for _, prefix := range publicPaths {
+			if strings.HasPrefix(path, prefix) {
+				return h.public(c)
+			}
+		}
+		return h.defaults(c)
+	}
+}
+
+// ApplyConfig 配置重新加载后按新的跨域策略重建处理函数
+func ApplyConfig(old, new *config.Config) {
+	if reflect.DeepEqual(old.CORS, new.CORS) {
+		return
+	}
+	current.Store(build(new))
+	logger.Info("CORS 策略已更新")
+}
+
+func build(cfg *config.Config) *handlers {
+	c := cfg.CORS
+	defaults := config.CORSPolicy{
+		AllowOrigins:     append(append([]string{}, c.AllowOrigins...), extensionOrigins(c.ExtensionIDs)...),
+		AllowMethods:     c.AllowMethods,
+		AllowHeaders:     c.AllowHeaders,
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           c.MaxAge,
+	}
+	public := inherit(c.Public, defaults)
+	admin := inherit(c.Admin, config.CORSPolicy{
+		AllowOrigins: c.AllowOrigins,
+		AllowMethods: c.AllowMethods,
+		AllowHeaders: c.AllowHeaders,
+		MaxAge:       c.MaxAge,
+	})
+	// 管理接口不允许任意来源，配置校验已拒绝 cors.admin 中的 "*"，这里排除从默认值继承的 "*"
+	admin.AllowOrigins = without(admin.AllowOrigins, "*")
+
+	return &handlers{
+		defaults: newHandler(defaults, c.ExposeHeaders),
+		public:   newHandler(public, c.ExposeHeaders),
+		admin:    newHandler(admin, c.ExposeHeaders),
+	}
+}
+
+// inherit 未设置的字段使用 base 中的值，allow_credentials 不继承
+func inherit(p, base config.CORSPolicy) config.CORSPolicy {
+	if len(p.AllowOrigins) == 0 {
+		p.AllowOrigins = base.AllowOrigins
+	}
+	if len(p.AllowMethods) == 0 {
+		p.AllowMethods = base.AllowMethods
+	}
+	if len(p.AllowHeaders) == 0 {
+		p.AllowHeaders = base.AllowHeaders
+	}
+	if p.MaxAge == 0 {
+		p.MaxAge = base.MaxAge
+	}
+	return p
+}
+
+func newHandler(p config.CORSPolicy, exposeHeaders []string) fiber.Handler {
+	origins := strings.Join(p.AllowOrigins, ",")
+	for _, origin := range p.AllowOrigins {
+		if origin == "*" {
+			origins = "*"
+			break
+		}
+	}
+	if origins == "" {
+		// 没有允许的来源时只允许同源访问，不返回任何跨域响应头
+		return func(c *fiber.Ctx) error { return c.Next() }
+	}
+	// 允许任意来源时不能携带凭据
+	allowCredentials := p.AllowCredentials && origins != "*"
 	return cors.New(cors.Config{
-		AllowOrigins:     "http://127.0.0.1:3000",
-		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization",
-		AllowCredentials: true,
-		ExposeHeaders:    "Content-Length,Content-Range",
-		MaxAge:           3600,
+		AllowOrigins:     origins,
+		AllowMethods:     strings.Join(p.AllowMethods, ","),
+		AllowHeaders:     strings.Join(p.AllowHeaders, ","),
+		AllowCredentials: allowCredentials,
+		ExposeHeaders:    strings.Join(exposeHeaders, ","),
+		MaxAge:           p.MaxAge,
 	})
-} 
\ No newline at end of file
+}
+
+// extensionOrigins 浏览器扩展的来源
+func extensionOrigins(ids []string) []string {
+	origins := make([]string, 0, len(ids))
+	for _, id := range ids {
+		origins = append(origins, "chrome-extension://"+strings.ToLower(id))
+	}
+	return origins
+}
+
+func without(list []string, value string) []string {
+	result := make([]string, 0, len(list))
+	for _, item := range list {
+		if item != value {
+			result = append(result, item)
+		}
+	}
+	return result
+}
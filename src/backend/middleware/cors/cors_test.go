@@ -0,0 +1,111 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"nlip/utils/testutil"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const extensionID = "abcdefghijklmnopabcdefghijklmnop"
+
+func TestPreflightPerRouteGroup(t *testing.T) {
+	t.Setenv("NLIP_CORS_ALLOW_ORIGINS", "https://clip.example.com")
+	t.Setenv("NLIP_CORS_EXTENSION_IDS", extensionID)
+	testutil.Setup(t)
+
+	app := fiber.New()
+	app.Use(New())
+	app.All("/*", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	const (
+		frontend  = "https://clip.example.com"
+		extension = "chrome-extension://" + extensionID
+		other     = "https://evil.example.com"
+	)
+	defaultPath := "/api/v1/nlip/spaces/list"
+	publicPath := "/api/v1/nlip/raw/space/clip"
+	adminPath := "/api/v1/nlip/admin/users"
+
+	tests := []struct {
+		name            string
+		path            string
+		origin          string
+		wantOrigin      string
+		wantCredentials bool
+		wantMaxAge      string
+	}{
+		{"默认策略允许前端", defaultPath, frontend, frontend, true, "3600"},
+		{"默认策略允许扩展", defaultPath, extension, extension, true, "3600"},
+		{"默认策略拒绝其他来源", defaultPath, other, "", false, ""},
+		{"公开策略允许任意来源且不携带凭据", publicPath, other, "*", false, "3600"},
+		{"公开策略对前端同样不携带凭据", publicPath, frontend, "*", false, "3600"},
+		{"管理策略允许前端", adminPath, frontend, frontend, true, "600"},
+		{"管理策略拒绝扩展", adminPath, extension, "", false, ""},
+		{"管理策略拒绝其他来源", adminPath, other, "", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodOptions, tt.path, nil)
+			req.Header.Set(fiber.HeaderOrigin, tt.origin)
+			req.Header.Set(fiber.HeaderAccessControlRequestMethod, fiber.MethodGet)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusNoContent {
+				t.Errorf("预检请求返回 %d，期望 204", resp.StatusCode)
+			}
+			if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin 为 %q，期望 %q", got, tt.wantOrigin)
+			}
+			if got := resp.Header.Get(fiber.HeaderAccessControlAllowCredentials) == "true"; got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials 为 %v，期望 %v", got, tt.wantCredentials)
+			}
+			if tt.wantOrigin != "" {
+				if got := resp.Header.Get(fiber.HeaderAccessControlMaxAge); got != tt.wantMaxAge {
+					t.Errorf("Access-Control-Max-Age 为 %q，期望 %q", got, tt.wantMaxAge)
+				}
+			}
+		})
+	}
+}
+
+func TestPreflightAllowsTokenAndPasswordHeaders(t *testing.T) {
+	t.Setenv("NLIP_CORS_ALLOW_ORIGINS", "https://clip.example.com")
+	testutil.Setup(t)
+
+	app := fiber.New()
+	app.Use(New())
+	app.All("/*", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	for _, path := range []string{"/api/v1/nlip/spaces/list", "/api/v1/nlip/raw/space/clip", "/api/v1/nlip/p/space"} {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodOptions, path, nil)
+			req.Header.Set(fiber.HeaderOrigin, "https://clip.example.com")
+			req.Header.Set(fiber.HeaderAccessControlRequestMethod, fiber.MethodGet)
+			req.Header.Set(fiber.HeaderAccessControlRequestHeaders, "X-API-Token, X-Clip-Password")
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			resp.Body.Close()
+
+			allowed := strings.ToLower(resp.Header.Get(fiber.HeaderAccessControlAllowHeaders))
+			for _, header := range []string{"x-api-token", "x-clip-password"} {
+				if !strings.Contains(allowed, header) {
+					t.Errorf("Access-Control-Allow-Headers %q 缺少 %s", allowed, header)
+				}
+			}
+		})
+	}
+}
@@ -1,36 +1,210 @@
 package limiter
 
 import (
-    "github.com/gofiber/fiber/v2"
-    "github.com/gofiber/fiber/v2/middleware/limiter"
-    "strings"
-    "time"
+	"fmt"
+	"math"
+	"nlip/config"
+	"nlip/utils/clientip"
+	"nlip/utils/logger"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
 )
 
-// New 创建一个新的速率限制中间件
+// cleanupInterval 清理已补满的令牌桶的间隔
+const cleanupInterval = time.Minute
+
+// rule 解析后的限制规则
+type rule struct {
+	config.RateLimitRule
+	segments []string
+	capacity float64
+	// rate 每秒补充的令牌数
+	rate   float64
+	period time.Duration
+}
+
+// limits 当前生效的规则和存储，配置重新加载时整体替换
+type limits struct {
+	enabled bool
+	rules   []rule
+	store   Store
+	kind    string
+}
+
+// result 一条规则的检查结果，用于设置 RateLimit-* 响应头
+type result struct {
+	rule      *rule
+	remaining float64
+}
+
+var (
+	current     atomic.Pointer[limits]
+	cleanupOnce sync.Once
+)
+
+// New 创建全局的访问频率限制中间件，检查按IP限制的规则
+// 按用户和 API Token 限制的规则需要在认证之后由 Principal 检查
 func New() fiber.Handler {
-    return limiter.New(limiter.Config{
-        Max:        60,                // 每个IP每分钟最多60个请求
-        Expiration: 1 * time.Minute,   // 计数器重置时间
-        KeyGenerator: func(c *fiber.Ctx) string {
-            // 根据路径设置不同的限制
-            path := c.Path()
-            switch {
-            case strings.Contains(path, "/auth/login"):
-                c.Locals("limit", 5)  // 登录接口限制
-            case strings.Contains(path, "/clips/upload"):
-                c.Locals("limit", 10) // 上传接口限制
-            default:
-                c.Locals("limit", 60) // 其他接口限制
-            }
-            return c.IP()
-        },
-        LimitReached: func(c *fiber.Ctx) error {
-            return c.Status(429).JSON(fiber.Map{
-                "code": 429,
-                "message": "请求过于频繁，请稍后再试",
-                "data": nil,
-            })
-        },
-    })
-} 
\ No newline at end of file
+	ApplyConfig(nil, config.Get())
+	return func(c *fiber.Ctx) error {
+		return check(c, func(r *rule) bool { return r.Key == "ip" })
+	}
+}
+
+// Principal 创建按用户和 API Token 限制的中间件，需要放在认证中间件之后
+// 未登录的请求按IP限制，同一个请求只检查一次
+func Principal() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Locals("rateLimitPrincipal") != nil {
+			return c.Next()
+		}
+		c.Locals("rateLimitPrincipal", true)
+		return check(c, func(r *rule) bool { return r.Key != "ip" })
+	}
+}
+
+// ApplyConfig 根据配置更新限制规则，存储类型变化时切换存储，已有的计数会重置
+func ApplyConfig(_, cfg *config.Config) {
+	next := &limits{
+		enabled: cfg.RateLimit.Enabled,
+		kind:    cfg.RateLimit.Store,
+	}
+	for _, r := range cfg.RateLimit.Rules {
+		period, err := time.ParseDuration(r.Period)
+		if err != nil || period <= 0 {
+			logger.Warning("忽略无效的访问频率限制规则 %s: period=%q", r.Name, r.Period)
+			continue
+		}
+		capacity := r.Burst
+		if capacity == 0 {
+			capacity = r.Rate
+		}
+		next.rules = append(next.rules, rule{
+			RateLimitRule: r,
+			segments:      strings.Split(strings.Trim(r.Path, "/"), "/"),
+			capacity:      float64(capacity),
+			rate:          float64(r.Rate) / period.Seconds(),
+			period:        period,
+		})
+	}
+
+	if old := current.Load(); old != nil && old.kind == next.kind {
+		next.store = old.store
+	} else if next.kind == "sqlite" {
+		next.store = newSQLiteStore()
+	} else {
+		next.store = newMemoryStore()
+	}
+	current.Store(next)
+	logger.Info("访问频率限制已更新: enabled=%v, store=%s, %d 条规则", next.enabled, next.kind, len(next.rules))
+
+	cleanupOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(cleanupInterval)
+			defer ticker.Stop()
+			for now := range ticker.C {
+				if err := current.Load().store.Cleanup(now); err != nil {
+					logger.Error("清理令牌桶失败: %v", err)
+				}
+			}
+		}()
+	})
+}
+
+// check 检查请求匹配的规则，任意一条规则的令牌不足时返回429
+// 存储出错时放行请求，避免数据库故障导致所有接口不可用
+func check(c *fiber.Ctx, filter func(*rule) bool) error {
+	l := current.Load()
+	if !l.enabled {
+		return c.Next()
+	}
+
+	now := time.Now()
+	path := strings.Split(strings.Trim(c.Path(), "/"), "/")
+	var tightest *result
+	for i := range l.rules {
+		r := &l.rules[i]
+		if !filter(r) || !r.match(c.Method(), path) {
+			continue
+		}
+		key := r.Name + "|" + principal(c, r.Key)
+		allowed, tokens, err := l.store.Take(key, r.capacity, r.rate, now)
+		if err != nil {
+			logger.Error("访问频率限制检查失败，放行请求: rule=%s, error=%v", r.Name, err)
+			continue
+		}
+		res := &result{rule: r, remaining: tokens}
+		if !allowed {
+			logger.Warning("请求过于频繁: rule=%s, key=%s, path=%s", r.Name, key, c.Path())
+			setHeaders(c, res)
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil((1-tokens)/r.rate))))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"code":    fiber.StatusTooManyRequests,
+				"message": "请求过于频繁，请稍后再试",
+				"data":    nil,
+			})
+		}
+		if tightest == nil || res.remaining < tightest.remaining {
+			tightest = res
+		}
+	}
+
+	// 两个阶段都有匹配的规则时，响应头使用剩余令牌最少的规则
+	if tightest != nil {
+		if prev, ok := c.Locals("rateLimit").(*result); !ok || tightest.remaining < prev.remaining {
+			c.Locals("rateLimit", tightest)
+			setHeaders(c, tightest)
+		}
+	}
+	return c.Next()
+}
+
+// match 判断请求是否匹配规则，* 和 :name 匹配一段路径，末尾的 ** 匹配剩余的所有路径
+func (r *rule) match(method string, path []string) bool {
+	if r.Method != "" && !strings.EqualFold(r.Method, method) {
+		return false
+	}
+	for i, seg := range r.segments {
+		if seg == "**" {
+			return true
+		}
+		if i >= len(path) {
+			return false
+		}
+		if seg != "*" && !strings.HasPrefix(seg, ":") && seg != path[i] {
+			return false
+		}
+	}
+	return len(path) == len(r.segments)
+}
+
+// principal 规则限制的对象：ip 按客户端IP，user 按登录用户，token 按 API Token
+// 请求没有对应的身份时依次退回到用户和IP
+func principal(c *fiber.Ctx, key string) string {
+	if key == "token" {
+		if tokenID, ok := c.Locals("tokenId").(string); ok && tokenID != "" {
+			return "token:" + tokenID
+		}
+		key = "user"
+	}
+	if key == "user" {
+		if userID, ok := c.Locals("userId").(string); ok && userID != "" {
+			return "user:" + userID
+		}
+	}
+	return "ip:" + clientip.IP(c)
+}
+
+// setHeaders 设置 RateLimit-* 响应头，Reset 为令牌补满所需的秒数
+func setHeaders(c *fiber.Ctx, res *result) {
+	r := res.rule
+	c.Set("RateLimit-Limit", strconv.Itoa(int(r.capacity)))
+	c.Set("RateLimit-Remaining", strconv.Itoa(int(math.Floor(res.remaining))))
+	c.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil((r.capacity-res.remaining)/r.rate))))
+	c.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", r.Rate, int(r.period.Seconds()), int(r.capacity)))
+}
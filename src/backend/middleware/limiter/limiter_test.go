@@ -0,0 +1,269 @@
+package limiter
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"nlip/config"
+	"nlip/utils/clientip"
+	"nlip/utils/testutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// setup 初始化测试环境并使用给定的存储和规则，返回的应用通过 X-User 和 X-Token 请求头模拟登录用户和 API Token
+func setup(t *testing.T, store string, rules ...config.RateLimitRule) *fiber.App {
+	t.Helper()
+	testutil.Setup(t)
+
+	cfg := *config.Get()
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.Store = store
+	cfg.RateLimit.Rules = rules
+	// 丢弃之前测试创建的存储，SQLite 存储使用的是已关闭的数据库
+	current.Store(nil)
+	ApplyConfig(nil, &cfg)
+	clientip.ApplyConfig(nil, &cfg)
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		return check(c, func(r *rule) bool { return r.Key == "ip" })
+	})
+	app.Use(func(c *fiber.Ctx) error {
+		if userID := c.Get("X-User"); userID != "" {
+			c.Locals("userId", userID)
+		}
+		if tokenID := c.Get("X-Token"); tokenID != "" {
+			c.Locals("tokenId", tokenID)
+		}
+		return c.Next()
+	})
+	app.Use(Principal())
+	app.All("/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	return app
+}
+
+func request(t *testing.T, app *fiber.App, method, path string, headers map[string]string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// TestTokenBucketBurstAndRefill 两种存储的令牌桶行为一致：最多连续通过 burst 个请求，之后按速率补充，不超过容量
+func TestTokenBucketBurstAndRefill(t *testing.T) {
+	for _, kind := range []string{"memory", "sqlite"} {
+		t.Run(kind, func(t *testing.T) {
+			testutil.Setup(t)
+			var store Store = newMemoryStore()
+			if kind == "sqlite" {
+				store = newSQLiteStore()
+			}
+
+			// 容量 3，每秒补充 1 个
+			t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			steps := []struct {
+				at        time.Duration
+				allowed   bool
+				remaining float64
+			}{
+				{0, true, 2},
+				{0, true, 1},
+				{0, true, 0},
+				{0, false, 0},
+				{500 * time.Millisecond, false, 0.5},
+				{time.Second, true, 0},
+				{time.Second, false, 0},
+				{time.Hour, true, 2},
+			}
+			for i, s := range steps {
+				allowed, remaining, err := store.Take("k", 3, 1, t0.Add(s.at))
+				if err != nil {
+					t.Fatalf("第 %d 次取令牌出错: %v", i+1, err)
+				}
+				if allowed != s.allowed || math.Abs(remaining-s.remaining) > 1e-9 {
+					t.Fatalf("第 %d 次取令牌 allowed=%v, remaining=%v，期望 %v, %v",
+						i+1, allowed, remaining, s.allowed, s.remaining)
+				}
+			}
+
+			// 其他 key 的令牌桶互不影响
+			if allowed, remaining, _ := store.Take("other", 3, 1, t0); !allowed || remaining != 2 {
+				t.Errorf("新的令牌桶 allowed=%v, remaining=%v，期望 true, 2", allowed, remaining)
+			}
+		})
+	}
+}
+
+// TestSQLiteStorePersistsAndCleansUp SQLite 存储的令牌桶在新的存储实例中保留，补满后被清理
+func TestSQLiteStorePersistsAndCleansUp(t *testing.T) {
+	testutil.Setup(t)
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	store := newSQLiteStore()
+	for i := 0; i < 2; i++ {
+		store.Take("k", 2, 1, t0)
+	}
+
+	// 模拟重启后使用新的存储实例
+	store = newSQLiteStore()
+	if allowed, _, err := store.Take("k", 2, 1, t0); err != nil || allowed {
+		t.Fatalf("令牌已用完，新的存储实例 allowed=%v, err=%v，期望拒绝", allowed, err)
+	}
+
+	countRows := func() int {
+		t.Helper()
+		var n int
+		if err := config.DB.QueryRow("SELECT COUNT(*) FROM nlip_rate_limits").Scan(&n); err != nil {
+			t.Fatalf("统计令牌桶失败: %v", err)
+		}
+		return n
+	}
+	// 两个令牌需要 2 秒补满
+	if err := store.Cleanup(t0.Add(time.Second)); err != nil || countRows() != 1 {
+		t.Fatalf("未补满的令牌桶不应被清理: rows=%d, err=%v", countRows(), err)
+	}
+	if err := store.Cleanup(t0.Add(2 * time.Second)); err != nil || countRows() != 0 {
+		t.Fatalf("补满的令牌桶应被清理: rows=%d, err=%v", countRows(), err)
+	}
+}
+
+// TestRuleMatch 规则路径中 * 和 :name 匹配一段路径，末尾的 ** 匹配剩余路径，method 为空时匹配所有方法
+func TestRuleMatch(t *testing.T) {
+	tests := []struct {
+		method     string
+		pattern    string
+		reqMethod  string
+		reqPath    string
+		wantResult bool
+	}{
+		{"POST", "/api/auth/*", "POST", "/api/auth/login", true},
+		{"POST", "/api/auth/*", "post", "/api/auth/login", true},
+		{"POST", "/api/auth/*", "GET", "/api/auth/login", false},
+		{"POST", "/api/auth/*", "POST", "/api/auth", false},
+		{"POST", "/api/auth/*", "POST", "/api/auth/login/extra", false},
+		{"", "/api/spaces/:id/clips", "GET", "/api/spaces/42/clips", true},
+		{"", "/api/spaces/:id/clips", "GET", "/api/spaces/42/shares", false},
+		{"", "/api/**", "DELETE", "/api/spaces/42/clips/7", true},
+		{"", "/api/**", "GET", "/api", true},
+		{"", "/api/**", "GET", "/other/api", false},
+	}
+	for _, tt := range tests {
+		r := rule{
+			RateLimitRule: config.RateLimitRule{Method: tt.method, Path: tt.pattern},
+			segments:      strings.Split(strings.Trim(tt.pattern, "/"), "/"),
+		}
+		path := strings.Split(strings.Trim(tt.reqPath, "/"), "/")
+		if got := r.match(tt.reqMethod, path); got != tt.wantResult {
+			t.Errorf("%s %s 匹配 %s %s 结果为 %v，期望 %v",
+				tt.reqMethod, tt.reqPath, tt.method, tt.pattern, got, tt.wantResult)
+		}
+	}
+}
+
+// TestPrincipalKeys 规则按IP、用户或 API Token 分别计数，没有对应身份时依次退回到用户和IP
+func TestPrincipalKeys(t *testing.T) {
+	once := func(name, path, key string) config.RateLimitRule {
+		return config.RateLimitRule{Name: name, Path: path, Key: key, Rate: 1, Period: "1h", Burst: 1}
+	}
+	app := setup(t, "memory",
+		once("by-ip", "/ip", "ip"),
+		once("by-user", "/user", "user"),
+		once("by-token", "/token", "token"),
+	)
+
+	alice := map[string]string{"X-User": "alice"}
+	bob := map[string]string{"X-User": "bob"}
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		want    int
+	}{
+		{"按IP限制", "/ip", alice, http.StatusOK},
+		{"同一IP的其他用户", "/ip", bob, http.StatusTooManyRequests},
+
+		{"按用户限制", "/user", alice, http.StatusOK},
+		{"同一用户再次请求", "/user", alice, http.StatusTooManyRequests},
+		{"同一IP的其他用户", "/user", bob, http.StatusOK},
+		{"未登录时按IP限制", "/user", nil, http.StatusOK},
+		{"未登录时再次请求", "/user", nil, http.StatusTooManyRequests},
+
+		{"按 API Token 限制", "/token", map[string]string{"X-User": "alice", "X-Token": "t1"}, http.StatusOK},
+		{"同一用户的其他 Token", "/token", map[string]string{"X-User": "alice", "X-Token": "t2"}, http.StatusOK},
+		{"同一 Token 再次请求", "/token", map[string]string{"X-User": "alice", "X-Token": "t1"}, http.StatusTooManyRequests},
+		{"没有 Token 时按用户限制", "/token", alice, http.StatusOK},
+		{"没有 Token 时同一用户再次请求", "/token", alice, http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		if resp := request(t, app, "GET", tt.path, tt.headers); resp.StatusCode != tt.want {
+			t.Errorf("%s: %s 返回 %d，期望 %d", tt.name, tt.path, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+// TestRateLimitHeaders 通过的请求返回剩余令牌数，被拒绝的请求返回429和 Retry-After
+func TestRateLimitHeaders(t *testing.T) {
+	app := setup(t, "memory",
+		config.RateLimitRule{Name: "items", Path: "/items/**", Key: "ip", Rate: 2, Period: "1m", Burst: 3})
+
+	// 每分钟补充 2 个令牌，补充一个令牌需要 30 秒
+	tests := []struct {
+		status    int
+		remaining string
+		reset     string
+	}{
+		{http.StatusOK, "2", "30"},
+		{http.StatusOK, "1", "60"},
+		{http.StatusOK, "0", "90"},
+		{http.StatusTooManyRequests, "0", "90"},
+	}
+	for i, tt := range tests {
+		resp := request(t, app, "GET", "/items/1", nil)
+		if resp.StatusCode != tt.status {
+			t.Fatalf("第 %d 次请求返回 %d，期望 %d", i+1, resp.StatusCode, tt.status)
+		}
+		want := map[string]string{
+			"RateLimit-Limit":     "3",
+			"RateLimit-Remaining": tt.remaining,
+			"RateLimit-Reset":     tt.reset,
+			"RateLimit-Policy":    "2;w=60;burst=3",
+		}
+		for key, value := range want {
+			if got := resp.Header.Get(key); got != value {
+				t.Errorf("第 %d 次请求 %s 为 %q，期望 %q", i+1, key, got, value)
+			}
+		}
+		if tt.status != http.StatusTooManyRequests {
+			continue
+		}
+
+		if got := resp.Header.Get(fiber.HeaderRetryAfter); got != "30" {
+			t.Errorf("Retry-After 为 %q，期望 \"30\"", got)
+		}
+		var body struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Code != http.StatusTooManyRequests {
+			t.Errorf("响应内容 code=%d, err=%v，期望 429", body.Code, err)
+		}
+	}
+
+	// 不匹配规则的请求不受限制，也不返回响应头
+	resp := request(t, app, "GET", "/other", nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("RateLimit-Limit") != "" {
+		t.Errorf("不匹配规则的请求返回 %d, RateLimit-Limit=%q", resp.StatusCode, resp.Header.Get("RateLimit-Limit"))
+	}
+}
@@ -0,0 +1,84 @@
+package limiter_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"nlip/config"
+	"nlip/middleware"
+	"nlip/middleware/limiter"
+	"nlip/routes"
+	"nlip/utils/clientip"
+	"nlip/utils/testutil"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TestLoginRuleBeforeDefaultRule 使用默认规则时，登录接口在 auth 规则的 5 次之后返回429，此时 api 规则的令牌还很充足
+func TestLoginRuleBeforeDefaultRule(t *testing.T) {
+	t.Setenv("NLIP_LOGIN_LOCKOUT_ENABLED", "false")
+	testutil.Setup(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.CustomErrorHandler})
+	clientip.ApplyConfig(nil, config.Get())
+	app.Use(limiter.New())
+	routes.SetupRoutes(app.Group("/api"))
+
+	// testutil.Setup 关闭了访问频率限制，这里使用默认规则重新开启
+	cfg := *config.Get()
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.Store = "memory"
+	limiter.ApplyConfig(nil, &cfg)
+
+	send := func(method, path, token, body string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	login := func() *http.Response {
+		return send("POST", "/api/v1/nlip/auth/login", "", `{"username":"alice","password":"wrong-password"}`)
+	}
+
+	for i := 1; i <= 5; i++ {
+		resp := login()
+		if resp.StatusCode == http.StatusTooManyRequests {
+			t.Fatalf("第 %d 次登录返回 429，auth 规则允许连续 5 次", i)
+		}
+		// 响应头使用剩余令牌更少的 auth 规则
+		if got := resp.Header.Get("RateLimit-Policy"); got != "5;w=60;burst=5" {
+			t.Fatalf("第 %d 次登录 RateLimit-Policy 为 %q，期望 auth 规则", i, got)
+		}
+	}
+
+	resp := login()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("第 6 次登录返回 %d，期望 429", resp.StatusCode)
+	}
+	if resp.Header.Get("RateLimit-Limit") != "5" || resp.Header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Errorf("429 响应头 RateLimit-Limit=%q, Retry-After=%q，期望 auth 规则",
+			resp.Header.Get("RateLimit-Limit"), resp.Header.Get(fiber.HeaderRetryAfter))
+	}
+
+	// 同一IP登录后的其他接口只受 api 规则限制，仍可访问
+	userID := testutil.CreateUser(t, "alice", false)
+	resp = send("GET", "/api/v1/nlip/spaces/list", testutil.Token(t, userID, "alice", false), "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("登录被限制后其他接口返回 %d，期望 200", resp.StatusCode)
+	}
+	if got := resp.Header.Get("RateLimit-Policy"); got != "60;w=60;burst=60" {
+		t.Errorf("其他接口 RateLimit-Policy 为 %q，期望 api 规则", got)
+	}
+	if got := resp.Header.Get("RateLimit-Remaining"); got != "59" {
+		t.Errorf("api 规则剩余 %q，期望 59", got)
+	}
+}
@@ -0,0 +1,113 @@
+package limiter
+
+import (
+	"database/sql"
+	"math"
+	"nlip/config"
+	"nlip/utils/logger"
+	"sync"
+	"time"
+)
+
+// Store 令牌桶的存储
+type Store interface {
+	// Take 从 key 对应的令牌桶中取出一个令牌，capacity 为桶容量，rate 为每秒补充的令牌数
+	// 返回是否取到令牌和取出后剩余的令牌数，令牌不足时不扣减
+	Take(key string, capacity, rate float64, now time.Time) (bool, float64, error)
+	// Cleanup 删除已经补满的令牌桶，补满的桶与不存在的桶等价
+	Cleanup(now time.Time) error
+}
+
+// memoryStore 保存在内存中的令牌桶，重启后重置
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *memoryStore) Take(key string, capacity, rate float64, now time.Time) (bool, float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(time.Duration((capacity - b.tokens) / rate * float64(time.Second)))
+	return allowed, b.tokens, nil
+}
+
+func (s *memoryStore) Cleanup(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, b := range s.buckets {
+		if !b.full.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+	return nil
+}
+
+// sqliteStore 保存在数据库中的令牌桶，重启后保留，多个实例共享同一个数据库文件时限制一致
+// 每次取令牌只执行一条语句，补充、扣减和判断在同一条语句中完成，不需要事务
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func newSQLiteStore() *sqliteStore {
+	return &sqliteStore{db: config.DB}
+}
+
+// 补充后的令牌数: MIN(@cap, tokens + (@now - updated_at) * @rate)，时间单位为毫秒
+const takeSQL = `
+	INSERT INTO nlip_rate_limits (key, tokens, allowed, updated_at, full_at)
+	VALUES (@key, @cap - 1, 1, @now, @now + CAST(1 / @rate AS INTEGER))
+	ON CONFLICT(key) DO UPDATE SET
+		allowed = MIN(@cap, tokens + (@now - updated_at) * @rate) >= 1,
+		tokens = MIN(@cap, tokens + (@now - updated_at) * @rate)
+			- (MIN(@cap, tokens + (@now - updated_at) * @rate) >= 1),
+		full_at = @now + CAST((@cap - MIN(@cap, tokens + (@now - updated_at) * @rate)
+			+ (MIN(@cap, tokens + (@now - updated_at) * @rate) >= 1)) / @rate AS INTEGER),
+		updated_at = @now
+	RETURNING allowed, tokens
+`
+
+func (s *sqliteStore) Take(key string, capacity, rate float64, now time.Time) (bool, float64, error) {
+	var allowed bool
+	var tokens float64
+	err := s.db.QueryRow(takeSQL,
+		sql.Named("key", key),
+		sql.Named("cap", capacity),
+		sql.Named("now", now.UnixMilli()),
+		sql.Named("rate", rate/1000),
+	).Scan(&allowed, &tokens)
+	return allowed, tokens, err
+}
+
+func (s *sqliteStore) Cleanup(now time.Time) error {
+	result, err := s.db.Exec("DELETE FROM nlip_rate_limits WHERE full_at <= ?", now.UnixMilli())
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		logger.Debug("清理已补满的令牌桶: %d 个", n)
+	}
+	return nil
+}
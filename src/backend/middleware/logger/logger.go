@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"nlip/utils/clientip"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 )
@@ -8,6 +10,12 @@ import (
 // New 创建一个新的日志中间件
 func New() fiber.Handler {
 	return logger.New(logger.Config{
-		Format: "[${time}] ${status} - ${latency} ${method} ${path}\n",
+		Format: "[${time}] ${status} - ${latency} ${ip} ${method} ${path}\n",
+		// 经过可信代理时记录真实的客户端IP
+		CustomTags: map[string]logger.LogFunc{
+			logger.TagIP: func(output logger.Buffer, c *fiber.Ctx, _ *logger.Data, _ string) (int, error) {
+				return output.WriteString(clientip.IP(c))
+			},
+		},
 	})
-} 
\ No newline at end of file
+}
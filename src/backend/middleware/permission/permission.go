@@ -0,0 +1,99 @@
+package permission
+
+import (
+	"nlip/utils/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Role 调用者的角色，由认证中间件设置的用户信息决定
+type Role string
+
+const (
+	RoleGuest Role = "guest"
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
+// Permission 管理功能的操作权限
+type Permission string
+
+const (
+	SettingsRead  Permission = "settings:read"
+	SettingsWrite Permission = "settings:write"
+	StatsRead     Permission = "stats:read"
+	UsersManage   Permission = "users:manage"
+	QuotaManage   Permission = "quota:manage"
+	JobsManage    Permission = "jobs:manage"
+	CleanupManage Permission = "cleanup:manage"
+)
+
+// rolePermissions 各角色拥有的权限，管理员拥有全部权限
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {SettingsRead, SettingsWrite, StatsRead, UsersManage, QuotaManage, JobsManage, CleanupManage},
+}
+
+// RoleOf 获取当前请求调用者的角色，需要在认证中间件之后调用
+func RoleOf(c *fiber.Ctx) Role {
+	if userID, _ := c.Locals("userId").(string); userID == "" {
+		return RoleGuest
+	}
+	if isAdmin, _ := c.Locals("isAdmin").(bool); isAdmin {
+		return RoleAdmin
+	}
+	return RoleUser
+}
+
+// Can 判断当前请求的调用者是否拥有指定权限
+func Can(c *fiber.Ctx, perm Permission) bool {
+	for _, p := range rolePermissions[RoleOf(c)] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// deny 游客返回 401，已登录用户返回 403
+func deny(c *fiber.Ctx, role Role, message string) error {
+	logger.Warning("权限不足: role=%s, userID=%v, %s %s", role, c.Locals("userId"), c.Method(), c.Path())
+	if role == RoleGuest {
+		return fiber.NewError(fiber.StatusUnauthorized, "请先登录")
+	}
+	return fiber.NewError(fiber.StatusForbidden, message)
+}
+
+// RequireRole 只允许指定角色的调用者访问
+func RequireRole(roles ...Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role := RoleOf(c)
+		for _, r := range roles {
+			if r == role {
+				return c.Next()
+			}
+		}
+		return deny(c, role, "没有权限访问")
+	}
+}
+
+// RequirePermission 只允许同时拥有所有指定权限的调用者访问
+func RequirePermission(perms ...Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		for _, perm := range perms {
+			if !Can(c, perm) {
+				return deny(c, RoleOf(c), "没有权限操作")
+			}
+		}
+		return c.Next()
+	}
+}
+
+// RequireAdmin 只允许管理员访问
+func RequireAdmin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if role := RoleOf(c); role != RoleAdmin {
+			return deny(c, role, "需要管理员权限")
+		}
+		return c.Next()
+	}
+}
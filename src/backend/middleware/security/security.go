@@ -0,0 +1,85 @@
+package security
+
+import (
+	"nlip/config"
+	"nlip/utils/clientip"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// docsPolicy Swagger 文档页面使用内联脚本和样式，单独放宽 CSP
+const docsPolicy = "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; object-src 'none'; base-uri 'self'"
+
+// New 创建安全响应头中间件，配置在 security_headers 中，每次请求读取当前配置，重新加载配置后立即生效
+func New() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		cfg := config.Get().SecurityHeaders
+		if !cfg.Enabled {
+			return c.Next()
+		}
+
+		c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+		c.Set(fiber.HeaderXDownloadOptions, "noopen")
+		c.Set(fiber.HeaderXDNSPrefetchControl, "off")
+		// 旧版浏览器的 XSS 过滤器本身存在漏洞，按现行建议关闭，由 CSP 防护
+		c.Set(fiber.HeaderXXSSProtection, "0")
+
+		if cfg.ReferrerPolicy != "" {
+			c.Set(fiber.HeaderReferrerPolicy, cfg.ReferrerPolicy)
+		}
+		if cfg.PermissionsPolicy != "" {
+			c.Set(fiber.HeaderPermissionsPolicy, cfg.PermissionsPolicy)
+		}
+
+		// HSTS 只在 HTTPS 下发送，HTTP 响应中的 HSTS 会被浏览器忽略，也会误导排查
+		// 由反向代理终止 TLS 时只信任可信代理报告的协议，客户端伪造的请求头不会生效
+		if cfg.HSTSMaxAge > 0 && clientip.IsHTTPS(c) {
+			c.Set(fiber.HeaderStrictTransportSecurity, "max-age="+strconv.Itoa(cfg.HSTSMaxAge)+"; includeSubDomains")
+		}
+
+		if frameOptions := xFrameOptions(cfg.FrameAncestors); frameOptions != "" {
+			c.Set(fiber.HeaderXFrameOptions, frameOptions)
+		}
+		if csp := contentSecurityPolicy(c.Path(), cfg.ContentSecurityPolicy, cfg.RawContentSecurityPolicy, cfg.RawPaths); csp != "" {
+			c.Set(fiber.HeaderContentSecurityPolicy, withFrameAncestors(csp, cfg.FrameAncestors))
+		}
+		return c.Next()
+	}
+}
+
+// contentSecurityPolicy 根据路径选择 CSP，原始内容和分享链接直接返回用户上传的内容，使用更严格的策略
+func contentSecurityPolicy(path, defaultPolicy, rawPolicy string, rawPaths []string) string {
+	for _, prefix := range rawPaths {
+		if prefix != "" && strings.HasPrefix(path, prefix) {
+			return rawPolicy
+		}
+	}
+	if path == "/docs" || strings.HasPrefix(path, "/docs/") {
+		return docsPolicy
+	}
+	return defaultPolicy
+}
+
+// withFrameAncestors 在 CSP 中加入 frame-ancestors 指令，CSP 中已包含该指令时保持不变
+func withFrameAncestors(csp string, ancestors []string) string {
+	if len(ancestors) == 0 || strings.Contains(csp, "frame-ancestors") {
+		return csp
+	}
+	return strings.TrimRight(strings.TrimSpace(csp), ";") + "; frame-ancestors " + strings.Join(ancestors, " ")
+}
+
+// xFrameOptions 为不支持 frame-ancestors 的旧版浏览器生成 X-Frame-Options，无法表示的来源列表不设置
+func xFrameOptions(ancestors []string) string {
+	if len(ancestors) != 1 {
+		return ""
+	}
+	switch ancestors[0] {
+	case "'none'":
+		return "DENY"
+	case "'self'":
+		return "SAMEORIGIN"
+	}
+	return ""
+}
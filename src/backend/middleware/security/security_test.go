@@ -0,0 +1,224 @@
+package security
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"nlip/config"
+	"nlip/utils/clientip"
+	"nlip/utils/testutil"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func newApp() *fiber.App {
+	clientip.ApplyConfig(nil, config.Get())
+	app := fiber.New()
+	app.Use(New())
+	app.Get("/*", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	return app
+}
+
+func get(t *testing.T, app *fiber.App, path string, headers map[string]string) http.Header {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	return resp.Header
+}
+
+func TestContentSecurityPolicy(t *testing.T) {
+	testutil.Setup(t)
+	app := newApp()
+	cfg := config.Get().SecurityHeaders
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"前端页面", "/", cfg.ContentSecurityPolicy + "; frame-ancestors 'self'"},
+		{"接口", "/api/v1/nlip/spaces/list", cfg.ContentSecurityPolicy + "; frame-ancestors 'self'"},
+		{"原始内容", "/api/v1/nlip/raw/space/clip", cfg.RawContentSecurityPolicy + "; frame-ancestors 'self'"},
+		{"分享链接", "/api/v1/nlip/s/token", cfg.RawContentSecurityPolicy + "; frame-ancestors 'self'"},
+		{"接口文档", "/docs/index.html", docsPolicy + "; frame-ancestors 'self'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := get(t, app, tt.path, nil)
+			if got := header.Get(fiber.HeaderContentSecurityPolicy); got != tt.want {
+				t.Errorf("%s 的 CSP 为 %q，期望 %q", tt.path, got, tt.want)
+			}
+			if got := header.Get(fiber.HeaderXContentTypeOptions); got != "nosniff" {
+				t.Errorf("%s 的 X-Content-Type-Options 为 %q", tt.path, got)
+			}
+		})
+	}
+}
+
+func TestRawPolicyBlocksScripts(t *testing.T) {
+	testutil.Setup(t)
+	app := newApp()
+
+	csp := get(t, app, "/api/v1/nlip/raw/space/clip", nil).Get(fiber.HeaderContentSecurityPolicy)
+	if csp == "" || csp == config.Get().SecurityHeaders.ContentSecurityPolicy {
+		t.Fatalf("原始内容应使用单独的 CSP，实际为 %q", csp)
+	}
+	for _, directive := range []string{"default-src 'none'", "frame-ancestors 'self'"} {
+		if !containsDirective(csp, directive) {
+			t.Errorf("原始内容的 CSP %q 缺少 %s", csp, directive)
+		}
+	}
+}
+
+func containsDirective(csp, directive string) bool {
+	for _, part := range strings.Split(csp, ";") {
+		if strings.TrimSpace(part) == directive {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFrameOptions(t *testing.T) {
+	testutil.Setup(t)
+	app := newApp()
+
+	if got := get(t, app, "/", nil).Get(fiber.HeaderXFrameOptions); got != "SAMEORIGIN" {
+		t.Errorf("默认的 X-Frame-Options 为 %q，期望 SAMEORIGIN", got)
+	}
+
+	tests := []struct {
+		ancestors []string
+		want      string
+	}{
+		{[]string{"'self'"}, "SAMEORIGIN"},
+		{[]string{"'none'"}, "DENY"},
+		{[]string{"https://example.com"}, ""},
+		{[]string{"'self'", "https://example.com"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := xFrameOptions(tt.ancestors); got != tt.want {
+			t.Errorf("xFrameOptions(%v) = %q，期望 %q", tt.ancestors, got, tt.want)
+		}
+	}
+}
+
+func TestHSTSRequiresHTTPS(t *testing.T) {
+	testutil.Setup(t)
+	app := newApp()
+
+	// 测试请求的连接地址不在可信代理中，伪造的协议请求头不应生效
+	tests := []struct {
+		name    string
+		headers map[string]string
+	}{
+		{"HTTP 请求", nil},
+		{"不可信的 X-Forwarded-Proto", map[string]string{fiber.HeaderXForwardedProto: "https"}},
+		{"不可信的 Forwarded", map[string]string{fiber.HeaderForwarded: "for=192.0.2.1;proto=https"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := get(t, app, "/", tt.headers).Get(fiber.HeaderStrictTransportSecurity); got != "" {
+				t.Errorf("不应发送 HSTS，实际为 %q", got)
+			}
+		})
+	}
+}
+
+func TestHSTSFromTrustedProxy(t *testing.T) {
+	// app.Test 发出的请求连接地址为 0.0.0.0
+	t.Setenv("NLIP_TRUSTED_PROXIES", "0.0.0.0")
+	testutil.Setup(t)
+	app := newApp()
+	want := "max-age=31536000; includeSubDomains"
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"X-Forwarded-Proto 为 https", map[string]string{fiber.HeaderXForwardedProto: "https"}, want},
+		{"X-Forwarded-Proto 为 http", map[string]string{fiber.HeaderXForwardedProto: "http"}, ""},
+		{"没有协议请求头", nil, ""},
+		// 默认只使用 X-Forwarded-Proto，代理原样传入的 Forwarded 可能由客户端伪造
+		{"Forwarded 中 proto 为 https", map[string]string{fiber.HeaderForwarded: "for=192.0.2.1;proto=https"}, ""},
+		{"Forwarded 与 X-Forwarded-Proto 冲突", map[string]string{
+			fiber.HeaderForwarded:       "for=192.0.2.1;proto=https",
+			fiber.HeaderXForwardedProto: "http",
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := get(t, app, "/", tt.headers).Get(fiber.HeaderStrictTransportSecurity); got != tt.want {
+				t.Errorf("HSTS 为 %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHSTSFromTrustedForwardedHeader(t *testing.T) {
+	t.Setenv("NLIP_TRUSTED_PROXIES", "0.0.0.0")
+	t.Setenv("NLIP_TRUSTED_HEADER", "forwarded")
+	testutil.Setup(t)
+	app := newApp()
+	want := "max-age=31536000; includeSubDomains"
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"Forwarded 中 proto 为 https", map[string]string{fiber.HeaderForwarded: "for=192.0.2.1;proto=https"}, want},
+		{"Forwarded 与 X-Forwarded-Proto 冲突", map[string]string{
+			fiber.HeaderForwarded:       "for=192.0.2.1;proto=http",
+			fiber.HeaderXForwardedProto: "https",
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := get(t, app, "/", tt.headers).Get(fiber.HeaderStrictTransportSecurity); got != tt.want {
+				t.Errorf("HSTS 为 %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHSTSOverTLS(t *testing.T) {
+	testutil.Setup(t)
+	app := newApp()
+
+	// 借用 httptest 生成的自签名证书
+	certServer := httptest.NewTLSServer(http.NotFoundHandler())
+	client := certServer.Client()
+	tlsConfig := certServer.TLS.Clone()
+	certServer.Close()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+
+	resp, err := client.Get("https://" + ln.Addr().(*net.TCPAddr).String() + "/")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get(fiber.HeaderStrictTransportSecurity); got != "max-age=31536000; includeSubDomains" {
+		t.Errorf("TLS 连接的 HSTS 为 %q", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"nlip/utils/logger"
 	fileValidator "nlip/utils/validator"
+	"reflect"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
@@ -38,8 +39,8 @@ func ValidateBody(payload interface{}) fiber.Handler {
 		logger.Debug("Content-Type: %s", c.Get("Content-Type"))
 		logger.Debug("Raw Body: %s", string(c.Body()))
 
-		// 创建一个新的payload实例
-		p := payload
+		// 创建一个新的payload实例，避免并发请求或上一次请求的数据残留
+		p := reflect.New(reflect.TypeOf(payload).Elem()).Interface()
 
 		// 解析请求体
 		if err := c.BodyParser(p); err != nil {
@@ -0,0 +1,75 @@
+package cleanup
+
+import (
+	"time"
+)
+
+// 清理类型
+const (
+	KindExpired       = "expired"
+	KindOverflow      = "overflow"
+	KindSpaceOverflow = "space_overflow"
+)
+
+// 清理执行结果
+const (
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+)
+
+// SpaceResult 单个空间的清理结果
+type SpaceResult struct {
+	SpaceID      string   `json:"spaceId"`
+	SpaceName    string   `json:"spaceName"`
+	ItemsDeleted int      `json:"itemsDeleted"`
+	BytesFreed   int64    `json:"bytesFreed"`
+	ClipIDs      []string `json:"clipIds"`
+}
+
+// Run 一次清理的执行记录
+type Run struct {
+	ID           string        `json:"id"`
+	Kind         string        `json:"kind"`
+	StartedAt    time.Time     `json:"startedAt"`
+	FinishedAt   time.Time     `json:"finishedAt"`
+	ItemsDeleted int           `json:"itemsDeleted"`
+	BytesFreed   int64         `json:"bytesFreed"`
+	Status       string        `json:"status"`
+	Error        string        `json:"error,omitempty"`
+	Spaces       []SpaceResult `json:"spaces,omitempty"`
+}
+
+// Preview 预演清理时将要删除的内容
+type Preview struct {
+	ItemsToDelete int           `json:"itemsToDelete"`
+	BytesToFree   int64         `json:"bytesToFree"`
+	Spaces        []SpaceResult `json:"spaces"`
+}
+
+// DryRunResult 清理预演结果，超量清理的预演不包含已计入过期清理的内容
+type DryRunResult struct {
+	GeneratedAt time.Time `json:"generatedAt"`
+	Expired     *Preview  `json:"expired,omitempty"`
+	Overflow    *Preview  `json:"overflow,omitempty"`
+}
+
+// DryRunOptions 预演清理的参数，保留天数和最大数量不为空时替换空间当前设置
+type DryRunOptions struct {
+	Kind          string
+	SpaceID       string
+	RetentionDays *int
+	MaxItems      *int
+}
+
+type RunResponse struct {
+	Run *Run `json:"run"`
+}
+
+type ListRunsResponse struct {
+	Runs  []Run `json:"runs"`
+	Total int   `json:"total"`
+}
+
+type DryRunResponse struct {
+	DryRun *DryRunResult `json:"dryRun"`
+}
@@ -11,6 +11,8 @@ type Clip struct {
     ContentType string    `json:"contentType"`
     Content     string   `json:"content,omitempty"`
     FilePath    string   `json:"filePath,omitempty"`
+    IsProtected bool      `json:"isProtected"`
+    PasswordHash string   `json:"-"`
     Creator     *Creator  `json:"creator,omitempty"`
     CreatedAt   time.Time `json:"createdAt"`
     UpdatedAt   time.Time `json:"updatedAt"`
@@ -26,6 +28,7 @@ type UploadClipRequest struct {
     Content     string `json:"content"`
     ContentType string `json:"contentType"`
     Creator     string `json:"creator,omitempty"`
+    Password    string `json:"password,omitempty" validate:"omitempty,min=4,max=72"`
     File        []byte `json:"-"`
     FileName    string `json:"-"`
 }
@@ -40,4 +43,9 @@ type ListClipsResponse struct {
 
 type UpdateClipRequest struct {
     Content string `json:"content" validate:"required"`
-} 
\ No newline at end of file
+}
+
+// SetClipPasswordRequest 设置或清除剪贴板密码请求，密码为空时清除
+type SetClipPasswordRequest struct {
+    Password string `json:"password" validate:"omitempty,min=4,max=72"`
+}
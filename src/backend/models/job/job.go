@@ -0,0 +1,40 @@
+package job
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 后台任务状态
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+// Job 持久化在数据库中的后台任务
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	UniqueKey   string          `json:"uniqueKey,omitempty"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	RunAt       time.Time       `json:"runAt"`
+	LastError   string          `json:"lastError,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+	FinishedAt  *time.Time      `json:"finishedAt"`
+}
+
+type JobResponse struct {
+	Job *Job `json:"job"`
+}
+
+type ListJobsResponse struct {
+	Jobs  []Job          `json:"jobs"`
+	Total int            `json:"total"`
+	Stats map[string]int `json:"stats"`
+}
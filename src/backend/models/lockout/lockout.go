@@ -0,0 +1,40 @@
+package lockout
+
+import "time"
+
+// 登录失败记录的类型
+const (
+	KindAccount = "account"
+	KindIP      = "ip"
+)
+
+// 账号安全事件类型
+const (
+	// NoticeAccountLocked 登录失败次数过多，账号被临时锁定
+	NoticeAccountLocked = "account_locked"
+	// NoticeFailedLogins 上次登录成功后出现过登录失败
+	NoticeFailedLogins = "failed_logins"
+)
+
+// Entry 账号或IP的登录失败记录，LockedUntil 为空表示未锁定
+type Entry struct {
+	Kind         string     `json:"kind"`
+	Value        string     `json:"value"`
+	Failures     int        `json:"failures"`
+	LastIP       string     `json:"lastIp"`
+	LastFailedAt time.Time  `json:"lastFailedAt"`
+	LockedUntil  *time.Time `json:"lockedUntil"`
+}
+
+type ListLockoutsResponse struct {
+	Lockouts []Entry `json:"lockouts"`
+}
+
+// Notice 登录成功时提示用户的账号安全事件
+type Notice struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"`
+	IP        string    `json:"ip"`
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,18 @@
+package quota
+
+// Usage 存储用量，QuotaBytes 为 0 表示不限制
+type Usage struct {
+	UsedBytes  int64 `json:"usedBytes"`
+	QuotaBytes int64 `json:"quotaBytes"`
+	// Custom 是否为管理员单独设置的配额，否则使用全局默认配额
+	Custom bool `json:"custom"`
+}
+
+// UpdateQuotaRequest 设置配额请求，QuotaBytes 为空时恢复使用全局默认配额，为 0 时不限制
+type UpdateQuotaRequest struct {
+	QuotaBytes *int64 `json:"quotaBytes"`
+}
+
+type UsageResponse struct {
+	Storage *Usage `json:"storage"`
+}
@@ -0,0 +1,40 @@
+package schedule
+
+import (
+	"time"
+)
+
+// 定时任务的执行结果
+const (
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+)
+
+// 定时任务的触发方式
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+	TriggerStartup  = "startup"
+)
+
+// ScheduledTask 定时任务及其最近一次执行情况
+type ScheduledTask struct {
+	Name           string     `json:"name"`
+	Schedule       string     `json:"schedule"`
+	Running        bool       `json:"running"`
+	NextRunAt      *time.Time `json:"nextRunAt"`
+	LastRunAt      *time.Time `json:"lastRunAt"`
+	LastDurationMs int64      `json:"lastDurationMs"`
+	LastStatus     string     `json:"lastStatus,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	LastTrigger    string     `json:"lastTrigger,omitempty"`
+	RunCount       int        `json:"runCount"`
+}
+
+type ScheduledTaskResponse struct {
+	Task *ScheduledTask `json:"task"`
+}
+
+type ListScheduledTasksResponse struct {
+	Tasks []ScheduledTask `json:"tasks"`
+}
@@ -0,0 +1,55 @@
+package settings
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ServerSettings 服务器设置
+type ServerSettings struct {
+	FileTypes struct {
+		AllowList []string `json:"allow_list"`
+		DenyList  []string `json:"deny_list"`
+	} `json:"file_types"`
+	Upload struct {
+		MaxSize int64 `json:"max_size"`
+	} `json:"upload"`
+	Space struct {
+		DefaultMaxItems       int `json:"default_max_items"`
+		DefaultRetentionDays  int `json:"default_retention_days"`
+		MaxItemsLimit         int `json:"max_items_limit"`
+		MaxRetentionDaysLimit int `json:"max_retention_days_limit"`
+	} `json:"space"`
+	Security struct {
+		TokenExpiry string `json:"token_expiry"`
+		Require2FA  string `json:"require_2fa"`
+	} `json:"security"`
+}
+
+// Change 一项设置的变更
+type Change struct {
+	Key      string          `json:"key"`
+	OldValue json.RawMessage `json:"oldValue"`
+	NewValue json.RawMessage `json:"newValue"`
+}
+
+// AuditEntry 设置变更记录
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	Key       string          `json:"key"`
+	OldValue  json.RawMessage `json:"oldValue"`
+	NewValue  json.RawMessage `json:"newValue"`
+	ChangedBy string          `json:"changedBy"`
+	Username  string          `json:"username"`
+	ChangedAt time.Time       `json:"changedAt"`
+}
+
+type UpdateSettingsResponse struct {
+	Settings *ServerSettings `json:"settings"`
+	Changes  []Change        `json:"changes"`
+}
+
+type ListHistoryResponse struct {
+	History []AuditEntry `json:"history"`
+	Total   int          `json:"total"`
+}
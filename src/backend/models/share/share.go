@@ -0,0 +1,52 @@
+package share
+
+import (
+	"time"
+)
+
+// ShareLink 单个剪贴板的公开分享链接
+type ShareLink struct {
+	ID            string     `json:"id"`
+	SpaceID       string     `json:"spaceId"`
+	ClipID        string     `json:"clipId"`
+	CreatedBy     string     `json:"createdBy"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	ExpiresAt     time.Time  `json:"expiresAt"`
+	MaxDownloads  *int       `json:"maxDownloads"`
+	DownloadCount int        `json:"downloadCount"`
+	RevokedAt     *time.Time `json:"revokedAt"`
+	AccessCount   int        `json:"accessCount"`
+	URL           string     `json:"url,omitempty"`
+}
+
+// AccessLog 分享链接访问记录
+type AccessLog struct {
+	ID         int64     `json:"id"`
+	ShareID    string    `json:"shareId"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+	Action     string    `json:"action"` // view 或 download
+	Status     string    `json:"status"`
+	AccessedAt time.Time `json:"accessedAt"`
+}
+
+// CreateShareRequest 创建分享链接请求
+type CreateShareRequest struct {
+	ExpiresInHours int  `json:"expiresInHours" validate:"required,min=1,max=720"`
+	MaxDownloads   *int `json:"maxDownloads" validate:"omitempty,min=1"`
+}
+
+// ShareResponse 分享链接响应
+type ShareResponse struct {
+	Share *ShareLink `json:"share"`
+}
+
+// ListSharesResponse 分享链接列表响应
+type ListSharesResponse struct {
+	Shares []ShareLink `json:"shares"`
+}
+
+// ListAccessLogsResponse 访问记录列表响应
+type ListAccessLogsResponse struct {
+	Logs []AccessLog `json:"logs"`
+}
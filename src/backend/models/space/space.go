@@ -1,6 +1,8 @@
 package space
 
 import (
+	"nlip/models/quota"
+	"nlip/models/stats"
 	"time"
 )
 
@@ -100,6 +102,12 @@ type ListCollaboratorsResponse struct {
 
 // SpaceStatsResponse 空间统计信息
 type SpaceStatsResponse struct {
-	ClipsCount     int    `json:"clipsCount"`
+	stats.Activity
 	OwnerUsername  string `json:"ownerUsername"`
+	// Storage 空间的存储用量和配额
+	Storage *quota.Usage `json:"storage"`
+	// NextEvictionAt 最早的内容超过保留天数的时间，内容在此后的第一次过期清理中删除
+	NextEvictionAt *time.Time `json:"nextEvictionAt"`
+	// NextEvictionIn 距离 NextEvictionAt 的秒数，已过期等待清理时为 0
+	NextEvictionIn *int64 `json:"nextEvictionIn"`
 }
@@ -0,0 +1,61 @@
+package stats
+
+import (
+	"time"
+)
+
+// ContentTypeStat 按内容类型统计的数量和大小
+type ContentTypeStat struct {
+	ContentType string `json:"contentType"`
+	Count       int    `json:"count"`
+	Bytes       int64  `json:"bytes"`
+}
+
+// DailyUploads 单日上传的数量和大小，Date 格式为 YYYY-MM-DD
+type DailyUploads struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Contributor 上传内容最多的用户
+type Contributor struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	Count    int    `json:"count"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// SpaceUsage 占用空间最多的空间
+type SpaceUsage struct {
+	SpaceID    string `json:"spaceId"`
+	SpaceName  string `json:"spaceName"`
+	Type       string `json:"type"`
+	ClipsCount int    `json:"clipsCount"`
+	UsedBytes  int64  `json:"usedBytes"`
+}
+
+// Activity 内容统计，空间统计和实例统计共用
+type Activity struct {
+	ClipsCount      int               `json:"clipsCount"`
+	TotalBytes      int64             `json:"totalBytes"`
+	ContentTypes    []ContentTypeStat `json:"contentTypes"`
+	UploadsPerDay   []DailyUploads    `json:"uploadsPerDay"`
+	TopContributors []Contributor     `json:"topContributors"`
+	LastActivityAt  *time.Time        `json:"lastActivityAt"`
+}
+
+// InstanceStats 实例统计信息
+type InstanceStats struct {
+	Activity
+	UsersCount         int          `json:"usersCount"`
+	SpacesCount        int          `json:"spacesCount"`
+	PublicSpacesCount  int          `json:"publicSpacesCount"`
+	PrivateSpacesCount int          `json:"privateSpacesCount"`
+	TopSpaces          []SpaceUsage `json:"topSpaces"`
+	GeneratedAt        time.Time    `json:"generatedAt"`
+}
+
+type InstanceStatsResponse struct {
+	Stats *InstanceStats `json:"stats"`
+}
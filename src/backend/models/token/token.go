@@ -2,6 +2,7 @@ package token
 
 import (
 	"time"
+	"nlip/models/lockout"
 	"nlip/models/user"
 )
 
@@ -33,6 +34,8 @@ type TokenLoginRequest struct {
 type TokenLoginResponse struct {
 	JWTToken string `json:"jwtToken"`
 	User     *user.User  `json:"user"`
+	// SecurityNotices 上次登录后的账号安全事件，每条只返回一次
+	SecurityNotices []lockout.Notice `json:"securityNotices,omitempty"`
 }
 
 type ListTokensResponse struct {
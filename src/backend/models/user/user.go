@@ -1,6 +1,8 @@
 package user
 
 import (
+	"nlip/models/lockout"
+	"nlip/models/quota"
 	"time"
 )
 
@@ -10,7 +12,10 @@ type User struct {
 	PasswordHash  string    `json:"-"`
 	IsAdmin       bool      `json:"isAdmin"`
 	NeedChangePwd bool      `json:"needChangePwd"`
+	Disabled      bool      `json:"disabled"`
 	CreatedAt     time.Time `json:"createdAt"`
+	// TwoFactorEnabled 是否已启用两步验证
+	TwoFactorEnabled bool `json:"twoFactorEnabled"`
 }
 
 type LoginRequest struct {
@@ -27,6 +32,50 @@ type AuthResponse struct {
 	Token         string `json:"token"`
 	User          *User  `json:"user"`
 	NeedChangePwd bool   `json:"needChangePwd"`
+	// SecurityNotices 上次登录后的账号安全事件，例如登录失败和账号被锁定，每条只返回一次
+	SecurityNotices []lockout.Notice `json:"securityNotices,omitempty"`
+	// TwoFactorSetupRequired 服务器要求该用户启用两步验证，启用前只能访问两步验证相关接口
+	TwoFactorSetupRequired bool `json:"twoFactorSetupRequired,omitempty"`
+}
+
+// TwoFactorChallengeResponse 已启用两步验证的用户密码验证通过后返回挑战令牌，提交验证码后才能获得登录令牌
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+	ExpiresIn         int    `json:"expiresIn"`
+}
+
+// TwoFactorVerifyRequest code 为身份验证器应用中的6位验证码或恢复码
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challengeToken" validate:"required"`
+	Code           string `json:"code" validate:"required,min=6,max=20"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required,min=6,max=20"`
+}
+
+// TwoFactorDisableRequest 关闭两步验证需要同时提供密码和验证码
+type TwoFactorDisableRequest struct {
+	Password string `json:"password" validate:"required,min=6,max=50"`
+	Code     string `json:"code" validate:"required,min=6,max=20"`
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
+
+// TwoFactorSetupResponse uri 可生成二维码供身份验证器应用扫描，也可以手动输入 secret
+type TwoFactorSetupResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodesResponse 恢复码只在生成时返回一次
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
 }
 
 type ChangePasswordRequest struct {
@@ -35,7 +84,59 @@ type ChangePasswordRequest struct {
 }
 
 type GetCurrentUserResponse struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	IsAdmin  bool   `json:"isAdmin"`
+	ID       string       `json:"id"`
+	Username string       `json:"username"`
+	IsAdmin  bool         `json:"isAdmin"`
+	Storage  *quota.Usage `json:"storage"`
+}
+
+// AdminUser 管理员查看的用户信息
+type AdminUser struct {
+	ID            string    `json:"id"`
+	Username      string    `json:"username"`
+	IsAdmin       bool      `json:"isAdmin"`
+	NeedChangePwd bool      `json:"needChangePwd"`
+	Disabled      bool      `json:"disabled"`
+	CreatedAt     time.Time `json:"createdAt"`
+	SpacesCount   int       `json:"spacesCount"`
+	UsedBytes     int64     `json:"usedBytes"`
+	// TwoFactorEnabled 是否已启用两步验证
+	TwoFactorEnabled bool `json:"twoFactorEnabled"`
+}
+
+type ListUsersResponse struct {
+	Users []AdminUser `json:"users"`
+	Total int         `json:"total"`
+}
+
+type AdminUserResponse struct {
+	User *AdminUser `json:"user"`
+}
+
+type CreateUserRequest struct {
+	Username      string `json:"username" validate:"required,min=3,max=50"`
+	Password      string `json:"password" validate:"required,min=6,max=50"`
+	IsAdmin       bool   `json:"isAdmin"`
+	NeedChangePwd bool   `json:"needChangePwd"`
+}
+
+// UpdateUserRequest 未传的字段保持不变
+type UpdateUserRequest struct {
+	IsAdmin  *bool `json:"isAdmin"`
+	Disabled *bool `json:"disabled"`
+}
+
+// ResetPasswordRequest 未指定新密码时随机生成
+type ResetPasswordRequest struct {
+	NewPassword string `json:"newPassword" validate:"omitempty,min=6,max=50"`
+}
+
+type ResetPasswordResponse struct {
+	User     *AdminUser `json:"user"`
+	Password string     `json:"password,omitempty"`
+}
+
+type DeleteUserResponse struct {
+	TransferredSpaces int `json:"transferredSpaces"`
+	DeletedSpaces     int `json:"deletedSpaces"`
 }
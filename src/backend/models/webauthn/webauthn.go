@@ -0,0 +1,119 @@
+package webauthn
+
+import "time"
+
+// Credential 用户注册的通行密钥，ID 为凭据ID的 base64url 编码
+type Credential struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+type ListCredentialsResponse struct {
+	Credentials []Credential `json:"credentials"`
+}
+
+type CredentialResponse struct {
+	Credential *Credential `json:"credential"`
+}
+
+// 以下为传给浏览器 navigator.credentials 的参数，二进制字段均为 base64url 编码
+
+type RelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions 注册通行密钥的参数，对应 PublicKeyCredentialCreationOptions
+type CreationOptions struct {
+	RP                     RelyingParty           `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              string                 `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	Attestation            string                 `json:"attestation"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+}
+
+// RequestOptions 使用通行密钥登录的参数，对应 PublicKeyCredentialRequestOptions
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int                    `json:"timeout"`
+	UserVerification string                 `json:"userVerification"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+}
+
+type CreationOptionsResponse struct {
+	PublicKey CreationOptions `json:"publicKey"`
+}
+
+type RequestOptionsResponse struct {
+	PublicKey RequestOptions `json:"publicKey"`
+}
+
+// AttestationResponse navigator.credentials.create() 返回的凭据，与 PublicKeyCredential.toJSON() 格式一致
+type AttestationResponse struct {
+	ID       string `json:"id" validate:"required"`
+	Type     string `json:"type" validate:"required"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON" validate:"required"`
+		AttestationObject string   `json:"attestationObject" validate:"required"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse navigator.credentials.get() 返回的凭据，与 PublicKeyCredential.toJSON() 格式一致
+type AssertionResponse struct {
+	ID       string `json:"id" validate:"required"`
+	Type     string `json:"type" validate:"required"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON" validate:"required"`
+		AuthenticatorData string `json:"authenticatorData" validate:"required"`
+		Signature         string `json:"signature" validate:"required"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+type FinishRegistrationRequest struct {
+	Name       string              `json:"name" validate:"max=50"`
+	Credential AttestationResponse `json:"credential"`
+}
+
+// BeginLoginRequest 不指定用户名时使用可发现凭据，由浏览器列出设备上保存的通行密钥
+type BeginLoginRequest struct {
+	Username string `json:"username" validate:"omitempty,max=50"`
+}
+
+type FinishLoginRequest struct {
+	Credential AssertionResponse `json:"credential"`
+}
+
+type RenameCredentialRequest struct {
+	Name string `json:"name" validate:"required,max=50"`
+}
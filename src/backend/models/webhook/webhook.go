@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"time"
+)
+
+// 投递状态
+const (
+	DeliveryPending = "pending"
+	DeliverySuccess = "success"
+	DeliveryFailed  = "failed"
+)
+
+// 可订阅的事件类型
+const (
+	EventClipCreated         = "clip_created"
+	EventClipUpdated         = "clip_updated"
+	EventClipDeleted         = "clip_deleted"
+	EventCollaboratorAdded   = "collaborator_added"
+	EventCollaboratorRemoved = "collaborator_removed"
+	EventCollaboratorUpdated = "collaborator_updated"
+)
+
+// AllEvents 所有可订阅的事件类型
+var AllEvents = []string{
+	EventClipCreated,
+	EventClipUpdated,
+	EventClipDeleted,
+	EventCollaboratorAdded,
+	EventCollaboratorRemoved,
+	EventCollaboratorUpdated,
+}
+
+// Webhook 空间的出站 Webhook
+type Webhook struct {
+	ID        string    `json:"id"`
+	SpaceID   string    `json:"spaceId"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Delivery Webhook 投递记录
+type Delivery struct {
+	ID             string     `json:"id"`
+	WebhookID      string     `json:"webhookId"`
+	EventType      string     `json:"eventType"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt"`
+	LastStatusCode *int       `json:"lastStatusCode"`
+	LastError      string     `json:"lastError,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt"`
+}
+
+// Payload 发送给 Webhook 接收方的消息体
+type Payload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	SpaceID   string      `json:"spaceId"`
+	Timestamp int64       `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// CreateWebhookRequest 创建 Webhook 请求
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" validate:"required,url,max=2048"`
+	Events []string `json:"events" validate:"omitempty,dive,oneof=clip_created clip_updated clip_deleted collaborator_added collaborator_removed collaborator_updated"`
+}
+
+// WebhookResponse Webhook 响应
+type WebhookResponse struct {
+	Webhook *Webhook `json:"webhook"`
+}
+
+// ListWebhooksResponse Webhook 列表响应
+type ListWebhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+// DeliveryResponse 投递记录响应
+type DeliveryResponse struct {
+	Delivery *Delivery `json:"delivery"`
+}
+
+// ListDeliveriesResponse 投递记录列表响应
+type ListDeliveriesResponse struct {
+	Deliveries []Delivery `json:"deliveries"`
+}
+
+// IngestHook 入站 Webhook，通过密钥地址无需登录即可向空间写入内容
+type IngestHook struct {
+	ID                  string     `json:"id"`
+	SpaceID             string     `json:"spaceId"`
+	Name                string     `json:"name"`
+	AllowedContentTypes []string   `json:"allowedContentTypes"`
+	RateLimit           int        `json:"rateLimit"`
+	CreatedBy           string     `json:"createdBy"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	LastUsedAt          *time.Time `json:"lastUsedAt"`
+	RevokedAt           *time.Time `json:"revokedAt"`
+	URL                 string     `json:"url,omitempty"`
+}
+
+// CreateIngestHookRequest 创建入站 Webhook 请求
+type CreateIngestHookRequest struct {
+	Name                string   `json:"name" validate:"required,min=1,max=100"`
+	AllowedContentTypes []string `json:"allowedContentTypes" validate:"omitempty,dive,oneof=application/json application/x-www-form-urlencoded multipart/form-data text/plain application/octet-stream"`
+	RateLimit           int      `json:"rateLimit" validate:"omitempty,min=1,max=600"`
+}
+
+// IngestHookResponse 入站 Webhook 响应
+type IngestHookResponse struct {
+	Hook *IngestHook `json:"hook"`
+}
+
+// ListIngestHooksResponse 入站 Webhook 列表响应
+type ListIngestHooksResponse struct {
+	Hooks []IngestHook `json:"hooks"`
+}
@@ -5,13 +5,19 @@ import (
 	authHandler "nlip/handlers/auth"
 	"nlip/handlers/clips"
 	"nlip/handlers/spaces"
+	"nlip/handlers/webhooks"
 	"nlip/handlers/ws"
 	"nlip/middleware/auth"
+	"nlip/middleware/limiter"
+	"nlip/middleware/permission"
 	"nlip/middleware/validator"
 	"nlip/models/clip"
+	"nlip/models/share"
 	"nlip/models/space"
 	"nlip/models/token"
 	"nlip/models/user"
+	"nlip/models/webauthn"
+	"nlip/models/webhook"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
@@ -41,15 +47,18 @@ func setupV1Routes(api fiber.Router) {
 		})
 	})
 
-	// 2. 认证路由 - 不需要token
+	// 2. 认证路由 - 不需要token，按用户限制的规则对这些请求按IP生效
 	authRoutes := api.Group("/auth")
-	authRoutes.Post("/login", validator.ValidateBody(&user.LoginRequest{}), authHandler.HandleLogin)
-	authRoutes.Post("/register", validator.ValidateBody(&user.RegisterRequest{}), authHandler.HandleRegister)
-	authRoutes.Post("/token-login", validator.ValidateBody(&token.TokenLoginRequest{}), authHandler.HandleTokenLogin)
+	authRoutes.Post("/login", limiter.Principal(), validator.ValidateBody(&user.LoginRequest{}), authHandler.HandleLogin)
+	authRoutes.Post("/register", limiter.Principal(), validator.ValidateBody(&user.RegisterRequest{}), authHandler.HandleRegister)
+	authRoutes.Post("/token-login", limiter.Principal(), validator.ValidateBody(&token.TokenLoginRequest{}), authHandler.HandleTokenLogin)
+	authRoutes.Post("/2fa/verify", limiter.Principal(), validator.ValidateBody(&user.TwoFactorVerifyRequest{}), authHandler.HandleVerifyTwoFactor)
+	authRoutes.Post("/webauthn/login/begin", limiter.Principal(), validator.ValidateBody(&webauthn.BeginLoginRequest{}), authHandler.HandleBeginPasskeyLogin)
+	authRoutes.Post("/webauthn/login/finish", limiter.Principal(), validator.ValidateBody(&webauthn.FinishLoginRequest{}), authHandler.HandleFinishPasskeyLogin)
 
 	// 3. 需要认证的路由组 - 需要token
 	authenticated := api.Group("")
-	authenticated.Use(auth.AuthMiddleware())
+	authenticated.Use(auth.AuthMiddleware(), limiter.Principal())
 
 	// 用户相关路由
 	authenticated.Get("/auth/me", authHandler.HandleGetCurrentUser)
@@ -57,6 +66,24 @@ func setupV1Routes(api fiber.Router) {
 		validator.ValidateBody(&user.ChangePasswordRequest{}),
 		authHandler.HandleChangePassword)
 
+	// 两步验证相关路由
+	authenticated.Get("/auth/2fa", authHandler.HandleGetTwoFactorStatus)
+	authenticated.Post("/auth/2fa/setup", authHandler.HandleSetupTwoFactor)
+	authenticated.Post("/auth/2fa/enable", validator.ValidateBody(&user.TwoFactorCodeRequest{}), authHandler.HandleEnableTwoFactor)
+	authenticated.Post("/auth/2fa/disable", validator.ValidateBody(&user.TwoFactorDisableRequest{}), authHandler.HandleDisableTwoFactor)
+	authenticated.Post("/auth/2fa/recovery-codes", validator.ValidateBody(&user.TwoFactorCodeRequest{}), authHandler.HandleRegenerateRecoveryCodes)
+
+	// 通行密钥相关路由
+	authenticated.Post("/auth/webauthn/register/begin", authHandler.HandleBeginPasskeyRegistration)
+	authenticated.Post("/auth/webauthn/register/finish",
+		validator.ValidateBody(&webauthn.FinishRegistrationRequest{}),
+		authHandler.HandleFinishPasskeyRegistration)
+	authenticated.Get("/auth/webauthn/credentials", authHandler.HandleListPasskeys)
+	authenticated.Put("/auth/webauthn/credentials/:credentialId",
+		validator.ValidateBody(&webauthn.RenameCredentialRequest{}),
+		authHandler.HandleRenamePasskey)
+	authenticated.Delete("/auth/webauthn/credentials/:credentialId", authHandler.HandleDeletePasskey)
+
 	// 用户token相关路由
 	tokenRoutes := authenticated.Group("/tokens")
 	tokenRoutes.Post("/create", validator.ValidateBody(&token.CreateTokenRequest{}), authHandler.HandleCreateToken)
@@ -75,6 +102,7 @@ func setupV1Routes(api fiber.Router) {
 		spaces.HandleUpdateSpace)
 	spaceRoutes.Delete("/:spaceId", spaces.HandleDeleteSpace)
 	spaceRoutes.Get("/:spaceId/stats", spaces.HandleSpaceStats)
+	spaceRoutes.Get("/:spaceId/events", spaces.HandleSpaceEvents)
 
 	// 协作者相关路由
 	spaceRoutes.Get("/:spaceId/collaborators", spaces.HandleListCollaborators)
@@ -94,6 +122,22 @@ func setupV1Routes(api fiber.Router) {
 		validator.ValidateBody(&space.UpdateCollaboratorPermissionsRequest{}),
 		spaces.HandleUpdateCollaboratorPermissions)
 
+	// Webhook 相关路由
+	spaceRoutes.Post("/:spaceId/webhooks",
+		validator.ValidateBody(&webhook.CreateWebhookRequest{}),
+		webhooks.HandleCreateWebhook)
+	spaceRoutes.Get("/:spaceId/webhooks", webhooks.HandleListWebhooks)
+	spaceRoutes.Delete("/:spaceId/webhooks/:webhookId", webhooks.HandleDeleteWebhook)
+	spaceRoutes.Get("/:spaceId/webhooks/:webhookId/deliveries", webhooks.HandleListDeliveries)
+	spaceRoutes.Post("/:spaceId/webhooks/:webhookId/deliveries/:deliveryId/redeliver", webhooks.HandleRedeliver)
+
+	// 入站 Webhook 管理路由
+	spaceRoutes.Post("/:spaceId/hooks",
+		validator.ValidateBody(&webhook.CreateIngestHookRequest{}),
+		webhooks.HandleCreateIngestHook)
+	spaceRoutes.Get("/:spaceId/hooks", webhooks.HandleListIngestHooks)
+	spaceRoutes.Delete("/:spaceId/hooks/:hookId", webhooks.HandleRevokeIngestHook)
+
 	// 更新空间设置路由
 	spaceRoutes.Put("/:spaceId/settings",
 		validator.ValidateBody(&space.UpdateSpaceSettingsRequest{}),
@@ -103,6 +147,7 @@ func setupV1Routes(api fiber.Router) {
 	clipRoutes := spaceRoutes.Group("/:spaceId/clips")
 	clipRoutes.Get("/list", clips.HandleListClips)
 	clipRoutes.Get("/last", clips.HandleGetLastClip)
+	clipRoutes.Get("/next", clips.HandleWaitNextClip)
 	clipRoutes.Get("/:clipId", clips.HandleGetClip)
 	clipRoutes.Post("/upload",
 		validator.ValidateBody(&clip.UploadClipRequest{}),
@@ -111,14 +156,83 @@ func setupV1Routes(api fiber.Router) {
 		validator.ValidateBody(&clip.UpdateClipRequest{}),
 		clips.HandleUpdateClip)
 	clipRoutes.Delete("/:clipId", clips.HandleDeleteClip)
+	clipRoutes.Get("/:clipId/thumbnail", clips.HandleGetClipThumbnail)
+	clipRoutes.Put("/:clipId/password",
+		validator.ValidateBody(&clip.SetClipPasswordRequest{}),
+		clips.HandleSetClipPassword)
+
+	// 剪贴板分享链接路由
+	clipRoutes.Post("/:clipId/shares",
+		validator.ValidateBody(&share.CreateShareRequest{}),
+		clips.HandleCreateShare)
+	clipRoutes.Get("/:clipId/shares", clips.HandleListShares)
+	clipRoutes.Delete("/:clipId/shares/:shareId", clips.HandleRevokeShare)
+	clipRoutes.Get("/:clipId/shares/:shareId/logs", clips.HandleListShareAccessLogs)
+
+	// 原始内容路由 - 便于 curl 等命令行工具直接粘贴和获取内容
+	authenticated.Post("/p/:spaceId/:filename?", clips.HandlePasteClip)
+	authenticated.Put("/p/:spaceId/:filename?", clips.HandlePasteClip)
+	authenticated.Get("/raw/:spaceId/:clipId", clips.HandleGetRawClip)
+
+	// 分享链接访问路由 - 通过签名令牌公开访问，由认证中间件放行
+	authenticated.Get("/s/:token", clips.HandleAccessShare)
+
+	// 入站 Webhook 写入路由 - 通过地址中的密钥写入内容，由认证中间件放行
+	authenticated.Post("/hooks/:secret", webhooks.HandleIngest)
 
 	// WebSocket路由 - 需要验证
 	authenticated.Get("/ws", websocket.New(ws.HandleWebSocket))
 
-	// 管理员路由 - 需要验证
-	adminRoutes := authenticated.Group("/admin")
-	adminRoutes.Get("/settings", admin.HandleGetSettings)
-	adminRoutes.Put("/settings", admin.HandleUpdateSettings)
+	// 管理员路由 - 需要验证，整个路由组只允许管理员访问，各路由再按权限校验
+	adminRoutes := authenticated.Group("/admin", permission.RequireAdmin())
+	readSettings := permission.RequirePermission(permission.SettingsRead)
+	writeSettings := permission.RequirePermission(permission.SettingsWrite)
+	readStats := permission.RequirePermission(permission.StatsRead)
+	manageJobs := permission.RequirePermission(permission.JobsManage)
+	manageCleanup := permission.RequirePermission(permission.CleanupManage)
+	manageUsers := permission.RequirePermission(permission.UsersManage)
+	manageQuota := permission.RequirePermission(permission.QuotaManage)
+
+	adminRoutes.Get("/settings", readSettings, admin.HandleGetSettings)
+	adminRoutes.Put("/settings", writeSettings, admin.HandleUpdateSettings)
+	adminRoutes.Get("/settings/history", readSettings, admin.HandleListSettingsHistory)
+	adminRoutes.Get("/stats", readStats, admin.HandleGetInstanceStats)
+
+	// 后台任务管理路由
+	adminRoutes.Get("/jobs", manageJobs, admin.HandleListJobs)
+	adminRoutes.Get("/jobs/:jobId", manageJobs, admin.HandleGetJob)
+	adminRoutes.Post("/jobs/:jobId/retry", manageJobs, admin.HandleRetryJob)
+
+	// 定时任务管理路由
+	adminRoutes.Get("/schedules", manageJobs, admin.HandleListScheduledTasks)
+	adminRoutes.Post("/schedules/:name/run", manageJobs, admin.HandleRunScheduledTask)
+
+	// 清理记录路由
+	adminRoutes.Get("/cleanup/runs", manageCleanup, admin.HandleListCleanupRuns)
+	adminRoutes.Get("/cleanup/runs/:runId", manageCleanup, admin.HandleGetCleanupRun)
+	adminRoutes.Get("/cleanup/dry-run", manageCleanup, admin.HandleCleanupDryRun)
+
+	// 用户管理路由
+	adminRoutes.Get("/users", manageUsers, admin.HandleListUsers)
+	adminRoutes.Post("/users", manageUsers,
+		validator.ValidateBody(&user.CreateUserRequest{}),
+		admin.HandleCreateUser)
+	adminRoutes.Get("/users/:userId", manageUsers, admin.HandleGetUser)
+	adminRoutes.Put("/users/:userId", manageUsers, admin.HandleUpdateUser)
+	adminRoutes.Delete("/users/:userId", manageUsers, admin.HandleDeleteUser)
+	adminRoutes.Post("/users/:userId/reset-password", manageUsers, admin.HandleResetUserPassword)
+	adminRoutes.Post("/users/:userId/unlock", manageUsers, admin.HandleUnlockUser)
+	adminRoutes.Delete("/users/:userId/2fa", manageUsers, admin.HandleResetUserTwoFactor)
+
+	// 登录锁定路由
+	adminRoutes.Get("/lockouts", manageUsers, admin.HandleListLockouts)
+	adminRoutes.Delete("/lockouts/:kind/:value", manageUsers, admin.HandleDeleteLockout)
+
+	// 存储配额路由
+	adminRoutes.Get("/users/:userId/quota", manageQuota, admin.HandleGetUserQuota)
+	adminRoutes.Put("/users/:userId/quota", manageQuota, admin.HandleUpdateUserQuota)
+	adminRoutes.Get("/spaces/:spaceId/quota", manageQuota, admin.HandleGetSpaceQuota)
+	adminRoutes.Put("/spaces/:spaceId/quota", manageQuota, admin.HandleUpdateSpaceQuota)
 
 	// 添加版本控制中间件
 	api.Use(func(c *fiber.Ctx) error {
@@ -0,0 +1,89 @@
+package routes_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"nlip/config"
+	"nlip/middleware"
+	"nlip/middleware/limiter"
+	"nlip/routes"
+	"nlip/utils/clientip"
+	"nlip/utils/testutil"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const adminPrefix = "/api/v1/nlip/admin"
+
+var paramPattern = regexp.MustCompile(`:[A-Za-z]+\??`)
+
+func newApp() *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.CustomErrorHandler})
+	clientip.ApplyConfig(nil, config.Get())
+	app.Use(limiter.New())
+	routes.SetupRoutes(app.Group("/api"))
+	return app
+}
+
+// TestAdminRoutesRequireAdmin 逐个请求所有管理接口，只有管理员可以访问，普通用户返回 403，游客返回 401
+func TestAdminRoutesRequireAdmin(t *testing.T) {
+	testutil.Setup(t)
+	app := newApp()
+
+	adminID := testutil.CreateUser(t, "root", true)
+	userID := testutil.CreateUser(t, "alice", false)
+
+	callers := []struct {
+		name  string
+		token string
+		allow bool
+		want  int
+	}{
+		{"管理员", testutil.Token(t, adminID, "root", true), true, 0},
+		{"普通用户", testutil.Token(t, userID, "alice", false), false, http.StatusForbidden},
+		{"游客", "", false, http.StatusUnauthorized},
+	}
+
+	var adminRoutes []fiber.Route
+	for _, route := range app.GetRoutes(true) {
+		if route.Method == fiber.MethodHead || !strings.HasPrefix(route.Path, adminPrefix+"/") {
+			continue
+		}
+		adminRoutes = append(adminRoutes, route)
+	}
+	if len(adminRoutes) == 0 {
+		t.Fatal("没有找到管理接口")
+	}
+
+	for _, route := range adminRoutes {
+		// 路径参数使用不存在的ID，管理员的请求最多返回 404，不会修改已有数据
+		path := paramPattern.ReplaceAllString(route.Path, "nonexistent")
+		for _, caller := range callers {
+			t.Run(route.Method+" "+route.Path+" "+caller.name, func(t *testing.T) {
+				req := httptest.NewRequest(route.Method, path, nil)
+				if caller.token != "" {
+					req.Header.Set("Authorization", caller.token)
+				}
+				resp, err := app.Test(req, -1)
+				if err != nil {
+					t.Fatalf("请求失败: %v", err)
+				}
+				defer resp.Body.Close()
+
+				if caller.allow {
+					if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden ||
+						resp.StatusCode >= http.StatusInternalServerError {
+						t.Errorf("%s 访问 %s %s 返回 %d", caller.name, route.Method, path, resp.StatusCode)
+					}
+					return
+				}
+				if resp.StatusCode != caller.want {
+					t.Errorf("%s 访问 %s %s 返回 %d，期望 %d", caller.name, route.Method, path, resp.StatusCode, caller.want)
+				}
+			})
+		}
+	}
+}
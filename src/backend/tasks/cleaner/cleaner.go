@@ -1,26 +1,68 @@
 package cleaner
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"nlip/config"
+	"nlip/models/cleanup"
+	"nlip/models/job"
+	"nlip/tasks/jobs"
+	"nlip/tasks/scheduler"
 	"nlip/utils/db"
 	"nlip/utils/logger"
-	"nlip/utils/storage"
 	"sync"
 	"time"
 )
 
+// JobSpaceOverflow 清理空间超量内容的任务类型
+const JobSpaceOverflow = "cleanup.space_overflow"
+
 var (
 	isRunning    bool
 	runningMutex sync.Mutex
 )
 
+// spaceOverflowPayload 清理空间超量内容的任务参数
+type spaceOverflowPayload struct {
+	SpaceID string `json:"spaceId"`
+}
+
+// RegisterJobs 注册清理相关的后台任务
+func RegisterJobs() {
+	jobs.Register(JobSpaceOverflow, 5, handleSpaceOverflowJob)
+}
+
+// EnqueueSpaceOverflow 添加清理空间超量内容的任务，同一空间只保留一个等待中的任务
+func EnqueueSpaceOverflow(spaceID string) error {
+	_, err := jobs.EnqueueUnique(JobSpaceOverflow, spaceID, spaceOverflowPayload{SpaceID: spaceID})
+	return err
+}
+
+func handleSpaceOverflowJob(j *job.Job) error {
+	var p spaceOverflowPayload
+	if err := json.Unmarshal(j.Payload, &p); err != nil {
+		return fmt.Errorf("解析清理任务参数失败: %w", err)
+	}
+
+	err := CleanSpaceOverflow(p.SpaceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// 空间已删除，无需清理
+		return nil
+	}
+	return err
+}
+
+// errCleanerBusy 已有清理任务正在执行
+var errCleanerBusy = errors.New("清理任务正在执行中")
+
 func runWithLock(task func() error) error {
 	runningMutex.Lock()
 	if isRunning {
 		runningMutex.Unlock()
-		return fmt.Errorf("清理任务正在执行中")
+		return errCleanerBusy
 	}
 	isRunning = true
 	runningMutex.Unlock()
@@ -34,345 +76,166 @@ func runWithLock(task func() error) error {
 	return task()
 }
 
-// StartCleanupTask 启动清理任务
-func StartCleanupTask() {
-	logger.Info("启动清理任务")
-	go func() {
-		// 启动时先执行一次清理
-		if err := cleanExpiredItems(); err != nil {
-			logger.Error("清理过期内容失败: %v", err)
-		}
-		if err := cleanOverflowItems(); err != nil {
-			logger.Error("清理超量内容失败: %v", err)
+// runWithLockWait 等待其他清理任务结束后再执行，避免同一时间触发的定时任务互相跳过，ctx 取消时放弃等待
+func runWithLockWait(ctx context.Context, task func() error) error {
+	for {
+		err := runWithLock(task)
+		if err != errCleanerBusy {
+			return err
 		}
-		// 添加清理过期邀请码
-		if err := cleanExpiredInvites(); err != nil {
-			logger.Error("清理过期邀请码失败: %v", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
 		}
-
-		// 设置定时器
-		ticker := time.NewTicker(1 * time.Hour)
-		defer ticker.Stop()
-
-		logger.Info("清理任务定时器已设置，间隔: 1小时")
-		for range ticker.C {
-			logger.Debug("开始执行定时清理任务")
-			if err := cleanExpiredItems(); err != nil {
-				logger.Error("清理过期内容失败: %v", err)
-			}
-			if err := cleanOverflowItems(); err != nil {
-				logger.Error("清理超量内容失败: %v", err)
-			}
-			// 添加定时清理过期邀请码
-			if err := cleanExpiredInvites(); err != nil {
-				logger.Error("清理过期邀请码失败: %v", err)
-			}
-			logger.Debug("定时清理任务完成")
-		}
-	}()
+	}
 }
 
-// cleanExpiredItems 清理过期的内容
-func cleanExpiredItems() error {
-	const batchSize = 100
+// 定时清理任务名称
+const (
+	TaskCleanExpired  = "clean_expired"
+	TaskCleanOverflow = "clean_overflow"
+	TaskCleanInvites  = "clean_invites"
+)
 
-	// 先查询空间信息，不放在事务中
-	spaces, err := getSpacesInfo()
-	if err != nil {
-		return err
+// RegisterScheduledTasks 注册定时清理任务，执行时间由配置中的 cron 表达式决定
+// 所有清理任务共用 runWithLock，同一时间只有一个清理任务在执行
+func RegisterScheduledTasks() error {
+	tasks := []scheduler.Task{
+		{
+			Name:       TaskCleanExpired,
+			Spec:       config.Get().Schedule.CleanExpired,
+			RunOnStart: true,
+			Run: func(ctx context.Context) error {
+				return runWithLockWait(ctx, func() error {
+					return cleanExpiredItems(ctx)
+				})
+			},
+		},
+		{
+			Name:       TaskCleanOverflow,
+			Spec:       config.Get().Schedule.CleanOverflow,
+			RunOnStart: true,
+			Run: func(ctx context.Context) error {
+				return runWithLockWait(ctx, func() error {
+					return cleanOverflowItems(ctx)
+				})
+			},
+		},
+		{
+			Name:       TaskCleanInvites,
+			Spec:       config.Get().Schedule.CleanInvites,
+			RunOnStart: true,
+			Run: func(ctx context.Context) error {
+				return runWithLockWait(ctx, cleanExpiredInvites)
+			},
+		},
 	}
 
-	for _, space := range spaces {
-		// 分批处理每个空间的数据
-		offset := 0
-		for {
-			err := db.WithTransaction(config.DB, func(tx *sql.Tx) error {
-				// 设置更短的超时时间
-				_, err := tx.Exec("PRAGMA busy_timeout = 2000")
-				if err != nil {
-					return err
-				}
-
-				// 只处理一批数据
-				result, err := db.ExecTx(tx, `
-					DELETE FROM nlip_clipboard_items 
-					WHERE id IN (
-						SELECT id FROM nlip_clipboard_items 
-						WHERE space_id = ? AND created_at < ?
-						LIMIT ?
-					)
-				`, space.ID, space.ExpireTime, batchSize)
-				if err != nil {
-					return err
-				}
-
-				count, _ := result.RowsAffected()
-				if count == 0 {
-					return sql.ErrNoRows // 用于跳出循环
-				}
-
-				return nil
-			})
-
-			if err == sql.ErrNoRows {
-				break // 没有更多数据需要处理
-			}
-			if err != nil {
-				logger.Error("处理空间 %s 的第 %d 批数据失败: %v",
-					space.ID, offset/batchSize, err)
-				// 继续处理下一个空间
-				break
-			}
-
-			offset += batchSize
-			// 添加短暂延迟，让其他操作有机会获取锁
-			time.Sleep(10 * time.Millisecond)
+	for _, t := range tasks {
+		if err := scheduler.Register(t); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-// 抽取查询空间信息的函数
-type spaceInfo struct {
-	ID         string
-	ExpireTime time.Time
-}
-
-func getSpacesInfo() ([]spaceInfo, error) {
-	rows, err := db.QueryRows(config.DB, `
-		SELECT id, retention_days 
-		FROM nlip_spaces
-	`)
-	if err != nil {
-		return nil, err
+// ApplySchedule 配置重新加载后按新的 cron 表达式调整清理任务的执行时间
+func ApplySchedule(old, new *config.Config) {
+	specs := []struct {
+		name     string
+		old, new string
+	}{
+		{TaskCleanExpired, old.Schedule.CleanExpired, new.Schedule.CleanExpired},
+		{TaskCleanOverflow, old.Schedule.CleanOverflow, new.Schedule.CleanOverflow},
+		{TaskCleanInvites, old.Schedule.CleanInvites, new.Schedule.CleanInvites},
 	}
-	defer rows.Close()
-
-	var spaces []spaceInfo
-	for rows.Next() {
-		var space spaceInfo
-		var retentionDays int
-		if err := rows.Scan(&space.ID, &retentionDays); err != nil {
-			return nil, err
+	for _, s := range specs {
+		if s.old == s.new {
+			continue
+		}
+		if err := scheduler.Reschedule(s.name, s.new); err != nil {
+			logger.Error("修改定时任务执行时间失败，继续使用原来的执行时间: %v", err)
 		}
-		space.ExpireTime = time.Now().AddDate(0, 0, -retentionDays)
-		spaces = append(spaces, space)
 	}
-	return spaces, nil
 }
 
-// cleanOverflowItems 修改建议
-func cleanOverflowItems() error {
-	logger.Debug("开始清理超量内容")
+// cleanExpiredItems 清理超过空间保留天数的内容，并保存清理记录
+func cleanExpiredItems(ctx context.Context) error {
+	startedAt := time.Now()
 
-	// 先查询所有空间信息，不放在事务中
-	spaces, err := getSpacesWithMaxItems()
+	spaces, err := loadSpaces("")
 	if err != nil {
-		return fmt.Errorf("查询空间信息失败: %w", err)
-	}
-
-	for _, space := range spaces {
-		// 对每个空间分批处理
-		err := cleanSingleSpaceOverflow(space.ID, space.MaxItems)
-		if err != nil {
-			logger.Error("清理空间 %s 失败: %v", space.ID, err)
-			continue
-		}
+		return err
 	}
-
-	logger.Debug("超量内容清理完成")
-	return nil
-}
-
-// 新增函数：获取空间信息
-type spaceMaxItems struct {
-	ID       string
-	MaxItems int
-}
-
-func getSpacesWithMaxItems() ([]spaceMaxItems, error) {
-	rows, err := db.QueryRows(config.DB, `
-		SELECT id, max_items 
-		FROM nlip_spaces
-	`)
+	plans, err := planExpired(spaces, startedAt)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
 
-	var spaces []spaceMaxItems
-	for rows.Next() {
-		var space spaceMaxItems
-		if err := rows.Scan(&space.ID, &space.MaxItems); err != nil {
-			return nil, err
-		}
-		spaces = append(spaces, space)
+	err = runPlans(ctx, cleanup.KindExpired, plans, startedAt, true)
+
+	if purgeErr := purgeRuns(startedAt); purgeErr != nil {
+		logger.Error("清理过期的清理记录失败: %v", purgeErr)
 	}
-	return spaces, nil
+	return err
 }
 
-// cleanSingleSpaceOverflow 修改建议
-func cleanSingleSpaceOverflow(spaceID string, maxItems int) error {
-	const batchSize = 50
-
-	// 先检查当前条目数量
-	var totalItems int
-	err := config.DB.QueryRow(`
-		SELECT COUNT(*) 
-		FROM nlip_clipboard_items 
-		WHERE space_id = ?
-	`, spaceID).Scan(&totalItems)
-	if err != nil {
-		return fmt.Errorf("查询条目总数失败: %w", err)
-	}
+// cleanOverflowItems 清理所有空间超出数量限制的内容，并保存清理记录
+func cleanOverflowItems(ctx context.Context) error {
+	logger.Debug("开始清理超量内容")
+	startedAt := time.Now()
 
-	if totalItems <= maxItems {
-		logger.Debug("空间 %s 当前条目数 %d 未超过限制 %d，无需清理",
-			spaceID, totalItems, maxItems)
-		return nil
+	spaces, err := loadSpaces("")
+	if err != nil {
+		return err
 	}
-
-	needToDelete := totalItems - maxItems
-	logger.Info("空间 %s 需要清理 %d 条记录（当前: %d, 最大: %d）",
-		spaceID, needToDelete, totalItems, maxItems)
-
-	totalCleaned := 0
-	batchCount := 0
-
-	for totalCleaned < needToDelete {
-		batchCount++
-		logger.Debug("处理第 %d 批数据", batchCount)
-
-		// 计算本批次要删除的数量
-		currentBatchSize := min(batchSize, needToDelete-totalCleaned)
-
-		err = db.WithTransaction(config.DB, func(tx *sql.Tx) error {
-			_, err := tx.Exec("PRAGMA busy_timeout = 1000")
-			if err != nil {
-				return fmt.Errorf("设置事务超时失败: %w", err)
-			}
-
-			// 先获取要删除的文件路径
-			var filePaths []string
-			rows, err := tx.Query(`
-				SELECT file_path 
-				FROM nlip_clipboard_items 
-				WHERE space_id = ? 
-				ORDER BY created_at ASC 
-				LIMIT ?
-			`, spaceID, currentBatchSize)
-			if err != nil {
-				return fmt.Errorf("查询文件路径失败: %w", err)
-			}
-			defer rows.Close()
-
-			for rows.Next() {
-				var filePath sql.NullString
-				if err := rows.Scan(&filePath); err != nil {
-					return fmt.Errorf("扫描文件路径失败: %w", err)
-				}
-				if filePath.Valid && filePath.String != "" {
-					filePaths = append(filePaths, filePath.String)
-				}
-			}
-
-			// 执行删除操作，限制删除数量
-			result, err := tx.Exec(`
-				DELETE FROM nlip_clipboard_items 
-				WHERE id IN (
-					SELECT id 
-					FROM nlip_clipboard_items 
-					WHERE space_id = ? 
-					ORDER BY created_at ASC 
-					LIMIT ?
-				)
-			`, spaceID, currentBatchSize)
-			if err != nil {
-				return fmt.Errorf("删除记录失败: %w", err)
-			}
-
-			count, _ := result.RowsAffected()
-			if count > 0 {
-				totalCleaned += int(count)
-				logger.Debug("空间 %s 第 %d 批次清理了 %d 条记录", spaceID, batchCount, count)
-
-				// 在事务外删除文件
-				go func(paths []string) {
-					for _, path := range paths {
-						if err := storage.DeleteFile(path); err != nil {
-							logger.Error("删除文件失败 %s: %v", path, err)
-						}
-					}
-				}(filePaths)
-			}
-			return nil
-		})
-
-		if err != nil {
-			return fmt.Errorf("处理第 %d 批数据失败: %w", batchCount, err)
-		}
-
-		if totalCleaned >= needToDelete {
-			break
-		}
-
-		time.Sleep(20 * time.Millisecond)
+	plans, err := planOverflow(spaces, startedAt, false)
+	if err != nil {
+		return err
 	}
 
-	if totalCleaned > 0 {
-		logger.Info("空间 %s 清理完成，共清理 %d 条超量内容，处理了 %d 个批次",
-			spaceID, totalCleaned, batchCount)
-	} else {
-		logger.Debug("空间 %s 无需清理超量内容", spaceID)
+	if err := runPlans(ctx, cleanup.KindOverflow, plans, startedAt, true); err != nil {
+		return err
 	}
-
+	logger.Debug("超量内容清理完成")
 	return nil
 }
 
-// 新增函数：获取要删除的文件
-func getFilesToDelete(spaceID string, offset, limit int) ([]string, error) {
-	rows, err := db.QueryRows(config.DB, `
-		SELECT file_path 
-		FROM nlip_clipboard_items 
-		WHERE space_id = ? AND file_path IS NOT NULL
-		ORDER BY created_at ASC
-		LIMIT ? OFFSET ?
-	`, spaceID, limit, offset)
+// cleanSingleSpaceOverflow 清理单个空间超出数量限制的内容，只在删除了内容时保存清理记录
+func cleanSingleSpaceOverflow(s spaceSettings) error {
+	startedAt := time.Now()
+
+	plans, err := planOverflow([]spaceSettings{s}, startedAt, false)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-
-	var filePaths []string
-	for rows.Next() {
-		var filePath string
-		if err := rows.Scan(&filePath); err != nil {
-			return nil, err
-		}
-		if filePath != "" {
-			filePaths = append(filePaths, filePath)
-		}
+	if len(plans) == 0 {
+		logger.Debug("空间 %s 当前条目数未超过限制 %d，无需清理", s.ID, s.MaxItems)
+		return nil
 	}
-	return filePaths, nil
+
+	return runPlans(context.Background(), cleanup.KindSpaceOverflow, plans, startedAt, false)
 }
 
-// CleanSpaceOverflow 清理指定空间超出数量限制的内容
+// CleanSpaceOverflow 清理指定空间超出数量限制的内容，空间不存在时返回包装了 sql.ErrNoRows 的错误
 func CleanSpaceOverflow(spaceID string) error {
 	// 添加重试机制
 	maxRetries := 3
 	retryDelay := 100 * time.Millisecond
 
-	// 先查询空间的 maxItems
-	var maxItems int
-	err := config.DB.QueryRow("SELECT max_items FROM nlip_spaces WHERE id = ?", spaceID).Scan(&maxItems)
+	spaces, err := loadSpaces(spaceID)
 	if err != nil {
 		return fmt.Errorf("获取空间信息失败: %w", err)
 	}
+	if len(spaces) == 0 {
+		return fmt.Errorf("获取空间信息失败: %w", sql.ErrNoRows)
+	}
 
 	var lastErr error
 	for i := 0; i < maxRetries; i++ {
 		err := runWithLock(func() error {
-			return cleanSingleSpaceOverflow(spaceID, maxItems)
+			return cleanSingleSpaceOverflow(spaces[0])
 		})
 
 		if err == nil {
@@ -390,22 +253,20 @@ func CleanSpaceOverflow(spaceID string) error {
 
 // cleanExpiredInvites 清理过期和已使用的邀请码记录
 func cleanExpiredInvites() error {
-	return runWithLock(func() error {
-		logger.Debug("开始清理邀请码")
-		
-		result, err := db.Exec(config.DB, `
-			DELETE FROM nlip_invites 
-			WHERE used_at IS NOT NULL 
-			   OR expires_at < strftime('%s', 'now')
-		`)
-		if err != nil {
-			return fmt.Errorf("清理邀请码失败: %w", err)
-		}
-		
-		if count, err := result.RowsAffected(); err == nil {
-			logger.Info("已清理 %d 条邀请码记录", count)
-		}
-		
-		return nil
-	})
+	logger.Debug("开始清理邀请码")
+	
+	result, err := db.Exec(config.DB, `
+		DELETE FROM nlip_invites 
+		WHERE used_at IS NOT NULL 
+		   OR expires_at < strftime('%s', 'now')
+	`)
+	if err != nil {
+		return fmt.Errorf("清理邀请码失败: %w", err)
+	}
+	
+	if count, err := result.RowsAffected(); err == nil {
+		logger.Info("已清理 %d 条邀请码记录", count)
+	}
+	
+	return nil
 }
@@ -0,0 +1,511 @@
+package cleaner
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nlip/config"
+	"nlip/models/cleanup"
+	"nlip/utils/db"
+	"nlip/utils/logger"
+	"nlip/utils/storage"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrSpaceNotFound 预演清理时指定的空间不存在
+var ErrSpaceNotFound = errors.New("空间不存在")
+
+// runRetention 清理记录保留时间
+const runRetention = 30 * 24 * time.Hour
+
+// deleteBatchSize 每个事务删除的最大条目数
+const deleteBatchSize = 100
+
+// spaceSettings 空间的清理相关设置
+type spaceSettings struct {
+	ID            string
+	Name          string
+	RetentionDays int
+	MaxItems      int
+}
+
+// planItem 计划删除的单条内容
+type planItem struct {
+	ID       string
+	ClipID   string
+	FilePath string
+	Size     int64
+}
+
+// spacePlan 单个空间的清理计划
+type spacePlan struct {
+	Space spaceSettings
+	Items []planItem
+}
+
+// loadSpaces 获取空间的清理设置，spaceID 为空时返回所有空间
+func loadSpaces(spaceID string) ([]spaceSettings, error) {
+	query := "SELECT id, name, retention_days, max_items FROM nlip_spaces"
+	var args []interface{}
+	if spaceID != "" {
+		query += " WHERE id = ?"
+		args = append(args, spaceID)
+	}
+	query += " ORDER BY created_at ASC"
+
+	rows, err := db.QueryRows(config.DB, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询空间信息失败: %w", err)
+	}
+	defer rows.Close()
+
+	var spaces []spaceSettings
+	for rows.Next() {
+		var s spaceSettings
+		if err := rows.Scan(&s.ID, &s.Name, &s.RetentionDays, &s.MaxItems); err != nil {
+			return nil, fmt.Errorf("读取空间信息失败: %w", err)
+		}
+		spaces = append(spaces, s)
+	}
+	return spaces, rows.Err()
+}
+
+// expireBefore 返回空间内容的过期时间，早于该时间创建的内容会被清理
+func (s spaceSettings) expireBefore(now time.Time) time.Time {
+	return now.AddDate(0, 0, -s.RetentionDays)
+}
+
+// queryPlanItems 查询计划删除的内容，并计算内容和文件的大小
+func queryPlanItems(query string, args ...interface{}) ([]planItem, error) {
+	rows, err := db.QueryRows(config.DB, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []planItem
+	for rows.Next() {
+		var item planItem
+		var filePath sql.NullString
+		if err := rows.Scan(&item.ID, &item.ClipID, &filePath, &item.Size); err != nil {
+			return nil, err
+		}
+		if filePath.Valid && filePath.String != "" {
+			item.FilePath = filePath.String
+			if info, err := os.Stat(item.FilePath); err == nil {
+				item.Size += info.Size()
+			}
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const selectPlanItemsSQL = `
+	SELECT id, clip_id, file_path, COALESCE(LENGTH(CAST(content AS BLOB)), 0)
+	FROM nlip_clipboard_items
+`
+
+// planExpired 计算各空间中已超过保留天数的内容
+func planExpired(spaces []spaceSettings, now time.Time) ([]spacePlan, error) {
+	var plans []spacePlan
+	for _, s := range spaces {
+		items, err := queryPlanItems(selectPlanItemsSQL+`
+			WHERE space_id = ? AND created_at < ?
+			ORDER BY created_at ASC
+		`, s.ID, s.expireBefore(now))
+		if err != nil {
+			return nil, fmt.Errorf("查询空间 %s 的过期内容失败: %w", s.ID, err)
+		}
+		if len(items) > 0 {
+			plans = append(plans, spacePlan{Space: s, Items: items})
+		}
+	}
+	return plans, nil
+}
+
+// planOverflow 计算各空间中超出最大数量的最早内容
+// afterExpired 为 true 时不计入已过期的内容，用于预演过期清理之后的超量清理
+func planOverflow(spaces []spaceSettings, now time.Time, afterExpired bool) ([]spacePlan, error) {
+	var plans []spacePlan
+	for _, s := range spaces {
+		var since time.Time
+		if afterExpired {
+			since = s.expireBefore(now)
+		}
+
+		var total int
+		err := config.DB.QueryRow(`
+			SELECT COUNT(*) FROM nlip_clipboard_items
+			WHERE space_id = ? AND created_at >= ?
+		`, s.ID, since).Scan(&total)
+		if err != nil {
+			return nil, fmt.Errorf("查询空间 %s 的条目总数失败: %w", s.ID, err)
+		}
+		if total <= s.MaxItems {
+			continue
+		}
+
+		items, err := queryPlanItems(selectPlanItemsSQL+`
+			WHERE space_id = ? AND created_at >= ?
+			ORDER BY created_at ASC
+			LIMIT ?
+		`, s.ID, since, total-s.MaxItems)
+		if err != nil {
+			return nil, fmt.Errorf("查询空间 %s 的超量内容失败: %w", s.ID, err)
+		}
+		if len(items) > 0 {
+			plans = append(plans, spacePlan{Space: s, Items: items})
+		}
+	}
+	return plans, nil
+}
+
+// executePlans 按计划分批删除内容，提交后再删除对应文件
+// 计划生成后已被删除的内容不计入结果，单个空间失败时继续处理其他空间并返回最后一个错误
+func executePlans(ctx context.Context, plans []spacePlan) ([]cleanup.SpaceResult, error) {
+	var results []cleanup.SpaceResult
+	var lastErr error
+
+	for _, plan := range plans {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		result := cleanup.SpaceResult{
+			SpaceID:   plan.Space.ID,
+			SpaceName: plan.Space.Name,
+			ClipIDs:   []string{},
+		}
+
+		for start := 0; start < len(plan.Items); start += deleteBatchSize {
+			batch := plan.Items[start:min(start+deleteBatchSize, len(plan.Items))]
+			deleted, err := deleteBatch(batch)
+			if err != nil {
+				logger.Error("清理空间 %s 的内容失败: %v", plan.Space.ID, err)
+				lastErr = fmt.Errorf("清理空间 %s 的内容失败: %w", plan.Space.ID, err)
+				break
+			}
+
+			for _, item := range deleted {
+				result.ItemsDeleted++
+				result.BytesFreed += item.Size
+				result.ClipIDs = append(result.ClipIDs, item.ClipID)
+				if item.FilePath != "" {
+					if err := storage.DeleteFile(item.FilePath); err != nil {
+						logger.Error("删除文件失败 %s: %v", item.FilePath, err)
+					}
+				}
+			}
+
+			// 添加短暂延迟，让其他操作有机会获取锁
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if result.ItemsDeleted > 0 {
+			logger.Info("空间 %s 清理了 %d 条内容，释放 %d 字节",
+				plan.Space.ID, result.ItemsDeleted, result.BytesFreed)
+			results = append(results, result)
+		}
+	}
+	return results, lastErr
+}
+
+// deleteBatch 在一个事务中删除一批内容，返回实际删除的条目
+func deleteBatch(batch []planItem) ([]planItem, error) {
+	byID := make(map[string]planItem, len(batch))
+	placeholders := make([]string, 0, len(batch))
+	args := make([]interface{}, 0, len(batch))
+	for _, item := range batch {
+		byID[item.ID] = item
+		placeholders = append(placeholders, "?")
+		args = append(args, item.ID)
+	}
+
+	var deleted []planItem
+	err := db.WithTransaction(config.DB, func(tx *sql.Tx) error {
+		rows, err := tx.Query(`
+			DELETE FROM nlip_clipboard_items
+			WHERE id IN (`+strings.Join(placeholders, ",")+`)
+			RETURNING id, space_id
+		`, args...)
+		if err != nil {
+			return err
+		}
+
+		spaceIDs := make(map[string]string, len(batch))
+		for rows.Next() {
+			var id, spaceID string
+			if err := rows.Scan(&id, &spaceID); err != nil {
+				rows.Close()
+				return err
+			}
+			deleted = append(deleted, byID[id])
+			spaceIDs[id] = spaceID
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// 删除关联的分享链接及访问记录，避免之后复用的剪贴板 ID 被旧链接访问
+		for _, item := range deleted {
+			if _, err := db.ExecTx(tx, `
+				DELETE FROM nlip_share_access_logs WHERE share_id IN (
+					SELECT id FROM nlip_share_links WHERE space_id = ? AND clip_id = ?
+				)
+			`, spaceIDs[item.ID], item.ClipID); err != nil {
+				return err
+			}
+			if _, err := db.ExecTx(tx,
+				"DELETE FROM nlip_share_links WHERE space_id = ? AND clip_id = ?",
+				spaceIDs[item.ID], item.ClipID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// runPlans 执行清理计划并保存清理记录
+// record 为 false 时只在实际删除了内容时保存记录
+func runPlans(ctx context.Context, kind string, plans []spacePlan, startedAt time.Time, record bool) error {
+	results, err := executePlans(ctx, plans)
+
+	run := cleanup.Run{
+		ID:         uuid.New().String(),
+		Kind:       kind,
+		StartedAt:  startedAt,
+		FinishedAt: time.Now(),
+		Status:     cleanup.StatusSuccess,
+		Spaces:     results,
+	}
+	for _, r := range results {
+		run.ItemsDeleted += r.ItemsDeleted
+		run.BytesFreed += r.BytesFreed
+	}
+	if err != nil {
+		run.Status = cleanup.StatusFailed
+		run.Error = err.Error()
+	}
+
+	if record || run.ItemsDeleted > 0 || err != nil {
+		if recErr := recordRun(&run); recErr != nil {
+			logger.Error("保存清理记录失败: %v", recErr)
+		}
+	}
+	return err
+}
+
+// recordRun 保存一次清理记录及各空间的明细
+func recordRun(run *cleanup.Run) error {
+	return db.WithTransaction(config.DB, func(tx *sql.Tx) error {
+		var errMsg interface{}
+		if run.Error != "" {
+			errMsg = run.Error
+		}
+		_, err := db.ExecTx(tx, `
+			INSERT INTO nlip_cleanup_runs
+			(id, kind, started_at, finished_at, items_deleted, bytes_freed, status, error)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, run.ID, run.Kind, run.StartedAt, run.FinishedAt, run.ItemsDeleted, run.BytesFreed, run.Status, errMsg)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range run.Spaces {
+			clipIDs, err := json.Marshal(s.ClipIDs)
+			if err != nil {
+				return err
+			}
+			_, err = db.ExecTx(tx, `
+				INSERT INTO nlip_cleanup_run_spaces
+				(run_id, space_id, space_name, items_deleted, bytes_freed, clip_ids)
+				VALUES (?, ?, ?, ?, ?, ?)
+			`, run.ID, s.SpaceID, s.SpaceName, s.ItemsDeleted, s.BytesFreed, string(clipIDs))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// purgeRuns 删除超过保留时间的清理记录
+func purgeRuns(now time.Time) error {
+	before := now.Add(-runRetention)
+	return db.WithTransaction(config.DB, func(tx *sql.Tx) error {
+		_, err := db.ExecTx(tx, `
+			DELETE FROM nlip_cleanup_run_spaces WHERE run_id IN (
+				SELECT id FROM nlip_cleanup_runs WHERE started_at < ?
+			)
+		`, before)
+		if err != nil {
+			return err
+		}
+		_, err = db.ExecTx(tx, "DELETE FROM nlip_cleanup_runs WHERE started_at < ?", before)
+		return err
+	})
+}
+
+// toPreview 将清理计划转换为预演结果
+func toPreview(plans []spacePlan) *cleanup.Preview {
+	p := &cleanup.Preview{Spaces: []cleanup.SpaceResult{}}
+	for _, plan := range plans {
+		r := cleanup.SpaceResult{
+			SpaceID:   plan.Space.ID,
+			SpaceName: plan.Space.Name,
+			ClipIDs:   make([]string, 0, len(plan.Items)),
+		}
+		for _, item := range plan.Items {
+			r.ItemsDeleted++
+			r.BytesFreed += item.Size
+			r.ClipIDs = append(r.ClipIDs, item.ClipID)
+		}
+		p.ItemsToDelete += r.ItemsDeleted
+		p.BytesToFree += r.BytesFreed
+		p.Spaces = append(p.Spaces, r)
+	}
+	return p
+}
+
+// DryRun 预演下一次清理将删除的内容，不会修改任何数据
+// 同时预演过期和超量清理时，超量清理只计算过期清理之后剩余的内容
+func DryRun(opts cleanup.DryRunOptions) (*cleanup.DryRunResult, error) {
+	spaces, err := loadSpaces(opts.SpaceID)
+	if err != nil {
+		return nil, err
+	}
+	if opts.SpaceID != "" && len(spaces) == 0 {
+		return nil, ErrSpaceNotFound
+	}
+
+	for i := range spaces {
+		if opts.RetentionDays != nil {
+			spaces[i].RetentionDays = *opts.RetentionDays
+		}
+		if opts.MaxItems != nil {
+			spaces[i].MaxItems = *opts.MaxItems
+		}
+	}
+
+	now := time.Now()
+	result := &cleanup.DryRunResult{GeneratedAt: now}
+	withExpired := opts.Kind == "" || opts.Kind == cleanup.KindExpired
+	withOverflow := opts.Kind == "" || opts.Kind == cleanup.KindOverflow
+
+	if withExpired {
+		plans, err := planExpired(spaces, now)
+		if err != nil {
+			return nil, err
+		}
+		result.Expired = toPreview(plans)
+	}
+	if withOverflow {
+		plans, err := planOverflow(spaces, now, withExpired)
+		if err != nil {
+			return nil, err
+		}
+		result.Overflow = toPreview(plans)
+	}
+	return result, nil
+}
+
+// ListRuns 按类型分页获取清理记录，不包含各空间的明细
+func ListRuns(kind string, limit, offset int) ([]cleanup.Run, int, error) {
+	where := ""
+	var args []interface{}
+	if kind != "" {
+		where = " WHERE kind = ?"
+		args = append(args, kind)
+	}
+
+	var total int
+	if err := config.DB.QueryRow("SELECT COUNT(*) FROM nlip_cleanup_runs"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.QueryRows(config.DB, `
+		SELECT id, kind, started_at, finished_at, items_deleted, bytes_freed, status, error
+		FROM nlip_cleanup_runs`+where+`
+		ORDER BY started_at DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	runs := []cleanup.Run{}
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, total, rows.Err()
+}
+
+// GetRun 获取清理记录及各空间删除的内容
+func GetRun(id string) (*cleanup.Run, error) {
+	run, err := scanRun(config.DB.QueryRow(`
+		SELECT id, kind, started_at, finished_at, items_deleted, bytes_freed, status, error
+		FROM nlip_cleanup_runs WHERE id = ?
+	`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryRows(config.DB, `
+		SELECT space_id, space_name, items_deleted, bytes_freed, clip_ids
+		FROM nlip_cleanup_run_spaces WHERE run_id = ?
+		ORDER BY items_deleted DESC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	run.Spaces = []cleanup.SpaceResult{}
+	for rows.Next() {
+		var s cleanup.SpaceResult
+		var name sql.NullString
+		var clipIDs string
+		if err := rows.Scan(&s.SpaceID, &name, &s.ItemsDeleted, &s.BytesFreed, &clipIDs); err != nil {
+			return nil, err
+		}
+		s.SpaceName = name.String
+		if err := json.Unmarshal([]byte(clipIDs), &s.ClipIDs); err != nil {
+			return nil, fmt.Errorf("解析清理记录失败: %w", err)
+		}
+		run.Spaces = append(run.Spaces, s)
+	}
+	return run, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRun(row rowScanner) (*cleanup.Run, error) {
+	var run cleanup.Run
+	var errMsg sql.NullString
+	err := row.Scan(&run.ID, &run.Kind, &run.StartedAt, &run.FinishedAt,
+		&run.ItemsDeleted, &run.BytesFreed, &run.Status, &errMsg)
+	if err != nil {
+		return nil, err
+	}
+	run.Error = errMsg.String
+	return &run, nil
+}
@@ -0,0 +1,65 @@
+package invite
+
+import (
+	"encoding/json"
+	"fmt"
+	"nlip/models/job"
+	"nlip/tasks/jobs"
+	"nlip/utils/email"
+	"strings"
+)
+
+// JobSendEmail 发送邀请邮件的任务类型
+const JobSendEmail = "email.invite"
+
+// redactedToken 管理接口中代替邀请令牌显示的内容
+const redactedToken = "******"
+
+// emailPayload 发送邀请邮件的任务参数
+type emailPayload struct {
+	To         string `json:"to"`
+	SpaceName  string `json:"spaceName"`
+	InviteLink string `json:"inviteLink"`
+}
+
+// RegisterJobs 注册邀请相关的后台任务，邀请链接中的令牌在管理接口中不可见
+func RegisterJobs() {
+	jobs.Register(JobSendEmail, 5, handleSendEmailJob)
+	jobs.RegisterRedactor(JobSendEmail, redactPayload)
+}
+
+// EnqueueEmail 添加发送邀请邮件的后台任务，发送失败时自动重试
+func EnqueueEmail(toEmail, spaceName, inviteLink string) error {
+	_, err := jobs.Enqueue(JobSendEmail, emailPayload{
+		To:         toEmail,
+		SpaceName:  spaceName,
+		InviteLink: inviteLink,
+	})
+	return err
+}
+
+func handleSendEmailJob(j *job.Job) error {
+	var p emailPayload
+	if err := json.Unmarshal(j.Payload, &p); err != nil {
+		return fmt.Errorf("解析邮件任务参数失败: %w", err)
+	}
+	return email.SendInviteEmail(p.To, p.SpaceName, p.InviteLink)
+}
+
+// redactPayload 隐藏邀请链接中的令牌，令牌在过期前可以直接加入空间
+func redactPayload(payload json.RawMessage) json.RawMessage {
+	var p emailPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return json.RawMessage(`{}`)
+	}
+	if i := strings.LastIndex(p.InviteLink, "/"); i >= 0 {
+		p.InviteLink = p.InviteLink[:i+1] + redactedToken
+	} else {
+		p.InviteLink = redactedToken
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return json.RawMessage(`{}`)
+	}
+	return data
+}
@@ -0,0 +1,50 @@
+package invite
+
+import (
+	"nlip/config"
+	"nlip/tasks/jobs"
+	"nlip/utils/testutil"
+	"strings"
+	"testing"
+)
+
+// TestInviteLinkRedacted 管理接口返回的邀请邮件任务不包含邀请令牌
+func TestInviteLinkRedacted(t *testing.T) {
+	testutil.Setup(t)
+	RegisterJobs()
+
+	const token = "0123456789abcdef0123456789abcdef"
+	if err := EnqueueEmail("bob@example.com", "alice-private", "https://nlip.example.com/invite/"+token); err != nil {
+		t.Fatalf("添加邀请邮件任务失败: %v", err)
+	}
+
+	list, _, err := jobs.List("", JobSendEmail, 10, 0)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("获取任务列表失败: %d, %v", len(list), err)
+	}
+	payload := string(list[0].Payload)
+	if strings.Contains(payload, token) {
+		t.Errorf("任务列表中的参数包含邀请令牌: %s", payload)
+	}
+	if !strings.Contains(payload, "https://nlip.example.com/invite/"+redactedToken) ||
+		!strings.Contains(payload, "bob@example.com") {
+		t.Errorf("任务参数脱敏后为 %s", payload)
+	}
+
+	j, err := jobs.Get(list[0].ID)
+	if err != nil {
+		t.Fatalf("获取任务失败: %v", err)
+	}
+	if strings.Contains(string(j.Payload), token) {
+		t.Errorf("任务详情中的参数包含邀请令牌: %s", j.Payload)
+	}
+
+	// 执行任务时仍使用完整的邀请链接
+	var stored string
+	if err := config.DB.QueryRow("SELECT payload FROM nlip_jobs WHERE id = ?", j.ID).Scan(&stored); err != nil {
+		t.Fatalf("查询任务失败: %v", err)
+	}
+	if !strings.Contains(stored, token) {
+		t.Errorf("数据库中的任务参数应保留完整的邀请链接: %s", stored)
+	}
+}
@@ -0,0 +1,538 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nlip/config"
+	"nlip/models/job"
+	"nlip/utils/logger"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Handler 任务处理函数，返回错误时任务按指数退避重试，超过最大次数后进入死信状态
+type Handler func(j *job.Job) error
+
+const (
+	// defaultWorkers 默认的并发执行任务数
+	defaultWorkers = 4
+	// baseRetryDelay 首次重试的等待时间，之后每次翻倍
+	baseRetryDelay = 30 * time.Second
+	// maxRetryDelay 重试等待时间上限
+	maxRetryDelay = 1 * time.Hour
+	// pollInterval 空闲时检查到期任务的间隔
+	pollInterval = 5 * time.Second
+	// succeededRetention 执行成功的任务保留时间
+	succeededRetention = 7 * 24 * time.Hour
+	// maxErrorLength 记录的错误信息最大长度
+	maxErrorLength = 1000
+)
+
+type registration struct {
+	handler     Handler
+	maxAttempts int
+}
+
+// Redactor 隐藏任务参数中的敏感信息，返回管理接口中显示的任务参数
+type Redactor func(payload json.RawMessage) json.RawMessage
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]registration)
+	redactors  = make(map[string]Redactor)
+	wakeup     chan struct{}
+
+	// runMu 保护执行器的启动和停止
+	runMu   sync.Mutex
+	stopped chan struct{}
+	running sync.WaitGroup
+)
+
+// Register 注册任务类型及其处理函数，需在 Start 之前调用
+func Register(jobType string, maxAttempts int, handler Handler) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	registry[jobType] = registration{handler: handler, maxAttempts: maxAttempts}
+}
+
+// RegisterRedactor 注册任务参数的脱敏函数，Get 和 List 返回的任务参数会先经过脱敏
+func RegisterRedactor(jobType string, redact Redactor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	redactors[jobType] = redact
+}
+
+// redact 对返回给调用方的任务参数脱敏
+func redact(j *job.Job) {
+	registryMu.RLock()
+	fn, ok := redactors[j.Type]
+	registryMu.RUnlock()
+	if ok {
+		j.Payload = fn(j.Payload)
+	}
+}
+
+func lookup(jobType string) (registration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registry[jobType]
+	return r, ok
+}
+
+// Enqueue 添加一个立即执行的任务
+func Enqueue(jobType string, payload interface{}) (string, error) {
+	return enqueue(jobType, "", payload, time.Now())
+}
+
+// EnqueueAt 添加一个在指定时间执行的任务
+func EnqueueAt(jobType string, payload interface{}, runAt time.Time) (string, error) {
+	return enqueue(jobType, "", payload, runAt)
+}
+
+// EnqueueUnique 添加任务，若已有相同类型和唯一键的任务在等待或执行中则直接返回该任务
+// 依赖 nlip_jobs 上 (type, unique_key) 的部分唯一索引，并发添加时也只会保留一个任务
+func EnqueueUnique(jobType, uniqueKey string, payload interface{}) (string, error) {
+	for i := 0; i < 3; i++ {
+		id, err := enqueue(jobType, uniqueKey, payload, time.Now())
+		if err != nil || id != "" {
+			return id, err
+		}
+
+		var existingID string
+		err = config.DB.QueryRow(`
+			SELECT id FROM nlip_jobs WHERE type = ? AND unique_key = ? AND status IN (?, ?)
+			LIMIT 1
+		`, jobType, uniqueKey, job.StatusPending, job.StatusRunning).Scan(&existingID)
+		if err == nil {
+			Wake()
+			return existingID, nil
+		} else if err != sql.ErrNoRows {
+			return "", fmt.Errorf("查询任务失败: %w", err)
+		}
+		// 冲突的任务刚好执行完成，重新添加
+	}
+	return "", fmt.Errorf("添加任务失败: type=%s, uniqueKey=%s", jobType, uniqueKey)
+}
+
+// enqueue 写入任务，已有相同类型和唯一键的任务在等待或执行中时不写入并返回空ID
+func enqueue(jobType, uniqueKey string, payload interface{}, runAt time.Time) (string, error) {
+	r, ok := lookup(jobType)
+	if !ok {
+		return "", fmt.Errorf("未注册的任务类型: %s", jobType)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("序列化任务参数失败: %w", err)
+	}
+
+	var key interface{}
+	if uniqueKey != "" {
+		key = uniqueKey
+	}
+
+	id := uuid.New().String()
+	now := time.Now()
+	result, err := config.DB.Exec(`
+		INSERT INTO nlip_jobs
+		(id, type, unique_key, payload, status, attempts, max_attempts, run_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`, id, jobType, key, string(data), job.StatusPending, r.maxAttempts, runAt, now, now)
+	if err != nil {
+		return "", fmt.Errorf("创建任务失败: %w", err)
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		// 已有相同唯一键的任务在等待或执行中
+		return "", nil
+	}
+
+	logger.Debug("添加后台任务: id=%s, type=%s", id, jobType)
+	if !runAt.After(now) {
+		Wake()
+	}
+	return id, nil
+}
+
+// Wake 唤醒空闲的任务执行器立即检查待执行任务
+func Wake() {
+	if wakeup == nil {
+		return
+	}
+	select {
+	case wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Start 启动任务执行器，返回停止函数
+// 服务上次退出时仍在执行的任务会重新进入等待状态，保证任务在重启后继续执行
+// 停止函数不再领取新任务并等待正在执行的任务完成，ctx 到期时不再等待并返回错误，
+// 未完成的任务在下次启动时恢复执行
+func Start() func(ctx context.Context) error {
+	runMu.Lock()
+	defer runMu.Unlock()
+	if stopped != nil {
+		return stop
+	}
+
+	workers := config.Get().Jobs.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	if wakeup == nil {
+		wakeup = make(chan struct{}, workers)
+	}
+
+	result, err := config.DB.Exec(`
+		UPDATE nlip_jobs SET status = ?, run_at = ?, updated_at = ?
+		WHERE status = ?
+	`, job.StatusPending, time.Now(), time.Now(), job.StatusRunning)
+	if err != nil {
+		logger.Error("恢复中断的后台任务失败: %v", err)
+	} else if count, _ := result.RowsAffected(); count > 0 {
+		logger.Info("恢复 %d 个中断的后台任务", count)
+	}
+
+	logger.Info("启动后台任务执行器，并发数: %d", workers)
+	stopped = make(chan struct{})
+	running.Add(workers + 1)
+	for i := 0; i < workers; i++ {
+		go worker(stopped)
+	}
+	go purgeLoop(stopped)
+	return stop
+}
+
+// stop 停止任务执行器并等待正在执行的任务完成
+func stop(ctx context.Context) error {
+	runMu.Lock()
+	defer runMu.Unlock()
+	if stopped == nil {
+		return nil
+	}
+	// 上次等待超时后再次调用时继续等待
+	select {
+	case <-stopped:
+	default:
+		close(stopped)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		stopped = nil
+		logger.Info("后台任务执行器已停止")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("等待后台任务完成超时: %w", ctx.Err())
+	}
+}
+
+// worker 循环领取并执行到期任务，没有任务时等待唤醒
+func worker(stopped <-chan struct{}) {
+	defer running.Done()
+	timer := time.NewTimer(pollInterval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stopped:
+			return
+		default:
+		}
+
+		j, err := claim()
+		if err != nil {
+			logger.Error("领取后台任务失败: %v", err)
+		}
+		if j != nil {
+			run(j)
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(pollInterval)
+
+		select {
+		case <-timer.C:
+		case <-wakeup:
+		case <-stopped:
+			return
+		}
+	}
+}
+
+// claim 领取一个到期任务并标记为执行中
+func claim() (*job.Job, error) {
+	now := time.Now()
+	row := config.DB.QueryRow(`
+		UPDATE nlip_jobs
+		SET status = ?, attempts = attempts + 1, updated_at = ?
+		WHERE id = (
+			SELECT id FROM nlip_jobs
+			WHERE status = ? AND run_at <= ?
+			ORDER BY run_at ASC
+			LIMIT 1
+		) AND status = ?
+		RETURNING `+jobColumns,
+		job.StatusRunning, now, job.StatusPending, now, job.StatusPending)
+
+	j, err := scanJob(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return j, err
+}
+
+// run 执行任务并记录结果
+func run(j *job.Job) {
+	r, ok := lookup(j.Type)
+	if !ok {
+		fail(j, fmt.Errorf("未注册的任务类型: %s", j.Type), true)
+		return
+	}
+
+	start := time.Now()
+	if err := safeCall(r.handler, j); err != nil {
+		fail(j, err, j.Attempts >= j.MaxAttempts)
+		return
+	}
+
+	now := time.Now()
+	_, err := config.DB.Exec(`
+		UPDATE nlip_jobs SET status = ?, last_error = NULL, updated_at = ?, finished_at = ?
+		WHERE id = ?
+	`, job.StatusSucceeded, now, now, j.ID)
+	if err != nil {
+		logger.Error("更新后台任务状态失败: %v", err)
+	}
+	logger.Debug("后台任务执行成功: id=%s, type=%s, 耗时=%v", j.ID, j.Type, time.Since(start))
+}
+
+// safeCall 执行任务处理函数，将 panic 转换为错误
+func safeCall(handler Handler, j *job.Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("任务执行发生panic: %v", p)
+		}
+	}()
+	return handler(j)
+}
+
+// fail 记录任务失败，未达到最大次数时安排重试，否则进入死信状态
+func fail(j *job.Job, taskErr error, dead bool) {
+	errMsg := taskErr.Error()
+	if len(errMsg) > maxErrorLength {
+		errMsg = errMsg[:maxErrorLength]
+	}
+
+	now := time.Now()
+	var err error
+	if dead {
+		logger.Error("后台任务失败次数达到上限: id=%s, type=%s, %v", j.ID, j.Type, taskErr)
+		_, err = config.DB.Exec(`
+			UPDATE nlip_jobs SET status = ?, last_error = ?, updated_at = ?, finished_at = ?
+			WHERE id = ?
+		`, job.StatusDead, errMsg, now, now, j.ID)
+	} else {
+		delay := RetryDelay(j.Attempts)
+		logger.Warning("后台任务执行失败，%v 后重试: id=%s, type=%s, attempts=%d, %v", delay, j.ID, j.Type, j.Attempts, taskErr)
+		_, err = config.DB.Exec(`
+			UPDATE nlip_jobs SET status = ?, run_at = ?, last_error = ?, updated_at = ?
+			WHERE id = ?
+		`, job.StatusPending, now.Add(delay), errMsg, now, j.ID)
+	}
+	if err != nil {
+		logger.Error("更新后台任务状态失败: %v", err)
+	}
+}
+
+// RetryDelay 计算第 attempts 次失败后的重试等待时间
+func RetryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := baseRetryDelay << uint(attempts-1)
+	if delay <= 0 || delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// purgeLoop 定期删除过期的已成功任务
+func purgeLoop(stopped <-chan struct{}) {
+	defer running.Done()
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stopped:
+			return
+		}
+
+		result, err := config.DB.Exec(`
+			DELETE FROM nlip_jobs WHERE status = ? AND finished_at < ?
+		`, job.StatusSucceeded, time.Now().Add(-succeededRetention))
+		if err != nil {
+			logger.Error("清理已完成的后台任务失败: %v", err)
+			continue
+		}
+		if count, _ := result.RowsAffected(); count > 0 {
+			logger.Debug("已清理 %d 个已完成的后台任务", count)
+		}
+	}
+}
+
+// Retry 将死信任务或等待中的任务设置为立即执行，死信任务会重置执行次数
+// 已有相同唯一键的任务在等待或执行中时，死信任务不能重试
+func Retry(jobID string) (*job.Job, error) {
+	now := time.Now()
+	result, err := config.DB.Exec(`
+		UPDATE OR IGNORE nlip_jobs
+		SET attempts = CASE WHEN status = ? THEN 0 ELSE attempts END,
+			status = ?, run_at = ?, finished_at = NULL, updated_at = ?
+		WHERE id = ? AND status IN (?, ?)
+	`, job.StatusDead, job.StatusPending, now, now, jobID, job.StatusDead, job.StatusPending)
+	if err != nil {
+		return nil, err
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		var status string
+		err := config.DB.QueryRow("SELECT status FROM nlip_jobs WHERE id = ?", jobID).Scan(&status)
+		if err == nil && status == job.StatusDead {
+			return nil, ErrDuplicateActive
+		}
+		return nil, ErrNotRetryable
+	}
+
+	Wake()
+	return Get(jobID)
+}
+
+var (
+	// ErrNotRetryable 任务不存在或不处于可重试的状态
+	ErrNotRetryable = errors.New("任务不存在或无法重试")
+	// ErrDuplicateActive 已有相同唯一键的任务在等待或执行中
+	ErrDuplicateActive = errors.New("已有相同的任务在等待或执行中")
+)
+
+const jobColumns = `id, type, unique_key, payload, status, attempts, max_attempts, run_at,
+	last_error, created_at, updated_at, finished_at`
+
+// Get 获取指定任务
+func Get(jobID string) (*job.Job, error) {
+	row := config.DB.QueryRow("SELECT "+jobColumns+" FROM nlip_jobs WHERE id = ?", jobID)
+	j, err := scanJob(row)
+	if err != nil {
+		return nil, err
+	}
+	redact(j)
+	return j, nil
+}
+
+// List 按状态和类型分页获取任务列表，返回任务和总数
+func List(status, jobType string, limit, offset int) ([]job.Job, int, error) {
+	where := " WHERE 1 = 1"
+	var args []interface{}
+	if status != "" {
+		where += " AND status = ?"
+		args = append(args, status)
+	}
+	if jobType != "" {
+		where += " AND type = ?"
+		args = append(args, jobType)
+	}
+
+	var total int
+	if err := config.DB.QueryRow("SELECT COUNT(*) FROM nlip_jobs"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := config.DB.Query("SELECT "+jobColumns+" FROM nlip_jobs"+where+
+		" ORDER BY created_at DESC LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := []job.Job{}
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		redact(j)
+		list = append(list, *j)
+	}
+	return list, total, rows.Err()
+}
+
+// Stats 统计各状态的任务数量
+func Stats() (map[string]int, error) {
+	stats := map[string]int{
+		job.StatusPending:   0,
+		job.StatusRunning:   0,
+		job.StatusSucceeded: 0,
+		job.StatusDead:      0,
+	}
+
+	rows, err := config.DB.Query("SELECT status, COUNT(*) FROM nlip_jobs GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		stats[status] = count
+	}
+	return stats, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row scanner) (*job.Job, error) {
+	var j job.Job
+	var uniqueKey, lastError sql.NullString
+	var payload string
+	var finishedAt sql.NullTime
+	err := row.Scan(&j.ID, &j.Type, &uniqueKey, &payload, &j.Status, &j.Attempts, &j.MaxAttempts,
+		&j.RunAt, &lastError, &j.CreatedAt, &j.UpdatedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+	j.UniqueKey = uniqueKey.String
+	j.Payload = json.RawMessage(payload)
+	j.LastError = lastError.String
+	if finishedAt.Valid {
+		j.FinishedAt = &finishedAt.Time
+	}
+	return &j, nil
+}
@@ -0,0 +1,154 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"nlip/config"
+	"nlip/models/job"
+	"nlip/utils/testutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testJobType = "test.unique"
+
+func countActive(t *testing.T, uniqueKey string) int {
+	t.Helper()
+	var count int
+	err := config.DB.QueryRow(`
+		SELECT COUNT(*) FROM nlip_jobs WHERE type = ? AND unique_key = ? AND status IN (?, ?)
+	`, testJobType, uniqueKey, job.StatusPending, job.StatusRunning).Scan(&count)
+	if err != nil {
+		t.Fatalf("统计任务失败: %v", err)
+	}
+	return count
+}
+
+func setStatus(t *testing.T, jobID, status string) {
+	t.Helper()
+	if _, err := config.DB.Exec("UPDATE nlip_jobs SET status = ? WHERE id = ?", status, jobID); err != nil {
+		t.Fatalf("更新任务状态失败: %v", err)
+	}
+}
+
+// TestEnqueueUniqueConcurrent 并发添加相同唯一键的任务时只保留一个
+func TestEnqueueUniqueConcurrent(t *testing.T) {
+	testutil.Setup(t)
+	Register(testJobType, 3, func(*job.Job) error { return nil })
+
+	const callers = 20
+	ids := make([]string, callers)
+	errs := make([]error, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], errs[i] = EnqueueUnique(testJobType, "space-1", map[string]string{"spaceId": "space-1"})
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range ids {
+		if errs[i] != nil {
+			t.Fatalf("添加任务失败: %v", errs[i])
+		}
+		if ids[i] != ids[0] {
+			t.Errorf("并发添加返回了不同的任务: %s 和 %s", ids[i], ids[0])
+		}
+	}
+	if count := countActive(t, "space-1"); count != 1 {
+		t.Fatalf("等待中的任务有 %d 个，期望 1 个", count)
+	}
+
+	// 执行中的任务同样不会重复添加
+	setStatus(t, ids[0], job.StatusRunning)
+	id, err := EnqueueUnique(testJobType, "space-1", nil)
+	if err != nil || id != ids[0] {
+		t.Errorf("任务执行中时应返回该任务，实际返回 %q, %v", id, err)
+	}
+
+	// 任务完成后可以再次添加
+	setStatus(t, ids[0], job.StatusSucceeded)
+	id, err = EnqueueUnique(testJobType, "space-1", nil)
+	if err != nil || id == "" || id == ids[0] {
+		t.Errorf("任务完成后应添加新任务，实际返回 %q, %v", id, err)
+	}
+
+	// 不同唯一键互不影响
+	other, err := EnqueueUnique(testJobType, "space-2", nil)
+	if err != nil || other == "" || other == id {
+		t.Errorf("不同唯一键应添加新任务，实际返回 %q, %v", other, err)
+	}
+}
+
+// TestRetryDeadWithActiveDuplicate 已有相同唯一键的任务在等待时，死信任务不能重试
+func TestRetryDeadWithActiveDuplicate(t *testing.T) {
+	testutil.Setup(t)
+	Register(testJobType, 3, func(*job.Job) error { return nil })
+
+	deadID, err := EnqueueUnique(testJobType, "space-1", nil)
+	if err != nil {
+		t.Fatalf("添加任务失败: %v", err)
+	}
+	setStatus(t, deadID, job.StatusDead)
+
+	if _, err := EnqueueUnique(testJobType, "space-1", nil); err != nil {
+		t.Fatalf("添加任务失败: %v", err)
+	}
+	if _, err := Retry(deadID); err != ErrDuplicateActive {
+		t.Errorf("重试返回 %v，期望 %v", err, ErrDuplicateActive)
+	}
+	if count := countActive(t, "space-1"); count != 1 {
+		t.Errorf("等待中的任务有 %d 个，期望 1 个", count)
+	}
+}
+
+// TestStopWaitsForRunningJob 停止执行器时等待正在执行的任务完成，且不再领取新任务
+func TestStopWaitsForRunningJob(t *testing.T) {
+	testutil.Setup(t)
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	Register(testJobType, 3, func(*job.Job) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+
+	stop := Start()
+	id, err := Enqueue(testJobType, nil)
+	if err != nil {
+		t.Fatalf("添加任务失败: %v", err)
+	}
+	Wake()
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("任务未开始执行")
+	}
+
+	// 任务未完成时等待超时
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("任务未完成时停止应超时，实际返回 %v", err)
+	}
+
+	// 停止后添加的任务不会被领取
+	pendingID, err := Enqueue(testJobType, nil)
+	if err != nil {
+		t.Fatalf("添加任务失败: %v", err)
+	}
+
+	close(release)
+	if err := stop(context.Background()); err != nil {
+		t.Fatalf("停止执行器失败: %v", err)
+	}
+	if j, err := Get(id); err != nil || j.Status != job.StatusSucceeded {
+		t.Fatalf("正在执行的任务应完成，实际为 %+v, %v", j, err)
+	}
+	if j, err := Get(pendingID); err != nil || j.Status != job.StatusPending {
+		t.Fatalf("停止后不应领取新任务，实际为 %+v, %v", j, err)
+	}
+}
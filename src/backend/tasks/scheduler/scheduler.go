@@ -0,0 +1,326 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"nlip/config"
+	"nlip/models/schedule"
+	"nlip/utils/logger"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTaskNotFound = errors.New("定时任务不存在")
+	ErrTaskRunning  = errors.New("定时任务正在执行中")
+)
+
+// Task 定时任务定义
+type Task struct {
+	Name string
+	// Spec cron 表达式，为空时不自动执行，只能手动触发
+	Spec string
+	// RunOnStart 是否在启动时执行一次
+	RunOnStart bool
+	// Run 任务函数，服务关闭时 ctx 会被取消
+	Run func(ctx context.Context) error
+}
+
+type taskState struct {
+	task Task
+	// reset 执行时间变化后通知调度循环重新计算下次执行时间
+	reset chan struct{}
+
+	mu       sync.Mutex
+	spec     string
+	schedule *Schedule
+	running  bool
+	next     time.Time
+}
+
+var (
+	tasksMu sync.RWMutex
+	tasks   = make(map[string]*taskState)
+
+	runCtx context.Context
+	wg     sync.WaitGroup
+)
+
+// Register 注册定时任务，cron 表达式无效时返回错误，需在 Start 之前调用
+func Register(t Task) error {
+	st := &taskState{task: t, reset: make(chan struct{}, 1), spec: t.Spec}
+	s, err := parseSpec(t.Name, t.Spec)
+	if err != nil {
+		return err
+	}
+	st.schedule = s
+
+	tasksMu.Lock()
+	defer tasksMu.Unlock()
+	tasks[t.Name] = st
+	return nil
+}
+
+// parseSpec 解析任务的 cron 表达式，为空时返回 nil
+func parseSpec(name, spec string) (*Schedule, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	s, err := Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("定时任务 %s 的 cron 表达式无效: %w", name, err)
+	}
+	return s, nil
+}
+
+// Reschedule 修改已注册任务的执行时间，立即按新的 cron 表达式计算下次执行时间
+// 表达式为空时停止自动执行，表达式无效时返回错误且保持原有执行时间
+func Reschedule(name, spec string) error {
+	tasksMu.RLock()
+	st, ok := tasks[name]
+	tasksMu.RUnlock()
+	if !ok {
+		return ErrTaskNotFound
+	}
+
+	s, err := parseSpec(name, spec)
+	if err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	st.spec = spec
+	st.schedule = s
+	st.mu.Unlock()
+
+	select {
+	case st.reset <- struct{}{}:
+	default:
+	}
+	logger.Info("定时任务 %s 的执行时间已修改为: %q", name, spec)
+	return nil
+}
+
+// Start 启动所有已注册的定时任务，ctx 取消后停止调度并通知正在执行的任务退出
+func Start(ctx context.Context) {
+	runCtx = ctx
+
+	tasksMu.RLock()
+	defer tasksMu.RUnlock()
+
+	for _, st := range tasks {
+		if st.schedule == nil {
+			logger.Info("定时任务 %s 未配置执行时间，仅支持手动触发", st.task.Name)
+		} else {
+			logger.Info("启动定时任务 %s，执行时间: %s", st.task.Name, st.spec)
+		}
+		wg.Add(1)
+		go loop(ctx, st)
+	}
+}
+
+// Wait 等待所有正在执行的任务退出
+func Wait() {
+	wg.Wait()
+}
+
+// loop 按 cron 表达式循环调度单个任务，执行时间修改后重新计算下次执行时间
+func loop(ctx context.Context, st *taskState) {
+	defer wg.Done()
+
+	if st.task.RunOnStart {
+		run(ctx, st, schedule.TriggerStartup)
+	}
+
+	for {
+		var timer *time.Timer
+		var fire <-chan time.Time
+
+		st.mu.Lock()
+		st.next = time.Time{}
+		if st.schedule != nil {
+			next := st.schedule.Next(time.Now())
+			if next.IsZero() {
+				logger.Warning("定时任务 %s 的 cron 表达式不会再触发", st.task.Name)
+			} else {
+				st.next = next
+				timer = time.NewTimer(time.Until(next))
+				fire = timer.C
+			}
+		}
+		st.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			logger.Debug("定时任务 %s 已停止", st.task.Name)
+			return
+		case <-st.reset:
+			if timer != nil {
+				timer.Stop()
+			}
+		case <-fire:
+			run(ctx, st, schedule.TriggerSchedule)
+		}
+	}
+}
+
+// Trigger 手动触发定时任务，任务在后台执行
+func Trigger(name string) error {
+	tasksMu.RLock()
+	st, ok := tasks[name]
+	tasksMu.RUnlock()
+	if !ok {
+		return ErrTaskNotFound
+	}
+	if runCtx == nil || runCtx.Err() != nil {
+		return errors.New("定时任务调度器未运行")
+	}
+
+	if !st.tryStart() {
+		return ErrTaskRunning
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		execute(runCtx, st, schedule.TriggerManual)
+	}()
+	return nil
+}
+
+// tryStart 将任务标记为执行中，任务已在执行时返回 false
+func (st *taskState) tryStart() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.running {
+		return false
+	}
+	st.running = true
+	return true
+}
+
+// run 执行一次任务，同一任务不会并发执行
+func run(ctx context.Context, st *taskState, trigger string) {
+	if !st.tryStart() {
+		logger.Warning("定时任务 %s 上一次执行尚未结束，跳过本次执行", st.task.Name)
+		return
+	}
+	execute(ctx, st, trigger)
+}
+
+// execute 执行已标记为执行中的任务并记录执行结果
+func execute(ctx context.Context, st *taskState, trigger string) {
+	defer func() {
+		st.mu.Lock()
+		st.running = false
+		st.mu.Unlock()
+	}()
+
+	logger.Debug("开始执行定时任务 %s (%s)", st.task.Name, trigger)
+	start := time.Now()
+	err := safeRun(ctx, st.task.Run)
+	duration := time.Since(start)
+
+	status := schedule.StatusSuccess
+	var errMsg interface{}
+	if err != nil {
+		status = schedule.StatusFailed
+		errMsg = err.Error()
+		logger.Error("定时任务 %s 执行失败: %v", st.task.Name, err)
+	} else {
+		logger.Debug("定时任务 %s 执行完成，耗时 %v", st.task.Name, duration)
+	}
+
+	_, dbErr := config.DB.Exec(`
+		INSERT INTO nlip_scheduled_tasks
+		(name, last_run_at, last_duration_ms, last_status, last_error, last_trigger, run_count)
+		VALUES (?, ?, ?, ?, ?, ?, 1)
+		ON CONFLICT(name) DO UPDATE SET
+			last_run_at = excluded.last_run_at,
+			last_duration_ms = excluded.last_duration_ms,
+			last_status = excluded.last_status,
+			last_error = excluded.last_error,
+			last_trigger = excluded.last_trigger,
+			run_count = run_count + 1
+	`, st.task.Name, start, duration.Milliseconds(), status, errMsg, trigger)
+	if dbErr != nil {
+		logger.Error("记录定时任务执行结果失败: %v", dbErr)
+	}
+}
+
+// safeRun 执行任务函数，将 panic 转换为错误
+func safeRun(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("定时任务发生panic: %v", p)
+		}
+	}()
+	return fn(ctx)
+}
+
+// List 获取所有定时任务及其最近一次执行情况
+func List() ([]schedule.ScheduledTask, error) {
+	tasksMu.RLock()
+	names := make([]string, 0, len(tasks))
+	for name := range tasks {
+		names = append(names, name)
+	}
+	tasksMu.RUnlock()
+	sort.Strings(names)
+
+	list := make([]schedule.ScheduledTask, 0, len(names))
+	for _, name := range names {
+		t, err := Get(name)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *t)
+	}
+	return list, nil
+}
+
+// Get 获取指定定时任务及其最近一次执行情况
+func Get(name string) (*schedule.ScheduledTask, error) {
+	tasksMu.RLock()
+	st, ok := tasks[name]
+	tasksMu.RUnlock()
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+
+	t := schedule.ScheduledTask{
+		Name: name,
+	}
+	st.mu.Lock()
+	t.Schedule = st.spec
+	t.Running = st.running
+	if !st.next.IsZero() {
+		next := st.next
+		t.NextRunAt = &next
+	}
+	st.mu.Unlock()
+
+	var lastRunAt sql.NullTime
+	var lastStatus, lastError, lastTrigger sql.NullString
+	err := config.DB.QueryRow(`
+		SELECT last_run_at, last_duration_ms, last_status, last_error, last_trigger, run_count
+		FROM nlip_scheduled_tasks WHERE name = ?
+	`, name).Scan(&lastRunAt, &t.LastDurationMs, &lastStatus, &lastError, &lastTrigger, &t.RunCount)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if lastRunAt.Valid {
+		t.LastRunAt = &lastRunAt.Time
+	}
+	t.LastStatus = lastStatus.String
+	t.LastError = lastError.String
+	t.LastTrigger = lastTrigger.String
+	return &t, nil
+}
@@ -0,0 +1,144 @@
+package thumbnail
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"nlip/models/job"
+	"nlip/tasks/jobs"
+	"nlip/utils/logger"
+	"nlip/utils/storage"
+	"os"
+)
+
+// JobGenerate 生成图片缩略图的任务类型
+const JobGenerate = "clip.thumbnail"
+
+const (
+	// maxSize 缩略图最大宽高
+	maxSize = 256
+	// quality 缩略图 JPEG 质量
+	quality = 80
+)
+
+// generatePayload 生成缩略图的任务参数
+type generatePayload struct {
+	FilePath string `json:"filePath"`
+}
+
+// RegisterJobs 注册缩略图相关的后台任务
+func RegisterJobs() {
+	jobs.Register(JobGenerate, 3, handleGenerateJob)
+}
+
+// Enqueue 添加为图片文件生成缩略图的任务
+func Enqueue(filePath string) error {
+	_, err := jobs.Enqueue(JobGenerate, generatePayload{FilePath: filePath})
+	return err
+}
+
+func handleGenerateJob(j *job.Job) error {
+	var p generatePayload
+	if err := json.Unmarshal(j.Payload, &p); err != nil {
+		return fmt.Errorf("解析缩略图任务参数失败: %w", err)
+	}
+	return Generate(p.FilePath)
+}
+
+// Generate 为图片文件生成 JPEG 缩略图，文件不存在或格式不支持时直接跳过
+func Generate(filePath string) error {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		logger.Debug("生成缩略图时文件已不存在: %s", filePath)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("打开文件失败: %w", err)
+	}
+	defer file.Close()
+
+	src, _, err := image.Decode(file)
+	if errors.Is(err, image.ErrFormat) {
+		logger.Debug("不支持生成缩略图的图片格式: %s", filePath)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("解析图片失败: %w", err)
+	}
+
+	out, err := os.Create(storage.ThumbnailPath(filePath))
+	if err != nil {
+		return fmt.Errorf("创建缩略图文件失败: %w", err)
+	}
+	defer out.Close()
+
+	if err := jpeg.Encode(out, resize(src), &jpeg.Options{Quality: quality}); err != nil {
+		return fmt.Errorf("写入缩略图失败: %w", err)
+	}
+
+	logger.Debug("缩略图生成成功: %s", filePath)
+	return nil
+}
+
+// resize 按比例缩小图片，使宽高都不超过 maxSize，每个目标像素取对应源区域的平均值
+// 大图逐像素求平均开销较高，因此在后台任务中执行
+func resize(src image.Image) image.Image {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	dstW, dstH := srcW, srcH
+	if srcW > maxSize || srcH > maxSize {
+		if srcW >= srcH {
+			dstW = maxSize
+			dstH = srcH * maxSize / srcW
+		} else {
+			dstH = maxSize
+			dstW = srcW * maxSize / srcH
+		}
+	}
+	if dstW < 1 {
+		dstW = 1
+	}
+	if dstH < 1 {
+		dstH = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0 := bounds.Min.Y + y*srcH/dstH
+		y1 := bounds.Min.Y + (y+1)*srcH/dstH
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dstW; x++ {
+			x0 := bounds.Min.X + x*srcW/dstW
+			x1 := bounds.Min.X + (x+1)*srcW/dstW
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+
+			// JPEG 不支持透明度，透明区域以白色背景填充
+			white := 0xffff - a/n
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8((r/n + white) >> 8)
+			dst.Pix[i+1] = uint8((g/n + white) >> 8)
+			dst.Pix[i+2] = uint8((b/n + white) >> 8)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+	return dst
+}
@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress Webhook 地址解析到了不允许访问的内网地址
+var ErrBlockedAddress = errors.New("Webhook地址不能指向本机、内网或链路本地地址")
+
+// resolveTimeout 注册时解析域名的超时时间
+const resolveTimeout = 5 * time.Second
+
+// blockedPrefixes 标准库判断之外仍需禁止的地址段
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // 本网络
+	netip.MustParsePrefix("100.64.0.0/10"), // 运营商级 NAT，云服务商内网中常可访问
+	netip.MustParsePrefix("198.18.0.0/15"), // 网络设备基准测试
+}
+
+// blockedAddr 判断地址是否禁止投递，测试中可替换以允许本机接收方
+var blockedAddr = func(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateURL 检查 Webhook 地址，解析主机名并拒绝指向内网的地址
+// 投递时连接阶段还会再次检查实际连接的地址，防止 DNS 重绑定
+func ValidateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("Webhook地址必须是有效的 http 或 https 地址")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("无法解析Webhook地址 %s", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if blockedAddr(addr) {
+			return ErrBlockedAddress
+		}
+	}
+	return nil
+}
+
+// checkDialAddress 在建立连接前检查解析后的实际地址
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("无效的连接地址 %s: %w", address, err)
+	}
+	if blockedAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+// newHTTPClient 创建投递使用的 HTTP 客户端
+// 每次建立连接（包括重定向后的连接）都会检查目标地址，且不使用环境变量中的代理
+func newHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: checkDialAddress,
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
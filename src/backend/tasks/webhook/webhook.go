@@ -0,0 +1,298 @@
+package webhook
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"nlip/config"
+	"nlip/models/job"
+	webhookModel "nlip/models/webhook"
+	"nlip/tasks/jobs"
+	"nlip/utils/logger"
+	"nlip/utils/sign"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 请求头
+const (
+	SignatureHeader = "X-Nlip-Signature"
+	EventHeader     = "X-Nlip-Event"
+	DeliveryHeader  = "X-Nlip-Delivery"
+)
+
+// JobDeliver Webhook 投递任务类型
+const JobDeliver = "webhook.deliver"
+
+const (
+	// maxAttempts 最大投递次数，超过后标记为失败
+	maxAttempts = 8
+	// maxErrorLength 记录的错误信息最大长度
+	maxErrorLength = 1000
+)
+
+var httpClient = newHTTPClient()
+
+// deliverPayload Webhook 投递任务参数
+type deliverPayload struct {
+	DeliveryID string `json:"deliveryId"`
+}
+
+// RegisterJobs 注册 Webhook 投递任务，投递失败时由任务队列按指数退避重试
+func RegisterJobs() {
+	jobs.Register(JobDeliver, maxAttempts, handleDeliverJob)
+}
+
+// Enqueue 为订阅了该事件的空间 Webhook 生成投递记录并加入任务队列
+// 投递记录和任务都持久化在数据库中，服务重启后会继续投递
+func Enqueue(spaceID, eventType string, data interface{}) {
+	rows, err := config.DB.Query(`
+		SELECT id, events FROM nlip_webhooks WHERE space_id = ? AND active = 1
+	`, spaceID)
+	if err != nil {
+		logger.Error("查询空间Webhook失败: %v", err)
+		return
+	}
+
+	var webhookIDs []string
+	for rows.Next() {
+		var id, eventsStr string
+		if err := rows.Scan(&id, &eventsStr); err != nil {
+			logger.Error("读取Webhook数据失败: %v", err)
+			continue
+		}
+		if subscribes(eventsStr, eventType) {
+			webhookIDs = append(webhookIDs, id)
+		}
+	}
+	rows.Close()
+
+	now := time.Now()
+	for _, webhookID := range webhookIDs {
+		deliveryID := uuid.New().String()
+		payload, err := json.Marshal(webhookModel.Payload{
+			ID:        deliveryID,
+			Event:     eventType,
+			SpaceID:   spaceID,
+			Timestamp: now.Unix(),
+			Data:      data,
+		})
+		if err != nil {
+			logger.Error("序列化Webhook消息失败: %v", err)
+			return
+		}
+
+		if err := insertDelivery(deliveryID, webhookID, eventType, string(payload), now); err != nil {
+			logger.Error("创建Webhook投递记录失败: webhookID=%s, %v", webhookID, err)
+		}
+	}
+}
+
+// Redeliver 以原始消息体重新投递一次，返回新的投递记录ID
+func Redeliver(d *webhookModel.Delivery) (string, error) {
+	deliveryID := uuid.New().String()
+	if err := insertDelivery(deliveryID, d.WebhookID, d.EventType, d.Payload, time.Now()); err != nil {
+		return "", err
+	}
+	return deliveryID, nil
+}
+
+// subscribes 判断 Webhook 是否订阅了指定事件
+func subscribes(eventsStr, eventType string) bool {
+	for _, e := range strings.Split(eventsStr, ",") {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func insertDelivery(deliveryID, webhookID, eventType, payload string, now time.Time) error {
+	_, err := config.DB.Exec(`
+		INSERT INTO nlip_webhook_deliveries
+		(id, webhook_id, event_type, payload, status, attempts, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?)
+	`, deliveryID, webhookID, eventType, payload, webhookModel.DeliveryPending, now, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = jobs.Enqueue(JobDeliver, deliverPayload{DeliveryID: deliveryID})
+	return err
+}
+
+type pendingDelivery struct {
+	id        string
+	eventType string
+	payload   string
+	attempts  int
+	final     bool
+	url       string
+	secret    string
+}
+
+// handleDeliverJob 执行 Webhook 投递任务
+func handleDeliverJob(j *job.Job) error {
+	var p deliverPayload
+	if err := json.Unmarshal(j.Payload, &p); err != nil {
+		return fmt.Errorf("解析投递任务参数失败: %w", err)
+	}
+
+	var d pendingDelivery
+	err := config.DB.QueryRow(`
+		SELECT d.id, d.event_type, d.payload, w.url, w.secret
+		FROM nlip_webhook_deliveries d
+		JOIN nlip_webhooks w ON d.webhook_id = w.id
+		WHERE d.id = ? AND d.status = ?
+	`, p.DeliveryID, webhookModel.DeliveryPending).Scan(&d.id, &d.eventType, &d.payload, &d.url, &d.secret)
+	if err == sql.ErrNoRows {
+		// Webhook 已删除或投递记录已完成，无需投递
+		logger.Debug("Webhook投递记录不存在或已完成: deliveryID=%s", p.DeliveryID)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("查询Webhook投递记录失败: %w", err)
+	}
+
+	d.attempts = j.Attempts
+	d.final = j.Attempts >= j.MaxAttempts
+	return deliver(d)
+}
+
+// deliver 发送一次投递并记录结果，失败时返回错误由任务队列安排重试
+func deliver(d pendingDelivery) error {
+	statusCode, deliverErr := send(d)
+	now := time.Now()
+
+	var code interface{}
+	if statusCode > 0 {
+		code = statusCode
+	}
+
+	if deliverErr == nil {
+		_, err := config.DB.Exec(`
+			UPDATE nlip_webhook_deliveries
+			SET status = ?, attempts = ?, next_attempt_at = NULL, last_status_code = ?, last_error = NULL, delivered_at = ?
+			WHERE id = ?
+		`, webhookModel.DeliverySuccess, d.attempts, code, now, d.id)
+		if err != nil {
+			logger.Error("更新Webhook投递记录失败: %v", err)
+		}
+		logger.Debug("Webhook投递成功: deliveryID=%s, event=%s", d.id, d.eventType)
+		return nil
+	}
+
+	errMsg := deliverErr.Error()
+	if len(errMsg) > maxErrorLength {
+		errMsg = errMsg[:maxErrorLength]
+	}
+
+	status := webhookModel.DeliveryPending
+	var nextAttemptAt interface{}
+	if d.final {
+		status = webhookModel.DeliveryFailed
+		logger.Warning("Webhook投递失败次数达到上限: deliveryID=%s, %v", d.id, deliverErr)
+	} else {
+		nextAttemptAt = now.Add(jobs.RetryDelay(d.attempts))
+		logger.Warning("Webhook投递失败，稍后重试: deliveryID=%s, attempts=%d, %v", d.id, d.attempts, deliverErr)
+	}
+
+	_, err := config.DB.Exec(`
+		UPDATE nlip_webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_status_code = ?, last_error = ?
+		WHERE id = ?
+	`, status, d.attempts, nextAttemptAt, code, errMsg, d.id)
+	if err != nil {
+		logger.Error("更新Webhook投递记录失败: %v", err)
+	}
+	return deliverErr
+}
+
+// send 发送带签名的请求，非 2xx 响应视为失败
+func send(d pendingDelivery) (int, error) {
+	body := []byte(d.payload)
+	req, err := http.NewRequest(http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Nlip-Webhook")
+	req.Header.Set(EventHeader, d.eventType)
+	req.Header.Set(DeliveryHeader, d.id)
+	req.Header.Set(SignatureHeader, "sha256="+sign.SignHex(body, d.secret))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("接收方返回状态码 %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// GetDelivery 获取指定 Webhook 的投递记录
+func GetDelivery(webhookID, deliveryID string) (*webhookModel.Delivery, error) {
+	row := config.DB.QueryRow(selectDeliverySQL+" WHERE webhook_id = ? AND id = ?", webhookID, deliveryID)
+	return scanDelivery(row)
+}
+
+const selectDeliverySQL = `
+	SELECT id, webhook_id, event_type, payload, status, attempts, next_attempt_at,
+		last_status_code, last_error, created_at, delivered_at
+	FROM nlip_webhook_deliveries`
+
+// ListDeliveries 获取指定 Webhook 最近的投递记录
+func ListDeliveries(webhookID string, limit int) ([]webhookModel.Delivery, error) {
+	rows, err := config.DB.Query(selectDeliverySQL+" WHERE webhook_id = ? ORDER BY created_at DESC LIMIT ?", webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []webhookModel.Delivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDelivery(row scanner) (*webhookModel.Delivery, error) {
+	var d webhookModel.Delivery
+	var nextAttemptAt, deliveredAt sql.NullTime
+	var lastStatusCode sql.NullInt64
+	var lastError sql.NullString
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+		&nextAttemptAt, &lastStatusCode, &lastError, &d.CreatedAt, &deliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	if nextAttemptAt.Valid {
+		d.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if lastStatusCode.Valid {
+		code := int(lastStatusCode.Int64)
+		d.LastStatusCode = &code
+	}
+	d.LastError = lastError.String
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return &d, nil
+}
@@ -0,0 +1,154 @@
+package webhook
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"nlip/utils/sign"
+	"testing"
+)
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		blocked bool
+		invalid bool
+	}{
+		{"http://127.0.0.1:8080/hook", true, false},
+		{"http://localhost/hook", true, false},
+		{"http://[::1]/hook", true, false},
+		{"http://[::ffff:127.0.0.1]/hook", true, false},
+		{"http://0.0.0.0/hook", true, false},
+		{"http://10.0.0.8/hook", true, false},
+		{"http://172.16.3.4/hook", true, false},
+		{"https://192.168.1.1/hook", true, false},
+		{"http://169.254.169.254/latest/meta-data", true, false},
+		{"http://[fe80::1]/hook", true, false},
+		{"http://[fd00::1]/hook", true, false},
+		{"http://0.1.2.3/hook", true, false},
+		{"http://100.64.0.1/hook", true, false},
+		{"http://100.127.255.254/hook", true, false},
+		{"http://[::ffff:100.100.100.200]/hook", true, false},
+		{"http://198.18.0.1/hook", true, false},
+		{"http://198.19.255.255/hook", true, false},
+		{"https://100.128.0.1/hook", false, false},
+		{"https://198.20.0.1/hook", false, false},
+		{"https://93.184.216.34/hook", false, false},
+		{"ftp://93.184.216.34/hook", false, true},
+		{"http:///hook", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := ValidateURL(tt.url)
+			switch {
+			case tt.blocked && !errors.Is(err, ErrBlockedAddress):
+				t.Errorf("应拒绝内网地址，实际返回 %v", err)
+			case tt.invalid && (err == nil || errors.Is(err, ErrBlockedAddress)):
+				t.Errorf("应拒绝无效地址，实际返回 %v", err)
+			case !tt.blocked && !tt.invalid && err != nil:
+				t.Errorf("地址应有效，实际返回 %v", err)
+			}
+		})
+	}
+}
+
+// receiver 启动记录请求的 Webhook 接收方，监听在 127.0.0.1
+func receiver(t *testing.T) (*httptest.Server, chan *http.Request, chan []byte) {
+	t.Helper()
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests, bodies
+}
+
+func testDelivery(url string) pendingDelivery {
+	return pendingDelivery{
+		id:        "delivery-1",
+		eventType: "clip_created",
+		payload:   `{"id":"delivery-1","event":"clip_created"}`,
+		url:       url,
+		secret:    "webhook-secret",
+	}
+}
+
+func TestSendBlocksInternalReceiver(t *testing.T) {
+	server, requests, _ := receiver(t)
+
+	// 接收方监听在本机，投递时连接阶段应被拒绝
+	statusCode, err := send(testDelivery(server.URL + "/hook"))
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("投递到本机地址应被拒绝，实际返回 %d, %v", statusCode, err)
+	}
+	select {
+	case <-requests:
+		t.Fatal("接收方不应收到请求")
+	default:
+	}
+}
+
+func TestSendBlocksRedirectToInternal(t *testing.T) {
+	internal, requests, _ := receiver(t)
+
+	// 第一次连接视为外部地址放行，重定向后的连接仍要检查目标地址
+	redirector := httptest.NewServer(http.RedirectHandler(internal.URL+"/hook", http.StatusTemporaryRedirect))
+	t.Cleanup(redirector.Close)
+	redirectorAddr := netip.MustParseAddrPort(redirector.Listener.Addr().String())
+
+	original := blockedAddr
+	t.Cleanup(func() { blockedAddr = original })
+	var dialed []netip.Addr
+	blockedAddr = func(addr netip.Addr) bool {
+		dialed = append(dialed, addr)
+		return len(dialed) > 1
+	}
+
+	_, err := send(testDelivery("http://" + redirectorAddr.String() + "/hook"))
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("重定向到内网地址应被拒绝，实际返回 %v", err)
+	}
+	select {
+	case <-requests:
+		t.Fatal("内网接收方不应收到请求")
+	default:
+	}
+}
+
+func TestSendDeliversSignedPayload(t *testing.T) {
+	server, requests, bodies := receiver(t)
+
+	original := blockedAddr
+	t.Cleanup(func() { blockedAddr = original })
+	blockedAddr = func(netip.Addr) bool { return false }
+
+	d := testDelivery(server.URL + "/hook")
+	statusCode, err := send(d)
+	if err != nil {
+		t.Fatalf("投递失败: %v", err)
+	}
+	if statusCode != http.StatusNoContent {
+		t.Errorf("状态码为 %d，期望 204", statusCode)
+	}
+
+	r := <-requests
+	body := <-bodies
+	if string(body) != d.payload {
+		t.Errorf("接收到的内容为 %q，期望 %q", body, d.payload)
+	}
+	if got := r.Header.Get(EventHeader); got != d.eventType {
+		t.Errorf("%s 为 %q，期望 %q", EventHeader, got, d.eventType)
+	}
+	if got := r.Header.Get(DeliveryHeader); got != d.id {
+		t.Errorf("%s 为 %q，期望 %q", DeliveryHeader, got, d.id)
+	}
+	if got, want := r.Header.Get(SignatureHeader), "sha256="+sign.SignHex(body, d.secret); got != want {
+		t.Errorf("%s 为 %q，期望 %q", SignatureHeader, got, want)
+	}
+}
@@ -0,0 +1,198 @@
+package clientip
+
+import (
+	"net"
+	"net/netip"
+	"nlip/config"
+	"nlip/utils/logger"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// proxyConfig 可信代理的地址范围及其传递客户端地址使用的请求头
+type proxyConfig struct {
+	prefixes []netip.Prefix
+	header   string
+}
+
+// proxies 当前的可信代理配置，配置重新加载时整体替换
+var proxies atomic.Pointer[proxyConfig]
+
+// ApplyConfig 根据配置更新可信代理列表，无效的条目会被忽略
+func ApplyConfig(_, cfg *config.Config) {
+	prefixes := make([]netip.Prefix, 0, len(cfg.TrustedProxies))
+	for _, entry := range cfg.TrustedProxies {
+		prefix, err := parsePrefix(entry)
+		if err != nil {
+			logger.Warning("忽略无效的可信代理: %q", entry)
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	proxies.Store(&proxyConfig{prefixes: prefixes, header: strings.ToLower(cfg.TrustedHeader)})
+	if len(prefixes) > 0 {
+		logger.Info("可信代理已更新: %s，客户端地址请求头: %s", strings.Join(cfg.TrustedProxies, ", "), cfg.TrustedHeader)
+	}
+}
+
+// parsePrefix 解析 IP 或 CIDR，单个 IP 视为只包含该地址的范围
+func parsePrefix(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+func isTrusted(addr netip.Addr) bool {
+	p := proxies.Load()
+	if p == nil {
+		return false
+	}
+	for _, prefix := range p.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// trustedHeader 可信代理传递客户端地址使用的请求头，未配置时为 x-forwarded-for
+func trustedHeader() string {
+	if p := proxies.Load(); p != nil && p.header != "" {
+		return p.header
+	}
+	return "x-forwarded-for"
+}
+
+// IP 获取请求的客户端IP
+// 直接连接的地址是可信代理时，从配置的请求头（trusted_header）中由近及远跳过可信代理，
+// 返回第一个不可信的地址；否则直接返回连接地址。其他转发请求头可能由客户端原样传入，不会被使用
+func IP(c *fiber.Ctx) string {
+	remote, ok := netip.AddrFromSlice(c.Context().RemoteIP())
+	if !ok {
+		return c.IP()
+	}
+	client := remote.Unmap()
+	if !isTrusted(client) {
+		return client.String()
+	}
+
+	// 代理追加的地址在末尾
+	var hops []string
+	var found bool
+	switch trustedHeader() {
+	case "forwarded":
+		hops, found = forwardedHops(c)
+	case "x-real-ip":
+		hops, found = headerHops(c, "X-Real-IP")
+	default:
+		hops, found = headerHops(c, fiber.HeaderXForwardedFor)
+	}
+	if !found {
+		return client.String()
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseAddr(hops[i])
+		if !ok {
+			// 无法解析的地址（例如 unknown）之前的记录无法确认来源
+			break
+		}
+		client = hop
+		if !isTrusted(hop) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// IsHTTPS 判断客户端是否通过 HTTPS 访问
+// 直接的 TLS 连接视为 HTTPS；由反向代理终止 TLS 时，只有直接连接的地址是可信代理，
+// 才采用协议请求头中最近一跳代理设置的值。trusted_header 为 forwarded 时使用 Forwarded 中的 proto，
+// 否则使用 X-Forwarded-Proto
+func IsHTTPS(c *fiber.Ctx) bool {
+	if c.Context().IsTLS() {
+		return true
+	}
+	remote, ok := netip.AddrFromSlice(c.Context().RemoteIP())
+	if !ok || !isTrusted(remote.Unmap()) {
+		return false
+	}
+
+	if trustedHeader() == "forwarded" {
+		elements, found := headerHops(c, fiber.HeaderForwarded)
+		if !found {
+			return false
+		}
+		for _, pair := range strings.Split(elements[len(elements)-1], ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "proto") {
+				return strings.EqualFold(strings.Trim(value, `"`), "https")
+			}
+		}
+		return false
+	}
+	if protos, found := headerHops(c, fiber.HeaderXForwardedProto); found {
+		return strings.EqualFold(protos[len(protos)-1], "https")
+	}
+	return false
+}
+
+// headerHops 读取逗号分隔的地址列表，同名请求头出现多次时按顺序合并
+func headerHops(c *fiber.Ctx, name string) ([]string, bool) {
+	values := c.Request().Header.PeekAll(name)
+	if len(values) == 0 {
+		return nil, false
+	}
+	var hops []string
+	for _, value := range values {
+		for _, hop := range strings.Split(string(value), ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops, true
+}
+
+// forwardedHops 读取 RFC 7239 Forwarded 请求头中每一跳的 for 参数
+// 例如 for=192.0.2.60;proto=https, for="[2001:db8::17]:4711"
+func forwardedHops(c *fiber.Ctx) ([]string, bool) {
+	elements, found := headerHops(c, fiber.HeaderForwarded)
+	if !found {
+		return nil, false
+	}
+	hops := make([]string, 0, len(elements))
+	for _, element := range elements {
+		hop := ""
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				hop = strings.Trim(value, `"`)
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops, true
+}
+
+// parseAddr 解析请求头中的地址，支持带端口和带方括号的 IPv6 地址
+func parseAddr(value string) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(strings.Trim(value, "[]")); err == nil {
+		return addr.Unmap(), true
+	}
+	host, _, err := net.SplitHostPort(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,98 @@
+package clientip
+
+import (
+	"io"
+	"net/http/httptest"
+	"nlip/config"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newApp 创建返回客户端IP和协议的测试应用，app.Test 发出的请求连接地址为 0.0.0.0
+func newApp(t *testing.T, trustedHeader string) *fiber.App {
+	t.Helper()
+	t.Cleanup(func() { proxies.Store(nil) })
+	ApplyConfig(nil, &config.Config{
+		TrustedProxies: []string{"0.0.0.0", "10.0.0.0/8"},
+		TrustedHeader:  trustedHeader,
+	})
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		proto := "http"
+		if IsHTTPS(c) {
+			proto = "https"
+		}
+		return c.SendString(IP(c) + " " + proto)
+	})
+	return app
+}
+
+func get(t *testing.T, app *fiber.App, headers map[string]string) string {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/", nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+// TestConflictingForwardedHeaders 可信代理转发的请求同时带有 Forwarded 和 X-Forwarded-For 时，只使用配置的请求头
+func TestConflictingForwardedHeaders(t *testing.T) {
+	// 客户端伪造 Forwarded，代理只追加 X-Forwarded-For 和设置 X-Forwarded-Proto
+	headers := map[string]string{
+		fiber.HeaderForwarded:       "for=198.51.100.7;proto=https",
+		fiber.HeaderXForwardedFor:   "203.0.113.9, 10.0.0.2",
+		fiber.HeaderXForwardedProto: "http",
+		"X-Real-IP":                 "192.0.2.44",
+	}
+
+	tests := []struct {
+		trustedHeader string
+		want          string
+	}{
+		{"x-forwarded-for", "203.0.113.9 http"},
+		{"x-real-ip", "192.0.2.44 http"},
+		{"forwarded", "198.51.100.7 https"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.trustedHeader, func(t *testing.T) {
+			app := newApp(t, tt.trustedHeader)
+			if got := get(t, app, headers); got != tt.want {
+				t.Errorf("结果为 %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestIgnoresUnconfiguredHeader 配置的请求头不存在时使用连接地址，不回退到其他请求头
+func TestIgnoresUnconfiguredHeader(t *testing.T) {
+	app := newApp(t, "x-forwarded-for")
+	got := get(t, app, map[string]string{
+		fiber.HeaderForwarded: "for=198.51.100.7;proto=https",
+		"X-Real-IP":           "192.0.2.44",
+	})
+	if want := "0.0.0.0 http"; got != want {
+		t.Errorf("结果为 %q，期望 %q", got, want)
+	}
+}
+
+// TestUntrustedPeer 连接地址不是可信代理时忽略所有转发请求头
+func TestUntrustedPeer(t *testing.T) {
+	t.Cleanup(func() { proxies.Store(nil) })
+	ApplyConfig(nil, &config.Config{TrustedProxies: []string{"10.0.0.0/8"}, TrustedHeader: "x-forwarded-for"})
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString(IP(c)) })
+	got := get(t, app, map[string]string{fiber.HeaderXForwardedFor: "203.0.113.9"})
+	if got != "0.0.0.0" {
+		t.Errorf("客户端IP为 %q，期望连接地址 0.0.0.0", got)
+	}
+}
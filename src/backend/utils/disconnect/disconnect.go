@@ -0,0 +1,64 @@
+package disconnect
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// pollInterval 检查客户端连接是否关闭的间隔
+const pollInterval = time.Second
+
+// Watch 在处理长时间阻塞的请求时检测客户端是否已断开连接
+// 返回的通道在客户端关闭连接或服务关闭时关闭；调用方必须在处理函数返回前调用 stop
+// fasthttp 不提供断开通知，这里定期窥探底层连接，不会读取连接中的数据
+func Watch(c *fiber.Ctx) (<-chan struct{}, func()) {
+	gone := make(chan struct{})
+	done := make(chan struct{})
+	conn := c.Context().Conn()
+	shutdown := c.Context().Done()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-shutdown:
+				close(gone)
+				return
+			case <-ticker.C:
+				if peerClosed(conn) {
+					close(gone)
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+	return gone, stop
+}
+
+// rawConn 返回 TLS 等包装连接下的底层连接
+func rawConn(conn net.Conn) net.Conn {
+	for {
+		wrapped, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			return conn
+		}
+		conn = wrapped.NetConn()
+	}
+}
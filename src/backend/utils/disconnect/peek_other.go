@@ -0,0 +1,10 @@
+//go:build !unix
+
+package disconnect
+
+import "net"
+
+// peerClosed 当前平台不支持窥探连接，只能等待超时或服务关闭
+func peerClosed(conn net.Conn) bool {
+	return false
+}
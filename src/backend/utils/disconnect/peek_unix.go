@@ -0,0 +1,37 @@
+//go:build unix
+
+package disconnect
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// peerClosed 以 MSG_PEEK 非阻塞地窥探连接，对端已关闭或连接出错时返回 true
+// 连接中有未读数据（如管线化的下一个请求）时视为连接仍然打开
+func peerClosed(conn net.Conn) bool {
+	sc, ok := rawConn(conn).(syscall.Conn)
+	if !ok {
+		return false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return false
+	}
+
+	closed := false
+	buf := make([]byte, 1)
+	raw.Read(func(fd uintptr) bool {
+		n, _, err := syscall.Recvfrom(int(fd), buf, syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		switch {
+		case err == nil:
+			closed = n == 0
+		case errors.Is(err, syscall.EAGAIN), errors.Is(err, syscall.EWOULDBLOCK), errors.Is(err, syscall.EINTR):
+		default:
+			closed = true
+		}
+		return true
+	})
+	return closed
+}
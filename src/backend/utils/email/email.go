@@ -5,6 +5,7 @@ import (
 	"net/smtp"
 	"nlip/config"
 	"nlip/utils/logger"
+	"sync"
 )
 
 type EmailConfig struct {
@@ -15,19 +16,34 @@ type EmailConfig struct {
 	From     string
 }
 
-var emailConfig EmailConfig
+var (
+	emailConfig   EmailConfig
+	emailConfigMu sync.RWMutex
+)
 
 // InitEmailConfig 初始化邮件配置
 func InitEmailConfig() {
+	cfg := config.Get().Email
+	emailConfigMu.Lock()
+	defer emailConfigMu.Unlock()
 	emailConfig = EmailConfig{
-		Host:     config.AppConfig.Email.Host,
-		Port:     config.AppConfig.Email.Port,
-		Username: config.AppConfig.Email.Username,
-		Password: config.AppConfig.Email.Password,
-		From:     config.AppConfig.Email.From,
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		From:     cfg.From,
 	}
 }
 
+// ApplyConfig 配置重新加载后更新邮件配置，之后发送的邮件使用新的配置
+func ApplyConfig(old, new *config.Config) {
+	if old.Email == new.Email {
+		return
+	}
+	InitEmailConfig()
+	logger.Info("邮件配置已更新: host=%s, port=%d", new.Email.Host, new.Email.Port)
+}
+
 // SendInviteEmail 发送邀请邮件
 func SendInviteEmail(toEmail, spaceName, inviteLink string) error {
 	subject := fmt.Sprintf("邀请您加入空间：%s", spaceName)
@@ -46,6 +62,10 @@ func SendInviteEmail(toEmail, spaceName, inviteLink string) error {
 
 // sendEmail 发送邮件的通用方法
 func sendEmail(to, subject, body string) error {
+	emailConfigMu.RLock()
+	emailConfig := emailConfig
+	emailConfigMu.RUnlock()
+
 	auth := smtp.PlainAuth("", emailConfig.Username, emailConfig.Password, emailConfig.Host)
 
 	mime := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
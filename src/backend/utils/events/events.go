@@ -0,0 +1,115 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// 事件类型
+const (
+	ClipCreated  = "clip_created"
+	ClipUpdated  = "clip_updated"
+	ClipDeleted  = "clip_deleted"
+	SpaceUpdated = "space_updated"
+)
+
+const (
+	// bufferSize 保留最近事件的数量，用于断线重连后补发
+	bufferSize = 1024
+	// subscriberBufferSize 每个订阅者的待发送事件队列长度
+	subscriberBufferSize = 64
+)
+
+// Event 空间活动事件
+type Event struct {
+	ID        int64       `json:"id"`
+	Type      string      `json:"type"`
+	SpaceID   string      `json:"spaceId"`
+	Data      interface{} `json:"data"`
+	Timestamp int64       `json:"timestamp"`
+}
+
+// 进程内的事件中心，按空间分发事件并在环形缓冲区中保留最近的事件
+var (
+	mu          sync.Mutex
+	buffer      = make([]Event, 0, bufferSize)
+	start       int
+	lastID      = time.Now().UnixMilli() // 以启动时间为起点，重启后事件ID仍保持递增
+	subscribers = make(map[string]map[chan Event]struct{})
+)
+
+// Publish 发布空间事件
+// 订阅者队列已满时关闭其通道，由客户端携带最后的事件ID重新连接补发
+func Publish(spaceID, eventType string, data interface{}) Event {
+	mu.Lock()
+	defer mu.Unlock()
+
+	lastID++
+	ev := Event{
+		ID:        lastID,
+		Type:      eventType,
+		SpaceID:   spaceID,
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+	}
+
+	if len(buffer) < bufferSize {
+		buffer = append(buffer, ev)
+	} else {
+		buffer[start] = ev
+		start = (start + 1) % bufferSize
+	}
+
+	for ch := range subscribers[spaceID] {
+		select {
+		case ch <- ev:
+		default:
+			removeSubscriber(spaceID, ch)
+			close(ch)
+		}
+	}
+
+	return ev
+}
+
+// Subscribe 订阅指定空间的事件
+// 返回 afterID 之后仍在缓冲区中的事件、接收新事件的通道及取消订阅函数
+// 补发事件与订阅在同一把锁内完成，保证事件不重复也不遗漏
+func Subscribe(spaceID string, afterID int64) ([]Event, <-chan Event, func()) {
+	ch := make(chan Event, subscriberBufferSize)
+
+	mu.Lock()
+	var missed []Event
+	if afterID > 0 {
+		for i := 0; i < len(buffer); i++ {
+			ev := buffer[(start+i)%len(buffer)]
+			if ev.SpaceID == spaceID && ev.ID > afterID {
+				missed = append(missed, ev)
+			}
+		}
+	}
+	if subscribers[spaceID] == nil {
+		subscribers[spaceID] = make(map[chan Event]struct{})
+	}
+	subscribers[spaceID][ch] = struct{}{}
+	mu.Unlock()
+
+	unsubscribe := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := subscribers[spaceID][ch]; ok {
+			removeSubscriber(spaceID, ch)
+			close(ch)
+		}
+	}
+
+	return missed, ch, unsubscribe
+}
+
+// removeSubscriber 移除订阅者，调用方需持有锁
+func removeSubscriber(spaceID string, ch chan Event) {
+	delete(subscribers[spaceID], ch)
+	if len(subscribers[spaceID]) == 0 {
+		delete(subscribers, spaceID)
+	}
+}
@@ -0,0 +1,47 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"nlip/config"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ChallengeExpiry 两步验证挑战令牌的有效期
+const ChallengeExpiry = 5 * time.Minute
+
+// ErrInvalidChallenge 挑战令牌无效或已过期
+var ErrInvalidChallenge = errors.New("两步验证已过期，请重新登录")
+
+// challengeKey 挑战令牌使用从 JWT 密钥派生的独立密钥签名，不能当作登录令牌使用
+func challengeKey() []byte {
+	mac := hmac.New(sha256.New, []byte(config.Get().JWTSecret))
+	mac.Write([]byte("nlip-2fa-challenge"))
+	return mac.Sum(nil)
+}
+
+// GenerateChallenge 密码验证通过后签发挑战令牌，提交验证码时换取登录令牌
+func GenerateChallenge(userID string) (string, error) {
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		Subject:   userID,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ChallengeExpiry)),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(challengeKey())
+}
+
+// ValidateChallenge 验证挑战令牌，返回用户ID
+func ValidateChallenge(tokenString string) (string, error) {
+	var claims jwt.RegisteredClaims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		return challengeKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid || claims.Subject == "" {
+		return "", ErrInvalidChallenge
+	}
+	return claims.Subject, nil
+}
@@ -12,6 +12,8 @@ type Claims struct {
     UserID   string `json:"userId"`
     Username string `json:"username"`
     IsAdmin  bool   `json:"isAdmin"`
+    // TwoFactorEnabled 用户是否已启用两步验证，由 Authenticate 从数据库读取，不写入令牌
+    TwoFactorEnabled bool `json:"-"`
     jwt.RegisteredClaims
 }
 
@@ -31,13 +33,13 @@ func GenerateToken(user *user.User) (string, error) {
         IsAdmin:  user.IsAdmin,
         NeedChangePwd: user.NeedChangePwd,
         RegisteredClaims: jwt.RegisteredClaims{
-            ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.AppConfig.TokenExpiry)),
+            ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.Get().TokenExpiry)),
             IssuedAt:  jwt.NewNumericDate(time.Now()),
         },
     }
 
     token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    tokenString, err := token.SignedString([]byte(config.AppConfig.JWTSecret))
+    tokenString, err := token.SignedString([]byte(config.Get().JWTSecret))
     if err != nil {
         logger.Error("生成JWT令牌失败: %v", err)
         return "", err
@@ -51,7 +53,7 @@ func GenerateToken(user *user.User) (string, error) {
 // ValidateToken 验证JWT令牌
 func ValidateToken(tokenString string) (*Claims, error) {
     token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-        return []byte(config.AppConfig.JWTSecret), nil
+        return []byte(config.Get().JWTSecret), nil
     })
 
     if err != nil {
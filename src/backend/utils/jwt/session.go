@@ -0,0 +1,55 @@
+package jwt
+
+import (
+	"database/sql"
+	"errors"
+	"nlip/config"
+	"nlip/utils/logger"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func init() {
+	// 签发时间精确到毫秒，避免与禁用账号或重置密码发生在同一秒的令牌无法区分
+	jwt.TimePrecision = time.Millisecond
+}
+
+var (
+	// ErrUserNotFound 令牌对应的用户已被删除
+	ErrUserNotFound = errors.New("用户不存在")
+	// ErrAccountDisabled 账号已被管理员禁用
+	ErrAccountDisabled = errors.New("账号已被禁用")
+	// ErrTokenRevoked 令牌签发后用户被禁用或重置了密码
+	ErrTokenRevoked = errors.New("认证令牌已失效")
+)
+
+// Authenticate 验证JWT令牌并检查用户当前状态
+// 用户被删除、禁用或令牌签发早于失效时间时返回错误，用户名、管理员身份和两步验证状态以数据库为准
+func Authenticate(tokenString string) (*Claims, error) {
+	claims, err := ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	var disabled bool
+	var validAfter int64
+	err = config.DB.QueryRow(`
+		SELECT username, is_admin, disabled, tokens_valid_after, totp_enabled
+		FROM nlip_users WHERE id = ?
+	`, claims.UserID).Scan(&claims.Username, &claims.IsAdmin, &disabled, &validAfter, &claims.TwoFactorEnabled)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if disabled {
+		return nil, ErrAccountDisabled
+	}
+	if claims.IssuedAt == nil || claims.IssuedAt.UnixMilli() < validAfter {
+		logger.Debug("令牌签发时间早于失效时间: userID=%s", claims.UserID)
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
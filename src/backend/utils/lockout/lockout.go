@@ -0,0 +1,224 @@
+package lockout
+
+import (
+	"database/sql"
+	"nlip/config"
+	"nlip/models/lockout"
+	"nlip/utils/db"
+	"nlip/utils/logger"
+	"time"
+)
+
+// Check 获取账号或客户端IP剩余的锁定时长，都未锁定时返回 0
+func Check(username, ip string) (time.Duration, error) {
+	if !config.Get().LoginLockout.Enabled {
+		return 0, nil
+	}
+
+	var lockedUntil int64
+	err := config.DB.QueryRow(`
+		SELECT COALESCE(MAX(locked_until), 0) FROM nlip_login_failures
+		WHERE (kind = ? AND value = ?) OR (kind = ? AND value = ?)
+	`, lockout.KindAccount, username, lockout.KindIP, ip).Scan(&lockedUntil)
+	if err != nil {
+		return 0, err
+	}
+
+	remaining := time.Until(time.UnixMilli(lockedUntil))
+	if remaining < 0 {
+		return 0, nil
+	}
+	return remaining, nil
+}
+
+// lockDuration 连续失败 failures 次后的锁定时长，达到 maxAttempts 次时开始锁定，之后每次失败翻倍
+func lockDuration(failures, maxAttempts int) time.Duration {
+	cfg := config.Get().LoginLockout
+	if failures < maxAttempts {
+		return 0
+	}
+	d := time.Duration(cfg.LockSeconds) * time.Second
+	limit := time.Duration(cfg.MaxLockSeconds) * time.Second
+	for i := maxAttempts; i < failures && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	return d
+}
+
+// RecordFailure 记录一次登录失败，账号和客户端IP分别计数，userID 为空表示用户名不存在
+// 返回本次失败后的锁定时长，账号首次被锁定时为该用户记录安全事件
+func RecordFailure(username, userID, ip string) (time.Duration, error) {
+	cfg := config.Get().LoginLockout
+	if !cfg.Enabled {
+		return 0, nil
+	}
+
+	now := time.Now()
+	subjects := []struct {
+		kind        string
+		value       string
+		maxAttempts int
+	}{
+		{lockout.KindAccount, username, cfg.MaxAttempts},
+		{lockout.KindIP, ip, cfg.IPMaxAttempts},
+	}
+
+	var lock time.Duration
+	err := db.WithTransaction(config.DB, func(tx *sql.Tx) error {
+		// 最后一次失败已超过重新计数的时间且未锁定的记录不再需要
+		resetBefore := now.Add(-time.Duration(cfg.ResetSeconds) * time.Second).UnixMilli()
+		if _, err := tx.Exec(`
+			DELETE FROM nlip_login_failures WHERE last_failed_at < ? AND locked_until < ?
+		`, resetBefore, now.UnixMilli()); err != nil {
+			return err
+		}
+
+		for _, s := range subjects {
+			var failures int
+			err := tx.QueryRow(`
+				SELECT failures FROM nlip_login_failures WHERE kind = ? AND value = ?
+			`, s.kind, s.value).Scan(&failures)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			failures++
+
+			var lockedUntil int64
+			if d := lockDuration(failures, s.maxAttempts); d > 0 {
+				lockedUntil = now.Add(d).UnixMilli()
+				if d > lock {
+					lock = d
+				}
+				logger.Warning("登录失败次数过多，已临时锁定: %s=%s, failures=%d, duration=%s", s.kind, s.value, failures, d)
+			}
+
+			if _, err := tx.Exec(`
+				INSERT INTO nlip_login_failures (kind, value, failures, last_ip, last_failed_at, locked_until)
+				VALUES (?, ?, ?, ?, ?, ?)
+				ON CONFLICT(kind, value) DO UPDATE SET
+					failures = excluded.failures, last_ip = excluded.last_ip,
+					last_failed_at = excluded.last_failed_at, locked_until = excluded.locked_until
+			`, s.kind, s.value, failures, ip, now.UnixMilli(), lockedUntil); err != nil {
+				return err
+			}
+
+			if s.kind == lockout.KindAccount && userID != "" && failures == s.maxAttempts {
+				if _, err := tx.Exec(`
+					INSERT INTO nlip_security_events (user_id, type, ip, attempts, created_at)
+					VALUES (?, ?, ?, ?, ?)
+				`, userID, lockout.NoticeAccountLocked, ip, failures, now); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return lock, err
+}
+
+// RecordSuccess 登录成功后清除账号的失败记录，之前有失败记录时为该用户记录安全事件
+// 返回该用户未读的安全事件并标记为已读，客户端的失败记录不清除
+func RecordSuccess(username, userID, ip string) ([]lockout.Notice, error) {
+	now := time.Now()
+	resetBefore := now.Add(-time.Duration(config.Get().LoginLockout.ResetSeconds) * time.Second).UnixMilli()
+
+	notices := []lockout.Notice{}
+	err := db.WithTransaction(config.DB, func(tx *sql.Tx) error {
+		var failures int
+		var lastIP string
+		err := tx.QueryRow(`
+			SELECT failures, last_ip FROM nlip_login_failures
+			WHERE kind = ? AND value = ? AND last_failed_at >= ?
+		`, lockout.KindAccount, username, resetBefore).Scan(&failures, &lastIP)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if failures > 0 {
+			if _, err := tx.Exec(`
+				INSERT INTO nlip_security_events (user_id, type, ip, attempts, created_at)
+				VALUES (?, ?, ?, ?, ?)
+			`, userID, lockout.NoticeFailedLogins, lastIP, failures, now); err != nil {
+				return err
+			}
+			logger.Info("登录成功，此前登录失败 %d 次: username=%s, ip=%s", failures, username, ip)
+		}
+		if _, err := tx.Exec(`
+			DELETE FROM nlip_login_failures WHERE kind = ? AND value = ?
+		`, lockout.KindAccount, username); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(`
+			SELECT id, type, ip, attempts, created_at FROM nlip_security_events
+			WHERE user_id = ? AND read_at IS NULL
+			ORDER BY id
+		`, userID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var n lockout.Notice
+			if err := rows.Scan(&n.ID, &n.Type, &n.IP, &n.Attempts, &n.CreatedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			notices = append(notices, n)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			UPDATE nlip_security_events SET read_at = ? WHERE user_id = ? AND read_at IS NULL
+		`, now, userID)
+		return err
+	})
+	return notices, err
+}
+
+// List 获取仍在计数或锁定中的登录失败记录，锁定中的记录在前
+func List() ([]lockout.Entry, error) {
+	now := time.Now()
+	resetBefore := now.Add(-time.Duration(config.Get().LoginLockout.ResetSeconds) * time.Second).UnixMilli()
+
+	rows, err := config.DB.Query(`
+		SELECT kind, value, failures, last_ip, last_failed_at, locked_until
+		FROM nlip_login_failures
+		WHERE last_failed_at >= ? OR locked_until > ?
+		ORDER BY locked_until > ? DESC, last_failed_at DESC
+	`, resetBefore, now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []lockout.Entry{}
+	for rows.Next() {
+		var e lockout.Entry
+		var lastFailedAt, lockedUntil int64
+		if err := rows.Scan(&e.Kind, &e.Value, &e.Failures, &e.LastIP, &lastFailedAt, &lockedUntil); err != nil {
+			return nil, err
+		}
+		e.LastFailedAt = time.UnixMilli(lastFailedAt)
+		if lockedUntil > now.UnixMilli() {
+			t := time.UnixMilli(lockedUntil)
+			e.LockedUntil = &t
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Unlock 清除账号或IP的登录失败记录并解除锁定，记录不存在时返回 false
+func Unlock(kind, value string) (bool, error) {
+	result, err := config.DB.Exec("DELETE FROM nlip_login_failures WHERE kind = ? AND value = ?", kind, value)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
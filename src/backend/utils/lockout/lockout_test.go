@@ -0,0 +1,160 @@
+package lockout
+
+import (
+	"fmt"
+	"nlip/config"
+	"nlip/models/lockout"
+	"nlip/utils/testutil"
+	"testing"
+	"time"
+)
+
+// setup 使用较小的次数限制初始化测试环境：账号 3 次、IP 5 次，锁定 60 秒起，最长 300 秒
+func setup(t *testing.T) {
+	t.Helper()
+	t.Setenv("NLIP_LOGIN_LOCKOUT_MAX_ATTEMPTS", "3")
+	t.Setenv("NLIP_LOGIN_LOCKOUT_IP_MAX_ATTEMPTS", "5")
+	t.Setenv("NLIP_LOGIN_LOCKOUT_LOCK_SECONDS", "60")
+	t.Setenv("NLIP_LOGIN_LOCKOUT_MAX_LOCK_SECONDS", "300")
+	testutil.Setup(t)
+}
+
+func recordFailure(t *testing.T, username, ip string) time.Duration {
+	t.Helper()
+	d, err := RecordFailure(username, "", ip)
+	if err != nil {
+		t.Fatalf("记录登录失败出错: %v", err)
+	}
+	return d
+}
+
+func check(t *testing.T, username, ip string) time.Duration {
+	t.Helper()
+	d, err := Check(username, ip)
+	if err != nil {
+		t.Fatalf("查询锁定状态出错: %v", err)
+	}
+	return d
+}
+
+// TestLockDurationBackoff 达到次数后开始锁定，之后每次失败锁定时长翻倍，不超过上限
+func TestLockDurationBackoff(t *testing.T) {
+	setup(t)
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, 60 * time.Second},
+		{4, 120 * time.Second},
+		{5, 240 * time.Second},
+		{6, 300 * time.Second},
+		{20, 300 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := lockDuration(tt.failures, 3); got != tt.want {
+			t.Errorf("失败 %d 次后锁定 %s，期望 %s", tt.failures, got, tt.want)
+		}
+	}
+
+	// RecordFailure 返回的锁定时长同样按次数翻倍
+	var got []time.Duration
+	for i := 0; i < 4; i++ {
+		got = append(got, recordFailure(t, "alice", fmt.Sprintf("192.0.2.%d", i+1)))
+	}
+	want := []time.Duration{0, 0, 60 * time.Second, 120 * time.Second}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("第 %d 次失败后锁定 %s，期望 %s", i+1, got[i], want[i])
+		}
+	}
+	if d := check(t, "alice", "198.51.100.1"); d <= 60*time.Second || d > 120*time.Second {
+		t.Errorf("账号剩余锁定时长为 %s，期望约 120s", d)
+	}
+}
+
+// TestAccountAndIPCountedSeparately 账号和IP分别计数：换IP不能绕过账号锁定，同一IP尝试多个账号达到IP次数后锁定该IP
+func TestAccountAndIPCountedSeparately(t *testing.T) {
+	setup(t)
+
+	// 同一账号从不同IP失败，账号被锁定，这些IP本身未达到次数
+	for i := 1; i <= 3; i++ {
+		recordFailure(t, "alice", fmt.Sprintf("192.0.2.%d", i))
+	}
+	if check(t, "alice", "203.0.113.50") == 0 {
+		t.Error("账号被锁定后，从新的IP登录也应被拒绝")
+	}
+	if d := check(t, "bob", "192.0.2.1"); d != 0 {
+		t.Errorf("其他账号从未达到次数的IP登录不应被锁定，剩余 %s", d)
+	}
+
+	// 同一IP尝试不同账号，每个账号都未达到次数，IP达到次数后被锁定
+	for i := 1; i <= 5; i++ {
+		d := recordFailure(t, fmt.Sprintf("user%d", i), "198.51.100.7")
+		if i < 5 && d != 0 {
+			t.Fatalf("第 %d 次失败后不应锁定，实际锁定 %s", i, d)
+		}
+	}
+	if check(t, "carol", "198.51.100.7") == 0 {
+		t.Error("IP被锁定后，使用其他账号登录也应被拒绝")
+	}
+	if d := check(t, "user1", "198.51.100.8"); d != 0 {
+		t.Errorf("账号未达到次数，从其他IP登录不应被锁定，剩余 %s", d)
+	}
+
+	// 登录成功只清除账号的记录，不清除IP的记录
+	if _, err := RecordSuccess("user1", "", "198.51.100.7"); err != nil {
+		t.Fatalf("记录登录成功出错: %v", err)
+	}
+	if check(t, "user1", "198.51.100.7") == 0 {
+		t.Error("登录成功不应解除IP的锁定")
+	}
+}
+
+// TestLockoutPersistsAcrossRestart 锁定记录保存在数据库中，重启后仍然有效
+func TestLockoutPersistsAcrossRestart(t *testing.T) {
+	setup(t)
+
+	for i := 0; i < 3; i++ {
+		recordFailure(t, "alice", "192.0.2.1")
+	}
+	before := check(t, "alice", "192.0.2.9")
+	if before == 0 {
+		t.Fatal("账号应被锁定")
+	}
+
+	// 重新打开同一个数据库文件，模拟服务重启
+	config.CloseDatabase()
+	if err := config.InitDatabase(); err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+
+	after := check(t, "alice", "192.0.2.9")
+	if after == 0 || after > before {
+		t.Errorf("重启后剩余锁定时长为 %s，期望不超过重启前的 %s 且大于 0", after, before)
+	}
+
+	// 重启后继续计数，下一次失败锁定时长翻倍
+	if d := recordFailure(t, "alice", "192.0.2.1"); d != 120*time.Second {
+		t.Errorf("重启后再次失败锁定 %s，期望 120s", d)
+	}
+
+	entries, err := List()
+	if err != nil {
+		t.Fatalf("获取登录失败记录出错: %v", err)
+	}
+	found := false
+	for _, e := range entries {
+		if e.Kind == lockout.KindAccount && e.Value == "alice" {
+			found = true
+			if e.Failures != 4 || e.LockedUntil == nil {
+				t.Errorf("账号记录为 failures=%d, lockedUntil=%v，期望失败 4 次且锁定中", e.Failures, e.LockedUntil)
+			}
+		}
+	}
+	if !found {
+		t.Error("登录失败记录中缺少账号 alice")
+	}
+}
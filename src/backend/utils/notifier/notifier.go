@@ -0,0 +1,59 @@
+package notifier
+
+import (
+	"sync"
+)
+
+// 进程内的剪贴板通知器，按空间分发新剪贴板的ID
+var (
+	mu          sync.Mutex
+	subscribers = make(map[string]map[chan string]struct{})
+)
+
+// Subscribe 订阅指定空间的新剪贴板通知
+// 返回接收剪贴板ID的通道及取消订阅函数，调用方使用完毕后必须取消订阅
+func Subscribe(spaceID string) (<-chan string, func()) {
+	ch := make(chan string, 1)
+
+	mu.Lock()
+	if subscribers[spaceID] == nil {
+		subscribers[spaceID] = make(map[chan string]struct{})
+	}
+	subscribers[spaceID][ch] = struct{}{}
+	mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			mu.Lock()
+			delete(subscribers[spaceID], ch)
+			if len(subscribers[spaceID]) == 0 {
+				delete(subscribers, spaceID)
+			}
+			mu.Unlock()
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+// Publish 通知订阅者空间中出现了新的剪贴板
+// 订阅者尚未处理上一条通知时丢弃本次通知，不会阻塞发布方
+func Publish(spaceID, clipID string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for ch := range subscribers[spaceID] {
+		select {
+		case ch <- clipID:
+		default:
+		}
+	}
+}
+
+// Count 返回指定空间当前的订阅者数量
+func Count(spaceID string) int {
+	mu.Lock()
+	defer mu.Unlock()
+	return len(subscribers[spaceID])
+}
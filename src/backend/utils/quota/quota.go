@@ -0,0 +1,125 @@
+package quota
+
+import (
+	"database/sql"
+	"fmt"
+	"nlip/config"
+	"nlip/models/quota"
+	"nlip/utils/db"
+)
+
+// 配额范围
+const (
+	ScopeUser  = "user"
+	ScopeSpace = "space"
+)
+
+// ExceededError 写入内容后超出存储配额
+type ExceededError struct {
+	Scope string
+	Used  int64
+	Quota int64
+}
+
+func (e *ExceededError) Error() string {
+	owner := "用户"
+	if e.Scope == ScopeSpace {
+		owner = "空间"
+	}
+	return fmt.Sprintf("%s存储配额不足：配额 %s，写入后将使用 %s", owner, FormatBytes(e.Quota), FormatBytes(e.Used))
+}
+
+// FormatBytes 将字节数格式化为易读的形式
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Check 在同一事务中写入内容后调用，检查空间和用户的用量是否超出配额
+// 用量由数据库触发器维护，写入和检查在同一事务中完成，并发写入不会绕过配额
+func Check(tx *sql.Tx, spaceID, userID string) error {
+	usage, err := load(db.QueryRowTx(tx, selectSpaceUsageSQL, spaceID), config.Get().Quota.SpaceBytes)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("查询空间存储用量失败: %w", err)
+	}
+	if err == nil && exceeded(usage) {
+		return &ExceededError{Scope: ScopeSpace, Used: usage.UsedBytes, Quota: usage.QuotaBytes}
+	}
+
+	// 游客等不在用户表中的创建者只受空间配额限制
+	usage, err = load(db.QueryRowTx(tx, selectUserUsageSQL, userID), config.Get().Quota.UserBytes)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("查询用户存储用量失败: %w", err)
+	}
+	if err == nil && exceeded(usage) {
+		return &ExceededError{Scope: ScopeUser, Used: usage.UsedBytes, Quota: usage.QuotaBytes}
+	}
+	return nil
+}
+
+func exceeded(u *quota.Usage) bool {
+	return u.QuotaBytes > 0 && u.UsedBytes > u.QuotaBytes
+}
+
+const (
+	selectSpaceUsageSQL = "SELECT used_bytes, quota_bytes FROM nlip_spaces WHERE id = ?"
+	selectUserUsageSQL  = "SELECT used_bytes, quota_bytes FROM nlip_users WHERE id = ?"
+)
+
+// load 读取用量，未单独设置配额时使用全局默认配额
+func load(row *sql.Row, defaultQuota int64) (*quota.Usage, error) {
+	var u quota.Usage
+	var custom sql.NullInt64
+	if err := row.Scan(&u.UsedBytes, &custom); err != nil {
+		return nil, err
+	}
+	u.QuotaBytes = defaultQuota
+	if custom.Valid {
+		u.QuotaBytes = custom.Int64
+		u.Custom = true
+	}
+	return &u, nil
+}
+
+// SpaceUsage 获取空间的存储用量
+func SpaceUsage(spaceID string) (*quota.Usage, error) {
+	return load(config.DB.QueryRow(selectSpaceUsageSQL, spaceID), config.Get().Quota.SpaceBytes)
+}
+
+// UserUsage 获取用户的存储用量
+func UserUsage(userID string) (*quota.Usage, error) {
+	return load(config.DB.QueryRow(selectUserUsageSQL, userID), config.Get().Quota.UserBytes)
+}
+
+// SetSpaceQuota 设置空间的配额，quotaBytes 为空时恢复使用全局默认配额
+func SetSpaceQuota(spaceID string, quotaBytes *int64) error {
+	return setQuota("nlip_spaces", spaceID, quotaBytes)
+}
+
+// SetUserQuota 设置用户的配额，quotaBytes 为空时恢复使用全局默认配额
+func SetUserQuota(userID string, quotaBytes *int64) error {
+	return setQuota("nlip_users", userID, quotaBytes)
+}
+
+func setQuota(table, id string, quotaBytes *int64) error {
+	var value interface{}
+	if quotaBytes != nil {
+		value = *quotaBytes
+	}
+	result, err := db.Exec(config.DB, "UPDATE "+table+" SET quota_bytes = ? WHERE id = ?", value, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
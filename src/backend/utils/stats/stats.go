@@ -0,0 +1,262 @@
+package stats
+
+import (
+	"database/sql"
+	"fmt"
+	"nlip/config"
+	"nlip/models/stats"
+	"nlip/utils/db"
+	"time"
+)
+
+const (
+	// DefaultDays 默认统计最近的天数
+	DefaultDays = 7
+	// MaxDays 最多统计最近的天数
+	MaxDays = 90
+	// topLimit 排行榜返回的数量
+	topLimit = 5
+)
+
+// ClampDays 将统计天数限制在 1 到 MaxDays 之间
+func ClampDays(days int) int {
+	if days < 1 {
+		return DefaultDays
+	}
+	if days > MaxDays {
+		return MaxDays
+	}
+	return days
+}
+
+// scope 统计范围，spaceID 为空时统计整个实例
+type scope struct {
+	spaceID string
+}
+
+// where 返回统计范围对应的查询条件，prefix 为 WHERE 或 AND
+func (s scope) where(prefix, column string) (string, []interface{}) {
+	if s.spaceID == "" {
+		return "", nil
+	}
+	return fmt.Sprintf(" %s %s = ?", prefix, column), []interface{}{s.spaceID}
+}
+
+// SpaceActivity 获取空间的内容统计
+func SpaceActivity(spaceID string, days int) (*stats.Activity, error) {
+	return collect(scope{spaceID: spaceID}, days)
+}
+
+// InstanceStats 获取整个实例的统计信息
+func InstanceStats(days int) (*stats.InstanceStats, error) {
+	activity, err := collect(scope{}, days)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &stats.InstanceStats{
+		Activity:    *activity,
+		GeneratedAt: time.Now(),
+	}
+
+	if err := config.DB.QueryRow("SELECT COUNT(*) FROM nlip_users").Scan(&result.UsersCount); err != nil {
+		return nil, fmt.Errorf("统计用户数量失败: %w", err)
+	}
+
+	err = config.DB.QueryRow(`
+		SELECT COUNT(*),
+			COALESCE(SUM(CASE WHEN type = 'public' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN type = 'private' THEN 1 ELSE 0 END), 0)
+		FROM nlip_spaces
+	`).Scan(&result.SpacesCount, &result.PublicSpacesCount, &result.PrivateSpacesCount)
+	if err != nil {
+		return nil, fmt.Errorf("统计空间数量失败: %w", err)
+	}
+
+	rows, err := db.QueryRows(config.DB, `
+		SELECT s.id, s.name, s.type, s.used_bytes,
+			(SELECT COUNT(*) FROM nlip_clipboard_items c WHERE c.space_id = s.id)
+		FROM nlip_spaces s
+		ORDER BY s.used_bytes DESC
+		LIMIT ?
+	`, topLimit)
+	if err != nil {
+		return nil, fmt.Errorf("统计空间用量失败: %w", err)
+	}
+	defer rows.Close()
+
+	result.TopSpaces = []stats.SpaceUsage{}
+	for rows.Next() {
+		var s stats.SpaceUsage
+		if err := rows.Scan(&s.SpaceID, &s.SpaceName, &s.Type, &s.UsedBytes, &s.ClipsCount); err != nil {
+			return nil, err
+		}
+		result.TopSpaces = append(result.TopSpaces, s)
+	}
+	return result, rows.Err()
+}
+
+// collect 统计内容数量、大小、类型分布、每日上传、主要贡献者和最近活动时间
+// 总大小使用触发器维护的空间用量，每日上传使用触发器维护的统计表，其余查询通过索引完成
+func collect(sc scope, days int) (*stats.Activity, error) {
+	var a stats.Activity
+
+	where, args := sc.where("WHERE", "space_id")
+	if err := config.DB.QueryRow("SELECT COUNT(*) FROM nlip_clipboard_items"+where, args...).Scan(&a.ClipsCount); err != nil {
+		return nil, fmt.Errorf("统计内容数量失败: %w", err)
+	}
+
+	where, args = sc.where("WHERE", "id")
+	if err := config.DB.QueryRow("SELECT COALESCE(SUM(used_bytes), 0) FROM nlip_spaces"+where, args...).Scan(&a.TotalBytes); err != nil {
+		return nil, fmt.Errorf("统计内容大小失败: %w", err)
+	}
+
+	var err error
+	if a.ContentTypes, err = contentTypes(sc); err != nil {
+		return nil, fmt.Errorf("统计内容类型失败: %w", err)
+	}
+	if a.UploadsPerDay, err = uploadsPerDay(sc, days); err != nil {
+		return nil, fmt.Errorf("统计每日上传失败: %w", err)
+	}
+	if a.TopContributors, err = topContributors(sc); err != nil {
+		return nil, fmt.Errorf("统计贡献者失败: %w", err)
+	}
+	if a.LastActivityAt, err = lastActivity(sc); err != nil {
+		return nil, fmt.Errorf("查询最近活动时间失败: %w", err)
+	}
+	return &a, nil
+}
+
+func contentTypes(sc scope) ([]stats.ContentTypeStat, error) {
+	where, args := sc.where("WHERE", "space_id")
+	rows, err := db.QueryRows(config.DB, `
+		SELECT content_type, COUNT(*), COALESCE(SUM(size_bytes), 0)
+		FROM nlip_clipboard_items`+where+`
+		GROUP BY content_type
+		ORDER BY COUNT(*) DESC, content_type ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []stats.ContentTypeStat{}
+	for rows.Next() {
+		var t stats.ContentTypeStat
+		if err := rows.Scan(&t.ContentType, &t.Count, &t.Bytes); err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// uploadsPerDay 统计最近 days 天每天的上传，没有上传的日期返回 0
+func uploadsPerDay(sc scope, days int) ([]stats.DailyUploads, error) {
+	now := time.Now()
+	first := now.AddDate(0, 0, -(days - 1)).Format("2006-01-02")
+
+	where, args := sc.where("AND", "space_id")
+	rows, err := db.QueryRows(config.DB, `
+		SELECT day, SUM(uploads), SUM(bytes)
+		FROM nlip_daily_uploads
+		WHERE day >= ?`+where+`
+		GROUP BY day
+	`, append([]interface{}{first}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byDay := make(map[string]stats.DailyUploads)
+	for rows.Next() {
+		var d stats.DailyUploads
+		if err := rows.Scan(&d.Date, &d.Count, &d.Bytes); err != nil {
+			return nil, err
+		}
+		byDay[d.Date] = d
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	list := make([]stats.DailyUploads, 0, days)
+	for i := days - 1; i >= 0; i-- {
+		day := now.AddDate(0, 0, -i).Format("2006-01-02")
+		d, ok := byDay[day]
+		if !ok {
+			d = stats.DailyUploads{Date: day}
+		}
+		list = append(list, d)
+	}
+	return list, nil
+}
+
+func topContributors(sc scope) ([]stats.Contributor, error) {
+	where, args := sc.where("WHERE", "c.space_id")
+	rows, err := db.QueryRows(config.DB, `
+		SELECT c.creator_id,
+			CASE WHEN c.creator_id = 'guest' THEN '游客' ELSE COALESCE(u.username, '') END,
+			COUNT(*), COALESCE(SUM(c.size_bytes), 0)
+		FROM nlip_clipboard_items c
+		LEFT JOIN nlip_users u ON c.creator_id = u.id`+where+`
+		GROUP BY c.creator_id
+		ORDER BY COUNT(*) DESC, SUM(c.size_bytes) DESC
+		LIMIT ?
+	`, append(args, topLimit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []stats.Contributor{}
+	for rows.Next() {
+		var c stats.Contributor
+		var userID sql.NullString
+		if err := rows.Scan(&userID, &c.Username, &c.Count, &c.Bytes); err != nil {
+			return nil, err
+		}
+		c.UserID = userID.String
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+// lastActivity 获取最近一次上传或修改内容的时间，没有内容时返回 nil
+func lastActivity(sc scope) (*time.Time, error) {
+	where, args := sc.where("WHERE", "space_id")
+	var t time.Time
+	err := config.DB.QueryRow(`
+		SELECT updated_at FROM nlip_clipboard_items`+where+`
+		ORDER BY updated_at DESC
+		LIMIT 1
+	`, args...).Scan(&t)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// NextEviction 获取空间中最早的内容超过保留天数的时间，没有内容时返回 nil
+func NextEviction(spaceID string) (*time.Time, error) {
+	var oldest time.Time
+	var retentionDays int
+	err := config.DB.QueryRow(`
+		SELECT c.created_at, s.retention_days
+		FROM nlip_clipboard_items c
+		JOIN nlip_spaces s ON s.id = c.space_id
+		WHERE c.space_id = ?
+		ORDER BY c.created_at ASC
+		LIMIT 1
+	`, spaceID).Scan(&oldest, &retentionDays)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	t := oldest.AddDate(0, 0, retentionDays)
+	return &t, nil
+}
@@ -12,13 +12,13 @@ import (
 // SaveFile 保存文件到本地存储
 func SaveFile(data []byte, fileName string) (string, error) {
 	// 确保上传目录存在
-	if err := os.MkdirAll(config.AppConfig.UploadDir, 0755); err != nil {
+	if err := os.MkdirAll(config.Get().UploadDir, 0755); err != nil {
 		logger.Error("创建上传目录失败: %v", err)
 		return "", fmt.Errorf("创建上传目录失败: %w", err)
 	}
 
 	// 生成文件路径
-	filePath := filepath.Join(config.AppConfig.UploadDir, fileName)
+	filePath := filepath.Join(config.Get().UploadDir, fileName)
 	logger.Debug("准备保存文件: %s", filePath)
 
 	// 创建文件
@@ -56,10 +56,20 @@ func DeleteFile(filePath string) error {
 		return fmt.Errorf("删除文件失败: %w", err)
 	}
 
+	// 同时删除文件的缩略图
+	if err := os.Remove(ThumbnailPath(filePath)); err != nil && !os.IsNotExist(err) {
+		logger.Warning("删除缩略图失败: %v", err)
+	}
+
 	logger.Info("文件删除成功: %s", filePath)
 	return nil
 }
 
+// ThumbnailPath 获取文件对应的缩略图路径
+func ThumbnailPath(filePath string) string {
+	return filePath + ".thumb.jpg"
+}
+
 // GetFile 从本地存储读取文件
 func GetFile(filePath string) ([]byte, error) {
 	logger.Debug("准备读取文件: %s", filePath)
@@ -119,13 +129,13 @@ func CleanupFiles(dir string) error {
 
 // EnsureUploadDir 确保上传目录存在
 func EnsureUploadDir() error {
-	logger.Debug("检查上传目录: %s", config.AppConfig.UploadDir)
+	logger.Debug("检查上传目录: %s", config.Get().UploadDir)
 
-	if err := os.MkdirAll(config.AppConfig.UploadDir, 0755); err != nil {
+	if err := os.MkdirAll(config.Get().UploadDir, 0755); err != nil {
 		logger.Error("创建上传目录失败: %v", err)
 		return fmt.Errorf("创建上传目录失败: %w", err)
 	}
 
-	logger.Info("上传目录就绪: %s", config.AppConfig.UploadDir)
+	logger.Info("上传目录就绪: %s", config.Get().UploadDir)
 	return nil
 } 
\ No newline at end of file
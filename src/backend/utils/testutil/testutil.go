@@ -0,0 +1,88 @@
+// Package testutil 为各模块的测试准备独立的配置和数据库，只应在测试中使用
+package testutil
+
+import (
+	"encoding/json"
+	"nlip/config"
+	"nlip/models/user"
+	"nlip/utils/jwt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// Setup 在临时目录中加载测试环境配置并初始化数据库，测试结束后关闭数据库并恢复工作目录
+// 会修改工作目录和环境变量，调用 Setup 的测试不能并行执行
+func Setup(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("NLIP_APP_ENV", "test")
+	t.Setenv("NLIP_JWT_SECRET", "nlip-test-secret-0123456789abcdef")
+	t.Setenv("NLIP_UPLOAD_DIR", filepath.Join(dir, "uploads"))
+	// 各测试在短时间内发出大量请求，不受访问频率限制影响
+	t.Setenv("NLIP_RATE_LIMIT_ENABLED", "false")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("获取工作目录失败: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("切换工作目录失败: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	config.LoadConfig()
+	if err := config.ValidateConfig(); err != nil {
+		t.Fatalf("测试配置无效: %v", err)
+	}
+	if err := config.InitDatabase(); err != nil {
+		t.Fatalf("初始化测试数据库失败: %v", err)
+	}
+	t.Cleanup(config.CloseDatabase)
+}
+
+// CreateUser 创建测试用户，返回用户ID
+func CreateUser(t *testing.T, username string, isAdmin bool) string {
+	t.Helper()
+
+	id := uuid.New().String()
+	_, err := config.DB.Exec(`
+		INSERT INTO nlip_users (id, username, password_hash, is_admin) VALUES (?, ?, ?, ?)
+	`, id, username, "-", isAdmin)
+	if err != nil {
+		t.Fatalf("创建测试用户失败: %v", err)
+	}
+	return id
+}
+
+// Token 为测试用户签发登录令牌，返回 Authorization 请求头的值
+func Token(t *testing.T, userID, username string, isAdmin bool) string {
+	t.Helper()
+
+	token, err := jwt.GenerateToken(&user.User{ID: userID, Username: username, IsAdmin: isAdmin})
+	if err != nil {
+		t.Fatalf("签发测试令牌失败: %v", err)
+	}
+	return "Bearer " + token
+}
+
+// CreateSpace 创建测试空间，collaborators 为协作者ID到权限（view 或 edit）的映射，返回空间ID
+func CreateSpace(t *testing.T, name, spaceType, ownerID string, collaborators map[string]string) string {
+	t.Helper()
+
+	data, err := json.Marshal(collaborators)
+	if err != nil {
+		t.Fatalf("序列化协作者失败: %v", err)
+	}
+	id := uuid.New().String()
+	_, err = config.DB.Exec(`
+		INSERT INTO nlip_spaces (id, name, type, owner_id, collaborators) VALUES (?, ?, ?, ?, ?)
+	`, id, name, spaceType, ownerID, string(data))
+	if err != nil {
+		t.Fatalf("创建测试空间失败: %v", err)
+	}
+	return id
+}
@@ -88,7 +88,7 @@ func IsAllowedExtension(filename string) bool {
 	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
 	
 	// 首先检查黑名单
-	for _, denied := range config.AppConfig.FileTypes.DenyList {
+	for _, denied := range config.Get().FileTypes.DenyList {
 		if ext == denied {
 			logger.Warning("文件扩展名在黑名单中: %s", ext)
 			return false
@@ -96,7 +96,7 @@ func IsAllowedExtension(filename string) bool {
 	}
 	
 	// 然后检查白名单
-	for _, allowed := range config.AppConfig.FileTypes.AllowList {
+	for _, allowed := range config.Get().FileTypes.AllowList {
 		if ext == allowed {
 			return true
 		}
@@ -0,0 +1,350 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/url"
+	"nlip/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timeout 注册和登录的有效期，超时后需要重新获取参数
+const Timeout = 5 * time.Minute
+
+// 仪式类型，注册和登录的挑战不能混用
+const (
+	KindRegistration = "registration"
+	KindLogin        = "login"
+)
+
+// 支持的 COSE 签名算法
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// Algorithms 注册时按优先顺序提供给浏览器的签名算法
+var Algorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+// 认证器数据中的标志位
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+var (
+	// ErrInvalidChallenge 挑战不存在、已使用或已过期
+	ErrInvalidChallenge = errors.New("验证已过期，请重试")
+	// ErrInvalidCredential 凭据数据或签名无效
+	ErrInvalidCredential = errors.New("通行密钥验证失败")
+)
+
+// ceremony 等待浏览器返回结果的注册或登录，userID 为空表示登录时未指定用户
+type ceremony struct {
+	kind    string
+	userID  string
+	expires time.Time
+}
+
+var (
+	ceremoniesMu sync.Mutex
+	ceremonies   = make(map[string]ceremony)
+)
+
+// NewChallenge 生成一次性挑战，返回 base64url 编码
+func NewChallenge(kind, userID string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(b)
+
+	now := time.Now()
+	ceremoniesMu.Lock()
+	defer ceremoniesMu.Unlock()
+	for key, c := range ceremonies {
+		if now.After(c.expires) {
+			delete(ceremonies, key)
+		}
+	}
+	ceremonies[challenge] = ceremony{kind: kind, userID: userID, expires: now.Add(Timeout)}
+	return challenge, nil
+}
+
+// takeChallenge 取出并删除挑战，每个挑战只能使用一次
+func takeChallenge(challenge, kind string) (ceremony, bool) {
+	ceremoniesMu.Lock()
+	defer ceremoniesMu.Unlock()
+	c, ok := ceremonies[challenge]
+	if !ok {
+		return ceremony{}, false
+	}
+	delete(ceremonies, challenge)
+	if c.kind != kind || time.Now().After(c.expires) {
+		return ceremony{}, false
+	}
+	return c, true
+}
+
+// RPID 依赖方ID，为 domain 配置中的主机名
+func RPID() string {
+	u, err := url.Parse(config.Get().Domain)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// allowedOrigin 判断浏览器报告的来源是否为服务器或前端的地址
+func allowedOrigin(origin string) bool {
+	cfg := config.Get()
+	for _, raw := range []string{cfg.Domain, cfg.FrontendURL} {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		if origin == u.Scheme+"://"+u.Host {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeBase64URL 解码浏览器提交的 base64url 数据，兼容带填充的写法
+func DecodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// EncodeBase64URL 编码返回给浏览器的二进制数据
+func EncodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// checkClientData 校验客户端数据的类型、来源和挑战，返回对应的仪式
+func checkClientData(clientDataJSON []byte, kind, clientType string) (ceremony, error) {
+	var clientData struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return ceremony{}, ErrInvalidCredential
+	}
+	if clientData.Type != clientType || !allowedOrigin(clientData.Origin) {
+		return ceremony{}, ErrInvalidCredential
+	}
+	c, ok := takeChallenge(strings.TrimRight(clientData.Challenge, "="), kind)
+	if !ok {
+		return ceremony{}, ErrInvalidChallenge
+	}
+	return c, nil
+}
+
+// authenticatorData 认证器数据，注册时包含新凭据的ID和公钥
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, ErrInvalidCredential
+	}
+	rpIDHash := sha256.Sum256([]byte(RPID()))
+	if !bytes.Equal(data[:32], rpIDHash[:]) {
+		return nil, ErrInvalidCredential
+	}
+	ad := &authenticatorData{
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return nil, ErrInvalidCredential
+	}
+	if ad.flags&flagAttested == 0 {
+		return ad, nil
+	}
+
+	// aaguid(16) + 凭据ID长度(2) + 凭据ID + COSE 公钥，之后可能还有扩展数据
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, ErrInvalidCredential
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+		return nil, ErrInvalidCredential
+	}
+	ad.credentialID = rest[:idLen]
+	rest = rest[idLen:]
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	ad.publicKey = rest[:len(rest)-len(after)]
+	return ad, nil
+}
+
+// Registration 验证通过的新凭据
+type Registration struct {
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    uint32
+}
+
+// VerifyRegistration 验证 navigator.credentials.create() 的结果
+// 注册时请求 none 证明，不校验认证器的厂商证明，只校验挑战、来源、依赖方和公钥
+func VerifyRegistration(userID string, clientDataJSON, attestationObject []byte) (*Registration, error) {
+	c, err := checkClientData(clientDataJSON, KindRegistration, "webauthn.create")
+	if err != nil {
+		return nil, err
+	}
+	if c.userID != userID {
+		return nil, ErrInvalidChallenge
+	}
+
+	obj, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	m, ok := obj.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrInvalidCredential
+	}
+	authData, ok := m["authData"].([]byte)
+	if !ok {
+		return nil, ErrInvalidCredential
+	}
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if ad.credentialID == nil {
+		return nil, ErrInvalidCredential
+	}
+	if _, err := parsePublicKey(ad.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Registration{
+		CredentialID: ad.credentialID,
+		PublicKey:    ad.publicKey,
+		SignCount:    ad.signCount,
+	}, nil
+}
+
+// VerifyAssertion 验证 navigator.credentials.get() 的结果，返回登录时指定的用户ID（可能为空）和新的签名计数
+// 登录要求认证器完成用户验证（指纹、面容或 PIN），通行密钥登录不再需要两步验证码
+func VerifyAssertion(clientDataJSON, authData, signature, coseKey []byte, storedCount uint32) (string, uint32, error) {
+	c, err := checkClientData(clientDataJSON, KindLogin, "webauthn.get")
+	if err != nil {
+		return "", 0, err
+	}
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return "", 0, err
+	}
+	if ad.flags&flagUserVerified == 0 {
+		return "", 0, ErrInvalidCredential
+	}
+
+	key, err := parsePublicKey(coseKey)
+	if err != nil {
+		return "", 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authData...), clientDataHash[:]...)
+	if !key.verify(signed, signature) {
+		return "", 0, ErrInvalidCredential
+	}
+
+	// 签名计数没有增加说明凭据可能被复制，不支持计数的认证器始终为 0
+	if (ad.signCount != 0 || storedCount != 0) && ad.signCount <= storedCount {
+		return "", 0, ErrInvalidCredential
+	}
+	return c.userID, ad.signCount, nil
+}
+
+// publicKey COSE 格式的公钥
+type publicKey struct {
+	key crypto.PublicKey
+}
+
+func (k publicKey) verify(data, sig []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		hash := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, hash[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, sig)
+	case *rsa.PublicKey:
+		hash := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig) == nil
+	}
+	return false
+}
+
+// parsePublicKey 解析 COSE_Key（RFC 9053），支持 ES256、EdDSA 和 RS256
+func parsePublicKey(data []byte) (*publicKey, error) {
+	obj, _, err := decodeCBOR(data)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	m, ok := obj.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrInvalidCredential
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == AlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, ErrInvalidCredential
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, ErrInvalidCredential
+		}
+		return &publicKey{key: key}, nil
+	case kty == 1 && alg == AlgEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, ErrInvalidCredential
+		}
+		return &publicKey{key: ed25519.PublicKey(x)}, nil
+	case kty == 3 && alg == AlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, ErrInvalidCredential
+		}
+		exp := 0
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+		return &publicKey{key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}}, nil
+	}
+	return nil, ErrInvalidCredential
+}